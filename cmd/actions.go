@@ -0,0 +1,142 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+	"github.com/schnauzersoft/ami-util/internal/github"
+	"github.com/schnauzersoft/ami-util/internal/mapping"
+)
+
+// reportToActions reports a run to the GitHub Actions workflow running it:
+// step outputs for wiring later steps, a warning annotation on every AMI
+// reference that no lookup found, and a job summary of the replacements.
+// Failing to do so does not fail the run.
+func reportToActions(res *resolution, results []fileprocessor.FileResult) {
+	if !github.InActions() {
+		return
+	}
+
+	err := github.SetOutputs(actionsOutputs(res, results))
+	if err != nil {
+		slog.Warn("Failed to set GitHub Actions outputs", "error", err)
+	}
+
+	unresolved := unresolvedReferences(res)
+
+	for _, reference := range unresolved {
+		err = github.WriteAnnotation(displayOutput(), github.Annotation{
+			Level:  "warning",
+			File:   github.WorkspacePath(reference.File),
+			Line:   reference.Line,
+			Column: reference.Column,
+			Title:  "Unresolved AMI",
+			Message: fmt.Sprintf("%s was not found in any account and region searched, so it cannot be kept up to date",
+				reference.AMI),
+		})
+		if err != nil {
+			slog.Warn("Failed to annotate unresolved AMI", "file", reference.File, "ami", reference.AMI, "error", err)
+		}
+	}
+
+	err = github.AppendStepSummary(stepSummary(res, results, unresolved))
+	if err != nil {
+		slog.Warn("Failed to write GitHub Actions job summary", "error", err)
+	}
+}
+
+// actionsOutputs returns the step outputs of a run: whether it changed files
+// (or would have, with --diff-only), which, how many AMI IDs were replaced,
+// and the resolved mapping, as accepted by apply.
+func actionsOutputs(res *resolution, results []fileprocessor.FileResult) []github.Output {
+	files := changedFiles(results)
+	if files == nil {
+		files = []string{}
+	}
+
+	replacements := 0
+	for _, result := range results {
+		replacements += result.Count
+	}
+
+	changed, _ := json.Marshal(files)
+	resolved, _ := json.Marshal(mapping.New(res.replacements))
+
+	return []github.Output{
+		{Name: "changes", Value: strconv.FormatBool(len(files) > 0)},
+		{Name: "changed-files", Value: string(changed)},
+		{Name: "replacements", Value: strconv.Itoa(replacements)},
+		{Name: "mapping", Value: string(resolved)},
+	}
+}
+
+// unresolvedReferences returns the AMI references left in the files whose
+// AMIs no lookup found, which are neither current nor replaceable. Without
+// lookups, as for apply, there are none.
+func unresolvedReferences(res *resolution) []fileprocessor.FileReference {
+	if res.awsClient == nil {
+		return nil
+	}
+
+	references, err := res.fileProcessor.ScanPath(res.paths...)
+	if err != nil {
+		slog.Warn("Failed to scan for unresolved AMIs", "error", err)
+
+		return nil
+	}
+
+	var unresolved []fileprocessor.FileReference
+
+	for _, reference := range references {
+		if !res.awsClient.Found(reference.AMI) {
+			unresolved = append(unresolved, reference)
+		}
+	}
+
+	return unresolved
+}
+
+// stepSummary describes the replacements made to files, the lookups that
+// failed, and the AMI references left unresolved, in Markdown.
+func stepSummary(res *resolution, results []fileprocessor.FileResult, unresolved []fileprocessor.FileReference,
+) string {
+	var builder strings.Builder
+
+	builder.WriteString("### ami-util\n\n")
+
+	if len(changedFiles(results)) == 0 {
+		builder.WriteString("No AMI IDs needed replacing.\n")
+	} else {
+		if diffOnly {
+			builder.WriteString("Diff only, no files were written.\n\n")
+		}
+
+		builder.WriteString(pullRequestBody(results))
+	}
+
+	if len(res.lookupErrors) > 0 {
+		fmt.Fprintf(&builder, "\n%d account/region lookups failed, so their AMIs may be reported as unresolved.\n",
+			len(res.lookupErrors))
+	}
+
+	if len(unresolved) > 0 {
+		fmt.Fprintf(&builder, "\n%d AMI references could not be resolved:\n\n", len(unresolved))
+		builder.WriteString("| AMI | File | Line |\n")
+		builder.WriteString("|---|---|---|\n")
+
+		for _, reference := range unresolved {
+			fmt.Fprintf(&builder, "| `%s` | `%s` | %d |\n", reference.AMI, github.WorkspacePath(reference.File),
+				reference.Line)
+		}
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,136 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/config"
+	"github.com/schnauzersoft/ami-util/internal/exitcode"
+	"github.com/schnauzersoft/ami-util/internal/mapping"
+	"github.com/schnauzersoft/ami-util/internal/results"
+
+	"github.com/spf13/cobra"
+)
+
+var ErrNoMappingFile = errors.New("mapping file is required")
+
+var applyMapping string
+
+// applyCmd represents the apply command.
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Apply a pre-computed AMI mapping without AWS access",
+	Long: `Apply the replacements from a mapping file to a file or directory without
+making any AWS calls.
+
+The mapping file is the JSON document written by --export-mapping, which makes
+it possible to resolve AMIs on a connected machine and apply the approved
+mapping on an air-gapped one. Pins from the configuration are still honored.
+
+Examples:
+  ami-util --file ./infra --export-mapping mapping.json   # on a connected machine
+  ami-util apply --mapping mapping.json --file ./infra     # on the build machine`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		summary := results.New(time.Now())
+
+		err := runApply(cmd.Context(), summary)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+
+		summary.ExitCode = exitcode.For(err, summary.Changed(), summary.Failures())
+		summary.Finish(time.Now(), err)
+
+		writeMetrics(cmd.Context(), summary)
+		writeJUnit(summary)
+		writeMarkdownSummary(summary)
+		writeCSVReport(summary)
+
+		if summary.ExitCode != exitcode.UpToDate {
+			exit(summary.ExitCode)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+
+	applyCmd.Flags().StringVar(&applyMapping, "mapping", "", "Path to the mapping file written by --export-mapping")
+}
+
+// runApply applies the mapping to the target files, recording the outcomes
+// in summary.
+func runApply(ctx context.Context, summary *results.Summary) error {
+	if applyMapping == "" {
+		return exitcode.Config(ErrNoMappingFile)
+	}
+
+	var err error
+
+	cfg, err = config.LoadConfig(ctx)
+	if err != nil {
+		return exitcode.Config(fmt.Errorf("failed to load configuration: %w", err))
+	}
+
+	paths, err := targetPaths()
+	if err != nil {
+		return exitcode.Config(err)
+	}
+
+	summary.Paths = paths
+
+	loaded, err := mapping.Load(applyMapping)
+	if err != nil {
+		return fmt.Errorf("failed to load mapping: %w", err)
+	}
+
+	res := &resolution{
+		fileProcessor: newFileProcessor(),
+		paths:         paths,
+		accounts:      cfg.Accounts,
+		replacements:  filterPinned(loaded.AMIReplacements()),
+	}
+
+	err = checkConflicts(res, nil)
+	if err != nil {
+		return err
+	}
+
+	summary.AddResolutions(res.replacements)
+
+	if len(res.replacements) == 0 {
+		slog.Info("No AMI replacements found")
+		reportToActions(res, nil)
+
+		return nil
+	}
+
+	fileResults, err := processFiles(ctx, res.fileProcessor, res.paths, res.replacements)
+
+	recordRun(res, fileResults)
+	summary.AddFiles(fileResults)
+	reportToActions(res, fileResults)
+
+	err = errors.Join(err, auditChanges(ctx, res, fileResults), strictError(nil))
+	if err != nil {
+		return err
+	}
+
+	err = handleGit(ctx, res, fileResults)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Successfully processed files", "paths", res.paths)
+
+	return nil
+}
@@ -0,0 +1,56 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/audit"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+)
+
+// auditChanges appends every replacement written to files to the audit log,
+// when one is configured. Nothing is written with --diff-only, and the run
+// fails when its changes cannot be audited.
+func auditChanges(ctx context.Context, res *resolution, results []fileprocessor.FileResult) error {
+	if cfg.AuditLog == "" || diffOnly || len(changedFiles(results)) == 0 {
+		return nil
+	}
+
+	host, _ := os.Hostname()
+
+	actor := audit.Actor{User: currentUser(), Host: host}
+
+	// Mappings are applied without AWS access
+	if res.awsClient != nil {
+		actor.Role = res.awsClient.RoleARN
+
+		region := ""
+		if len(res.regions) > 0 {
+			region = res.regions[0]
+		}
+
+		identity, err := res.awsClient.Identity(ctx, region)
+		if err != nil {
+			slog.Warn("Failed to get the AWS identity for the audit log", "error", err)
+		}
+
+		actor.Identity = identity
+	}
+
+	entries := audit.NewEntries(time.Now(), actor, results)
+
+	err := audit.Append(cfg.AuditLog, entries)
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("Audit log written", "path", cfg.AuditLog, "entries", len(entries))
+
+	return nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/config"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+	"github.com/schnauzersoft/ami-util/internal/logging"
+)
+
+// handleCDKContext re-runs the machine image lookups cached in cdk.context.json
+// files and, for each lookup whose cached AMI is no longer the newest match,
+// either refreshes the cached AMI or deletes the entry so that the CDK looks
+// it up again on the next synth.
+func handleCDKContext(ctx context.Context, res *resolution) error {
+	if cfg.CDKContext == "" {
+		return nil
+	}
+
+	lookups, err := res.fileProcessor.FindCDKContextLookups(res.paths...)
+	if err != nil {
+		return fmt.Errorf("failed to find CDK context lookups: %w", err)
+	}
+
+	var updates []fileprocessor.CDKContextUpdate
+
+	for _, lookup := range lookups {
+		latest, err := res.awsClient.ResolveImageLookup(ctx, lookup.ImageLookup)
+		if err != nil {
+			slog.Warn("Failed to resolve cached AMI lookup", "file", lookup.File, "ami", lookup.AMI,
+				"region", lookup.Region, "error", err)
+
+			continue
+		}
+
+		if latest.ImageID == lookup.AMI {
+			logging.Trace("Cached AMI lookup is current", "file", lookup.File, "ami", lookup.AMI, "region", lookup.Region)
+
+			continue
+		}
+
+		update := fileprocessor.CDKContextUpdate{
+			File: lookup.File,
+			Key:  lookup.Key,
+			Replacement: aws.AMIReplacement{
+				OldAMI:  lookup.AMI,
+				NewAMI:  latest.ImageID,
+				Name:    latest.Name,
+				Account: lookup.Account,
+				Region:  lookup.Region,
+				Created: latest.CreationDate,
+			},
+		}
+
+		if cfg.CDKContext == config.CDKContextDelete {
+			update.Delete = true
+
+			slog.Info("Deleting stale cached AMI lookup; the CDK resolves the new AMI on the next synth",
+				"file", lookup.File, "ami", lookup.AMI, "region", lookup.Region, "new_ami", latest.ImageID,
+				"name", latest.Name)
+		} else {
+			slog.Info("Refreshing cached AMI lookup", "file", lookup.File, "region", lookup.Region,
+				"ami", lookup.AMI, "new_ami", latest.ImageID, "name", latest.Name)
+		}
+
+		updates = append(updates, update)
+	}
+
+	rewritten, err := res.fileProcessor.RewriteCDKContext(ctx, updates)
+	res.rewritten = append(res.rewritten, rewritten...)
+
+	if err != nil {
+		return fmt.Errorf("failed to rewrite CDK context: %w", err)
+	}
+
+	return nil
+}
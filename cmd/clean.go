@@ -0,0 +1,111 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/config"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+	"github.com/schnauzersoft/ami-util/internal/logging"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cleanDryRun    bool
+	cleanOlderThan time.Duration
+)
+
+// cleanCmd represents the clean command.
+var cleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove backup files left by previous runs",
+	Long: `Find and remove the *.backup and timestamped *.backup.<time> files that ami-util
+creates next to updated files, or under --backup-dir when it is set.
+
+Use --dry-run to list the backups that would be removed, and --older-than to
+only remove backups that have not been modified within the given duration.
+
+Examples:
+  ami-util clean --file ./infra --dry-run
+  ami-util clean --file ./infra --older-than 168h`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		err := runClean(cmd.Context())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cleanCmd)
+
+	cleanCmd.Flags().BoolVar(&cleanDryRun, "dry-run", false, "List backup files without removing them")
+	cleanCmd.Flags().DurationVar(&cleanOlderThan, "older-than", 0, "Only remove backups older than this duration")
+}
+
+func runClean(ctx context.Context) error {
+	var err error
+
+	cfg, err = config.LoadConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	paths := []string{cfg.BackupDir}
+	if cfg.BackupDir == "" {
+		paths, err = targetPaths()
+		if err != nil {
+			return err
+		}
+	}
+
+	var backups []string
+
+	for _, path := range paths {
+		found, err := fileprocessor.NewProcessor().FindBackups(path, cleanOlderThan)
+		if err != nil {
+			return fmt.Errorf("failed to find backup files: %w", err)
+		}
+
+		backups = append(backups, found...)
+	}
+
+	removed := 0
+
+	for _, backup := range backups {
+		if cleanDryRun {
+			slog.Info("Would remove backup", "path", backup)
+
+			continue
+		}
+
+		err := os.Remove(backup)
+		if err != nil {
+			slog.Warn("Failed to remove backup", "path", backup, "error", err)
+
+			continue
+		}
+
+		removed++
+
+		logging.Trace("Removed backup", "path", backup)
+	}
+
+	if cleanDryRun {
+		slog.Info("Found backup files", "count", len(backups))
+	} else {
+		slog.Info("Removed backup files", "count", removed)
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	parityOK      = "ok"
+	parityLag     = "LAG"
+	parityMissing = "MISSING"
+	parityError   = "ERROR"
+)
+
+var ErrRegionsOutOfSync = errors.New("latest AMIs differ between regions")
+
+// compareRegionsCmd represents the compare-regions command.
+var compareRegionsCmd = &cobra.Command{
+	Use:   "compare-regions",
+	Short: "Compare the latest AMI for each pattern across regions",
+	Long: `Compare the latest AMI for each configured pattern across regions.
+
+For every account and name pattern, the newest image in each region is listed.
+A region whose newest image has a different name than the newest image of all
+regions is flagged as LAG, and a region with no matching image as MISSING.
+Images are ranked as in a run that updates files: by the version of the
+pattern's filter, if any, and else by creation date. ssm:, exec:, and
+marketplace: patterns and AMI IDs are skipped. The command exits non-zero when
+any region is out of sync.
+
+Examples:
+  ami-util compare-regions --account-ids 137112412989 --patterns "al2023-ami-*" --regions us-east-1,eu-west-1`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		err := runCompareRegions(cmd.Context())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+type regionLatest struct {
+	region string
+	ami    *aws.AMIInfo
+	err    error
+}
+
+func init() {
+	rootCmd.AddCommand(compareRegionsCmd)
+}
+
+func runCompareRegions(ctx context.Context) error {
+	var err error
+
+	cfg, err = config.LoadConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if !cfg.HasAccounts() {
+		return config.ErrNoAccountID
+	}
+
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	regions := targetRegions(awsClient)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, tableColumnPadding, ' ', 0)
+
+	fmt.Fprintln(writer, "ACCOUNT\tPATTERN\tREGION\tAMI\tNAME\tCREATED\tSTATUS")
+
+	inSync := true
+
+	for _, accountID := range cfg.Accounts {
+		for _, pattern := range namePatterns(cfg.Patterns) {
+			results := make([]regionLatest, 0, len(regions))
+			for _, region := range regionsFor(accountID, regions) {
+				ami, err := awsClient.FindLatestAMI(ctx, accountID, region, pattern)
+				results = append(results, regionLatest{region: region, ami: ami, err: err})
+			}
+
+			if !printRegionParity(writer, awsClient, accountID, pattern, results) {
+				inSync = false
+			}
+		}
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write comparison: %w", err)
+	}
+
+	if !inSync {
+		return ErrRegionsOutOfSync
+	}
+
+	return nil
+}
+
+// namePatterns returns the patterns matching AMI names, leaving out source
+// patterns and AMI IDs, whose images are not compared by name.
+func namePatterns(patterns []string) []string {
+	sources := sourcePatterns(patterns)
+
+	var filtered []string
+
+	for _, pattern := range patterns {
+		if !slices.Contains(sources, pattern) && !strings.HasPrefix(pattern, "ami-") {
+			filtered = append(filtered, pattern)
+		}
+	}
+
+	return filtered
+}
+
+// printRegionParity prints the latest AMI of pattern in each region, flagging
+// the regions whose latest AMI is not named as the newest of all regions.
+func printRegionParity(writer *tabwriter.Writer, awsClient *aws.Client, accountID, pattern string,
+	results []regionLatest,
+) bool {
+	var found []aws.AMIInfo
+
+	for _, result := range results {
+		if result.ami != nil {
+			found = append(found, *result.ami)
+		}
+	}
+
+	var newest aws.AMIInfo
+	if len(found) > 0 {
+		newest = awsClient.NewestAMI(pattern, found)
+	}
+
+	inSync := true
+
+	for _, result := range results {
+		switch {
+		case errors.Is(result.err, aws.ErrAMINotFound):
+			inSync = false
+
+			fmt.Fprintf(writer, "%s\t%s\t%s\t-\t-\t-\t%s\n", accountID, pattern, result.region, parityMissing)
+		case result.err != nil:
+			inSync = false
+
+			fmt.Fprintf(writer, "%s\t%s\t%s\t-\t-\t-\t%s: %v\n", accountID, pattern, result.region, parityError, result.err)
+		default:
+			status := parityOK
+			if result.ami.Name != newest.Name {
+				inSync = false
+				status = parityLag
+			}
+
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", accountID, pattern, result.region, result.ami.ImageID,
+				result.ami.Name, result.ami.CreationDate.Format(time.RFC3339), status)
+		}
+	}
+
+	return inSync
+}
@@ -0,0 +1,74 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+func completeProfiles(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	profiles, err := aws.ListProfiles()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	return profiles, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeRegions(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var err error
+
+	cfg, err = config.LoadConfig(cmd.Context())
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	awsClient, err := aws.NewClient(cmd.Context(), cfg.Profile, cfg.RoleARN, awsClientOptions()...)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	regions, err := awsClient.ListRegions(cmd.Context())
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	return completeCommaSeparated(regions, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeAccountIDs(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	loaded, err := config.LoadConfig(cmd.Context())
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	return completeCommaSeparated(loaded.Accounts, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeCommaSeparated completes the last element of a comma-separated flag
+// value, skipping values that have already been given.
+func completeCommaSeparated(values []string, toComplete string) []string {
+	prefix := ""
+	if index := strings.LastIndex(toComplete, ","); index >= 0 {
+		prefix = toComplete[:index+1]
+	}
+
+	given := strings.Split(prefix, ",")
+	completions := make([]string, 0, len(values))
+
+	for _, value := range values {
+		if !slices.Contains(given, value) {
+			completions = append(completions, prefix+value)
+		}
+	}
+
+	return completions
+}
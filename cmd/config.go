@@ -0,0 +1,100 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/schnauzersoft/ami-util/internal/config"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var ErrInvalidConfig = errors.New("configuration is invalid")
+
+// configCmd represents the config command.
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and validate configuration",
+}
+
+// configValidateCmd represents the config validate command.
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Validate configuration and report every problem found",
+	Long: `Validate configuration and report every problem found.
+
+Without a file argument, the effective configuration (config file, environment
+variables, and flags) is validated. With a file argument, only that file is
+loaded and validated.
+
+The following are checked:
+  - at least one account and a target file are configured
+  - account IDs are 12 digits
+  - regions look like region codes (us-east-1, eu-west-2, ...)
+  - the role ARN is a valid IAM role ARN
+  - patterns are non-empty, contain no commas, and are valid AMI IDs when they look like one
+
+Examples:
+  ami-util config validate
+  ami-util config validate ami.yaml`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := runConfigValidate(cmd.Context(), args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+func runConfigValidate(ctx context.Context, args []string) error {
+	var (
+		loaded *config.Config
+		source string
+		err    error
+	)
+
+	if len(args) > 0 {
+		source = args[0]
+		loaded, err = config.LoadConfigFile(ctx, source)
+	} else {
+		loaded, err = config.LoadConfig(ctx)
+		source = cmp.Or(viper.GetString("config"), viper.ConfigFileUsed())
+
+		if source == "" {
+			source = "flags and environment"
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	problems := config.Diagnose(loaded)
+	if len(problems) == 0 {
+		fmt.Fprintf(os.Stdout, "Configuration from %s is valid\n", source)
+
+		return nil
+	}
+
+	fmt.Fprintf(os.Stdout, "Configuration from %s has %d problems:\n", source, len(problems))
+
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stdout, "  - %v\n", problem)
+	}
+
+	return ErrInvalidConfig
+}
@@ -0,0 +1,133 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+)
+
+var ErrConflictingReplacements = errors.New("conflicting AMI replacements")
+
+// conflictPrompt asks which of the replacements of a conflict to apply,
+// reporting false to apply none of them.
+type conflictPrompt func(conflict aws.Conflict) (aws.AMIReplacement, bool, error)
+
+// checkConflicts refuses replacements that map the same AMI onto different
+// AMIs within a target, rather than leaving the result to their order. With
+// a prompt, it asks which replacement to apply instead, once per conflict.
+func checkConflicts(res *resolution, prompt conflictPrompt) error {
+	groups := [][]aws.AMIReplacement{res.replacements}
+	if len(res.targets) > 0 {
+		groups = nil
+
+		for _, target := range res.targets {
+			groups = append(groups, target.replacements)
+		}
+	}
+
+	var (
+		problems []string
+		asked    = make(map[string]bool)
+	)
+
+	for _, replacements := range groups {
+		for _, conflict := range aws.FindConflicts(replacements) {
+			key := conflict.OldAMI + " " + conflict.Region
+
+			switch {
+			case prompt == nil:
+				problems = append(problems, describeConflict(conflict))
+			case !asked[key]:
+				asked[key] = true
+
+				chosen, ok, err := prompt(conflict)
+				if err != nil {
+					return err
+				}
+
+				// Skipping drops every replacement of the conflict
+				newAMI := ""
+				if ok {
+					newAMI = chosen.NewAMI
+				}
+
+				res.resolveConflict(conflict, newAMI)
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %d AMIs are mapped onto different AMIs:\n  - %s",
+		ErrConflictingReplacements, len(problems), strings.Join(problems, "\n  - "))
+}
+
+// resolveConflict keeps only the replacements of conflict onto newAMI in res
+// and its targets, or none of them when newAMI is empty.
+func (r *resolution) resolveConflict(conflict aws.Conflict, newAMI string) {
+	r.replacements = aws.ResolveConflict(r.replacements, conflict, newAMI)
+
+	for i := range r.targets {
+		r.targets[i].replacements = aws.ResolveConflict(r.targets[i].replacements, conflict, newAMI)
+	}
+}
+
+func describeConflict(conflict aws.Conflict) string {
+	choices := make([]string, 0, len(conflict.Replacements))
+	for _, replacement := range conflict.Replacements {
+		choices = append(choices, fmt.Sprintf("%s (account %s, region %s)", replacement.NewAMI,
+			replacement.Account, replacement.Region))
+	}
+
+	scope := ""
+	if conflict.Region != "" {
+		scope = " in " + conflict.Region
+	}
+
+	return fmt.Sprintf("%s%s -> %s", conflict.OldAMI, scope, strings.Join(choices, ", "))
+}
+
+// newConflictPrompt returns a prompt that asks the user which replacement of
+// a conflict to apply, or to skip them all.
+func newConflictPrompt(in io.Reader, out io.Writer) conflictPrompt {
+	reader := bufio.NewReader(in)
+
+	return func(conflict aws.Conflict) (aws.AMIReplacement, bool, error) {
+		fmt.Fprintf(out, "\n%s is mapped onto different AMIs:\n", conflict.OldAMI)
+
+		for i, replacement := range conflict.Replacements {
+			fmt.Fprintf(out, "  [%d] %s %s (account %s, region %s)\n", i+1, replacement.NewAMI, replacement.Name,
+				replacement.Account, replacement.Region)
+		}
+
+		for {
+			fmt.Fprintf(out, "Apply which replacement? [1-%d]/[s]kip: ", len(conflict.Replacements))
+
+			line, err := reader.ReadString('\n')
+			if err != nil && line == "" {
+				return aws.AMIReplacement{}, false, fmt.Errorf("failed to read response: %w", err)
+			}
+
+			answer := strings.ToLower(strings.TrimSpace(line))
+			if answer == "s" || answer == "skip" {
+				return aws.AMIReplacement{}, false, nil
+			}
+
+			choice, err := strconv.Atoi(answer)
+			if err == nil && choice >= 1 && choice <= len(conflict.Replacements) {
+				return conflict.Replacements[choice-1], true, nil
+			}
+		}
+	}
+}
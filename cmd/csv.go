@@ -0,0 +1,32 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/schnauzersoft/ami-util/internal/report"
+	"github.com/schnauzersoft/ami-util/internal/results"
+
+	"github.com/spf13/viper"
+)
+
+// writeCSVReport writes the replacements of a finished run as CSV. Failing
+// to do so does not fail the run.
+func writeCSVReport(summary *results.Summary) {
+	path := viper.GetString("report_csv")
+	if path == "" {
+		return
+	}
+
+	err := report.FromSummary(summary).WriteFile(path, report.FormatCSV)
+	if err != nil {
+		slog.Warn("Failed to write CSV report", "path", path, "error", err)
+
+		return
+	}
+
+	slog.Debug("CSV report written", "path", path)
+}
@@ -0,0 +1,19 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import "os"
+
+// colorOutput reports whether output written to file is colored: only when
+// it is a terminal and NO_COLOR is not set.
+func colorOutput(file *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	info, err := file.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
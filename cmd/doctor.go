@@ -0,0 +1,187 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/config"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	checkPass = "PASS"
+	checkFail = "FAIL"
+	checkSkip = "SKIP"
+)
+
+var ErrDoctorChecksFailed = errors.New("one or more checks failed")
+
+// doctorCmd represents the doctor command.
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Validate configuration, credentials, and permissions",
+	Long: `Validate that ami-util can run successfully with the current configuration.
+
+The following checks are performed and summarized:
+  - the configuration file (if any) parses and the configuration is valid
+  - the AWS profile loads
+  - the role can be assumed for each account
+  - ec2:DescribeImages is permitted in each target region
+
+Examples:
+  ami-util doctor
+  ami-util doctor --account-ids 123456789012 --regions us-east-1,eu-west-1`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		err := runDoctor(cmd.Context())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+type doctorCheck struct {
+	name   string
+	status string
+	detail string
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func runDoctor(ctx context.Context) error {
+	checks := checkConfiguration(ctx)
+
+	if cfg != nil {
+		checks = append(checks, checkAWS(ctx)...)
+	}
+
+	return printDoctorResults(checks)
+}
+
+func checkConfiguration(ctx context.Context) []doctorCheck {
+	var checks []doctorCheck
+
+	var err error
+
+	cfg, err = config.LoadConfig(ctx)
+	if err != nil {
+		return append(checks, doctorCheck{"load configuration", checkFail, err.Error()})
+	}
+
+	configFile := viper.ConfigFileUsed()
+	if configFile == "" {
+		checks = append(checks, doctorCheck{"config file", checkSkip, "no configuration file found"})
+	} else {
+		err = config.ParseConfigFile(configFile)
+		if err != nil {
+			checks = append(checks, doctorCheck{"config file", checkFail, err.Error()})
+		} else {
+			checks = append(checks, doctorCheck{"config file", checkPass, configFile})
+		}
+	}
+
+	// Files are named when updating, so the configuration need not name them
+	err = errors.Join(config.DiagnoseWithoutFiles(cfg)...)
+	if err != nil {
+		checks = append(checks, doctorCheck{"validate configuration", checkFail, err.Error()})
+	} else {
+		checks = append(checks, doctorCheck{"validate configuration", checkPass, ""})
+	}
+
+	return checks
+}
+
+func checkAWS(ctx context.Context) []doctorCheck {
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return []doctorCheck{{"load AWS profile " + cfg.Profile, checkFail, err.Error()}}
+	}
+
+	checks := []doctorCheck{{"load AWS profile " + cfg.Profile, checkPass, ""}}
+
+	regions := cfg.Regions
+	if len(regions) == 0 && !cfg.AllRegions {
+		region, err := awsClient.GetRegion()
+		if err != nil {
+			return append(checks, doctorCheck{"resolve region", checkFail, err.Error()})
+		}
+
+		checks = append(checks, doctorCheck{"resolve region", checkPass, region})
+		regions = []string{region}
+	}
+
+	for _, accountID := range cfg.Accounts {
+		checks = append(checks, checkAccount(ctx, awsClient, accountID, regionsFor(accountID, regions))...)
+	}
+
+	return checks
+}
+
+func checkAccount(ctx context.Context, awsClient *aws.Client, accountID string, regions []string) []doctorCheck {
+	// account_regions may list no regions for an account
+	if len(regions) == 0 {
+		return []doctorCheck{{"assume role for " + accountID, checkFail, "no regions to check for " + accountID}}
+	}
+
+	identity, err := awsClient.GetCallerIdentity(ctx, accountID, regions[0])
+	if err != nil {
+		return []doctorCheck{{"assume role for " + accountID, checkFail, err.Error()}}
+	}
+
+	checks := []doctorCheck{{"assume role for " + accountID, checkPass, identity}}
+
+	for _, region := range regions {
+		name := fmt.Sprintf("describe images in %s/%s", accountID, region)
+
+		err := awsClient.CheckDescribeImages(ctx, accountID, region)
+		if err != nil {
+			checks = append(checks, doctorCheck{name, checkFail, err.Error()})
+		} else {
+			checks = append(checks, doctorCheck{name, checkPass, ""})
+		}
+	}
+
+	return checks
+}
+
+func printDoctorResults(checks []doctorCheck) error {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, tableColumnPadding, ' ', 0)
+
+	fmt.Fprintln(writer, "CHECK\tSTATUS\tDETAIL")
+
+	failed := 0
+
+	for _, check := range checks {
+		if check.status == checkFail {
+			failed++
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", check.name, check.status, check.detail)
+	}
+
+	fmt.Fprintf(writer, "\n%d checks, %d failed\n", len(checks), failed)
+
+	err := writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write doctor results: %w", err)
+	}
+
+	if failed > 0 {
+		return ErrDoctorChecksFailed
+	}
+
+	return nil
+}
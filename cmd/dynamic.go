@@ -0,0 +1,198 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/config"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+)
+
+// handleDynamicReferences reports the SSM dynamic references and FindInMap
+// image IDs in the target files and, in rewrite mode, moves references pinned
+// to an old parameter version onto the latest version. Parameter versions are
+// numbered per region, so references in a region scope are resolved in its
+// region, and the others in every target region.
+func handleDynamicReferences(ctx context.Context, res *resolution) error {
+	if cfg.DynamicReferences == "" {
+		return nil
+	}
+
+	references, err := res.fileProcessor.ScanDynamicReferences(res.paths...)
+	if err != nil {
+		return fmt.Errorf("failed to scan dynamic references: %w", err)
+	}
+
+	if len(references) == 0 {
+		return nil
+	}
+
+	if len(res.regions) == 0 {
+		slog.Warn("No region to resolve dynamic references in")
+
+		return nil
+	}
+
+	parameters := resolveDynamicParameters(ctx, res.awsClient, res.regions, references)
+
+	for _, reference := range references {
+		reportDynamicReference(reference, parameters[fileprocessor.ParameterRegion{
+			Name:   reference.Name,
+			Region: cmp.Or(reference.Region, res.regions[0]),
+		}])
+	}
+
+	if cfg.DynamicReferences != config.DynamicReferencesRewrite {
+		return nil
+	}
+
+	versions := dynamicVersions(parameters, res.regions, references)
+
+	rewritten, err := res.fileProcessor.RewriteDynamicReferences(ctx, references, versions)
+	res.rewritten = append(res.rewritten, rewritten...)
+
+	if err != nil {
+		return fmt.Errorf("failed to rewrite dynamic references: %w", err)
+	}
+
+	return nil
+}
+
+// resolveDynamicParameters looks up every SSM parameter referenced once per
+// region: in the region of the reference's region scope, or in every region
+// outside them. Parameters that do not hold an AMI ID are not AMI usages and
+// are skipped.
+func resolveDynamicParameters(ctx context.Context, awsClient *aws.Client, regions []string,
+	references []fileprocessor.DynamicReference,
+) map[fileprocessor.ParameterRegion]*aws.SSMParameter {
+	parameters := make(map[fileprocessor.ParameterRegion]*aws.SSMParameter)
+	seen := make(map[fileprocessor.ParameterRegion]bool)
+
+	for _, reference := range references {
+		if reference.Kind != fileprocessor.DynamicSSM {
+			continue
+		}
+
+		lookupRegions := regions
+		if reference.Region != "" {
+			lookupRegions = []string{reference.Region}
+		}
+
+		for _, region := range lookupRegions {
+			key := fileprocessor.ParameterRegion{Name: reference.Name, Region: region}
+			if seen[key] {
+				continue
+			}
+
+			seen[key] = true
+
+			parameter, err := awsClient.GetSSMParameter(ctx, region, reference.Name)
+			if err != nil {
+				if !errors.Is(err, aws.ErrInvalidSSMValue) {
+					slog.Warn("Failed to resolve SSM parameter", "parameter", reference.Name, "region", region,
+						"error", err)
+				} else {
+					slog.Debug("Skipping SSM parameter, which does not hold an AMI ID", "parameter", reference.Name)
+				}
+
+				continue
+			}
+
+			parameters[key] = parameter
+		}
+	}
+
+	return parameters
+}
+
+// dynamicVersions returns the latest versions that pinned SSM references are
+// moved onto: in region scopes, that of the scope's region, and outside them,
+// the version every target region agrees on. References outside region
+// scopes are not rewritten when the regions' versions differ, since a version
+// of one region resolves to another value, if any, in the others.
+func dynamicVersions(parameters map[fileprocessor.ParameterRegion]*aws.SSMParameter, regions []string,
+	references []fileprocessor.DynamicReference,
+) map[fileprocessor.ParameterRegion]int64 {
+	versions := make(map[fileprocessor.ParameterRegion]int64, len(parameters))
+	for key, parameter := range parameters {
+		versions[key] = parameter.Version
+	}
+
+	checked := make(map[string]bool)
+
+	for _, reference := range references {
+		if reference.Kind != fileprocessor.DynamicSSM || reference.Region != "" || checked[reference.Name] {
+			continue
+		}
+
+		checked[reference.Name] = true
+
+		version, agreed := agreedVersion(parameters, reference.Name, regions)
+		if !agreed {
+			slog.Warn("Not rewriting SSM dynamic references outside a region scope, whose parameter version "+
+				"differs between regions", "parameter", reference.Name, "regions", regions)
+
+			continue
+		}
+
+		versions[fileprocessor.ParameterRegion{Name: reference.Name}] = version
+	}
+
+	return versions
+}
+
+// agreedVersion returns the latest version of the named parameter when it
+// resolved to the same version in every region.
+func agreedVersion(parameters map[fileprocessor.ParameterRegion]*aws.SSMParameter, name string,
+	regions []string,
+) (int64, bool) {
+	var version int64
+
+	for i, region := range regions {
+		parameter := parameters[fileprocessor.ParameterRegion{Name: name, Region: region}]
+		if parameter == nil || (i > 0 && parameter.Version != version) {
+			return 0, false
+		}
+
+		version = parameter.Version
+	}
+
+	return version, len(regions) > 0
+}
+
+func reportDynamicReference(reference fileprocessor.DynamicReference, parameter *aws.SSMParameter) {
+	location := []any{"file", reference.File, "line", reference.Line}
+
+	switch {
+	case reference.Kind == fileprocessor.DynamicFindInMap:
+		slog.Info("ImageId comes from a mapping; AMI IDs in the mapping are updated per region key",
+			append(location, "mapping", reference.Name)...)
+	case reference.Kind == fileprocessor.DynamicKarpenter && strings.HasPrefix(reference.Name, "alias:") &&
+		!strings.HasSuffix(reference.Name, "@latest"):
+		slog.Info("EC2NodeClass selects AMIs by an alias pinned to a version; use @latest to pick up new AMIs",
+			append(location, "selector", reference.Name)...)
+	case reference.Kind == fileprocessor.DynamicKarpenter:
+		slog.Info("EC2NodeClass selects AMIs that Karpenter resolves, so they are not updated",
+			append(location, "selector", reference.Name)...)
+	case parameter == nil:
+		return
+	case reference.Version == 0:
+		slog.Info("SSM dynamic reference resolves to the latest version", append(location, "parameter", reference.Name,
+			"value", parameter.Value, "latest_version", parameter.Version)...)
+	case reference.Version < parameter.Version:
+		slog.Info("SSM dynamic reference is pinned to an old version", append(location, "parameter", reference.Name,
+			"version", reference.Version, "latest_version", parameter.Version, "value", parameter.Value)...)
+	default:
+		slog.Info("SSM dynamic reference is pinned to the latest version", append(location, "parameter", reference.Name,
+			"version", reference.Version, "value", parameter.Value)...)
+	}
+}
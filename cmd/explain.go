@@ -0,0 +1,153 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+// explainCmd represents the explain command.
+var explainCmd = &cobra.Command{
+	Use:   "explain AMI_ID",
+	Short: "Show how the replacement for an AMI is chosen",
+	Long: `Show how ami-util chooses the replacement for an AMI ID.
+
+For every configured account and region, this prints the AMI's resolved name,
+the search pattern derived from that name, every candidate image considered
+with its creation date, and why the winning image was selected.
+
+Examples:
+  ami-util explain ami-037057f9512b47316 --account-ids 137112412989 --regions us-east-1`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := runExplain(cmd.Context(), args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+}
+
+func runExplain(ctx context.Context, amiID string) error {
+	var err error
+
+	cfg, err = config.LoadConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if !cfg.HasAccounts() {
+		return config.ErrNoAccountID
+	}
+
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	regions := cfg.Regions
+	if len(regions) == 0 && !cfg.AllRegions {
+		region, err := awsClient.GetRegion()
+		if err != nil {
+			return fmt.Errorf("failed to get region from AWS profile: %w", err)
+		}
+
+		regions = []string{region}
+	}
+
+	for _, accountID := range cfg.Accounts {
+		for _, region := range regionsFor(accountID, regions) {
+			fmt.Fprintf(os.Stdout, "Account %s, region %s\n", accountID, region)
+
+			explanation, err := awsClient.ExplainAMI(ctx, accountID, region, amiID)
+			if err != nil {
+				if errors.Is(err, aws.ErrAMINotFound) {
+					fmt.Fprintf(os.Stdout, "  %s was not found\n\n", amiID)
+
+					continue
+				}
+
+				return fmt.Errorf("failed to explain %s: %w", amiID, err)
+			}
+
+			err = printExplanation(os.Stdout, explanation)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func printExplanation(out io.Writer, explanation *aws.Explanation) error {
+	fmt.Fprintf(out, "  AMI:     %s\n", explanation.AMI.ImageID)
+	fmt.Fprintf(out, "  Name:    %s\n", explanation.AMI.Name)
+	fmt.Fprintf(out, "  Created: %s\n", explanation.AMI.CreationDate.Format(time.RFC3339))
+	fmt.Fprintf(out, "  Arch:    %s\n", explanation.AMI.Architecture)
+
+	bootMode := explanation.AMI.BootMode
+	if bootMode == "" {
+		bootMode = "default"
+	}
+
+	fmt.Fprintf(out, "  Type:    %s, %s root device, %s boot mode\n", explanation.AMI.VirtualizationType,
+		explanation.AMI.RootDeviceType, bootMode)
+	fmt.Fprintf(out, "  Pattern: %s\n", explanation.Pattern)
+	fmt.Fprintf(out, "  Candidates (%d, newest first):\n", len(explanation.Candidates))
+
+	table := tabwriter.NewWriter(out, 0, 0, tableColumnPadding, ' ', 0)
+
+	for _, candidate := range explanation.Candidates {
+		marker := " "
+		if explanation.Latest != nil && candidate.ImageID == explanation.Latest.ImageID {
+			marker = "*"
+		}
+
+		fmt.Fprintf(table, "   %s %s\t%s\t%s\n",
+			marker, candidate.ImageID, candidate.CreationDate.Format(time.RFC3339), candidate.Name)
+	}
+
+	err := table.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write explanation: %w", err)
+	}
+
+	fmt.Fprintf(out, "  Result:  %s\n\n", explanationResult(explanation))
+
+	return nil
+}
+
+func explanationResult(explanation *aws.Explanation) string {
+	current := explanation.AMI.ImageID
+
+	switch {
+	case explanation.Latest == nil:
+		return "no candidates matched the pattern; " + current + " is left unchanged"
+	case explanation.Latest.ImageID == current:
+		return current + " is already the newest candidate by creation date"
+	case aws.IsPinned(aws.AMIReplacement{OldAMI: current, Name: explanation.AMI.Name}, cfg.Pins):
+		return fmt.Sprintf("%s is the newest candidate by creation date, but %s is pinned",
+			explanation.Latest.ImageID, current)
+	default:
+		return fmt.Sprintf("%s has the newest creation date of %d candidates and replaces %s",
+			explanation.Latest.ImageID, len(explanation.Candidates), current)
+	}
+}
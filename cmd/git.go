@@ -0,0 +1,266 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/config"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+	"github.com/schnauzersoft/ami-util/internal/git"
+	"github.com/schnauzersoft/ami-util/internal/github"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const commitSubject = "Update AMI IDs"
+
+// addGitFlags adds the flags that commit the changed files and open a pull
+// request for them.
+func addGitFlags(flags *pflag.FlagSet) {
+	flags.String("git-branch", "",
+		"Create this branch for the changed files, expanding {{date}} and {{timestamp}}")
+	flags.Bool("git-commit", false, "Commit only the changed files with a generated message")
+	flags.Bool("git-push", false, "Push the commit to --git-remote (with --git-commit)")
+	flags.String("git-remote", config.DefaultGitRemote, "Remote that --git-push pushes to")
+	flags.Bool("github-pr", false,
+		"Open a GitHub pull request for the pushed branch, authenticated with GITHUB_TOKEN or GH_TOKEN")
+	flags.String("github-base", "",
+		"Branch the pull request merges into (default: the branch checked out before the run)")
+}
+
+// bindGitFlags binds the flags added by addGitFlags to their settings.
+func bindGitFlags(flags *pflag.FlagSet) {
+	_ = viper.BindPFlag("git_branch", flags.Lookup("git-branch"))
+	_ = viper.BindPFlag("git_commit", flags.Lookup("git-commit"))
+	_ = viper.BindPFlag("git_push", flags.Lookup("git-push"))
+	_ = viper.BindPFlag("git_remote", flags.Lookup("git-remote"))
+	_ = viper.BindPFlag("github_pr", flags.Lookup("github-pr"))
+	_ = viper.BindPFlag("github_base", flags.Lookup("github-base"))
+}
+
+// handleGit creates the configured branch, commits the files a run changed,
+// pushes the branch, and opens a pull request for it, as far as --git-branch,
+// --git-commit, --git-push, and --github-pr ask for.
+func handleGit(ctx context.Context, res *resolution, results []fileprocessor.FileResult) error {
+	if diffOnly || (cfg.GitBranch == "" && !cfg.GitCommit) {
+		return nil
+	}
+
+	results = slices.Concat(res.rewritten, results)
+
+	files := changedFiles(results)
+	if len(files) == 0 {
+		slog.Info("No files changed, skipping git branch and commit")
+
+		return nil
+	}
+
+	repo, err := git.Open(ctx, res.paths)
+	if err != nil {
+		return fmt.Errorf("failed to open git worktree: %w", err)
+	}
+
+	base := cfg.GitHubBase
+	if cfg.GitHubPR && base == "" {
+		base, err = repo.CurrentBranch(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get current branch: %w", err)
+		}
+	}
+
+	if cfg.GitBranch != "" {
+		err = recordStartBranch(ctx, repo)
+		if err != nil {
+			return err
+		}
+
+		branch := expandBranchName(cfg.GitBranch, time.Now())
+
+		err = repo.CreateBranch(ctx, branch)
+		if err != nil {
+			return fmt.Errorf("failed to create branch %s: %w", branch, err)
+		}
+
+		slog.Info("Created branch", "branch", branch)
+	}
+
+	if !cfg.GitCommit {
+		return nil
+	}
+
+	hash, err := repo.Commit(ctx, files, commitMessage(results))
+	if err != nil {
+		return fmt.Errorf("failed to commit changed files: %w", err)
+	}
+
+	slog.Info("Committed changed files", "files", len(files), "commit", hash)
+
+	if !cfg.GitPush {
+		return nil
+	}
+
+	branch, err := repo.CurrentBranch(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get current branch: %w", err)
+	}
+
+	err = repo.Push(ctx, cfg.GitRemote, branch)
+	if err != nil {
+		return fmt.Errorf("failed to push %s to %s: %w", branch, cfg.GitRemote, err)
+	}
+
+	slog.Info("Pushed branch", "branch", branch, "remote", cfg.GitRemote)
+
+	if !cfg.GitHubPR {
+		return nil
+	}
+
+	return openPullRequest(ctx, repo, base, branch, results)
+}
+
+// openPullRequest opens a GitHub pull request from branch into base that
+// summarizes the replacements made.
+func openPullRequest(ctx context.Context, repo *git.Repo, base, branch string,
+	results []fileprocessor.FileResult,
+) error {
+	remoteURL, err := repo.RemoteURL(ctx, cfg.GitRemote)
+	if err != nil {
+		return fmt.Errorf("failed to get URL of %s: %w", cfg.GitRemote, err)
+	}
+
+	owner, name, err := github.ParseRemote(remoteURL)
+	if err != nil {
+		return err
+	}
+
+	client, err := github.NewClient()
+	if err != nil {
+		return err
+	}
+
+	url, err := client.CreatePullRequest(ctx, owner, name, github.PullRequest{
+		Title: commitSubject,
+		Head:  branch,
+		Base:  base,
+		Body:  pullRequestBody(results),
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Opened pull request", "url", url)
+
+	return nil
+}
+
+// expandBranchName fills in the {{date}} (2025-01-31) and {{timestamp}}
+// (20250131T153000Z) placeholders of a branch name template, in UTC.
+func expandBranchName(template string, now time.Time) string {
+	now = now.UTC()
+
+	return strings.NewReplacer(
+		"{{date}}", now.Format(time.DateOnly),
+		"{{timestamp}}", now.Format("20060102T150405Z"),
+	).Replace(template)
+}
+
+// pullRequestBody summarizes the replacements made to files as a Markdown
+// table of old and new AMIs, the new AMIs' creation dates, and the files.
+func pullRequestBody(results []fileprocessor.FileResult) string {
+	type row struct {
+		replacement aws.AMIReplacement
+		files       []string
+	}
+
+	var rows []*row
+
+	for _, result := range results {
+		for _, replacement := range result.Replacements {
+			index := slices.IndexFunc(rows, func(r *row) bool {
+				return r.replacement.OldAMI == replacement.OldAMI && r.replacement.NewAMI == replacement.NewAMI
+			})
+			if index < 0 {
+				rows = append(rows, &row{replacement: replacement})
+				index = len(rows) - 1
+			}
+
+			if !slices.Contains(rows[index].files, result.Path) {
+				rows[index].files = append(rows[index].files, result.Path)
+			}
+		}
+	}
+
+	var builder strings.Builder
+
+	files := changedFiles(results)
+	fmt.Fprintf(&builder, "Updates %d AMI IDs across %d files.\n\n", len(rows), len(files))
+
+	if len(rows) == 0 {
+		fmt.Fprintf(&builder, "Changed files: `%s`\n", strings.Join(files, "`, `"))
+
+		return builder.String()
+	}
+
+	builder.WriteString("| Old AMI | New AMI | Name | Created | Files |\n")
+	builder.WriteString("|---|---|---|---|---|\n")
+
+	for _, r := range rows {
+		created := "-"
+		if !r.replacement.Created.IsZero() {
+			created = r.replacement.Created.UTC().Format(time.DateOnly)
+		}
+
+		fmt.Fprintf(&builder, "| `%s` | `%s` | %s | %s | `%s` |\n", r.replacement.OldAMI, r.replacement.NewAMI,
+			r.replacement.Name, created, strings.Join(r.files, "`, `"))
+	}
+
+	return builder.String()
+}
+
+// changedFiles returns the files that results changed, each once.
+func changedFiles(results []fileprocessor.FileResult) []string {
+	var files []string
+
+	for _, result := range results {
+		if result.Count > 0 && !slices.Contains(files, result.Path) {
+			files = append(files, result.Path)
+		}
+	}
+
+	return files
+}
+
+// commitMessage describes the replacements made to files, one line per
+// distinct replacement.
+func commitMessage(results []fileprocessor.FileResult) string {
+	var lines []string
+
+	for _, result := range results {
+		for _, replacement := range result.Replacements {
+			line := fmt.Sprintf("- %s -> %s", replacement.OldAMI, replacement.NewAMI)
+			if replacement.Name != "" {
+				line += " (" + replacement.Name + ")"
+			}
+
+			if !slices.Contains(lines, line) {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	if len(lines) == 0 {
+		return commitSubject
+	}
+
+	return commitSubject + "\n\n" + strings.Join(lines, "\n") + "\n"
+}
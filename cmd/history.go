@@ -0,0 +1,145 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+	"github.com/schnauzersoft/ami-util/internal/history"
+
+	"github.com/spf13/cobra"
+)
+
+// historyCmd represents the history command.
+var historyCmd = &cobra.Command{
+	Use:   "history [run-id]",
+	Short: "List and inspect past runs",
+	Long: `List past runs recorded in ~/.ami-util/history.jsonl, or show the details of
+a single run.
+
+Every update run is recorded with its timestamp, user, target, accounts,
+regions, and the AMI replacements made in each file.
+
+Examples:
+  ami-util history                         # List all runs
+  ami-util history 20250103T101500Z-3f9a   # Show a single run`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		err := runHistory(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+}
+
+func runHistory(args []string) error {
+	path, err := history.DefaultPath()
+	if err != nil {
+		return fmt.Errorf("failed to locate history: %w", err)
+	}
+
+	runs, err := history.Load(path)
+	if err != nil {
+		return fmt.Errorf("failed to load history: %w", err)
+	}
+
+	if len(args) == 0 {
+		return printRuns(runs)
+	}
+
+	run, err := history.Find(runs, args[0])
+	if err != nil {
+		return fmt.Errorf("failed to find run: %w", err)
+	}
+
+	return printRun(run)
+}
+
+func printRuns(runs []history.Run) error {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, tableColumnPadding, ' ', 0)
+
+	fmt.Fprintln(writer, "ID\tTIME\tUSER\tTARGET\tREPLACEMENTS\tFILES")
+
+	for _, run := range runs {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%d\t%d\n", run.ID, run.Timestamp.Format(time.RFC3339),
+			run.User, run.Target, run.ReplacementCount(), len(run.Files))
+	}
+
+	err := writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+
+	return nil
+}
+
+func printRun(run history.Run) error {
+	fmt.Fprintf(os.Stdout, "ID:       %s\n", run.ID)
+	fmt.Fprintf(os.Stdout, "Time:     %s\n", run.Timestamp.Format(time.RFC3339))
+	fmt.Fprintf(os.Stdout, "User:     %s\n", run.User)
+	fmt.Fprintf(os.Stdout, "Target:   %s\n", run.Target)
+	fmt.Fprintf(os.Stdout, "Accounts: %s\n", strings.Join(run.Accounts, ", "))
+	fmt.Fprintf(os.Stdout, "Regions:  %s\n\n", strings.Join(run.Regions, ", "))
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, tableColumnPadding, ' ', 0)
+
+	fmt.Fprintln(writer, "FILE\tOLD AMI\tNEW AMI\tNAME\tACCOUNT\tREGION")
+
+	for _, file := range run.Files {
+		for _, replacement := range file.Replacements {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", file.Path, replacement.OldAMI, replacement.NewAMI,
+				replacement.Name, replacement.Account, replacement.Region)
+		}
+	}
+
+	err := writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+
+	return nil
+}
+
+func recordRun(res *resolution, results []fileprocessor.FileResult) {
+	// Nothing is written with --diff-only, so there is nothing to undo.
+	if diffOnly {
+		return
+	}
+
+	path, err := history.DefaultPath()
+	if err != nil {
+		slog.Warn("Failed to record run history", "error", err)
+
+		return
+	}
+
+	run := history.NewRun(currentUser(), strings.Join(res.paths, ", "), res.accounts, res.regions, results)
+
+	err = history.Append(path, run)
+	if err != nil {
+		slog.Warn("Failed to record run history", "error", err)
+	}
+}
+
+func currentUser() string {
+	current, err := user.Current()
+	if err != nil {
+		return os.Getenv("USER")
+	}
+
+	return current.Username
+}
@@ -0,0 +1,245 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+	"github.com/schnauzersoft/ami-util/internal/results"
+)
+
+// imageBuilderUpdate is an Image Builder ARN in the target files that has a
+// newer version, with the replacements of the AMIs its build distributed by
+// those of the newer build in the same account and region.
+type imageBuilderUpdate struct {
+	arn          aws.ImageBuilderARN
+	latest       aws.ImageBuilderARN
+	replacements []aws.AMIReplacement
+}
+
+// collectImageBuilderUpdates resolves the Image Builder ARNs in paths to their
+// latest versions with --image-builder. ARNs with x in their version already
+// select the latest one and are left alone. A failed lookup is reported and
+// leaves the ARN, and the AMIs of its build, as they are.
+func collectImageBuilderUpdates(ctx context.Context, awsClient *aws.Client, fileProcessor *fileprocessor.Processor,
+	paths []string,
+) ([]imageBuilderUpdate, []results.Error) {
+	if !cfg.ImageBuilder {
+		return nil, nil
+	}
+
+	references, err := fileProcessor.ScanImageBuilderReferences(paths...)
+	if err != nil {
+		slog.Warn("Failed to scan Image Builder ARNs", "error", err)
+
+		return nil, []results.Error{{Message: err.Error()}}
+	}
+
+	arns := make(map[string]aws.ImageBuilderARN)
+	for _, reference := range references {
+		arns[reference.ARN.String()] = reference.ARN
+	}
+
+	var (
+		updates      []imageBuilderUpdate
+		lookupErrors []results.Error
+	)
+
+	for _, key := range slices.Sorted(maps.Keys(arns)) {
+		arn := arns[key]
+		if arn.Floating() {
+			slog.Debug("Image Builder ARN selects the latest version", "arn", key)
+
+			continue
+		}
+
+		update, err := resolveImageBuilderUpdate(ctx, awsClient, arn)
+		if errors.Is(err, aws.ErrRejectedBuildAMI) {
+			slog.Warn("Not updating Image Builder ARN, whose latest build is rejected", "arn", key, "error", err)
+
+			continue
+		}
+
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("Failed to resolve Image Builder ARN", "arn", key, "error", err)
+
+				lookupErrors = append(lookupErrors, results.Error{Message: err.Error(), Region: arn.Region})
+			}
+
+			continue
+		}
+
+		if update.latest == arn {
+			slog.Debug("Image Builder ARN is up to date", "arn", key)
+
+			continue
+		}
+
+		slog.Debug("Found newer Image Builder version", "arn", key, "latest", update.latest.String(),
+			"replacements", len(update.replacements))
+
+		updates = append(updates, update)
+	}
+
+	return updates, lookupErrors
+}
+
+// resolveImageBuilderUpdate returns the update of arn to its latest version,
+// whose latest ARN is arn itself when it is the latest. The AMIs of the latest
+// build must pass the same filters and policy as any other candidate; those
+// that do not are dropped, and the error of the last is returned when none
+// pass.
+func resolveImageBuilderUpdate(ctx context.Context, awsClient *aws.Client, arn aws.ImageBuilderARN,
+) (imageBuilderUpdate, error) {
+	latest, err := awsClient.LatestImageBuilderARN(ctx, arn)
+	if err != nil {
+		return imageBuilderUpdate{}, fmt.Errorf("failed to find the latest version of %s: %w", arn, err)
+	}
+
+	update := imageBuilderUpdate{arn: arn, latest: latest}
+	if latest == arn || arn.Resource != aws.ImageBuilderImage {
+		return update, nil
+	}
+
+	current, err := awsClient.GetImageBuild(ctx, arn)
+	if err != nil {
+		return imageBuilderUpdate{}, err
+	}
+
+	newer, err := awsClient.GetImageBuild(ctx, latest)
+	if err != nil {
+		return imageBuilderUpdate{}, err
+	}
+
+	for _, newAMI := range newer.AMIs {
+		for _, oldAMI := range current.AMIs {
+			if oldAMI.Account != newAMI.Account || oldAMI.Region != newAMI.Region || oldAMI.ImageID == newAMI.ImageID {
+				continue
+			}
+
+			update.replacements = append(update.replacements, aws.AMIReplacement{
+				OldAMI:  oldAMI.ImageID,
+				NewAMI:  newAMI.ImageID,
+				Name:    newAMI.Name,
+				Account: newAMI.Account,
+				Region:  newAMI.Region,
+			})
+		}
+	}
+
+	if len(update.replacements) == 0 {
+		return update, nil
+	}
+
+	var rejected error
+
+	update.replacements = slices.DeleteFunc(update.replacements, func(replacement aws.AMIReplacement) bool {
+		err := awsClient.CheckBuildAMI(ctx, replacement.Account, replacement.Region, replacement.OldAMI,
+			replacement.NewAMI)
+		if err != nil {
+			slog.Warn("Skipping Image Builder AMI", "ami", replacement.OldAMI, "new_ami", replacement.NewAMI,
+				"region", replacement.Region, "error", err)
+
+			rejected = err
+		}
+
+		return err != nil
+	})
+
+	if len(update.replacements) == 0 {
+		return imageBuilderUpdate{}, rejected
+	}
+
+	return update, nil
+}
+
+// preferImageBuilds replaces the AMIs distributed by an outdated Image
+// Builder build with those of the latest build, in place of any other
+// replacement found for them.
+func preferImageBuilds(replacements []aws.AMIReplacement, updates []imageBuilderUpdate) []aws.AMIReplacement {
+	built := make(map[string]bool)
+
+	var buildReplacements []aws.AMIReplacement
+
+	for _, update := range updates {
+		for _, replacement := range update.replacements {
+			built[replacement.OldAMI+" "+replacement.Region] = true
+		}
+
+		buildReplacements = append(buildReplacements, update.replacements...)
+	}
+
+	replacements = slices.DeleteFunc(replacements, func(replacement aws.AMIReplacement) bool {
+		return built[replacement.OldAMI+" "+replacement.Region]
+	})
+
+	return append(replacements, buildReplacements...)
+}
+
+// imageBuilderARNs returns the latest version of each outdated Image Builder
+// ARN, keyed by ARN. An image whose AMI replacements were all dropped, such
+// as for pinned AMIs, keeps its ARN, so that it still matches its AMIs.
+func imageBuilderARNs(updates []imageBuilderUpdate, replacements []aws.AMIReplacement) map[string]string {
+	latest := make(map[string]string, len(updates))
+
+	for _, update := range updates {
+		kept := slices.ContainsFunc(update.replacements, func(built aws.AMIReplacement) bool {
+			return slices.ContainsFunc(replacements, func(replacement aws.AMIReplacement) bool {
+				return replacement.OldAMI == built.OldAMI && replacement.NewAMI == built.NewAMI &&
+					replacement.Region == built.Region
+			})
+		})
+
+		if len(update.replacements) > 0 && !kept {
+			slog.Warn("Not updating Image Builder ARN, whose AMIs are not replaced", "arn", update.arn.String(),
+				"latest", update.latest.String())
+
+			continue
+		}
+
+		latest[update.arn.String()] = update.latest.String()
+	}
+
+	return latest
+}
+
+// handleImageBuilderARNs moves the Image Builder ARNs in the target files
+// onto their latest versions, before the AMI IDs of their builds are
+// replaced.
+func handleImageBuilderARNs(ctx context.Context, res *resolution) error {
+	if len(res.imageBuilderARNs) == 0 {
+		return nil
+	}
+
+	references, err := res.fileProcessor.ScanImageBuilderReferences(res.paths...)
+	if err != nil {
+		return fmt.Errorf("failed to scan Image Builder ARNs: %w", err)
+	}
+
+	for _, reference := range references {
+		latest := res.imageBuilderARNs[reference.ARN.String()]
+		if latest != "" {
+			slog.Info("Image Builder ARN has a newer version", "file", reference.File, "line", reference.Line,
+				"arn", reference.ARN.String(), "latest", latest)
+		}
+	}
+
+	rewritten, err := res.fileProcessor.RewriteImageBuilderReferences(ctx, references, res.imageBuilderARNs)
+	res.rewritten = append(res.rewritten, rewritten...)
+
+	if err != nil {
+		return fmt.Errorf("failed to rewrite Image Builder ARNs: %w", err)
+	}
+
+	return nil
+}
@@ -5,15 +5,26 @@ Copyright © 2025 Ben Sapp ya.bsapp.ru
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
 	"os"
+	"slices"
+	"strings"
 
+	"github.com/schnauzersoft/ami-util/internal/aws"
 	"github.com/schnauzersoft/ami-util/internal/config"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
 
 	"github.com/spf13/cobra"
 )
 
+var ErrNoAMIReferences = errors.New("no AMI references found")
+
+var initFromScan bool
+
 // initCmd represents the init command.
 var initCmd = &cobra.Command{
 	Use:   "init [filename]",
@@ -23,36 +34,62 @@ var initCmd = &cobra.Command{
 This command creates a sample configuration file that you can customize
 for your environment. The file can be in YAML, YML, or TOML format.
 
+With --from-scan, the configuration is bootstrapped from the files given with
+--file (the current directory by default) instead: every AMI they reference
+is looked up in the configured regions, or the profile's region, and the file
+is written with the accounts that own them, the regions they were found in,
+and name patterns derived from their names.
+
 Examples:
   ami-util init                    # Creates ami.yaml
   ami-util init my-config.yaml     # Creates my-config.yaml
-  ami-util init config.toml        # Creates config.toml`,
+  ami-util init config.toml        # Creates config.toml
+  ami-util init --from-scan --file ./infra --regions us-east-1,eu-west-1`,
 	Args: cobra.MaximumNArgs(1),
-	Run: func(_ *cobra.Command, args []string) {
-		err := runInit(args)
+	Run: func(cmd *cobra.Command, args []string) {
+		err := runInit(cmd.Context(), args)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 	},
 }
 
 func init() {
+	initCmd.Flags().BoolVar(&initFromScan, "from-scan", false,
+		"Derive the accounts, regions, and patterns from the AMIs referenced by the files")
 	rootCmd.AddCommand(initCmd)
 }
 
-func runInit(args []string) error {
+func runInit(ctx context.Context, args []string) error {
 	filename := "ami.yaml"
 	if len(args) > 0 {
 		filename = args[0]
 	}
 
+	if initFromScan {
+		scanned, err := scannedConfig(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = config.SaveConfig(scanned, filename)
+		if err != nil {
+			return fmt.Errorf("failed to create configuration file: %w", err)
+		}
+
+		slog.Info("Configuration file created from scan", "path", filename, "accounts", len(scanned.Accounts),
+			"patterns", len(scanned.Patterns))
+
+		return nil
+	}
+
 	// Create sample configuration
 	sampleConfig := &config.Config{
 		Accounts: []string{"137112412989"}, // Amazon Linux AMI account
-		File:     "config.yaml",
+		Files:    []string{"config.yaml"},
 		Profile:  "default",
-		Verbose:  false,
+		Verbose:  0,
 		Regions:  []string{},
 		RoleARN:  "",
 		Patterns: []string{
@@ -63,6 +100,7 @@ func runInit(args []string) error {
 			"al2023-ami-ecs-*",
 			"al2023-ami-eks-*",
 		},
+		Pins: []string{},
 	}
 
 	// Save configuration
@@ -71,9 +109,161 @@ func runInit(args []string) error {
 		return fmt.Errorf("failed to create configuration file: %w", err)
 	}
 
-	log.Printf("Configuration file created: %s", filename)
-	log.Printf("Edit the file to customize your settings, then run:")
-	log.Printf("  ami-util --file your-target-file.yaml")
+	slog.Info("Configuration file created", "path", filename)
+	slog.Info("Edit the file to customize your settings, then run: ami-util --file your-target-file.yaml")
 
 	return nil
 }
+
+// scannedConfig returns a configuration for the AMIs referenced by the
+// configured files: the accounts that own them, the regions they were found
+// in, and the patterns derived from their names. Patterns are assigned to
+// their owners when the AMIs belong to more than one account.
+func scannedConfig(ctx context.Context) (*config.Config, error) {
+	var err error
+
+	cfg, err = config.LoadConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if len(cfg.Files) == 0 {
+		cfg.Files = []string{"."}
+	}
+
+	paths, err := targetPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	references, err := newFileProcessor().ScanPath(paths...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", strings.Join(paths, ", "), err)
+	}
+
+	if len(references) == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrNoAMIReferences, strings.Join(paths, ", "))
+	}
+
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	regions, err := scanRegions(awsClient, references)
+	if err != nil {
+		return nil, err
+	}
+
+	amis, missing, err := describeReferencedAMIs(ctx, awsClient, references, regions, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, amiID := range missing {
+		slog.Warn("Referenced AMI not found in the searched regions", "ami", amiID, "regions", regions)
+	}
+
+	owners := make(map[string][]string)
+	foundRegions := make(map[string]bool)
+
+	for _, ami := range amis {
+		pattern := aws.GeneralizeName(ami.Name)
+		if !slices.Contains(owners[pattern], ami.Owner) {
+			owners[pattern] = append(owners[pattern], ami.Owner)
+		}
+
+		foundRegions[ami.Region] = true
+	}
+
+	scanned := &config.Config{
+		Files:    cfg.Files,
+		Profile:  cfg.Profile,
+		Regions:  slices.Sorted(maps.Keys(foundRegions)),
+		Patterns: slices.Sorted(maps.Keys(owners)),
+		Pins:     cfg.Pins,
+	}
+
+	for _, accounts := range owners {
+		for _, accountID := range accounts {
+			if !slices.Contains(scanned.Accounts, accountID) {
+				scanned.Accounts = append(scanned.Accounts, accountID)
+			}
+		}
+	}
+
+	slices.Sort(scanned.Accounts)
+
+	if len(scanned.Accounts) > 1 {
+		scanned.PatternOwners = owners
+	}
+
+	return scanned, nil
+}
+
+// scanRegions returns the regions to look the referenced AMIs up in: those
+// the references lie in the scope of, and the configured regions, or the
+// profile's region.
+func scanRegions(awsClient *aws.Client, references []fileprocessor.FileReference) ([]string, error) {
+	regions := slices.Clone(cfg.Regions)
+	if len(regions) == 0 && cfg.AllRegions {
+		regions = discoveredRegions()
+	}
+
+	if len(regions) == 0 {
+		region, err := awsClient.GetRegion()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get region from AWS profile: %w", err)
+		}
+
+		regions = []string{region}
+	}
+
+	for _, reference := range references {
+		if reference.Region != "" && !slices.Contains(regions, reference.Region) {
+			regions = append(regions, reference.Region)
+		}
+	}
+
+	return regions, nil
+}
+
+// describeReferencedAMIs looks the AMIs referenced up in each region in turn,
+// until every one is found, with the default credentials and then with the
+// role of each of accounts. The AMIs found in none of the regions are
+// returned, sorted, alongside those found.
+func describeReferencedAMIs(ctx context.Context, awsClient *aws.Client, references []fileprocessor.FileReference,
+	regions, accounts []string,
+) ([]aws.AMIInfo, []string, error) {
+	remaining := make(map[string]bool)
+	for _, reference := range references {
+		remaining[reference.AMI] = true
+	}
+
+	var amis []aws.AMIInfo
+
+	for _, region := range regions {
+		if len(remaining) == 0 {
+			break
+		}
+
+		for _, accountID := range append([]string{""}, accounts...) {
+			if len(remaining) == 0 {
+				break
+			}
+
+			found, err := awsClient.DescribeAccountAMIs(ctx, accountID, region, slices.Sorted(maps.Keys(remaining)))
+			if err != nil {
+				return nil, nil, err
+			}
+
+			for _, ami := range found {
+				delete(remaining, ami.ImageID)
+			}
+
+			amis = append(amis, found...)
+		}
+	}
+
+	return amis, slices.Sorted(maps.Keys(remaining)), nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+)
+
+// newReplacementPrompt returns a decision callback that asks the user to accept,
+// skip, or accept all remaining replacements, once for the accounts and
+// regions that replace an AMI by the same AMI.
+func newReplacementPrompt(in io.Reader, out io.Writer) fileprocessor.DecisionFunc {
+	reader := bufio.NewReader(in)
+
+	return func(replacements []aws.AMIReplacement, files []string) (fileprocessor.Decision, error) {
+		var accounts, regions []string
+
+		for _, replacement := range replacements {
+			accounts = appendMissing(accounts, replacement.Account)
+			regions = appendMissing(regions, replacement.Region)
+		}
+
+		fmt.Fprintf(out, "\n%s -> %s\n", replacements[0].OldAMI, replacements[0].NewAMI)
+		fmt.Fprintf(out, "  Name:    %s\n", replacements[0].Name)
+		fmt.Fprintf(out, "  Account: %s\n", strings.Join(accounts, ", "))
+		fmt.Fprintf(out, "  Region:  %s\n", strings.Join(regions, ", "))
+		fmt.Fprintf(out, "  Files:   %s\n", strings.Join(files, ", "))
+
+		for {
+			fmt.Fprint(out, "Apply this replacement? [y]es/[s]kip/[a]ll: ")
+
+			line, err := reader.ReadString('\n')
+			if err != nil && line == "" {
+				return fileprocessor.DecisionSkip, fmt.Errorf("failed to read response: %w", err)
+			}
+
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "y", "yes":
+				return fileprocessor.DecisionAccept, nil
+			case "s", "skip", "n", "no":
+				return fileprocessor.DecisionSkip, nil
+			case "a", "all":
+				return fileprocessor.DecisionAcceptAll, nil
+			}
+		}
+	}
+}
+
+// newFilePrompt returns a confirmation callback that shows the diff of a file
+// and asks the user to write it, skip it, write all remaining files, or quit.
+func newFilePrompt(in io.Reader, out io.Writer) fileprocessor.ConfirmFunc {
+	reader := bufio.NewReader(in)
+
+	return func(_, diff string) (fileprocessor.Decision, error) {
+		fmt.Fprintf(out, "\n%s", diff)
+
+		for {
+			fmt.Fprint(out, "Write this file? [y]es/[n]o/[a]ll/[q]uit: ")
+
+			line, err := reader.ReadString('\n')
+			if err != nil && line == "" {
+				return fileprocessor.DecisionQuit, fmt.Errorf("failed to read response: %w", err)
+			}
+
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "y", "yes":
+				return fileprocessor.DecisionAccept, nil
+			case "n", "no", "s", "skip":
+				return fileprocessor.DecisionSkip, nil
+			case "a", "all":
+				return fileprocessor.DecisionAcceptAll, nil
+			case "q", "quit":
+				return fileprocessor.DecisionQuit, nil
+			}
+		}
+	}
+}
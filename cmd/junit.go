@@ -0,0 +1,50 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"log/slog"
+	"slices"
+
+	"github.com/schnauzersoft/ami-util/internal/junit"
+	"github.com/schnauzersoft/ami-util/internal/results"
+
+	"github.com/spf13/viper"
+)
+
+// writeJUnit writes the JUnit XML report of a finished run. Files that
+// reference AMIs but were not processed are reported as up to date. Failing
+// to write the report does not fail the run.
+func writeJUnit(summary *results.Summary) {
+	path := viper.GetString("report_junit")
+	if path == "" {
+		return
+	}
+
+	var files []string
+
+	// Without a configuration, the run stopped before reaching any file
+	if cfg != nil && len(summary.Paths) > 0 {
+		references, err := newFileProcessor().ScanPath(summary.Paths...)
+		if err != nil {
+			slog.Warn("Failed to scan files for JUnit report", "error", err)
+		}
+
+		for _, reference := range references {
+			if !slices.Contains(files, reference.File) {
+				files = append(files, reference.File)
+			}
+		}
+	}
+
+	err := junit.WriteFile(path, junit.New(summary, files))
+	if err != nil {
+		slog.Warn("Failed to write JUnit report", "path", path, "error", err)
+
+		return
+	}
+
+	slog.Debug("JUnit report written", "path", path)
+}
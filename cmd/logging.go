@@ -0,0 +1,59 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/schnauzersoft/ami-util/internal/config"
+	"github.com/schnauzersoft/ami-util/internal/exitcode"
+	"github.com/schnauzersoft/ami-util/internal/logging"
+	"github.com/schnauzersoft/ami-util/internal/progress"
+
+	"github.com/spf13/viper"
+)
+
+// warnings records the warnings logged during strict runs.
+var warnings *logging.Recorder
+
+// setupLogging makes the logger configured by log_format, and log_level or
+// else verbose and quiet, the default, for slog and the log package alike,
+// before any command runs. Logs go to stderr, kept clear of the progress bar,
+// which is only reported along with info logs.
+func setupLogging(ctx context.Context) error {
+	// Read the configuration file; the command reports one that fails to load
+	_, _ = config.LoadConfig(ctx)
+
+	var err error
+
+	level := logging.VerbosityLevel(viper.GetInt("verbose"), viper.GetBool("quiet"))
+
+	name := viper.GetString("log_level")
+	if name != "" {
+		level, err = logging.ParseLevel(name)
+		if err != nil {
+			return exitcode.Config(fmt.Errorf("invalid logging configuration: %w", err))
+		}
+	}
+
+	logger, err := logging.New(progress.Writer(), viper.GetString("log_format"), level)
+	if err != nil {
+		return exitcode.Config(fmt.Errorf("invalid logging configuration: %w", err))
+	}
+
+	progress.SetEnabled(!viper.GetBool("no_progress") && level <= slog.LevelInfo)
+
+	// Strict runs keep the warnings to fail with them
+	if viper.GetBool("strict") {
+		warnings = logging.NewRecorder(logger.Handler())
+		logger = slog.New(warnings)
+	}
+
+	slog.SetDefault(logger)
+
+	return nil
+}
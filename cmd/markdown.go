@@ -0,0 +1,32 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/schnauzersoft/ami-util/internal/markdown"
+	"github.com/schnauzersoft/ami-util/internal/results"
+
+	"github.com/spf13/viper"
+)
+
+// writeMarkdownSummary writes the Markdown summary of a finished run.
+// Failing to do so does not fail the run.
+func writeMarkdownSummary(summary *results.Summary) {
+	path := viper.GetString("summary_md")
+	if path == "" {
+		return
+	}
+
+	err := markdown.WriteFile(path, summary)
+	if err != nil {
+		slog.Warn("Failed to write Markdown summary", "path", path, "error", err)
+
+		return
+	}
+
+	slog.Debug("Markdown summary written", "path", path)
+}
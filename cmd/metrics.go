@@ -0,0 +1,50 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/config"
+	"github.com/schnauzersoft/ami-util/internal/metrics"
+	"github.com/schnauzersoft/ami-util/internal/results"
+
+	"github.com/spf13/viper"
+)
+
+// writeMetrics writes the metrics of a finished run to the configured
+// textfile collector file and Pushgateway. Failing to do so does not fail
+// the run.
+func writeMetrics(ctx context.Context, summary *results.Summary) {
+	file := viper.GetString("metrics_file")
+	gateway := viper.GetString("metrics_pushgateway")
+
+	if file == "" && gateway == "" {
+		return
+	}
+
+	run := metrics.New(summary, config.ParseTags(viper.GetStringSlice("metrics_labels")), aws.APICalls())
+
+	if file != "" {
+		err := metrics.WriteFile(file, run)
+		if err != nil {
+			slog.Warn("Failed to write metrics", "path", file, "error", err)
+		} else {
+			slog.Debug("Metrics written", "path", file)
+		}
+	}
+
+	if gateway != "" {
+		// Push even when the run was interrupted
+		err := metrics.Push(context.WithoutCancel(ctx), gateway, run)
+		if err != nil {
+			slog.Warn("Failed to push metrics", "url", gateway, "error", err)
+		} else {
+			slog.Debug("Metrics pushed", "url", gateway)
+		}
+	}
+}
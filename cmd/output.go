@@ -0,0 +1,49 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/schnauzersoft/ami-util/internal/exitcode"
+	"github.com/schnauzersoft/ami-util/internal/results"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+var ErrUnsupportedOutput = errors.New("unsupported output format")
+
+func validateOutputFormat() error {
+	if outputFormat != outputText && outputFormat != outputJSON {
+		return exitcode.Config(fmt.Errorf("%w: %s (must be %s or %s)", ErrUnsupportedOutput, outputFormat,
+			outputText, outputJSON))
+	}
+
+	return nil
+}
+
+// displayOutput returns where diffs and prompts are written: stdout, unless
+// stdout is reserved for the JSON results.
+func displayOutput() *os.File {
+	if outputFormat == outputJSON {
+		return os.Stderr
+	}
+
+	return os.Stdout
+}
+
+// writeSummary writes the JSON results of a finished run.
+func writeSummary(summary *results.Summary) {
+	err := summary.Write(os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+)
+
+// handlePackerFilters resolves the source_ami_filter blocks of the Packer
+// templates in the target files instead of rewriting them, reporting the AMI
+// each filter selects and warning when it selects nothing, is ambiguous, or
+// selects an AMI that has a newer replacement. Filters are resolved in the
+// region of their source, or the first target region.
+func handlePackerFilters(ctx context.Context, res *resolution) error {
+	filters, err := res.fileProcessor.FindPackerSourceFilters(res.paths...)
+	if err != nil {
+		return fmt.Errorf("failed to find Packer source filters: %w", err)
+	}
+
+	newer := make(map[string]string, len(res.replacements))
+	for _, replacement := range res.replacements {
+		newer[replacement.OldAMI] = replacement.NewAMI
+	}
+
+	for _, filter := range filters {
+		region := filter.Region
+		if region == "" && len(res.regions) > 0 {
+			region = res.regions[0]
+		}
+
+		if region == "" {
+			slog.Warn("No region to resolve Packer source filters in")
+
+			return nil
+		}
+
+		ami, err := res.awsClient.ResolveSourceAMIFilter(ctx, region, filter.SourceAMIFilter)
+		reportPackerFilter(filter, region, ami, newer, err)
+	}
+
+	return nil
+}
+
+func reportPackerFilter(filter fileprocessor.PackerSourceFilter, region string, ami *aws.AMIInfo,
+	newer map[string]string, err error,
+) {
+	location := []any{"file", filter.File, "line", filter.Line, "source", filter.Source, "region", region}
+
+	switch {
+	case errors.Is(err, aws.ErrAMINotFound):
+		slog.Warn("source_ami_filter matches no AMI", location...)
+	case err != nil:
+		slog.Warn("Failed to resolve source_ami_filter", append(location, "error", err)...)
+	case newer[ami.ImageID] != "":
+		slog.Warn("source_ami_filter resolves to an AMI that is replaced", append(location, "ami", ami.ImageID,
+			"name", ami.Name, "new_ami", newer[ami.ImageID])...)
+	default:
+		slog.Info("source_ami_filter resolves to an AMI", append(location, "ami", ami.ImageID, "name", ami.Name)...)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	publishUpdated      = "updated"
+	publishUnchanged    = "unchanged"
+	publishWouldPublish = "would publish"
+	publishMissing      = "MISSING"
+	publishError        = "ERROR"
+)
+
+var (
+	ErrNoPublishParameters = errors.New("no publish_parameters configured")
+	ErrPublishFailed       = errors.New("failed to publish some parameters")
+)
+
+var publishDryRun bool
+
+// publishCmd represents the publish command.
+var publishCmd = &cobra.Command{
+	Use:   "publish",
+	Short: "Publish the latest AMI for each pattern to SSM Parameter Store",
+	Long: `Publish the latest AMI for each pattern to SSM Parameter Store.
+
+For every entry in publish_parameters, the newest AMI matching its pattern is
+resolved in each account and region and written to the SSM parameter in that
+account and region, assuming the same roles used for lookups. Parameters that
+already hold the latest AMI are left unchanged. The configuration is
+validated before any parameter is written, and the command exits non-zero
+when any parameter could not be published.
+
+Examples:
+  ami-util publish --account-ids 123456789012 --regions us-east-1,eu-west-1
+  ami-util publish --dry-run`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		err := runPublish(cmd.Context())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(publishCmd)
+
+	publishCmd.Flags().BoolVar(&publishDryRun, "dry-run", false,
+		"Show which parameters would change without writing them")
+}
+
+func runPublish(ctx context.Context) error {
+	var err error
+
+	cfg, err = config.LoadConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if len(cfg.PublishParameters) == 0 {
+		return ErrNoPublishParameters
+	}
+
+	// Publishing updates no files, but every parameter is checked before any
+	// is written
+	err = errors.Join(config.DiagnoseWithoutFiles(cfg)...)
+	if err != nil {
+		return fmt.Errorf("configuration validation failed: %w", err)
+	}
+
+	if !cfg.HasAccounts() {
+		return config.ErrNoAccountID
+	}
+
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	regions := targetRegions(awsClient)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, tableColumnPadding, ' ', 0)
+
+	fmt.Fprintln(writer, "ACCOUNT\tREGION\tPARAMETER\tAMI\tSTATUS")
+
+	failed := false
+
+	for _, accountID := range cfg.Accounts {
+		for _, region := range regionsFor(accountID, regions) {
+			for _, parameter := range cfg.PublishParameters {
+				ami, status := publishParameter(ctx, awsClient, accountID, region, parameter)
+				if status != publishUpdated && status != publishUnchanged && status != publishWouldPublish {
+					failed = true
+				}
+
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", accountID, region, parameter.Parameter, ami, status)
+			}
+		}
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write publish results: %w", err)
+	}
+
+	if failed {
+		return ErrPublishFailed
+	}
+
+	return nil
+}
+
+// publishParameter resolves the latest AMI for a parameter's pattern and
+// writes it, returning the AMI and the status to report.
+func publishParameter(ctx context.Context, awsClient *aws.Client, accountID, region string,
+	parameter config.PublishParameter,
+) (string, string) {
+	latest, err := awsClient.FindLatestAMI(ctx, accountID, region, parameter.Pattern)
+
+	switch {
+	case errors.Is(err, aws.ErrAMINotFound):
+		return "-", publishMissing
+	case err != nil:
+		return "-", fmt.Sprintf("%s: %v", publishError, err)
+	case publishDryRun:
+		return latest.ImageID, publishWouldPublish
+	}
+
+	updated, err := awsClient.PublishSSMParameter(ctx, accountID, region, parameter.Parameter, latest.ImageID)
+	if err != nil {
+		return latest.ImageID, fmt.Sprintf("%s: %v", publishError, err)
+	}
+
+	if !updated {
+		return latest.ImageID, publishUnchanged
+	}
+
+	return latest.ImageID, publishUpdated
+}
@@ -0,0 +1,92 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+)
+
+// accountRegions holds the regions discovered for each account when
+// all_regions is set. Accounts without an entry use the target regions.
+var accountRegions map[string][]string
+
+// discoverAccountRegions looks up the regions enabled for every account.
+// Owner aliases are not real accounts, so they use the regions enabled for
+// the base credentials.
+func discoverAccountRegions(ctx context.Context, awsClient *aws.Client) error {
+	accountRegions = make(map[string][]string, len(cfg.Accounts))
+
+	for _, accountID := range cfg.Accounts {
+		// Accounts with configured regions need no lookup
+		if _, ok := cfg.AccountRegions[accountID]; ok {
+			continue
+		}
+
+		lookupAccount := accountID
+		if aws.IsOwnerAlias(accountID) {
+			lookupAccount = ""
+		}
+
+		regions, err := awsClient.ListEnabledRegions(ctx, lookupAccount)
+		if err != nil {
+			return fmt.Errorf("failed to list enabled regions for account %s: %w", accountID, err)
+		}
+
+		slog.Debug("Listed enabled regions", "account", accountID, "regions", len(regions))
+
+		accountRegions[accountID] = regions
+	}
+
+	return nil
+}
+
+// discoverTargetRegions discovers the regions of the accounts of the current
+// target when all_regions is set for it, and otherwise forgets those
+// discovered for another target.
+func discoverTargetRegions(ctx context.Context, awsClient *aws.Client) error {
+	if !cfg.AllRegions {
+		accountRegions = nil
+
+		return nil
+	}
+
+	return discoverAccountRegions(ctx, awsClient)
+}
+
+// regionsFor returns the regions to search for an account: those configured
+// for it in account_regions, those discovered for it, or the target regions.
+func regionsFor(accountID string, regions []string) []string {
+	if configured, ok := cfg.AccountRegions[accountID]; ok {
+		return configured
+	}
+
+	if discovered, ok := accountRegions[accountID]; ok {
+		return discovered
+	}
+
+	return regions
+}
+
+// discoveredRegions returns every region discovered for any account.
+func discoveredRegions() []string {
+	var regions []string
+
+	for _, discovered := range accountRegions {
+		for _, region := range discovered {
+			if !slices.Contains(regions, region) {
+				regions = append(regions, region)
+			}
+		}
+	}
+
+	slices.Sort(regions)
+
+	return regions
+}
@@ -0,0 +1,83 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/schnauzersoft/ami-util/internal/report"
+
+	"github.com/spf13/cobra"
+)
+
+var reportFormat string
+
+// reportCmd represents the report command.
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Report available AMI replacements without modifying files",
+	Long: `Resolve the latest AMIs and print a structured report of the replacements
+that would be made, without modifying any files.
+
+Each entry lists the old AMI, the new AMI, the image name, the account and
+region it was resolved in, and the files that reference the old AMI.
+
+Examples:
+  ami-util report --file config.yaml
+  ami-util report --file ./infra --format json
+  ami-util report --file ./infra --format yaml
+  ami-util report --file ./infra --format csv`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		err := runReport(cmd.Context())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+
+	reportCmd.Flags().StringVar(&reportFormat, "format", report.FormatTable, "Output format (table, json, yaml, csv)")
+}
+
+func runReport(ctx context.Context) error {
+	// An unknown format fails before any AMI is looked up
+	err := report.CheckFormat(reportFormat)
+	if err != nil {
+		return err
+	}
+
+	res, err := resolveReplacements(ctx)
+	if err != nil {
+		return err
+	}
+
+	references, err := res.fileProcessor.ScanPath(res.paths...)
+	if err != nil {
+		return fmt.Errorf("failed to scan %s: %w", strings.Join(res.paths, ", "), err)
+	}
+
+	replacementReport := report.New(res.replacements, references)
+
+	attention, err := findAttention(ctx, res)
+	if err != nil {
+		return err
+	}
+
+	replacementReport.AddAttention(attention)
+
+	err = replacementReport.Write(os.Stdout, reportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	return nil
+}
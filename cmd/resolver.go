@@ -0,0 +1,131 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/progress"
+	"github.com/schnauzersoft/ami-util/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// resolveTask is a single account and region to resolve the latest AMIs in,
+// or a single AMI ID to resolve the equivalents of.
+type resolveTask struct {
+	accountID string
+	region    string
+	amiID     string
+}
+
+// resolveFunc resolves the replacements for a single task.
+type resolveFunc func(ctx context.Context, task resolveTask) ([]aws.AMIReplacement, error)
+
+type resolveResult struct {
+	task         resolveTask
+	replacements []aws.AMIReplacement
+	err          error
+}
+
+// runResolveTasks resolves every task using at most cfg.MaxConcurrency workers,
+// reporting their progress as the phase name. Results are returned in the
+// same order as the tasks.
+func runResolveTasks(ctx context.Context, name string, tasks []resolveTask, resolve resolveFunc,
+) []resolveResult {
+	results := make([]resolveResult, len(tasks))
+	indexes := make(chan int)
+
+	workers := min(max(cfg.MaxConcurrency, 1), len(tasks))
+
+	phase := progress.Start(name, "lookups", len(tasks))
+
+	var wg sync.WaitGroup
+
+	for range workers {
+		wg.Go(func() {
+			for index := range indexes {
+				task := tasks[index]
+
+				err := ctx.Err()
+				if err != nil {
+					results[index] = resolveResult{task: task, err: err}
+
+					continue
+				}
+
+				replacements, err := traceResolve(ctx, name, task, resolve)
+				results[index] = resolveResult{task: task, replacements: replacements, err: err}
+
+				phase.Step()
+			}
+		})
+	}
+
+	for index := range tasks {
+		indexes <- index
+	}
+
+	close(indexes)
+	wg.Wait()
+	phase.Finish()
+
+	return results
+}
+
+// traceResolve resolves the replacements for a single task in a span named
+// after its phase, which the spans of the AWS calls made for it are under.
+func traceResolve(ctx context.Context, name string, task resolveTask, resolve resolveFunc,
+) ([]aws.AMIReplacement, error) {
+	attributes := []attribute.KeyValue{semconv.CloudAccountID(task.accountID), semconv.CloudRegion(task.region)}
+	if task.amiID != "" {
+		attributes = append(attributes, tracing.AMIKey.String(task.amiID))
+	}
+
+	ctx, span := tracing.Start(ctx, name, attributes...)
+
+	replacements, err := resolve(ctx, task)
+	span.SetAttributes(tracing.ReplacementsKey.Int(len(replacements)))
+	tracing.End(span, err)
+
+	return replacements, err
+}
+
+// resolveInUseAMI resolves the replacement for an AMI used by a resource in
+// resourceAccount, trying each configured account as the AMI's owner. It
+// reports false when the AMI is already the newest or is pinned. The
+// replacement must be launchable by resourceAccount as well as by the
+// configured launch accounts, and pass the Inspector check.
+func resolveInUseAMI(ctx context.Context, awsClient *aws.Client, region, amiID, resourceAccount string,
+) (aws.AMIReplacement, bool, error) {
+	for _, owner := range cfg.Accounts {
+		replacements, err := awsClient.GetLatestAMIs(ctx, owner, region, []string{amiID})
+		if err != nil {
+			return aws.AMIReplacement{}, false, err
+		}
+
+		replacements = filterPinned(replacements)
+		if len(replacements) == 0 {
+			continue
+		}
+
+		replacement := replacements[0]
+
+		launchAccounts := append(slices.Clone(cfg.LaunchAccounts), resourceAccount)
+
+		err = checkReplacementAMI(ctx, awsClient, owner, region, replacement.NewAMI, launchAccounts)
+		if err != nil {
+			return aws.AMIReplacement{}, false, err
+		}
+
+		return replacement, true, nil
+	}
+
+	return aws.AMIReplacement{}, false, nil
+}
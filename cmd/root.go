@@ -5,14 +5,25 @@ Copyright © 2025 Ben Sapp ya.bsapp.ru
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/schnauzersoft/ami-util/internal/aws"
 	"github.com/schnauzersoft/ami-util/internal/config"
+	"github.com/schnauzersoft/ami-util/internal/exitcode"
 	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+	"github.com/schnauzersoft/ami-util/internal/mapping"
+	"github.com/schnauzersoft/ami-util/internal/results"
+	"github.com/schnauzersoft/ami-util/internal/setup"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -24,7 +35,15 @@ var (
 	BuildTime = "unknown"
 )
 
-var cfg *config.Config
+var (
+	cfg           *config.Config
+	interactive   bool
+	exportMapping string
+	outputFormat  string
+	showDiff      bool
+	diffOnly      bool
+	confirm       bool
+)
 
 // rootCmd represents the base command when called without any subcommands.
 var rootCmd = &cobra.Command{
@@ -43,7 +62,7 @@ Configuration:
   3. Configuration file (ami.yaml, ami.yml, or ami.toml)
   4. Default values
 
-  Configuration file locations (searched in order):
+  Configuration file locations (searched in order, unless --config names one):
   - ./ami.yaml (or .yml, .toml)
   - $HOME/.ami-util/ami.yaml
   - /etc/ami-util/ami.yaml
@@ -77,22 +96,57 @@ Examples:
   
   # Mixed usage
   ami-util --account-ids 123456789012 --file config.yaml --profile myprofile`,
-	Run: func(_ *cobra.Command, _ []string) {
-		err := runUpdate()
+	PersistentPreRun: func(cmd *cobra.Command, _ []string) {
+		err := setupLogging(cmd.Context())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(exitcode.ConfigError)
+		}
+
+		startTracing(cmd)
+	},
+	Run: func(cmd *cobra.Command, _ []string) {
+		summary := results.New(time.Now())
+
+		err := runUpdate(cmd.Context(), summary)
+		summary.ExitCode = exitcode.For(err, summary.Changed(), summary.Failures())
+		summary.Finish(time.Now(), err)
+
+		writeMetrics(cmd.Context(), summary)
+		writeJUnit(summary)
+		writeMarkdownSummary(summary)
+		writeCSVReport(summary)
+
+		if outputFormat == outputJSON {
+			writeSummary(summary)
+		}
+
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		}
+
+		if summary.ExitCode != exitcode.UpToDate {
+			exit(summary.ExitCode)
 		}
 	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Interrupts and SIGTERM cancel the context passed to every command.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	err := rootCmd.ExecuteContext(ctx)
+
+	stop()
+
+	// Commands exit themselves, so errors here are command line errors
 	if err != nil {
-		os.Exit(1)
+		exit(exitcode.ConfigError)
 	}
+
+	endTracing(exitcode.UpToDate)
 }
 
 func init() {
@@ -108,6 +162,9 @@ func init() {
 	viper.AutomaticEnv()
 
 	// Bind environment variables
+	_ = viper.BindEnv("config", "AMI_CONFIG")
+	_ = viper.BindEnv("config_sha256", "AMI_CONFIG_SHA256")
+	_ = viper.BindEnv("env", "AMI_ENV")
 	_ = viper.BindEnv("accounts", "AMI_ACCOUNTS")
 	_ = viper.BindEnv("file", "AMI_FILE")
 	_ = viper.BindEnv("profile", "AMI_PROFILE")
@@ -115,209 +172,1034 @@ func init() {
 	_ = viper.BindEnv("regions", "AMI_REGIONS")
 	_ = viper.BindEnv("role_arn", "AMI_ROLE_ARN")
 	_ = viper.BindEnv("patterns", "AMI_PATTERNS")
+	_ = viper.BindEnv("pins", "AMI_PINS")
+	_ = viper.BindEnv("retry_max_attempts", "AMI_RETRY_MAX_ATTEMPTS")
+	_ = viper.BindEnv("retry_mode", "AMI_RETRY_MODE")
+	_ = viper.BindEnv("retry_max_backoff", "AMI_RETRY_MAX_BACKOFF")
+	_ = viper.BindEnv("retry_quota", "AMI_RETRY_QUOTA")
+	_ = viper.BindEnv("no_retry_rate_limit", "AMI_NO_RETRY_RATE_LIMIT")
+	_ = viper.BindEnv("aws_timeout", "AMI_AWS_TIMEOUT")
+	_ = viper.BindEnv("max_concurrency", "AMI_MAX_CONCURRENCY")
+	_ = viper.BindEnv("file_workers", "AMI_FILE_WORKERS")
+	_ = viper.BindEnv("sso_profile", "AMI_SSO_PROFILE")
+	_ = viper.BindEnv("sso_login", "AMI_SSO_LOGIN")
+	_ = viper.BindEnv("web_identity_token_file", "AMI_WEB_IDENTITY_TOKEN_FILE")
+	_ = viper.BindEnv("endpoint_url", "AMI_ENDPOINT_URL")
+	_ = viper.BindEnv("policy_file", "AMI_POLICY_FILE")
+	_ = viper.BindEnv("launch_accounts", "AMI_LAUNCH_ACCOUNTS")
+	_ = viper.BindEnv("inspector", "AMI_INSPECTOR")
+	_ = viper.BindEnv("inspector_max_critical", "AMI_INSPECTOR_MAX_CRITICAL")
+	_ = viper.BindEnv("inspector_require_scan", "AMI_INSPECTOR_REQUIRE_SCAN")
+	_ = viper.BindEnv("stale_after", "AMI_STALE_AFTER")
+	_ = viper.BindEnv("dynamic_references", "AMI_DYNAMIC_REFERENCES")
+	_ = viper.BindEnv("cdk_context", "AMI_CDK_CONTEXT")
+	_ = viper.BindEnv("image_builder", "AMI_IMAGE_BUILDER")
+	_ = viper.BindEnv("role_arn_template", "AMI_ROLE_ARN_TEMPLATE")
+	_ = viper.BindEnv("mfa_serial", "AMI_MFA_SERIAL")
+	_ = viper.BindEnv("mfa_token", "AMI_MFA_TOKEN")
+	_ = viper.BindEnv("mfa_token_command", "AMI_MFA_TOKEN_COMMAND")
+	_ = viper.BindEnv("duration_seconds", "AMI_DURATION_SECONDS")
+	_ = viper.BindEnv("session_tags", "AMI_SESSION_TAGS")
+	_ = viper.BindEnv("transitive_tag_keys", "AMI_TRANSITIVE_TAG_KEYS")
+	_ = viper.BindEnv("source_identity", "AMI_SOURCE_IDENTITY")
+	_ = viper.BindEnv("architecture", "AMI_ARCHITECTURE")
+	_ = viper.BindEnv("virtualization_type", "AMI_VIRTUALIZATION_TYPE")
+	_ = viper.BindEnv("root_device_type", "AMI_ROOT_DEVICE_TYPE")
+	_ = viper.BindEnv("version_regex", "AMI_VERSION_REGEX")
+	_ = viper.BindEnv("exclude_patterns", "AMI_EXCLUDE_PATTERNS")
+	_ = viper.BindEnv("min_age", "AMI_MIN_AGE")
+	_ = viper.BindEnv("accounts_from_org", "AMI_ACCOUNTS_FROM_ORG")
+	_ = viper.BindEnv("all_regions", "AMI_ALL_REGIONS")
+	_ = viper.BindEnv("yaml_keys", "AMI_YAML_KEYS")
+	_ = viper.BindEnv("hcl", "AMI_HCL")
+	_ = viper.BindEnv("hcl_attributes", "AMI_HCL_ATTRIBUTES")
+	_ = viper.BindEnv("ansible", "AMI_ANSIBLE")
+	_ = viper.BindEnv("gitignore", "AMI_GITIGNORE")
+	_ = viper.BindEnv("max_depth", "AMI_MAX_DEPTH")
+	_ = viper.BindEnv("follow_symlinks", "AMI_FOLLOW_SYMLINKS")
+	_ = viper.BindEnv("no_backup", "AMI_NO_BACKUP")
+	_ = viper.BindEnv("backup_dir", "AMI_BACKUP_DIR")
+	_ = viper.BindEnv("backup_keep", "AMI_BACKUP_KEEP")
+	_ = viper.BindEnv("provenance_comments", "AMI_PROVENANCE_COMMENTS")
+	_ = viper.BindEnv("git_branch", "AMI_GIT_BRANCH")
+	_ = viper.BindEnv("git_commit", "AMI_GIT_COMMIT")
+	_ = viper.BindEnv("git_push", "AMI_GIT_PUSH")
+	_ = viper.BindEnv("git_remote", "AMI_GIT_REMOTE")
+	_ = viper.BindEnv("github_pr", "AMI_GITHUB_PR")
+	_ = viper.BindEnv("github_base", "AMI_GITHUB_BASE")
+	_ = viper.BindEnv("log_format", "AMI_LOG_FORMAT")
+	_ = viper.BindEnv("log_level", "AMI_LOG_LEVEL")
+	_ = viper.BindEnv("quiet", "AMI_QUIET")
+	_ = viper.BindEnv("no_progress", "AMI_NO_PROGRESS")
+	_ = viper.BindEnv("strict", "AMI_STRICT")
+	_ = viper.BindEnv("metrics_file", "AMI_METRICS_FILE")
+	_ = viper.BindEnv("metrics_pushgateway", "AMI_METRICS_PUSHGATEWAY")
+	_ = viper.BindEnv("metrics_labels", "AMI_METRICS_LABELS")
+	_ = viper.BindEnv("audit_log", "AMI_AUDIT_LOG")
+	_ = viper.BindEnv("report_junit", "AMI_REPORT_JUNIT")
+	_ = viper.BindEnv("summary_md", "AMI_SUMMARY_MD")
+	_ = viper.BindEnv("report_csv", "AMI_REPORT_CSV")
+	_ = viper.BindEnv("org_units", "AMI_ORG_UNITS")
+	_ = viper.BindEnv("org_account_tags", "AMI_ORG_ACCOUNT_TAGS")
 
 	// Set default values
 	viper.SetDefault("profile", "default")
-	viper.SetDefault("verbose", false)
+	viper.SetDefault("verbose", 0)
+	viper.SetDefault("max_concurrency", config.DefaultMaxConcurrency)
+	viper.SetDefault("file_workers", config.DefaultFileWorkers)
+	viper.SetDefault("git_remote", config.DefaultGitRemote)
 
 	// Define flags
-	rootCmd.Flags().StringSlice("account-ids", []string{}, "Comma-separated list of AWS account IDs")
-	rootCmd.Flags().String("file", "", "Path to the configuration file to update")
-	rootCmd.Flags().String("profile", "default", "AWS profile to use for authentication")
-	rootCmd.Flags().Bool("verbose", false, "Enable verbose output")
-	rootCmd.Flags().StringSlice("regions", []string{},
+	rootCmd.PersistentFlags().String("config", "",
+		"Configuration file, S3 object (s3://bucket/key), or HTTPS URL to use instead of searching for ami.yaml")
+	rootCmd.PersistentFlags().String("config-sha256", "",
+		"SHA-256 checksum the --config file must have")
+	rootCmd.PersistentFlags().String("env", "",
+		"Environment from the configuration file's environments whose settings override the top-level ones")
+	rootCmd.PersistentFlags().StringSlice("account-ids", []string{},
+		"Comma-separated list of AWS account IDs or owner aliases (amazon, self, aws-marketplace)")
+	rootCmd.PersistentFlags().Bool("accounts-from-org", false,
+		"Add the active accounts of the AWS Organization to the account IDs")
+	rootCmd.PersistentFlags().StringSlice("org-units", []string{},
+		"Only discover accounts under these OU or root IDs, at any depth (with --accounts-from-org)")
+	rootCmd.PersistentFlags().StringSlice("org-account-tags", []string{},
+		"Only discover accounts with this Key=Value tag (with --accounts-from-org, can be repeated)")
+	rootCmd.PersistentFlags().StringSlice("file", []string{},
+		"File, directory, or glob pattern to update (can be repeated)")
+	rootCmd.PersistentFlags().String("profile", "default", "AWS profile to use for authentication")
+	rootCmd.PersistentFlags().CountP("verbose", "v",
+		"Log per-account and per-region progress, or per-file detail too when repeated (-vv)")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Only log warnings and errors")
+	rootCmd.PersistentFlags().Bool("no-progress", false,
+		"Do not draw a progress bar on terminals or log progress lines periodically elsewhere")
+	rootCmd.PersistentFlags().Bool("strict", false,
+		"Fail the run on any warning or unresolved AMI, before writing files")
+	rootCmd.PersistentFlags().String("log-format", "", "Log format: text or json (default text)")
+	rootCmd.PersistentFlags().String("log-level", "",
+		"Minimum log level: trace, debug, info, warn, or error (overrides --verbose and --quiet)")
+	rootCmd.PersistentFlags().String("metrics-file", "",
+		"Write run metrics to this .prom file for the node exporter's textfile collector")
+	rootCmd.PersistentFlags().String("metrics-pushgateway", "",
+		"Push run metrics to the Prometheus Pushgateway at this URL")
+	rootCmd.PersistentFlags().StringSlice("metrics-labels", []string{},
+		"name=value label added to every metric and to the Pushgateway group (can be repeated)")
+	rootCmd.PersistentFlags().String("audit-log", "",
+		"Append every replacement written to files to this JSON lines audit log")
+	rootCmd.PersistentFlags().String("report-junit", "",
+		"Write a JUnit XML report with a test case per file, failed when its AMI IDs are outdated")
+	rootCmd.PersistentFlags().String("summary-md", "",
+		"Write a Markdown summary of the replacements, affected files, and skipped items to this file")
+	rootCmd.PersistentFlags().String("report-csv", "",
+		"Write the replacements, with the AMIs' creation dates and the files affected, to this CSV file")
+	rootCmd.PersistentFlags().StringSlice("regions", []string{},
 		"Comma-separated list of AWS regions to search (if not specified, will use region from AWS profile)")
-	rootCmd.Flags().String("role-arn", "", "Role ARN to assume (overrides AWS_ROLE_ARN env var)")
-	rootCmd.Flags().StringSlice("patterns", []string{}, "Comma-separated list of AMI name patterns to search for")
+	rootCmd.PersistentFlags().Bool("all-regions", false,
+		"Search every region enabled for each account instead of --regions")
+	rootCmd.PersistentFlags().String("role-arn", "", "Role ARN to assume (overrides AWS_ROLE_ARN env var)")
+	rootCmd.PersistentFlags().String("role-arn-template", "",
+		"Role ARN to assume per account, with {{account_id}} replaced by each account ID")
+	rootCmd.PersistentFlags().StringSlice("patterns", []string{},
+		"Comma-separated list of AMI name patterns to search for")
+	rootCmd.PersistentFlags().String("arch", "",
+		"Only consider candidate AMIs with this architecture (i386, x86_64, arm64, x86_64_mac, arm64_mac)")
+	rootCmd.PersistentFlags().StringSlice("launch-accounts", []string{},
+		"Account IDs that must be able to launch replacement AMIs (owner, shared, or public)")
+	rootCmd.PersistentFlags().Bool("inspector", false,
+		"Skip replacement AMIs with more critical Amazon Inspector findings than --inspector-max-critical")
+	rootCmd.PersistentFlags().Int("inspector-max-critical", 0,
+		"Most critical Inspector findings a replacement AMI may have (with --inspector)")
+	rootCmd.PersistentFlags().Bool("inspector-require-scan", false,
+		"Also skip replacement AMIs that Inspector has no findings for (with --inspector)")
+	rootCmd.PersistentFlags().Duration("stale-after", 0,
+		"Also report referenced AMIs older than this without a replacement (e.g. 4320h)")
+	rootCmd.PersistentFlags().Duration("min-age", 0,
+		"Only consider candidate AMIs created at least this long ago (e.g. 48h)")
+	rootCmd.PersistentFlags().StringSlice("yaml-keys", []string{},
+		"Only update AMI IDs in YAML files under these dot-separated key paths (e.g. image_id,spec.amiID)")
+	rootCmd.PersistentFlags().Bool("hcl", false,
+		"Only update AMI IDs in Terraform files assigned to --hcl-attributes, and report resource addresses")
+	rootCmd.PersistentFlags().StringSlice("hcl-attributes", fileprocessor.DefaultHCLAttributes,
+		"Terraform attributes whose AMI IDs are updated with --hcl")
+	rootCmd.PersistentFlags().Bool("ansible", false,
+		"Only update AMI IDs in YAML files used by ec2_instance and ec2_launch_template tasks and vars files")
+	rootCmd.PersistentFlags().Bool("gitignore", false,
+		"Skip files and directories ignored by .gitignore files when searching directories")
+	rootCmd.PersistentFlags().Int("max-depth", 0,
+		"Only search files at most this many directory levels deep, where 1 is the directory's own files (0 for no limit)")
+	rootCmd.PersistentFlags().Bool("follow-symlinks", false,
+		"Descend into symlinked directories when searching directories, walking each directory once")
+	rootCmd.PersistentFlags().Bool("no-backup", false,
+		"Update files without saving backups of their original content")
+	rootCmd.PersistentFlags().String("backup-dir", "",
+		"Save backups under this directory, mirroring the updated files' paths, instead of next to them")
+	rootCmd.PersistentFlags().Int("backup-keep", 0,
+		"Save timestamped backups and keep this many per file (0 keeps a single backup, replaced on every run)")
+	rootCmd.PersistentFlags().Bool("provenance-comments", false,
+		"Append a comment to each updated line with the AMI it held before, the new AMI's name, and the date")
+	rootCmd.PersistentFlags().StringSlice("pin", []string{},
+		"AMI ID or name pattern that must never be replaced (can be repeated)")
+	rootCmd.PersistentFlags().Int("max-concurrency", config.DefaultMaxConcurrency,
+		"Maximum number of account/region lookups to run in parallel")
+	rootCmd.PersistentFlags().Int("file-workers", config.DefaultFileWorkers,
+		"Maximum number of files to process in parallel")
+	rootCmd.PersistentFlags().Int("retry-max-attempts", 0,
+		"Maximum attempts per AWS call, including the first (0 uses the SDK default)")
+	rootCmd.PersistentFlags().String("retry-mode", "", "AWS retry mode: standard or adaptive (default standard)")
+	rootCmd.PersistentFlags().Duration("retry-max-backoff", 0,
+		"Maximum backoff delay between retries of an AWS call (0 uses the SDK default)")
+	rootCmd.PersistentFlags().Int("retry-quota", 0,
+		"Retry tokens each AWS call may spend, 5 per retry (0 shares the SDK's 500 between all calls)")
+	rootCmd.PersistentFlags().Bool("no-retry-rate-limit", false,
+		"Do not limit retries with the SDK's retry token bucket shared by all AWS calls")
+	rootCmd.PersistentFlags().Duration("aws-timeout", 0,
+		"Maximum time for each AWS call, including its retries (0 for no limit)")
+	rootCmd.PersistentFlags().String("sso-profile", "",
+		"Profile whose SSO session is checked and refreshed (defaults to --profile)")
+	rootCmd.PersistentFlags().Bool("sso-login", false,
+		"Start the SSO device-code login flow when the SSO session has expired")
+	rootCmd.PersistentFlags().String("mfa-serial", "", "Serial number or ARN of the MFA device required to assume roles")
+	rootCmd.PersistentFlags().String("mfa-token", "", "MFA token code (prompted for when MFA is required and not given)")
+	rootCmd.PersistentFlags().String("mfa-token-command", "", "Command whose output is used as the MFA token code")
+	rootCmd.PersistentFlags().Int("duration-seconds", 0,
+		"Duration of assumed role sessions in seconds, 900 to 43200 (0 uses the STS default of 3600)")
+	rootCmd.PersistentFlags().StringSlice("session-tags", []string{},
+		"Key=Value session tag passed when assuming roles (can be repeated)")
+	rootCmd.PersistentFlags().StringSlice("transitive-tag-keys", []string{},
+		"Session tag key that carries over to chained role sessions (can be repeated)")
+	rootCmd.PersistentFlags().String("source-identity", "", "Source identity set when assuming roles")
+	rootCmd.PersistentFlags().String("web-identity-token-file", "",
+		"OIDC token file used to assume --role-arn via web identity (overrides AWS_WEB_IDENTITY_TOKEN_FILE)")
+	rootCmd.PersistentFlags().String("endpoint-url", "",
+		"Endpoint URL for EC2 and STS calls, such as LocalStack or an interface VPC endpoint")
+	rootCmd.PersistentFlags().String("policy-file", "", "File of CEL rules every replacement AMI must pass")
+
+	rootCmd.Flags().BoolVar(&interactive, "interactive", false,
+		"Prompt to accept or skip each replacement before files are modified")
+	rootCmd.Flags().BoolVar(&showDiff, "show-diff", false,
+		"Print a unified diff of every change made to files")
+	rootCmd.Flags().BoolVar(&diffOnly, "diff-only", false,
+		"Print a unified diff of every change without writing files or saving backups")
+	rootCmd.Flags().BoolVar(&confirm, "confirm", false,
+		"Show the diff of each file and ask before writing it")
+	rootCmd.Flags().StringVar(&exportMapping, "export-mapping", "",
+		"Write the resolved old-to-new AMI mapping to this JSON file")
+	rootCmd.Flags().StringVar(&outputFormat, "output", outputText,
+		"Results format: text, or json for a single JSON document on stdout with logs and diffs on stderr")
+	rootCmd.Flags().String("dynamic-references", "",
+		"Handle CloudFormation SSM dynamic references and FindInMap image IDs: report or rewrite")
+	rootCmd.Flags().String("cdk-context", "",
+		"Handle cached AMI lookups in cdk.context.json files: refresh or delete")
+	rootCmd.Flags().Bool("image-builder", false,
+		"Update Image Builder image and recipe ARNs to their latest versions, along with the AMIs of their builds")
+	addGitFlags(rootCmd.Flags())
 
 	// Bind flags to viper
-	_ = viper.BindPFlag("accounts", rootCmd.Flags().Lookup("account-ids"))
-	_ = viper.BindPFlag("file", rootCmd.Flags().Lookup("file"))
-	_ = viper.BindPFlag("profile", rootCmd.Flags().Lookup("profile"))
-	_ = viper.BindPFlag("verbose", rootCmd.Flags().Lookup("verbose"))
-	_ = viper.BindPFlag("regions", rootCmd.Flags().Lookup("regions"))
-	_ = viper.BindPFlag("role_arn", rootCmd.Flags().Lookup("role-arn"))
-	_ = viper.BindPFlag("patterns", rootCmd.Flags().Lookup("patterns"))
+	_ = viper.BindPFlag("config", rootCmd.PersistentFlags().Lookup("config"))
+	_ = viper.BindPFlag("config_sha256", rootCmd.PersistentFlags().Lookup("config-sha256"))
+	_ = viper.BindPFlag("env", rootCmd.PersistentFlags().Lookup("env"))
+	_ = viper.BindPFlag("accounts", rootCmd.PersistentFlags().Lookup("account-ids"))
+	_ = viper.BindPFlag("accounts_from_org", rootCmd.PersistentFlags().Lookup("accounts-from-org"))
+	_ = viper.BindPFlag("org_units", rootCmd.PersistentFlags().Lookup("org-units"))
+	_ = viper.BindPFlag("org_account_tags", rootCmd.PersistentFlags().Lookup("org-account-tags"))
+	_ = viper.BindPFlag("file", rootCmd.PersistentFlags().Lookup("file"))
+	_ = viper.BindPFlag("profile", rootCmd.PersistentFlags().Lookup("profile"))
+	_ = viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
+	_ = viper.BindPFlag("quiet", rootCmd.PersistentFlags().Lookup("quiet"))
+	_ = viper.BindPFlag("no_progress", rootCmd.PersistentFlags().Lookup("no-progress"))
+	_ = viper.BindPFlag("strict", rootCmd.PersistentFlags().Lookup("strict"))
+	_ = viper.BindPFlag("metrics_file", rootCmd.PersistentFlags().Lookup("metrics-file"))
+	_ = viper.BindPFlag("metrics_pushgateway", rootCmd.PersistentFlags().Lookup("metrics-pushgateway"))
+	_ = viper.BindPFlag("metrics_labels", rootCmd.PersistentFlags().Lookup("metrics-labels"))
+	_ = viper.BindPFlag("audit_log", rootCmd.PersistentFlags().Lookup("audit-log"))
+	_ = viper.BindPFlag("report_junit", rootCmd.PersistentFlags().Lookup("report-junit"))
+	_ = viper.BindPFlag("summary_md", rootCmd.PersistentFlags().Lookup("summary-md"))
+	_ = viper.BindPFlag("report_csv", rootCmd.PersistentFlags().Lookup("report-csv"))
+	_ = viper.BindPFlag("log_format", rootCmd.PersistentFlags().Lookup("log-format"))
+	_ = viper.BindPFlag("log_level", rootCmd.PersistentFlags().Lookup("log-level"))
+	_ = viper.BindPFlag("regions", rootCmd.PersistentFlags().Lookup("regions"))
+	_ = viper.BindPFlag("all_regions", rootCmd.PersistentFlags().Lookup("all-regions"))
+	_ = viper.BindPFlag("role_arn", rootCmd.PersistentFlags().Lookup("role-arn"))
+	_ = viper.BindPFlag("patterns", rootCmd.PersistentFlags().Lookup("patterns"))
+	_ = viper.BindPFlag("yaml_keys", rootCmd.PersistentFlags().Lookup("yaml-keys"))
+	_ = viper.BindPFlag("hcl", rootCmd.PersistentFlags().Lookup("hcl"))
+	_ = viper.BindPFlag("hcl_attributes", rootCmd.PersistentFlags().Lookup("hcl-attributes"))
+	_ = viper.BindPFlag("ansible", rootCmd.PersistentFlags().Lookup("ansible"))
+	_ = viper.BindPFlag("gitignore", rootCmd.PersistentFlags().Lookup("gitignore"))
+	_ = viper.BindPFlag("max_depth", rootCmd.PersistentFlags().Lookup("max-depth"))
+	_ = viper.BindPFlag("follow_symlinks", rootCmd.PersistentFlags().Lookup("follow-symlinks"))
+	_ = viper.BindPFlag("no_backup", rootCmd.PersistentFlags().Lookup("no-backup"))
+	_ = viper.BindPFlag("backup_dir", rootCmd.PersistentFlags().Lookup("backup-dir"))
+	_ = viper.BindPFlag("backup_keep", rootCmd.PersistentFlags().Lookup("backup-keep"))
+	_ = viper.BindPFlag("provenance_comments", rootCmd.PersistentFlags().Lookup("provenance-comments"))
+	_ = viper.BindPFlag("pins", rootCmd.PersistentFlags().Lookup("pin"))
+	_ = viper.BindPFlag("architecture", rootCmd.PersistentFlags().Lookup("arch"))
+	_ = viper.BindPFlag("min_age", rootCmd.PersistentFlags().Lookup("min-age"))
+	_ = viper.BindPFlag("launch_accounts", rootCmd.PersistentFlags().Lookup("launch-accounts"))
+	_ = viper.BindPFlag("inspector", rootCmd.PersistentFlags().Lookup("inspector"))
+	_ = viper.BindPFlag("inspector_max_critical", rootCmd.PersistentFlags().Lookup("inspector-max-critical"))
+	_ = viper.BindPFlag("inspector_require_scan", rootCmd.PersistentFlags().Lookup("inspector-require-scan"))
+	_ = viper.BindPFlag("stale_after", rootCmd.PersistentFlags().Lookup("stale-after"))
+	_ = viper.BindPFlag("max_concurrency", rootCmd.PersistentFlags().Lookup("max-concurrency"))
+	_ = viper.BindPFlag("file_workers", rootCmd.PersistentFlags().Lookup("file-workers"))
+	_ = viper.BindPFlag("retry_max_attempts", rootCmd.PersistentFlags().Lookup("retry-max-attempts"))
+	_ = viper.BindPFlag("retry_mode", rootCmd.PersistentFlags().Lookup("retry-mode"))
+	_ = viper.BindPFlag("retry_max_backoff", rootCmd.PersistentFlags().Lookup("retry-max-backoff"))
+	_ = viper.BindPFlag("retry_quota", rootCmd.PersistentFlags().Lookup("retry-quota"))
+	_ = viper.BindPFlag("no_retry_rate_limit", rootCmd.PersistentFlags().Lookup("no-retry-rate-limit"))
+	_ = viper.BindPFlag("aws_timeout", rootCmd.PersistentFlags().Lookup("aws-timeout"))
+	_ = viper.BindPFlag("sso_profile", rootCmd.PersistentFlags().Lookup("sso-profile"))
+	_ = viper.BindPFlag("sso_login", rootCmd.PersistentFlags().Lookup("sso-login"))
+	_ = viper.BindPFlag("role_arn_template", rootCmd.PersistentFlags().Lookup("role-arn-template"))
+	_ = viper.BindPFlag("mfa_serial", rootCmd.PersistentFlags().Lookup("mfa-serial"))
+	_ = viper.BindPFlag("mfa_token", rootCmd.PersistentFlags().Lookup("mfa-token"))
+	_ = viper.BindPFlag("mfa_token_command", rootCmd.PersistentFlags().Lookup("mfa-token-command"))
+	_ = viper.BindPFlag("duration_seconds", rootCmd.PersistentFlags().Lookup("duration-seconds"))
+	_ = viper.BindPFlag("session_tags", rootCmd.PersistentFlags().Lookup("session-tags"))
+	_ = viper.BindPFlag("transitive_tag_keys", rootCmd.PersistentFlags().Lookup("transitive-tag-keys"))
+	_ = viper.BindPFlag("source_identity", rootCmd.PersistentFlags().Lookup("source-identity"))
+	_ = viper.BindPFlag("web_identity_token_file", rootCmd.PersistentFlags().Lookup("web-identity-token-file"))
+	_ = viper.BindPFlag("endpoint_url", rootCmd.PersistentFlags().Lookup("endpoint-url"))
+	_ = viper.BindPFlag("policy_file", rootCmd.PersistentFlags().Lookup("policy-file"))
+	_ = viper.BindPFlag("dynamic_references", rootCmd.Flags().Lookup("dynamic-references"))
+	_ = viper.BindPFlag("cdk_context", rootCmd.Flags().Lookup("cdk-context"))
+	_ = viper.BindPFlag("image_builder", rootCmd.Flags().Lookup("image-builder"))
+	bindGitFlags(rootCmd.Flags())
+
+	// Register dynamic flag completions
+	_ = rootCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+	_ = rootCmd.RegisterFlagCompletionFunc("regions", completeRegions)
+	_ = rootCmd.RegisterFlagCompletionFunc("account-ids", completeAccountIDs)
 }
 
-func runUpdate() error {
-	// Load and validate configuration
-	err := loadAndValidateConfig()
+// resolution holds the outcome of resolving the latest AMIs for the configured targets.
+type resolution struct {
+	awsClient     *aws.Client
+	fileProcessor *fileprocessor.Processor
+	paths         []string
+	accounts      []string
+	regions       []string
+	replacements  []aws.AMIReplacement
+
+	// targets are the paths of each configured target and the replacements
+	// resolved for them, which only apply to its own paths.
+	targets []resolvedTarget
+
+	// imageBuilderARNs are the latest versions of the outdated Image Builder
+	// ARNs in the paths, keyed by ARN.
+	imageBuilderARNs map[string]string
+
+	// rewritten are the files changed by dynamic reference, Image Builder ARN,
+	// and CDK context handling before AMI IDs are replaced.
+	rewritten []fileprocessor.FileResult
+
+	// lookupErrors are the AMI lookups that failed without stopping the run.
+	lookupErrors []results.Error
+}
+
+// resolvedTarget is the paths of a configured target and the replacements
+// resolved for them.
+type resolvedTarget struct {
+	paths        []string
+	replacements []aws.AMIReplacement
+}
+
+// runUpdate updates the target files, recording the run in summary for
+// --output json.
+func runUpdate(ctx context.Context, summary *results.Summary) error {
+	err := validateOutputFormat()
 	if err != nil {
 		return err
 	}
 
-	// Print configuration info if verbose
-	printConfigInfo()
+	res, err := resolveReplacements(ctx)
+	if err != nil {
+		return err
+	}
 
-	// Create AWS client and file processor
-	awsClient, fileProcessor, err := createClients()
+	summary.Paths = res.paths
+	summary.Accounts = res.accounts
+	summary.Regions = res.regions
+	summary.DiffOnly = diffOnly
+	summary.AddResolutions(res.replacements)
+
+	for _, lookupError := range res.lookupErrors {
+		summary.AddError(lookupError)
+	}
+
+	reportAttention(ctx, res, summary)
+
+	// A strict run stops here, before writing anything, if the replacements
+	// may be incomplete
+	err = strictError(res)
 	if err != nil {
 		return err
 	}
 
-	// Get file info and patterns
-	fileInfo, patterns, err := getFileInfoAndPatterns(fileProcessor)
+	display := displayOutput()
+
+	var prompt conflictPrompt
+	if interactive {
+		prompt = newConflictPrompt(os.Stdin, display)
+	}
+
+	err = checkConflicts(res, prompt)
 	if err != nil {
 		return err
 	}
 
-	// Collect AMI replacements from all accounts and regions
-	allReplacements := collectAMIReplacements(awsClient, patterns)
+	if showDiff || diffOnly {
+		res.fileProcessor.SetDiff(display, colorOutput(display))
+		res.fileProcessor.SetDiffOnly(diffOnly)
+	}
 
-	if len(allReplacements) == 0 {
-		log.Println("No AMI replacements found")
+	if confirm {
+		res.fileProcessor.SetConfirmFunc(newFilePrompt(os.Stdin, display), colorOutput(display))
 
-		return nil
+		// Files are confirmed one at a time, in directory order.
+		res.fileProcessor.SetWorkers(1)
+	}
+
+	if exportMapping != "" {
+		err = mapping.New(res.replacements).Save(exportMapping)
+		if err != nil {
+			return fmt.Errorf("failed to export mapping: %w", err)
+		}
+
+		slog.Info("Mapping written", "path", exportMapping)
+	}
+
+	err = handleDynamicReferences(ctx, res)
+	if err != nil {
+		return err
+	}
+
+	err = handleImageBuilderARNs(ctx, res)
+	if err != nil {
+		return err
 	}
 
-	// Process the file or directory
-	err = processFiles(fileProcessor, fileInfo, allReplacements)
+	err = handlePackerFilters(ctx, res)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Successfully processed %s", cfg.File)
+	err = handleCDKContext(ctx, res)
+	summary.AddFiles(res.rewritten)
+
+	if err != nil {
+		return err
+	}
+
+	if len(res.replacements) == 0 {
+		slog.Info("No AMI replacements found")
+		recordRun(res, nil)
+		reportToActions(res, nil)
+
+		err = auditChanges(ctx, res, res.rewritten)
+		if err != nil {
+			return err
+		}
+
+		return handleGit(ctx, res, nil)
+	}
+
+	if interactive {
+		res.fileProcessor.SetDecisionFunc(newReplacementPrompt(os.Stdin, display))
+	}
+
+	// Process the files and directories
+	fileResults, err := processTargets(ctx, res)
+
+	recordRun(res, fileResults)
+	summary.AddFiles(fileResults)
+	reportToActions(res, fileResults)
+
+	err = errors.Join(err, auditChanges(ctx, res, slices.Concat(res.rewritten, fileResults)))
+	if err != nil {
+		return err
+	}
+
+	// Nor does it commit changes made while something went wrong
+	err = strictError(nil)
+	if err != nil {
+		return err
+	}
+
+	err = handleGit(ctx, res, fileResults)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Successfully processed files", "paths", res.paths)
 
 	return nil
 }
 
-func loadAndValidateConfig() error {
+func resolveReplacements(ctx context.Context) (*resolution, error) {
+	// Load and validate configuration
+	err := loadAndValidateConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Print configuration info if verbose
+	printConfigInfo()
+
+	// Create AWS client and file processor
+	awsClient, fileProcessor, err := createClients(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &resolution{awsClient: awsClient, fileProcessor: fileProcessor}
+
+	// Each target is resolved with its own settings in place of the top-level ones
+	base := cfg
+	defer func() { cfg = base }()
+
+	for _, targetConfig := range base.TargetConfigs() {
+		cfg = targetConfig
+
+		if len(base.Targets) > 0 {
+			err = discoverTargetRegions(ctx, awsClient)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		resolved, err := resolveTarget(ctx, awsClient, fileProcessor)
+		if err != nil {
+			return nil, err
+		}
+
+		res.add(resolved)
+	}
+
+	err = ctx.Err()
+	if err != nil {
+		return nil, fmt.Errorf("interrupted while resolving AMIs, no files were modified: %w", err)
+	}
+
+	return res, nil
+}
+
+// resolveTarget resolves the latest AMIs for the paths of the current
+// configuration.
+func resolveTarget(ctx context.Context, awsClient *aws.Client, fileProcessor *fileprocessor.Processor,
+) (*resolution, error) {
+	// Get the target paths and patterns
+	paths, patterns, err := getPathsAndPatterns(fileProcessor)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect AMI replacements from all accounts and regions
+	regions := targetRegions(awsClient)
+	allReplacements, lookupErrors := collectAMIReplacements(ctx, awsClient, regions, patterns)
+
+	if len(regions) > 1 {
+		amiIDs, err := directoryAMIs(fileProcessor, paths)
+		if err != nil {
+			return nil, err
+		}
+
+		amiIDs = appendMissing(amiIDs, patterns...)
+
+		equivalents, equivalentErrors := collectEquivalentReplacements(ctx, awsClient, regions, amiIDs)
+		allReplacements = append(allReplacements, equivalents...)
+		lookupErrors = append(lookupErrors, equivalentErrors...)
+	}
+
+	// The AMIs of outdated Image Builder builds in the files move onto those
+	// of the latest build
+	updates, updateErrors := collectImageBuilderUpdates(ctx, awsClient, fileProcessor, paths)
+	allReplacements = preferImageBuilds(allReplacements, updates)
+	lookupErrors = append(lookupErrors, updateErrors...)
+
+	// Drop replacements for pinned AMIs and for AMIs that cannot be launched
+	allReplacements = filterPinned(allReplacements)
+	allReplacements = filterLaunchable(ctx, awsClient, allReplacements)
+
+	return &resolution{
+		paths:            paths,
+		accounts:         cfg.Accounts,
+		regions:          regions,
+		replacements:     allReplacements,
+		imageBuilderARNs: imageBuilderARNs(updates, allReplacements),
+		lookupErrors:     lookupErrors,
+	}, nil
+}
+
+// add adds the resolution of a target.
+func (r *resolution) add(resolved *resolution) {
+	r.targets = append(r.targets, resolvedTarget{paths: resolved.paths, replacements: resolved.replacements})
+	r.replacements = append(r.replacements, resolved.replacements...)
+	r.lookupErrors = append(r.lookupErrors, resolved.lookupErrors...)
+
+	if len(resolved.imageBuilderARNs) > 0 {
+		if r.imageBuilderARNs == nil {
+			r.imageBuilderARNs = make(map[string]string)
+		}
+
+		maps.Copy(r.imageBuilderARNs, resolved.imageBuilderARNs)
+	}
+
+	r.paths = appendMissing(r.paths, resolved.paths...)
+	r.accounts = appendMissing(r.accounts, resolved.accounts...)
+	r.regions = appendMissing(r.regions, resolved.regions...)
+}
+
+// appendMissing appends the values not already in values.
+func appendMissing(values []string, added ...string) []string {
+	for _, value := range added {
+		if !slices.Contains(values, value) {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// processTargets replaces AMI IDs in the paths of every target with the
+// replacements resolved for it, or in all paths with all replacements when
+// no targets were resolved, as for apply.
+func processTargets(ctx context.Context, res *resolution) ([]fileprocessor.FileResult, error) {
+	if len(res.targets) == 0 {
+		return processFiles(ctx, res.fileProcessor, res.paths, res.replacements)
+	}
+
+	var fileResults []fileprocessor.FileResult
+
+	for _, target := range res.targets {
+		if len(target.replacements) == 0 {
+			continue
+		}
+
+		targetResults, err := processFiles(ctx, res.fileProcessor, target.paths, target.replacements)
+		fileResults = append(fileResults, targetResults...)
+
+		if err != nil {
+			return fileResults, err
+		}
+	}
+
+	return fileResults, nil
+}
+
+func loadAndValidateConfig(ctx context.Context) error {
 	var err error
 
-	cfg, err = config.LoadConfig()
+	cfg, err = config.LoadConfig(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
+		return exitcode.Config(fmt.Errorf("failed to load configuration: %w", err))
 	}
 
 	err = config.ValidateConfig(cfg)
 	if err != nil {
-		return fmt.Errorf("configuration validation failed: %w", err)
+		return exitcode.Config(fmt.Errorf("configuration validation failed: %w", err))
 	}
 
 	return nil
 }
 
 func printConfigInfo() {
-	if cfg.Verbose {
-		log.Printf("Updating AMI IDs in file: %s", cfg.File)
-		log.Printf("Account IDs: %s", strings.Join(cfg.Accounts, ", "))
-
-		if len(cfg.Regions) > 0 {
-			log.Printf("Regions: %s", strings.Join(cfg.Regions, ", "))
-		} else {
-			log.Printf("Regions: will use region from AWS profile")
+	slog.Debug("Configuration", "files", cfg.Files, "targets", len(cfg.Targets), "accounts", cfg.Accounts,
+		"regions", cfg.Regions, "profile", cfg.Profile, "role_arn", cfg.RoleARN)
+}
+
+func newAWSClient(ctx context.Context) (*aws.Client, error) {
+	awsClient, err := aws.NewClient(ctx, cfg.Profile, cfg.RoleARN, awsClientOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS client: %w", err)
+	}
+
+	err = awsClient.CheckCredentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS credentials: %w", err)
+	}
+
+	if cfg.AccountsFromOrg {
+		err = addOrganizationAccounts(ctx, awsClient)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		log.Printf("AWS Profile: %s", cfg.Profile)
+	if cfg.AllRegions {
+		err = discoverAccountRegions(ctx, awsClient)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return awsClient, nil
+}
 
-		if cfg.RoleARN != "" {
-			log.Printf("Role ARN: %s", cfg.RoleARN)
+// addOrganizationAccounts adds the accounts discovered from the organization
+// to the configured accounts.
+func addOrganizationAccounts(ctx context.Context, awsClient *aws.Client) error {
+	accounts, err := awsClient.ListOrganizationAccounts(ctx, cfg.OrgUnits, config.ParseTags(cfg.OrgAccountTags))
+	if err != nil {
+		return fmt.Errorf("failed to discover accounts from the organization: %w", err)
+	}
+
+	for _, accountID := range accounts {
+		if !slices.Contains(cfg.Accounts, accountID) {
+			cfg.Accounts = append(cfg.Accounts, accountID)
 		}
 	}
+
+	if len(cfg.Accounts) == 0 {
+		return fmt.Errorf("%w: no active accounts found in the organization", config.ErrNoAccountID)
+	}
+
+	slog.Debug("Discovered accounts from the organization", "accounts", len(accounts))
+
+	return nil
+}
+
+func awsClientOptions() []aws.Option {
+	return setup.AWSOptions(cfg)
 }
 
-func createClients() (*aws.Client, *fileprocessor.Processor, error) {
-	awsClient, err := aws.NewClient(cfg.Profile, cfg.RoleARN)
+func createClients(ctx context.Context) (*aws.Client, *fileprocessor.Processor, error) {
+	awsClient, err := newAWSClient(ctx)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create AWS client: %w", err)
+		return nil, nil, err
 	}
 
-	fileProcessor := fileprocessor.NewProcessor(cfg.Verbose)
+	return awsClient, newFileProcessor(), nil
+}
 
-	return awsClient, fileProcessor, nil
+// newFileProcessor returns a file processor configured for updating files.
+func newFileProcessor() *fileprocessor.Processor {
+	return setup.FileProcessor(cfg)
 }
 
-func getFileInfoAndPatterns(fileProcessor *fileprocessor.Processor) (os.FileInfo, []string, error) {
-	fileInfo, err := os.Stat(cfg.File)
+// targetPaths returns the files and directories named by --file, with glob
+// patterns expanded.
+func targetPaths() ([]string, error) {
+	files := cfg.Files
+	if len(files) == 0 {
+		files = cfg.AllFiles()
+	}
+
+	if len(files) == 0 {
+		return nil, config.ErrNoFilePath
+	}
+
+	paths, err := fileprocessor.ExpandPaths(files)
 	if err != nil {
-		return nil, nil, fmt.Errorf("file path does not exist: %w", err)
+		return nil, fmt.Errorf("failed to expand file paths: %w", err)
+	}
+
+	return paths, nil
+}
+
+func getPathsAndPatterns(fileProcessor *fileprocessor.Processor) ([]string, []string, error) {
+	paths, err := targetPaths()
+	if err != nil {
+		return nil, nil, err
 	}
 
 	var patterns []string
 
-	if !fileInfo.IsDir() {
+	for _, path := range paths {
+		if containsDirectory([]string{path}) {
+			continue
+		}
+
 		// Extract AMI patterns from the file
-		filePatterns, err := fileProcessor.FindAMIsInFile(cfg.File)
+		filePatterns, err := fileProcessor.FindAMIsInFile(path)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to find AMIs in file: %w", err)
 		}
 
-		patterns = filePatterns
-	} else {
+		// Files often reference the same AMIs, which are looked up once
+		patterns = appendMissing(patterns, filePatterns...)
+	}
+
+	if containsDirectory(paths) {
 		// Use configured patterns for directory processing
-		patterns = cfg.Patterns
+		patterns = appendMissing(patterns, cfg.Patterns...)
+	} else {
+		// SSM parameter, Marketplace, and resolver plugin patterns apply to files
+		// as well as directories
+		patterns = appendMissing(patterns, sourcePatterns(cfg.Patterns)...)
 	}
 
-	return fileInfo, patterns, nil
+	return paths, patterns, nil
 }
 
-func collectAMIReplacements(awsClient *aws.Client, patterns []string) []aws.AMIReplacement {
-	var allReplacements []aws.AMIReplacement
+// containsDirectory reports whether any of paths is a directory.
+func containsDirectory(paths []string) bool {
+	return slices.ContainsFunc(paths, func(path string) bool {
+		info, err := os.Stat(path)
 
-	for _, accountID := range cfg.Accounts {
-		if cfg.Verbose {
-			log.Printf("Processing account: %s", accountID)
-		}
+		return err == nil && info.IsDir()
+	})
+}
+
+func targetRegions(awsClient *aws.Client) []string {
+	if len(cfg.Regions) > 0 {
+		return cfg.Regions
+	}
 
-		accountReplacements := processAccount(awsClient, accountID, patterns)
-		allReplacements = append(allReplacements, accountReplacements...)
+	if cfg.AllRegions {
+		return discoveredRegions()
 	}
 
-	return allReplacements
+	// No regions specified, get region from AWS profile
+	region, err := awsClient.GetRegion()
+	if err != nil {
+		slog.Warn("Failed to get region from AWS profile", "error", err)
+
+		return nil
+	}
+
+	return []string{region}
 }
 
-func processAccount(awsClient *aws.Client, accountID string, patterns []string) []aws.AMIReplacement {
-	var accountReplacements []aws.AMIReplacement
+// sourcePatterns returns the patterns that name where AMIs come from rather
+// than matching AMI names.
+func sourcePatterns(patterns []string) []string {
+	var filtered []string
 
-	regions := cfg.Regions
-	if len(regions) == 0 {
-		// No regions specified, get region from AWS profile
-		region, err := awsClient.GetRegion()
-		if err != nil {
-			log.Printf("Warning: failed to get region from AWS profile: %v", err)
+	for _, pattern := range patterns {
+		for _, prefix := range []string{aws.SSMPatternPrefix, aws.MarketplacePatternPrefix, aws.ExecPatternPrefix} {
+			if strings.HasPrefix(pattern, prefix) {
+				filtered = append(filtered, pattern)
 
-			return accountReplacements
+				break
+			}
 		}
+	}
 
-		regions = []string{region}
+	return filtered
+}
+
+// collectAMIReplacements looks up the replacements in every account and
+// region, returning the lookups that failed alongside them.
+func collectAMIReplacements(ctx context.Context, awsClient *aws.Client, regions, patterns []string,
+) ([]aws.AMIReplacement, []results.Error) {
+	tasks := make([]resolveTask, 0, len(cfg.Accounts)*len(regions))
+
+	for _, accountID := range cfg.SearchedAccounts(patterns) {
+		if len(cfg.PatternsFor(accountID, patterns)) == 0 {
+			continue
+		}
+
+		for _, region := range regionsFor(accountID, regions) {
+			tasks = append(tasks, resolveTask{accountID: accountID, region: region})
+		}
 	}
 
-	for _, region := range regions {
-		if cfg.Verbose {
-			log.Printf("  Processing region: %s", region)
+	var (
+		allReplacements []aws.AMIReplacement
+		lookupErrors    []results.Error
+	)
+
+	taskResults := runResolveTasks(ctx, "Looking up AMIs", tasks,
+		func(ctx context.Context, task resolveTask) ([]aws.AMIReplacement, error) {
+			slog.Debug("Processing account", "account", task.accountID, "region", task.region)
+
+			return awsClient.GetLatestAMIs(ctx, task.accountID, task.region, cfg.PatternsFor(task.accountID, patterns))
+		})
+
+	for _, result := range taskResults {
+		if result.err != nil && ctx.Err() != nil {
+			continue
 		}
 
-		replacements, err := awsClient.GetLatestAMIs(accountID, region, patterns)
-		if err != nil {
-			log.Printf("Warning: failed to get AMIs for account %s, region %s: %v", accountID, region, err)
+		if result.err != nil {
+			slog.Warn("Failed to get AMIs", "account", result.task.accountID, "region", result.task.region,
+				"error", result.err)
+
+			lookupErrors = append(lookupErrors, results.Error{
+				Message: result.err.Error(),
+				Account: result.task.accountID,
+				Region:  result.task.region,
+			})
+
+			continue
+		}
+
+		slog.Debug("Found AMI replacements", "account", result.task.accountID, "region", result.task.region,
+			"count", len(result.replacements))
+
+		allReplacements = append(allReplacements, result.replacements...)
+	}
+
+	if len(lookupErrors) > 0 {
+		slog.Warn("Account/region lookups failed", "failed", len(lookupErrors), "lookups", len(tasks))
+	}
+
+	return allReplacements, lookupErrors
+}
+
+// directoryAMIs returns the AMI IDs referenced in the files under the
+// directories among paths, which are not looked up by ID like those of files.
+func directoryAMIs(fileProcessor *fileprocessor.Processor, paths []string) ([]string, error) {
+	directories := slices.DeleteFunc(slices.Clone(paths), func(path string) bool {
+		return !containsDirectory([]string{path})
+	})
+	if len(directories) == 0 {
+		return nil, nil
+	}
+
+	references, err := fileProcessor.ScanPath(directories...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find AMIs in directories: %w", err)
+	}
+
+	var amiIDs []string
+
+	for _, reference := range references {
+		amiIDs = appendMissing(amiIDs, reference.AMI)
+	}
+
+	return amiIDs, nil
+}
+
+// collectEquivalentReplacements maps every AMI ID found in the files onto its
+// equivalent in each other target region, so that the replacements cover
+// every region the files' images are deployed to. Like every cross-region
+// replacement, they are only written to references in those regions.
+func collectEquivalentReplacements(ctx context.Context, awsClient *aws.Client, regions, patterns []string,
+) ([]aws.AMIReplacement, []results.Error) {
+	var tasks []resolveTask
+
+	for _, accountID := range cfg.Accounts {
+		for _, pattern := range patterns {
+			if strings.HasPrefix(pattern, "ami-") {
+				tasks = append(tasks, resolveTask{accountID: accountID, amiID: pattern})
+			}
+		}
+	}
+
+	taskResults := runResolveTasks(ctx, "Finding cross-region equivalents", tasks,
+		func(ctx context.Context, task resolveTask) ([]aws.AMIReplacement, error) {
+			return awsClient.FindEquivalentAMIs(ctx, task.accountID, task.amiID, regions)
+		})
+
+	var (
+		replacements []aws.AMIReplacement
+		lookupErrors []results.Error
+	)
+
+	for _, result := range taskResults {
+		if result.err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("Failed to find cross-region equivalents", "ami", result.task.amiID,
+					"account", result.task.accountID, "error", result.err)
+
+				lookupErrors = append(lookupErrors, results.Error{
+					Message: fmt.Sprintf("failed to find cross-region equivalents of %s: %v", result.task.amiID, result.err),
+					Account: result.task.accountID,
+				})
+			}
 
 			continue
 		}
 
-		accountReplacements = append(accountReplacements, replacements...)
+		for _, replacement := range result.replacements {
+			slog.Debug("Found cross-region equivalent", "ami", replacement.OldAMI,
+				"source_region", replacement.SourceRegion, "region", replacement.Region, "new_ami", replacement.NewAMI)
+		}
+
+		replacements = append(replacements, result.replacements...)
+	}
+
+	return replacements, lookupErrors
+}
+
+// filterLaunchable drops replacements whose new AMI is not yet available, not
+// shared with the launch accounts, or fails the Inspector check, so files
+// never point at an image that cannot or should not be launched.
+func filterLaunchable(ctx context.Context, awsClient *aws.Client, replacements []aws.AMIReplacement,
+) []aws.AMIReplacement {
+	var tasks []resolveTask
 
-		if cfg.Verbose {
-			log.Printf("    Found %d AMI replacements", len(replacements))
+	indexes := make(map[resolveTask]int)
+
+	for _, replacement := range replacements {
+		task := resolveTask{accountID: replacement.Account, region: replacement.Region, amiID: replacement.NewAMI}
+		if _, ok := indexes[task]; !ok {
+			indexes[task] = len(tasks)
+			tasks = append(tasks, task)
 		}
 	}
 
-	return accountReplacements
+	results := runResolveTasks(ctx, "Checking launch permissions", tasks,
+		func(ctx context.Context, task resolveTask) ([]aws.AMIReplacement, error) {
+			return nil, checkReplacementAMI(ctx, awsClient, task.accountID, task.region, task.amiID,
+				cfg.LaunchAccounts)
+		})
+
+	kept := make([]aws.AMIReplacement, 0, len(replacements))
+
+	for _, replacement := range replacements {
+		task := resolveTask{accountID: replacement.Account, region: replacement.Region, amiID: replacement.NewAMI}
+
+		err := results[indexes[task]].err
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("Not replacing AMI", "ami", replacement.OldAMI, "new_ami", replacement.NewAMI,
+					"account", replacement.Account, "region", replacement.Region, "error", err)
+			}
+
+			continue
+		}
+
+		kept = append(kept, replacement)
+	}
+
+	return kept
 }
 
-func processFiles(fileProcessor *fileprocessor.Processor, fileInfo os.FileInfo,
-	allReplacements []aws.AMIReplacement,
+// checkReplacementAMI verifies that an AMI owned by accountID can be launched
+// by launchAccounts and, with --inspector, that it passes the Inspector check.
+// Candidates are checked as they are chosen, so only AMIs named directly,
+// such as by SSM parameters, plugins, and Image Builder builds, are still
+// checked here.
+func checkReplacementAMI(ctx context.Context, awsClient *aws.Client, accountID, region, amiID string,
+	launchAccounts []string,
 ) error {
-	var err error
-	if fileInfo.IsDir() {
-		err = fileProcessor.ProcessDirectory(cfg.File, allReplacements)
-	} else {
-		err = fileProcessor.ProcessFile(cfg.File, allReplacements)
+	err := awsClient.CheckLaunchable(ctx, accountID, region, amiID, launchAccounts)
+	if err != nil {
+		return err
 	}
 
+	return awsClient.CheckFindings(ctx, accountID, region, amiID)
+}
+
+func filterPinned(replacements []aws.AMIReplacement) []aws.AMIReplacement {
+	if len(cfg.Pins) == 0 {
+		return replacements
+	}
+
+	kept := make([]aws.AMIReplacement, 0, len(replacements))
+
+	for _, replacement := range replacements {
+		if aws.IsPinned(replacement, cfg.Pins) {
+			slog.Debug("Skipping pinned AMI", "ami", replacement.OldAMI, "name", replacement.Name)
+
+			continue
+		}
+
+		kept = append(kept, replacement)
+	}
+
+	return kept
+}
+
+func processFiles(ctx context.Context, fileProcessor *fileprocessor.Processor, paths []string,
+	replacements []aws.AMIReplacement,
+) ([]fileprocessor.FileResult, error) {
+	results, err := fileProcessor.ProcessPaths(ctx, paths, replacements)
 	if err != nil {
-		return fmt.Errorf("failed to process file: %w", err)
+		return results, fmt.Errorf("failed to process file: %w", err)
 	}
 
-	return nil
+	return results, nil
 }
@@ -0,0 +1,198 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/schnauzersoft/ami-util/internal/config"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+
+	"github.com/spf13/cobra"
+)
+
+const tableColumnPadding = 2
+
+// scanCmd represents the scan command.
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Inventory AMI references in a file or directory",
+	Long: `Inventory AMI references in a file or directory without contacting AWS.
+
+Every AMI ID found is reported with its file path and line number, followed
+by a summary of how many times each AMI is referenced. CloudFormation SSM
+dynamic references, FindInMap image IDs, and Karpenter AMI selectors are
+listed separately.
+
+Examples:
+  ami-util scan --file ./repo
+  ami-util scan --file terraform/main.tf`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		err := runScan(cmd.Context())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scanCmd)
+}
+
+func runScan(ctx context.Context) error {
+	var err error
+
+	cfg, err = config.LoadConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	paths, err := targetPaths()
+	if err != nil {
+		return err
+	}
+
+	fileProcessor := newFileProcessor()
+
+	references, err := fileProcessor.ScanPath(paths...)
+	if err != nil {
+		return fmt.Errorf("failed to scan %s: %w", strings.Join(paths, ", "), err)
+	}
+
+	dynamicReferences, err := fileProcessor.ScanDynamicReferences(paths...)
+	if err != nil {
+		return fmt.Errorf("failed to scan %s: %w", strings.Join(paths, ", "), err)
+	}
+
+	err = printScanResults(references)
+	if err != nil {
+		return err
+	}
+
+	return printDynamicReferences(dynamicReferences)
+}
+
+// valueOrDash returns value, or a dash for an empty table cell.
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
+
+func printScanResults(references []fileprocessor.FileReference) error {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, tableColumnPadding, ' ', 0)
+
+	showRegions := slices.ContainsFunc(references, func(ref fileprocessor.FileReference) bool {
+		return ref.Region != ""
+	})
+
+	header := "FILE\tLINE\tAMI"
+	if cfg.HCL {
+		header += "\tADDRESS"
+	}
+
+	if showRegions {
+		header += "\tREGION"
+	}
+
+	fmt.Fprintln(writer, header)
+
+	counts := make(map[string]int)
+	files := make(map[string]map[string]bool)
+
+	for _, ref := range references {
+		row := fmt.Sprintf("%s\t%d\t%s", ref.File, ref.Line, ref.AMI)
+		if cfg.HCL {
+			row += "\t" + valueOrDash(ref.Address)
+		}
+
+		if showRegions {
+			row += "\t" + valueOrDash(ref.Region)
+		}
+
+		fmt.Fprintln(writer, row)
+
+		counts[ref.AMI]++
+
+		if files[ref.AMI] == nil {
+			files[ref.AMI] = make(map[string]bool)
+		}
+
+		files[ref.AMI][ref.File] = true
+	}
+
+	amis := make([]string, 0, len(counts))
+	for ami := range counts {
+		amis = append(amis, ami)
+	}
+
+	sort.Slice(amis, func(i, j int) bool {
+		if counts[amis[i]] != counts[amis[j]] {
+			return counts[amis[i]] > counts[amis[j]]
+		}
+
+		return amis[i] < amis[j]
+	})
+
+	fmt.Fprintln(writer)
+	fmt.Fprintln(writer, "AMI\tCOUNT\tFILES")
+
+	for _, ami := range amis {
+		fmt.Fprintf(writer, "%s\t%d\t%d\n", ami, counts[ami], len(files[ami]))
+	}
+
+	fmt.Fprintf(writer, "\nFound %d references to %d unique AMIs\n", len(references), len(amis))
+
+	err := writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write scan results: %w", err)
+	}
+
+	return nil
+}
+
+func printDynamicReferences(references []fileprocessor.DynamicReference) error {
+	if len(references) == 0 {
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, tableColumnPadding, ' ', 0)
+
+	fmt.Fprintln(writer)
+	fmt.Fprintln(writer, "FILE\tLINE\tKIND\tNAME\tVERSION")
+
+	for _, ref := range references {
+		version := "latest"
+		if ref.Version > 0 {
+			version = strconv.FormatInt(ref.Version, 10)
+		}
+
+		if ref.Kind == fileprocessor.DynamicFindInMap || ref.Kind == fileprocessor.DynamicKarpenter {
+			version = "-"
+		}
+
+		fmt.Fprintf(writer, "%s\t%d\t%s\t%s\t%s\n", ref.File, ref.Line, ref.Kind, ref.Name, version)
+	}
+
+	fmt.Fprintf(writer, "\nFound %d dynamic AMI references\n", len(references))
+
+	err := writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write scan results: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/exitcode"
+	"github.com/schnauzersoft/ami-util/internal/git"
+	"github.com/schnauzersoft/ami-util/internal/results"
+
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const defaultScheduleJitter = 5 * time.Minute
+
+var (
+	ErrNoCron        = errors.New("--cron is required")
+	ErrInvalidJitter = errors.New("jitter must not be negative")
+)
+
+var (
+	scheduleCron   string
+	scheduleJitter time.Duration
+)
+
+// startBranch is the branch the first run of a schedule or watch created a
+// git branch from, which every later run switches back to before it starts,
+// so that runs do not each branch off the previous run's branch.
+var startBranch struct {
+	repeated bool
+	repo     *git.Repo
+	name     string
+}
+
+// scheduleCmd represents the schedule command.
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Run the configured targets on a cron schedule",
+	Long: `Keep running and update the configured targets on a cron schedule, as a run
+without a subcommand would, including the git commits and pull requests
+configured with --git-branch, --git-commit, and --github-pr.
+
+The schedule is a standard five-field cron expression, or a descriptor such
+as @weekly, in the local time zone unless it starts with CRON_TZ=<zone>. Each
+run starts after a random delay of up to --jitter, so that many schedules on
+the same expression do not all call AWS at once. The configuration is
+reloaded on every run. Stop with Ctrl-C or SIGTERM.
+
+Examples:
+  ami-util schedule --cron "0 6 * * MON" --file ./infra --github-pr
+  ami-util schedule --cron "CRON_TZ=Europe/Berlin 0 6 * * *" --jitter 30m`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		err := runSchedule(cmd.Context(), cmd.Flags())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(exitcode.ConfigError)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scheduleCmd)
+
+	scheduleCmd.Flags().StringVar(&scheduleCron, "cron", "", "Cron expression of when to run, e.g. \"0 6 * * MON\"")
+	scheduleCmd.Flags().DurationVar(&scheduleJitter, "jitter", defaultScheduleJitter,
+		"Longest random delay before each run")
+	addGitFlags(scheduleCmd.Flags())
+}
+
+func runSchedule(ctx context.Context, flags *pflag.FlagSet) error {
+	if scheduleCron == "" {
+		return ErrNoCron
+	}
+
+	if scheduleJitter < 0 {
+		return ErrInvalidJitter
+	}
+
+	schedule, err := cron.ParseStandard(scheduleCron)
+	if err != nil {
+		return fmt.Errorf("invalid cron expression %q: %w", scheduleCron, err)
+	}
+
+	// The settings are bound to the root command's flags until now
+	bindGitFlags(flags)
+
+	startBranch.repeated = true
+
+	for {
+		next := schedule.Next(time.Now())
+		if scheduleJitter > 0 {
+			next = next.Add(rand.N(scheduleJitter)) //nolint:gosec
+		}
+
+		slog.Info("Waiting for the next run", "at", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			slog.Info("Stopping schedule")
+
+			return nil
+		case <-timer.C:
+		}
+
+		runScheduled(ctx)
+	}
+}
+
+// runScheduled runs the configured targets once, writing the same outputs
+// as a run without a subcommand. Failures are logged and left for the next
+// run to retry.
+func runScheduled(ctx context.Context) {
+	code, err := runRepeated(ctx)
+
+	switch {
+	case err != nil && ctx.Err() == nil:
+		slog.Warn("Scheduled run failed", "error", err, "exit_code", code)
+	case err == nil:
+		slog.Info("Scheduled run finished", "exit_code", code)
+	}
+}
+
+// runRepeated runs the configured targets once for a schedule or watch, as a
+// run without a subcommand would, from the branch the first run started on
+// and with the warnings of earlier runs forgotten. It returns the exit code
+// the run would have had.
+func runRepeated(ctx context.Context) (int, error) {
+	if warnings != nil {
+		warnings.Reset()
+	}
+
+	if startBranch.repo != nil {
+		err := startBranch.repo.Switch(ctx, startBranch.name)
+		if err != nil {
+			return exitcode.Failure, fmt.Errorf("failed to switch back to branch %s: %w", startBranch.name, err)
+		}
+	}
+
+	summary := results.New(time.Now())
+
+	err := runUpdate(ctx, summary)
+	summary.ExitCode = exitcode.For(err, summary.Changed(), summary.Failures())
+	summary.Finish(time.Now(), err)
+
+	writeMetrics(ctx, summary)
+	writeJUnit(summary)
+	writeMarkdownSummary(summary)
+	writeCSVReport(summary)
+
+	return summary.ExitCode, err
+}
+
+// recordStartBranch remembers the checked out branch of repo when a schedule
+// or watch first creates a git branch in it.
+func recordStartBranch(ctx context.Context, repo *git.Repo) error {
+	if !startBranch.repeated || startBranch.repo != nil {
+		return nil
+	}
+
+	name, err := repo.CurrentBranch(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get current branch: %w", err)
+	}
+
+	startBranch.repo = repo
+	startBranch.name = name
+
+	return nil
+}
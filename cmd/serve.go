@@ -0,0 +1,209 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/config"
+	"github.com/schnauzersoft/ami-util/internal/exitcode"
+	"github.com/schnauzersoft/ami-util/internal/server"
+	"github.com/schnauzersoft/ami-util/internal/setup"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultServeAddress = "127.0.0.1:8080"
+
+	// serveTokenEnv holds the bearer token requests must carry.
+	serveTokenEnv = "AMI_SERVE_TOKEN"
+)
+
+var (
+	ErrEmptyToken       = errors.New("token file is empty")
+	ErrNoPatterns       = errors.New("no patterns requested or configured")
+	ErrNoServeToken     = errors.New("a token is required to listen on a non-loopback address")
+	ErrUntrustedPattern = errors.New("pattern is not in the server configuration")
+)
+
+var (
+	serveAddress   string
+	serveTokenFile string
+)
+
+// serveCmd represents the serve command.
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve AMI resolution and rewriting over a REST API",
+	Long: `Run an HTTP server exposing AMI resolution and rewriting, for platforms that
+call ami-util as a service rather than running the CLI per request.
+
+Endpoints:
+  POST /resolve   {"patterns": [...], "accounts": [...], "regions": [...]}
+                  returns the latest AMIs as a mapping, as written by
+                  --export-mapping; empty fields use the configuration
+  POST /rewrite   {"content": "...", "mapping": {"replacements": [...]}}
+                  returns {"content": "...", "count": N}
+  GET  /healthz   returns {"status": "ok"}
+
+Requests to /resolve and /rewrite must carry the token from --token-file or
+AMI_SERVE_TOKEN as "Authorization: Bearer <token>", when one is set. A token
+is required unless the server listens on a loopback address.
+
+Requested patterns may name pattern aliases. exec: and ssm: patterns, which
+run programs or read parameters on the server, are only accepted when the
+server configuration lists them.
+
+Examples:
+  ami-util serve --account-ids 123456789012 --regions us-east-1
+  AMI_SERVE_TOKEN=secret ami-util serve --listen :8080`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		err := runServe(cmd.Context())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveAddress, "listen", defaultServeAddress, "Address to listen on")
+	serveCmd.Flags().StringVar(&serveTokenFile, "token-file", "",
+		"File holding the bearer token requests must carry (default $"+serveTokenEnv+")")
+}
+
+func runServe(ctx context.Context) error {
+	var err error
+
+	cfg, err = config.LoadConfig(ctx)
+	if err != nil {
+		return exitcode.Config(fmt.Errorf("failed to load configuration: %w", err))
+	}
+
+	token, err := serveToken()
+	if err != nil {
+		return err
+	}
+
+	if token == "" {
+		if !isLoopbackAddress(serveAddress) {
+			return exitcode.Config(fmt.Errorf("%w: set --token-file or %s", ErrNoServeToken, serveTokenEnv))
+		}
+
+		slog.Warn("Serving without authentication; set --token-file or " + serveTokenEnv)
+	}
+
+	base := cfg
+
+	return server.New(func(ctx context.Context, request server.ResolveRequest) ([]aws.AMIReplacement, error) {
+		return resolveForRequest(ctx, base, request)
+	}, token).ListenAndServe(ctx, serveAddress)
+}
+
+// serveToken returns the bearer token from --token-file or the environment.
+func serveToken() (string, error) {
+	if serveTokenFile == "" {
+		return os.Getenv(serveTokenEnv), nil
+	}
+
+	content, err := os.ReadFile(filepath.Clean(serveTokenFile))
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("%w: %s", ErrEmptyToken, serveTokenFile)
+	}
+
+	return token, nil
+}
+
+// isLoopbackAddress reports whether a listen address only accepts local
+// connections. An empty host listens on every interface.
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkRequestPatterns rejects the exec: and ssm: patterns of a request that
+// the configuration does not list, at the top level, in a target, or as a
+// pattern alias, so that clients cannot run programs or read parameters of
+// their choosing on the server.
+func checkRequestPatterns(base *config.Config, patterns []string) error {
+	trusted := slices.Concat(base.Patterns, slices.Collect(maps.Values(base.PatternAliases)))
+	for _, target := range base.Targets {
+		trusted = append(trusted, target.Patterns...)
+	}
+
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, aws.ExecPatternPrefix) && !strings.HasPrefix(pattern, aws.SSMPatternPrefix) {
+			continue
+		}
+
+		if !slices.Contains(trusted, pattern) {
+			return fmt.Errorf("%w: %w: %q", server.ErrInvalidRequest, ErrUntrustedPattern, pattern)
+		}
+	}
+
+	return nil
+}
+
+// resolveForRequest resolves the latest AMIs with the configuration, using
+// the accounts, regions, and patterns of the request where set.
+func resolveForRequest(ctx context.Context, base *config.Config, request server.ResolveRequest,
+) ([]aws.AMIReplacement, error) {
+	patterns := base.ExpandPatterns(request.Patterns)
+
+	err := checkRequestPatterns(base, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	requestConfig := base.ForTarget(config.Target{
+		Accounts: request.Accounts,
+		Regions:  request.Regions,
+		Patterns: patterns,
+	})
+
+	if !requestConfig.HasAccounts() {
+		return nil, fmt.Errorf("%w: %w", server.ErrInvalidRequest, config.ErrNoAccountID)
+	}
+
+	if len(requestConfig.Patterns) == 0 {
+		return nil, fmt.Errorf("%w: %w", server.ErrInvalidRequest, ErrNoPatterns)
+	}
+
+	resolver, err := setup.NewResolver(ctx, requestConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolver.Resolve(ctx, requestConfig.Patterns)
+}
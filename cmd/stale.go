@@ -0,0 +1,126 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+	"github.com/schnauzersoft/ami-util/internal/results"
+)
+
+const hoursPerDay = 24
+
+// findAttention returns the AMIs referenced in the paths of res that no
+// replacement was resolved for and that no longer exist or, with
+// --stale-after, are older than it, sorted by AMI ID. They are looked up in the regions of res
+// and of the references, with the default credentials and the role of each
+// account.
+func findAttention(ctx context.Context, res *resolution) ([]results.Attention, error) {
+	references, err := res.fileProcessor.ScanPath(res.paths...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", strings.Join(res.paths, ", "), err)
+	}
+
+	replaced := make(map[string]bool, len(res.replacements))
+	for _, replacement := range res.replacements {
+		replaced[replacement.OldAMI] = true
+	}
+
+	references = slices.DeleteFunc(references, func(reference fileprocessor.FileReference) bool {
+		return replaced[reference.AMI]
+	})
+	if len(references) == 0 {
+		return nil, nil
+	}
+
+	regions := slices.Clone(res.regions)
+	for _, reference := range references {
+		regions = appendMissing(regions, reference.Region)
+	}
+
+	regions = slices.DeleteFunc(regions, func(region string) bool { return region == "" })
+	if len(regions) == 0 {
+		return nil, nil
+	}
+
+	accounts := slices.DeleteFunc(slices.Clone(res.accounts), aws.IsOwnerAlias)
+
+	amis, missing, err := describeReferencedAMIs(ctx, res.awsClient, references, regions, accounts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up referenced AMIs: %w", err)
+	}
+
+	filesByAMI := fileprocessor.FilesByAMI(references)
+
+	var attention []results.Attention
+
+	for _, amiID := range missing {
+		attention = append(attention, results.Attention{
+			AMI:    amiID,
+			Status: results.AttentionMissing,
+			Files:  filesByAMI[amiID],
+		})
+	}
+
+	for _, ami := range amis {
+		age := time.Since(ami.CreationDate)
+		if cfg.StaleAfter <= 0 || age < cfg.StaleAfter {
+			continue
+		}
+
+		created := ami.CreationDate.UTC()
+
+		attention = append(attention, results.Attention{
+			AMI:     ami.ImageID,
+			Status:  results.AttentionStale,
+			Name:    ami.Name,
+			Owner:   ami.Owner,
+			Region:  ami.Region,
+			Created: &created,
+			AgeDays: int(age.Hours() / hoursPerDay),
+			Files:   filesByAMI[ami.ImageID],
+		})
+	}
+
+	slices.SortFunc(attention, func(a, b results.Attention) int {
+		return strings.Compare(a.AMI, b.AMI)
+	})
+
+	return attention, nil
+}
+
+// reportAttention looks up the AMIs that need attention, logging and
+// recording them in summary. A failed lookup is recorded as an error of the
+// run rather than stopping it.
+func reportAttention(ctx context.Context, res *resolution, summary *results.Summary) {
+	attention, err := findAttention(ctx, res)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Warn("Failed to check for missing and stale AMIs", "error", err)
+			summary.AddError(results.Error{Message: err.Error()})
+		}
+
+		return
+	}
+
+	for _, entry := range attention {
+		switch entry.Status {
+		case results.AttentionMissing:
+			slog.Warn("Referenced AMI no longer exists", "ami", entry.AMI, "files", entry.Files)
+		default:
+			slog.Warn("Referenced AMI is stale", "ami", entry.AMI, "name", entry.Name, "age_days", entry.AgeDays,
+				"files", entry.Files)
+		}
+	}
+
+	summary.Attention = append(summary.Attention, attention...)
+}
@@ -0,0 +1,37 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrStrict = errors.New("strict mode")
+
+// strictError returns the warnings logged so far, and the AMI references in
+// the files of res that no lookup resolved, as one error when strict is set.
+// A nil res only reports the warnings.
+func strictError(res *resolution) error {
+	if cfg == nil || !cfg.Strict || warnings == nil {
+		return nil
+	}
+
+	problems := warnings.Warnings()
+
+	if res != nil {
+		for _, reference := range unresolvedReferences(res) {
+			problems = append(problems, fmt.Sprintf("%s:%d: %s was not found in any account and region searched",
+				reference.File, reference.Line, reference.AMI))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %d problems:\n  - %s", ErrStrict, len(problems), strings.Join(problems, "\n  - "))
+}
@@ -0,0 +1,68 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/exitcode"
+	"github.com/schnauzersoft/ami-util/internal/tracing"
+
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// shutdownTimeout limits how long exiting waits for spans to be exported.
+const shutdownTimeout = 5 * time.Second
+
+// endTracing ends the run's span with the exit code and flushes its trace.
+var endTracing = func(int) {}
+
+// startTracing starts the span of the command's run, continuing the trace of
+// the pipeline running it, if any. Every span of the run is in its context.
+func startTracing(cmd *cobra.Command) {
+	shutdown, err := tracing.Setup(cmd.Context(), Version)
+	if err != nil {
+		slog.Warn("Tracing is disabled", "error", err)
+
+		return
+	}
+
+	if !tracing.Enabled() {
+		return
+	}
+
+	ctx, span := tracing.Start(tracing.FromEnvironment(cmd.Context()), cmd.CommandPath())
+	cmd.SetContext(ctx)
+
+	endTracing = func(code int) {
+		span.SetAttributes(semconv.ProcessExitCode(code))
+
+		if code != exitcode.UpToDate && code != exitcode.Changed {
+			span.SetStatus(codes.Error, fmt.Sprintf("exit code %d", code))
+		}
+
+		span.End()
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		err := shutdown(ctx)
+		if err != nil {
+			slog.Warn("Failed to export traces", "error", err)
+		}
+	}
+}
+
+// exit ends the run's trace and exits with code. Deferred calls do not run.
+func exit(code int) {
+	endTracing(code)
+	os.Exit(code)
+}
@@ -0,0 +1,224 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrAutoScalingGroupUpdateFailed = errors.New("failed to update some auto scaling groups")
+	ErrInvalidInstanceWarmup        = errors.New("instance warmup must not be negative")
+)
+
+var (
+	autoScalingGroupNames   []string
+	autoScalingGroupTags    []string
+	instanceRefresh         bool
+	instanceRefreshWarmup   time.Duration
+	instanceRefreshSkip     bool
+	autoScalingGroupsDryRun bool
+)
+
+// updateAutoScalingGroupsCmd represents the update-auto-scaling-groups command.
+var updateAutoScalingGroupsCmd = &cobra.Command{
+	Use:   "update-auto-scaling-groups",
+	Short: "Roll Auto Scaling groups onto the latest AMI",
+	Long: `Roll Auto Scaling groups onto the latest AMI.
+
+Auto Scaling groups are found by name and tag in each account and region. When
+the AMI of the launch template version a group launches has a newer
+replacement, a new template version is created with the new AMI and the group
+is pointed at it: groups that launch $Latest pick it up as it is, groups that
+launch $Default have it made the default version, and groups pinned to a
+version number are updated to the new number. Groups sharing a template
+version share the new version. With --instance-refresh, an instance refresh is
+then started so running instances are replaced.
+
+Examples:
+  ami-util update-auto-scaling-groups --account-ids 123456789012 --name "web-*" --dry-run
+  ami-util update-auto-scaling-groups --tag Team=platform --instance-refresh --instance-warmup 5m --skip-matching`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		err := runUpdateAutoScalingGroups(cmd.Context())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(updateAutoScalingGroupsCmd)
+
+	updateAutoScalingGroupsCmd.Flags().StringSliceVar(&autoScalingGroupNames, "name", []string{},
+		"Auto Scaling group name to update, with * wildcards (can be repeated)")
+	updateAutoScalingGroupsCmd.Flags().StringSliceVar(&autoScalingGroupTags, "tag", []string{},
+		"Only update Auto Scaling groups with this Key=Value tag (can be repeated)")
+	updateAutoScalingGroupsCmd.Flags().BoolVar(&instanceRefresh, "instance-refresh", false,
+		"Start an instance refresh of each updated group")
+	updateAutoScalingGroupsCmd.Flags().DurationVar(&instanceRefreshWarmup, "instance-warmup", 0,
+		"Time for a new instance to warm up during an instance refresh (default: the group's setting)")
+	updateAutoScalingGroupsCmd.Flags().BoolVar(&instanceRefreshSkip, "skip-matching", false,
+		"Skip replacing instances that already run the new launch template version")
+	updateAutoScalingGroupsCmd.Flags().BoolVar(&autoScalingGroupsDryRun, "dry-run", false,
+		"Show which groups would be updated without changing them")
+}
+
+func runUpdateAutoScalingGroups(ctx context.Context) error {
+	var err error
+
+	cfg, err = config.LoadConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if !cfg.HasAccounts() {
+		return config.ErrNoAccountID
+	}
+
+	if instanceRefreshWarmup < 0 {
+		return ErrInvalidInstanceWarmup
+	}
+
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	regions := targetRegions(awsClient)
+	tags := config.ParseTags(autoScalingGroupTags)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, tableColumnPadding, ' ', 0)
+
+	fmt.Fprintln(writer, "ACCOUNT\tREGION\tGROUP\tTEMPLATE\tOLD AMI\tNEW AMI\tSTATUS")
+
+	updater := &autoScalingGroupUpdater{awsClient: awsClient, versions: make(map[string]int64)}
+	failed := false
+
+	for _, accountID := range cfg.Accounts {
+		if aws.IsOwnerAlias(accountID) {
+			continue
+		}
+
+		for _, region := range regionsFor(accountID, regions) {
+			groups, err := awsClient.FindAutoScalingGroups(ctx, accountID, region, autoScalingGroupNames, tags)
+			if err != nil {
+				failed = true
+
+				fmt.Fprintf(writer, "%s\t%s\t-\t-\t-\t-\tERROR: %v\n", accountID, region, err)
+
+				continue
+			}
+
+			for _, group := range groups {
+				newAMI, status, ok := updater.update(ctx, group)
+				if !ok {
+					failed = true
+				}
+
+				template := group.LaunchTemplate.Name
+				if template == "" {
+					template = "-"
+				}
+
+				oldAMI := group.LaunchTemplate.ImageID
+				if oldAMI == "" {
+					oldAMI = "-"
+				}
+
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					accountID, region, group.Name, template, oldAMI, newAMI, status)
+			}
+		}
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write auto scaling group results: %w", err)
+	}
+
+	if failed {
+		return ErrAutoScalingGroupUpdateFailed
+	}
+
+	return nil
+}
+
+// autoScalingGroupUpdater updates groups, remembering the template versions
+// it has created so that groups sharing a template version share the new one.
+type autoScalingGroupUpdater struct {
+	awsClient *aws.Client
+	versions  map[string]int64
+}
+
+// update rolls a single group onto the latest AMI, returning the new AMI, the
+// status to report, and whether the update succeeded or was not needed.
+func (u *autoScalingGroupUpdater) update(ctx context.Context, group aws.AutoScalingGroup) (string, string, bool) {
+	template := group.LaunchTemplate
+
+	switch {
+	case template.ID == "":
+		return "-", "skipped: no launch template", true
+	case template.ImageID == "" || !aws.ContainsAMI([]byte(template.ImageID)):
+		return "-", "skipped: no AMI ID", true
+	}
+
+	replacement, found, err := resolveInUseAMI(ctx, u.awsClient, group.Region, template.ImageID, group.Account)
+
+	switch {
+	case err != nil:
+		return "-", fmt.Sprintf("ERROR: %v", err), false
+	case !found:
+		return "-", "up to date", true
+	case autoScalingGroupsDryRun && instanceRefresh:
+		return replacement.NewAMI, "would update and refresh", true
+	case autoScalingGroupsDryRun:
+		return replacement.NewAMI, "would update", true
+	}
+
+	key := fmt.Sprintf("%s/%s/%s/%d/%t", group.Account, group.Region, template.ID, template.Version,
+		group.UsesDefaultVersion())
+
+	version, ok := u.versions[key]
+	if !ok {
+		version, err = u.awsClient.UpdateLaunchTemplate(ctx, template, replacement.NewAMI, group.UsesDefaultVersion())
+		if err != nil {
+			return replacement.NewAMI, fmt.Sprintf("ERROR: %v", err), false
+		}
+
+		u.versions[key] = version
+	}
+
+	err = u.awsClient.UseLaunchTemplateVersion(ctx, group, version)
+	if err != nil {
+		return replacement.NewAMI, fmt.Sprintf("ERROR: %v", err), false
+	}
+
+	status := fmt.Sprintf("updated (version %d)", version)
+
+	if !instanceRefresh {
+		return replacement.NewAMI, status, true
+	}
+
+	refreshID, err := u.awsClient.StartInstanceRefresh(ctx, group, aws.InstanceRefreshPreferences{
+		InstanceWarmup: instanceRefreshWarmup,
+		SkipMatching:   instanceRefreshSkip,
+	})
+	if err != nil {
+		return replacement.NewAMI, fmt.Sprintf("%s, refresh ERROR: %v", status, err), false
+	}
+
+	return replacement.NewAMI, fmt.Sprintf("%s, refresh %s started", status, refreshID), true
+}
@@ -0,0 +1,160 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var ErrLaunchTemplateUpdateFailed = errors.New("failed to update some launch templates")
+
+var (
+	launchTemplateNames      []string
+	launchTemplateTags       []string
+	launchTemplateSetDefault bool
+	launchTemplateDryRun     bool
+)
+
+// updateLaunchTemplatesCmd represents the update-launch-templates command.
+var updateLaunchTemplatesCmd = &cobra.Command{
+	Use:   "update-launch-templates",
+	Short: "Update the AMI of EC2 launch templates",
+	Long: `Update the AMI of EC2 launch templates managed directly in EC2.
+
+Launch templates are found by name and tag in each account and region. When
+the AMI of a template's default version has a newer replacement, a new version
+is created from the default version with the new AMI, and is optionally made
+the default version. Pins and launch checks apply as they do to files, and the
+template's account must be able to launch the new AMI.
+
+Examples:
+  ami-util update-launch-templates --account-ids 123456789012 --name "web-*" --dry-run
+  ami-util update-launch-templates --tag Team=platform --set-default`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		err := runUpdateLaunchTemplates(cmd.Context())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(updateLaunchTemplatesCmd)
+
+	updateLaunchTemplatesCmd.Flags().StringSliceVar(&launchTemplateNames, "name", []string{},
+		"Launch template name to update, with * wildcards (can be repeated)")
+	updateLaunchTemplatesCmd.Flags().StringSliceVar(&launchTemplateTags, "tag", []string{},
+		"Only update launch templates with this Key=Value tag (can be repeated)")
+	updateLaunchTemplatesCmd.Flags().BoolVar(&launchTemplateSetDefault, "set-default", false,
+		"Make the new version the default version of each template")
+	updateLaunchTemplatesCmd.Flags().BoolVar(&launchTemplateDryRun, "dry-run", false,
+		"Show which templates would be updated without creating versions")
+}
+
+func runUpdateLaunchTemplates(ctx context.Context) error {
+	var err error
+
+	cfg, err = config.LoadConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if !cfg.HasAccounts() {
+		return config.ErrNoAccountID
+	}
+
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	regions := targetRegions(awsClient)
+	tags := config.ParseTags(launchTemplateTags)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, tableColumnPadding, ' ', 0)
+
+	fmt.Fprintln(writer, "ACCOUNT\tREGION\tTEMPLATE\tOLD AMI\tNEW AMI\tSTATUS")
+
+	failed := false
+
+	for _, accountID := range cfg.Accounts {
+		if aws.IsOwnerAlias(accountID) {
+			continue
+		}
+
+		for _, region := range regionsFor(accountID, regions) {
+			templates, err := awsClient.FindLaunchTemplates(ctx, accountID, region, launchTemplateNames, tags)
+			if err != nil {
+				failed = true
+
+				fmt.Fprintf(writer, "%s\t%s\t-\t-\t-\tERROR: %v\n", accountID, region, err)
+
+				continue
+			}
+
+			for _, template := range templates {
+				newAMI, status, ok := updateLaunchTemplate(ctx, awsClient, template)
+				if !ok {
+					failed = true
+				}
+
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n",
+					accountID, region, template.Name, template.ImageID, newAMI, status)
+			}
+		}
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write launch template results: %w", err)
+	}
+
+	if failed {
+		return ErrLaunchTemplateUpdateFailed
+	}
+
+	return nil
+}
+
+// updateLaunchTemplate updates a single template, returning the new AMI, the
+// status to report, and whether the update succeeded or was not needed.
+func updateLaunchTemplate(ctx context.Context, awsClient *aws.Client, template aws.LaunchTemplate,
+) (string, string, bool) {
+	if template.ImageID == "" || !aws.ContainsAMI([]byte(template.ImageID)) {
+		return "-", "skipped: no AMI ID", true
+	}
+
+	replacement, found, err := resolveInUseAMI(ctx, awsClient, template.Region, template.ImageID, template.Account)
+
+	switch {
+	case err != nil:
+		return "-", fmt.Sprintf("ERROR: %v", err), false
+	case !found:
+		return "-", "up to date", true
+	case launchTemplateDryRun:
+		return replacement.NewAMI, "would update", true
+	}
+
+	version, err := awsClient.UpdateLaunchTemplate(ctx, template, replacement.NewAMI, launchTemplateSetDefault)
+	if err != nil {
+		return replacement.NewAMI, fmt.Sprintf("ERROR: %v", err), false
+	}
+
+	if launchTemplateSetDefault {
+		return replacement.NewAMI, fmt.Sprintf("updated (default version %d)", version), true
+	}
+
+	return replacement.NewAMI, fmt.Sprintf("updated (version %d)", version), true
+}
@@ -0,0 +1,228 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var ErrStackUpdateFailed = errors.New("failed to update some stacks")
+
+var (
+	stackNames     []string
+	stackTags      []string
+	stackChangeSet bool
+	stackDryRun    bool
+)
+
+// updateStacksCmd represents the update-stacks command.
+var updateStacksCmd = &cobra.Command{
+	Use:   "update-stacks",
+	Short: "Update AMI parameters of deployed CloudFormation stacks",
+	Long: `Update AMI parameters of deployed CloudFormation stacks.
+
+Stacks are found by name and tag in each account and region. Parameters typed
+AWS::EC2::Image::Id or List<AWS::EC2::Image::Id>, and String parameters whose
+value is an AMI ID, are checked for newer replacements. Stacks with outdated
+AMIs are updated with their current template and every other parameter left
+at its previous value, or, with --change-set, a change set is created for
+review instead. Pins and launch checks apply as they do to files, and the
+stack's account must be able to launch the new AMI.
+
+Examples:
+  ami-util update-stacks --account-ids 123456789012 --name "web-*" --dry-run
+  ami-util update-stacks --tag Team=platform --change-set`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		err := runUpdateStacks(cmd.Context())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(updateStacksCmd)
+
+	updateStacksCmd.Flags().StringSliceVar(&stackNames, "name", []string{},
+		"Stack name to update, with * wildcards (can be repeated)")
+	updateStacksCmd.Flags().StringSliceVar(&stackTags, "tag", []string{},
+		"Only update stacks with this Key=Value tag (can be repeated)")
+	updateStacksCmd.Flags().BoolVar(&stackChangeSet, "change-set", false,
+		"Create a change set for each stack instead of updating it")
+	updateStacksCmd.Flags().BoolVar(&stackDryRun, "dry-run", false,
+		"Show which stacks would be updated without changing them")
+}
+
+func runUpdateStacks(ctx context.Context) error {
+	var err error
+
+	cfg, err = config.LoadConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if !cfg.HasAccounts() {
+		return config.ErrNoAccountID
+	}
+
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	regions := targetRegions(awsClient)
+	tags := config.ParseTags(stackTags)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, tableColumnPadding, ' ', 0)
+
+	fmt.Fprintln(writer, "ACCOUNT\tREGION\tSTACK\tPARAMETER\tOLD VALUE\tNEW VALUE\tSTATUS")
+
+	failed := false
+
+	for _, accountID := range cfg.Accounts {
+		if aws.IsOwnerAlias(accountID) {
+			continue
+		}
+
+		for _, region := range regionsFor(accountID, regions) {
+			stacks, err := awsClient.FindStacks(ctx, accountID, region, stackNames, tags)
+			if err != nil {
+				failed = true
+
+				fmt.Fprintf(writer, "%s\t%s\t-\t-\t-\t-\tERROR: %v\n", accountID, region, err)
+
+				continue
+			}
+
+			for _, stack := range stacks {
+				if !updateStack(ctx, writer, awsClient, stack) {
+					failed = true
+				}
+			}
+		}
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write stack results: %w", err)
+	}
+
+	if failed {
+		return ErrStackUpdateFailed
+	}
+
+	return nil
+}
+
+// stackParameterUpdate is the new value resolved for an AMI parameter.
+type stackParameterUpdate struct {
+	parameter aws.StackParameter
+	value     string
+	status    string
+}
+
+// updateStack resolves the AMI parameters of a stack, updates the stack when
+// any of them changed, and writes a row per AMI parameter. It reports whether
+// every parameter was resolved and the update succeeded.
+func updateStack(ctx context.Context, writer io.Writer, awsClient *aws.Client, stack aws.Stack) bool {
+	var updates []stackParameterUpdate
+
+	values := make(map[string]string)
+	ok := true
+
+	for _, parameter := range stack.Parameters {
+		if !parameter.HoldsAMIs() {
+			continue
+		}
+
+		value, err := resolveStackParameter(ctx, awsClient, stack, parameter.Value)
+
+		update := stackParameterUpdate{parameter: parameter, value: value}
+
+		switch {
+		case err != nil:
+			ok = false
+			update.value = "-"
+			update.status = fmt.Sprintf("ERROR: %v", err)
+		case value == parameter.Value:
+			update.value = "-"
+			update.status = "up to date"
+		default:
+			values[parameter.Key] = value
+		}
+
+		updates = append(updates, update)
+	}
+
+	status := ""
+
+	switch {
+	case len(values) == 0:
+	case stackDryRun && stackChangeSet:
+		status = "would create change set"
+	case stackDryRun:
+		status = "would update"
+	default:
+		changeSet, err := awsClient.UpdateStackParameters(ctx, stack, values, stackChangeSet)
+
+		switch {
+		case err != nil:
+			ok = false
+			status = fmt.Sprintf("ERROR: %v", err)
+		case stackChangeSet:
+			status = fmt.Sprintf("change set %s created", changeSet)
+		default:
+			status = "update started"
+		}
+	}
+
+	for _, update := range updates {
+		if update.status == "" {
+			update.status = status
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", stack.Account, stack.Region, stack.Name,
+			update.parameter.Key, update.parameter.Value, update.value, update.status)
+	}
+
+	return ok
+}
+
+// resolveStackParameter returns a parameter value with each AMI in it
+// replaced by its newest replacement. List values are comma-separated.
+func resolveStackParameter(ctx context.Context, awsClient *aws.Client, stack aws.Stack, value string,
+) (string, error) {
+	amis := strings.Split(value, ",")
+
+	for i, ami := range amis {
+		amiID := strings.TrimSpace(ami)
+		if !aws.ContainsAMI([]byte(amiID)) {
+			continue
+		}
+
+		replacement, found, err := resolveInUseAMI(ctx, awsClient, stack.Region, amiID, stack.Account)
+		if err != nil {
+			return "", err
+		}
+
+		if found {
+			amis[i] = strings.Replace(ami, amiID, replacement.NewAMI, 1)
+		}
+	}
+
+	return strings.Join(amis, ","), nil
+}
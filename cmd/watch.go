@@ -0,0 +1,139 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/report"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const defaultWatchInterval = 6 * time.Hour
+
+var ErrInvalidInterval = errors.New("interval must be greater than zero")
+
+var (
+	watchInterval   time.Duration
+	watchReportOnly bool
+)
+
+// watchCmd represents the watch command.
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Periodically re-check for newer AMIs and apply updates",
+	Long: `Keep running and periodically re-resolve the latest AMIs, applying updates
+to the configured targets whenever newer images appear. Each check runs as a
+run without a subcommand would, including the conflict and strict checks,
+the outputs, and the git commits and pull requests configured with
+--git-branch, --git-commit, and --github-pr.
+
+The configuration is reloaded on every check, so changes to ami.yaml take
+effect without restarting. Use --report-only to print the pending
+replacements instead of modifying files. Stop with Ctrl-C or SIGTERM.
+
+Examples:
+  ami-util watch --file ./infra --interval 6h
+  ami-util watch --file ./infra --interval 30m --report-only`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		err := runWatch(cmd.Context(), cmd.Flags())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", defaultWatchInterval, "Time between checks")
+	watchCmd.Flags().BoolVar(&watchReportOnly, "report-only", false, "Report pending replacements without modifying files")
+	addGitFlags(watchCmd.Flags())
+}
+
+func runWatch(ctx context.Context, flags *pflag.FlagSet) error {
+	if watchInterval <= 0 {
+		return ErrInvalidInterval
+	}
+
+	// The settings are bound to the root command's flags until now
+	bindGitFlags(flags)
+
+	startBranch.repeated = true
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		err := runWatchIteration(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Check failed", "error", err)
+		}
+
+		slog.Info("Waiting for the next check", "interval", watchInterval)
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping watch")
+
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// runWatchIteration runs one check, applying the updates as a run without a
+// subcommand would, or only reporting them with --report-only.
+func runWatchIteration(ctx context.Context) error {
+	if !watchReportOnly {
+		code, err := runRepeated(ctx)
+		if err == nil {
+			slog.Info("Check finished", "exit_code", code)
+		}
+
+		return err
+	}
+
+	res, err := resolveReplacements(ctx)
+	if err != nil {
+		return err
+	}
+
+	references, err := res.fileProcessor.ScanPath(res.paths...)
+	if err != nil {
+		return fmt.Errorf("failed to scan %s: %w", strings.Join(res.paths, ", "), err)
+	}
+
+	pending := &report.Report{}
+
+	for _, replacement := range report.New(res.replacements, references).Replacements {
+		if len(replacement.Files) > 0 {
+			pending.Replacements = append(pending.Replacements, replacement)
+		}
+	}
+
+	if len(pending.Replacements) == 0 {
+		slog.Info("No AMI replacements found")
+
+		return nil
+	}
+
+	err = pending.Write(os.Stdout, report.FormatTable)
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+)
+
+const (
+	DirPerm  = 0o700
+	FilePerm = 0o600
+)
+
+// Entry records a single replacement written to a file: when, where, what it
+// replaced, and who made it. User is the local user running ami-util on Host,
+// Identity the AWS principal of its credentials, and Role the role assumed to
+// look up the replacement in Account, if any.
+type Entry struct {
+	Timestamp time.Time `json:"timestamp"`
+	File      string    `json:"file"`
+	OldAMI    string    `json:"oldAmi"`
+	NewAMI    string    `json:"newAmi"`
+	Name      string    `json:"name"`
+	Account   string    `json:"account"`
+	Region    string    `json:"region"`
+	User      string    `json:"user"`
+	Host      string    `json:"host,omitempty"`
+	Identity  string    `json:"identity,omitempty"`
+	Role      string    `json:"role,omitempty"`
+}
+
+// Actor is who made the replacements of a run. Role returns the role
+// assumed in an account.
+type Actor struct {
+	User     string
+	Host     string
+	Identity string
+	Role     func(accountID string) string
+}
+
+// NewEntries returns an entry for every replacement written to the files of
+// results, naming files by their absolute paths. Files that were skipped,
+// failed, or left unchanged have none.
+func NewEntries(timestamp time.Time, actor Actor, results []fileprocessor.FileResult) []Entry {
+	var entries []Entry
+
+	for _, result := range results {
+		if result.Count == 0 || result.Skipped || result.Err != nil {
+			continue
+		}
+
+		file, err := filepath.Abs(result.Path)
+		if err != nil {
+			file = result.Path
+		}
+
+		for _, replacement := range result.Replacements {
+			entry := Entry{
+				Timestamp: timestamp.UTC(),
+				File:      file,
+				OldAMI:    replacement.OldAMI,
+				NewAMI:    replacement.NewAMI,
+				Name:      replacement.Name,
+				Account:   replacement.Account,
+				Region:    replacement.Region,
+				User:      actor.User,
+				Host:      actor.Host,
+				Identity:  actor.Identity,
+			}
+
+			if actor.Role != nil {
+				entry.Role = actor.Role(replacement.Account)
+			}
+
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// Append appends entries to the audit log at path as JSON lines, creating it
+// if needed. The file is only ever appended to, in a single write, so the
+// entries of concurrent runs do not interleave.
+func Append(path string, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var lines bytes.Buffer
+
+	encoder := json.NewEncoder(&lines)
+
+	for _, entry := range entries {
+		err := encoder.Encode(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit entry: %w", err)
+		}
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), DirPerm)
+	if err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(filepath.Clean(path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, FilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	_, err = file.Write(lines.Bytes())
+	if err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	// Entries must reach the disk before the run reports success
+	err = file.Sync()
+	if err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	return nil
+}
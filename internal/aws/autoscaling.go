@@ -0,0 +1,194 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+)
+
+const launchTemplateLatestVersion = "$Latest"
+
+// AutoScalingGroup is an Auto Scaling group and the launch template version
+// it launches instances from.
+type AutoScalingGroup struct {
+	Name    string
+	Account string
+	Region  string
+
+	// LaunchTemplate is the launch template version the group currently
+	// resolves to. Its ID is empty when the group uses a launch configuration.
+	LaunchTemplate LaunchTemplate
+
+	// LaunchTemplateVersion is the version as set on the group: a version
+	// number, $Default, or $Latest.
+	LaunchTemplateVersion string
+
+	// MixedInstances reports whether the launch template is set through a
+	// mixed instances policy.
+	MixedInstances bool
+}
+
+// InstanceRefreshPreferences are the settings of an instance refresh. Zero
+// values use the group's defaults.
+type InstanceRefreshPreferences struct {
+	InstanceWarmup time.Duration
+	SkipMatching   bool
+}
+
+// FindAutoScalingGroups returns the Auto Scaling groups in an account and
+// region whose names match one of names (with * wildcards) and that carry
+// every tag, along with the launch template version each one uses. Empty
+// names and tags match every group.
+func (c *Client) FindAutoScalingGroups(ctx context.Context, accountID, region string, names []string,
+	tags map[string]string,
+) ([]AutoScalingGroup, error) {
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config for account %s: %w", accountID, err)
+	}
+
+	cfg.Region = region
+	autoScalingClient := c.newAutoScalingClient(cfg)
+	ec2Client := c.newEC2Client(cfg)
+
+	var filters []types.Filter
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		filters = append(filters, types.Filter{Name: aws.String("tag:" + key), Values: []string{tags[key]}})
+	}
+
+	var groups []AutoScalingGroup
+
+	paginator := autoscaling.NewDescribeAutoScalingGroupsPaginator(autoScalingClient,
+		&autoscaling.DescribeAutoScalingGroupsInput{Filters: filters})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe auto scaling groups: %w", err)
+		}
+
+		for _, group := range page.AutoScalingGroups {
+			name := aws.ToString(group.AutoScalingGroupName)
+			if len(names) > 0 && !slices.ContainsFunc(names, func(pattern string) bool {
+				return MatchNamePattern(pattern, name)
+			}) {
+				continue
+			}
+
+			autoScalingGroup := AutoScalingGroup{Name: name, Account: accountID, Region: region}
+
+			spec := group.LaunchTemplate
+			if spec == nil && group.MixedInstancesPolicy != nil && group.MixedInstancesPolicy.LaunchTemplate != nil {
+				spec = group.MixedInstancesPolicy.LaunchTemplate.LaunchTemplateSpecification
+				autoScalingGroup.MixedInstances = true
+			}
+
+			if spec != nil {
+				autoScalingGroup.LaunchTemplateVersion = aws.ToString(spec.Version)
+				if autoScalingGroup.LaunchTemplateVersion == "" {
+					autoScalingGroup.LaunchTemplateVersion = launchTemplateDefaultVersion
+				}
+
+				launchTemplate, found, err := describeLaunchTemplateVersion(ctx, ec2Client,
+					aws.ToString(spec.LaunchTemplateId), autoScalingGroup.LaunchTemplateVersion)
+				if err != nil {
+					return nil, fmt.Errorf("failed to describe launch template of group %s: %w", name, err)
+				}
+
+				if found {
+					launchTemplate.Account = accountID
+					launchTemplate.Region = region
+					autoScalingGroup.LaunchTemplate = launchTemplate
+				}
+			}
+
+			groups = append(groups, autoScalingGroup)
+		}
+	}
+
+	return groups, nil
+}
+
+// UsesDefaultVersion reports whether the group launches the default version
+// of its launch template.
+func (g AutoScalingGroup) UsesDefaultVersion() bool {
+	return g.LaunchTemplateVersion == launchTemplateDefaultVersion
+}
+
+// UseLaunchTemplateVersion points a group at a new version of its launch
+// template. Groups that launch $Default or $Latest are left alone, since they
+// pick up the new version without being changed.
+func (c *Client) UseLaunchTemplateVersion(ctx context.Context, group AutoScalingGroup, version int64) error {
+	if group.LaunchTemplateVersion == launchTemplateDefaultVersion ||
+		group.LaunchTemplateVersion == launchTemplateLatestVersion {
+		return nil
+	}
+
+	cfg, err := c.getConfig(group.Account)
+	if err != nil {
+		return fmt.Errorf("failed to get config for account %s: %w", group.Account, err)
+	}
+
+	cfg.Region = group.Region
+	autoScalingClient := c.newAutoScalingClient(cfg)
+
+	spec := &types.LaunchTemplateSpecification{
+		LaunchTemplateId: aws.String(group.LaunchTemplate.ID),
+		Version:          aws.String(strconv.FormatInt(version, 10)),
+	}
+
+	input := &autoscaling.UpdateAutoScalingGroupInput{AutoScalingGroupName: aws.String(group.Name)}
+	if group.MixedInstances {
+		input.MixedInstancesPolicy = &types.MixedInstancesPolicy{
+			LaunchTemplate: &types.LaunchTemplate{LaunchTemplateSpecification: spec},
+		}
+	} else {
+		input.LaunchTemplate = spec
+	}
+
+	_, err = autoScalingClient.UpdateAutoScalingGroup(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to update auto scaling group %s: %w", group.Name, err)
+	}
+
+	return nil
+}
+
+// StartInstanceRefresh starts an instance refresh of a group and returns its
+// ID.
+func (c *Client) StartInstanceRefresh(ctx context.Context, group AutoScalingGroup,
+	preferences InstanceRefreshPreferences,
+) (string, error) {
+	cfg, err := c.getConfig(group.Account)
+	if err != nil {
+		return "", fmt.Errorf("failed to get config for account %s: %w", group.Account, err)
+	}
+
+	cfg.Region = group.Region
+	autoScalingClient := c.newAutoScalingClient(cfg)
+
+	refreshPreferences := &types.RefreshPreferences{SkipMatching: aws.Bool(preferences.SkipMatching)}
+	if preferences.InstanceWarmup > 0 {
+		refreshPreferences.InstanceWarmup = aws.Int32(int32(preferences.InstanceWarmup / time.Second))
+	}
+
+	result, err := autoScalingClient.StartInstanceRefresh(ctx, &autoscaling.StartInstanceRefreshInput{
+		AutoScalingGroupName: aws.String(group.Name),
+		Preferences:          refreshPreferences,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to start instance refresh of group %s: %w", group.Name, err)
+	}
+
+	return aws.ToString(result.InstanceRefreshId), nil
+}
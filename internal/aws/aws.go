@@ -8,10 +8,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -19,7 +22,10 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
 )
 
 var (
@@ -27,104 +33,303 @@ var (
 	ErrNoRegion    = errors.New("no region configured in AWS profile or environment")
 )
 
+const (
+	defaultRegion = "us-east-1"
+
+	// maxFilterValues is the most values a DescribeImages filter accepts.
+	maxFilterValues = 200
+
+	// AccountIDPlaceholder is replaced with the target account ID in role ARN templates.
+	AccountIDPlaceholder = "{{account_id}}"
+)
+
+// ownerAliases are the DescribeImages owner aliases accepted in place of an
+// account ID.
+var ownerAliases = []string{"amazon", "self", "aws-marketplace", "aws-backup-vault"}
+
+var amiIDRegex = regexp.MustCompile(`ami-[a-f0-9]{8,17}`)
+
+// ProvenanceMarker starts the comments that record which AMI a line held
+// before it was updated. AMI IDs after it on the same line are not references.
+const ProvenanceMarker = "ami-util: was "
+
+var provenanceRegex = regexp.MustCompile(regexp.QuoteMeta(ProvenanceMarker) + `[^\n]*`)
+
+// maskedAMIPrefix stands in for the ami- prefix of the AMI IDs in provenance
+// comments while content is searched, keeping offsets unchanged.
+const maskedAMIPrefix = "ami\x00"
+
 type AMIInfo struct {
 	ImageID      string
 	Name         string
 	CreationDate time.Time
 	Owner        string
 	Region       string
+	Architecture string
+
+	VirtualizationType string
+	RootDeviceType     string
+	BootMode           string
+
+	Tags map[string]string
+
+	// Encrypted reports whether every EBS snapshot of the AMI is encrypted.
+	Encrypted bool
+	Public    bool
+}
+
+// Explanation describes how the latest AMI for an existing AMI ID was chosen.
+type Explanation struct {
+	AMI        AMIInfo
+	Pattern    string
+	Candidates []AMIInfo
+	Latest     *AMIInfo
+}
+
+type AMIReference struct {
+	AMI    string
+	Line   int
+	Column int
 }
 
 type AMIReplacement struct {
-	OldAMI string
-	NewAMI string
-	Name   string
+	OldAMI  string
+	NewAMI  string
+	Name    string
+	Account string
+	Region  string
+
+	// SourceRegion is set when OldAMI belongs to a different region than
+	// Region, for a replacement that maps it onto its equivalent in Region.
+	SourceRegion string
+
+	// Created is when NewAMI was created, and OldCreated when OldAMI was,
+	// or zero when it is not known.
+	Created    time.Time
+	OldCreated time.Time
+}
+
+// CrossRegion reports whether the replacement maps an AMI onto its equivalent
+// in another region.
+func (r AMIReplacement) CrossRegion() bool {
+	return r.SourceRegion != "" && r.SourceRegion != r.Region
+}
+
+// AccountRole is the role assumed to query AMIs owned by a specific account.
+// Empty session name and external ID fall back to the AWS_ROLE_* variables.
+type AccountRole struct {
+	RoleARN     string
+	SessionName string
+	ExternalID  string
 }
 
 type Client struct {
-	cfg     aws.Config
-	ec2     *ec2.Client
-	sts     *sts.Client
-	profile string
-	roleARN string
+	cfg        aws.Config
+	ec2        *ec2.Client
+	sts        *sts.Client
+	profile    string
+	roleARN    string
+	ssoProfile string
+	ssoLogin   bool
+
+	webIdentityTokenFile string
+	roleARNTemplate      string
+	accountRoles         map[string]AccountRole
+	mfa                  *mfaTokenProvider
+	imageFilter          ImageFilter
+	patternFilters       map[string]ImageFilter
+	endpointURL          string
+	session              sessionSettings
+
+	// inspector limits the Inspector findings of candidates, and findings
+	// keeps the outcome of their checks.
+	inspector inspectorSettings
+	findings  findingsCache
+
+	// assumed caches the configuration for each assumed role, so credentials
+	// (and any MFA prompt) are obtained once per role rather than per call.
+	assumedMu sync.Mutex
+	assumed   map[AccountRole]aws.Config
+
+	// describes reuses the DescribeImages calls of lookups.
+	describes describeCache
+
+	// found records the ID of every AMI that lookups have described.
+	foundMu sync.Mutex
+	found   map[string]bool
 }
 
-func NewClient(profile, roleARN string) (*Client, error) {
-	ctx := context.Background()
+func NewClient(ctx context.Context, profile, roleARN string, opts ...Option) (*Client, error) {
+	options := &clientOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	err := options.loadPolicy()
+	if err != nil {
+		return nil, err
+	}
 
-	cfg, err := config.LoadDefaultConfig(ctx,
+	loadOptions := append([]func(*config.LoadOptions) error{
 		config.WithSharedConfigProfile(profile),
-	)
+	}, options.loadOptions()...)
+
+	cfg, err := config.LoadDefaultConfig(ctx, loadOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
-	return &Client{
-		cfg:     cfg,
-		ec2:     ec2.NewFromConfig(cfg),
-		sts:     sts.NewFromConfig(cfg),
-		profile: profile,
-		roleARN: roleARN,
-	}, nil
-}
+	// Every call, including those of assumed roles, is counted and is a span
+	// of the trace in its context, if any
+	otelaws.AppendMiddlewares(&cfg.APIOptions)
+	cfg.APIOptions = append(cfg.APIOptions, countAPICalls)
 
-func (c *Client) AssumeRole() (aws.Config, error) {
-	roleARN := c.roleARN
-	if roleARN == "" {
-		roleARN = os.Getenv("AWS_ROLE_ARN")
+	ssoProfile := options.ssoProfile
+	if ssoProfile == "" {
+		ssoProfile = profile
 	}
 
-	if roleARN == "" {
-		return c.cfg, nil
+	client := &Client{
+		cfg:        cfg,
+		profile:    profile,
+		roleARN:    roleARN,
+		ssoProfile: ssoProfile,
+		ssoLogin:   options.ssoLogin,
+
+		webIdentityTokenFile: options.webIdentityTokenFile,
+		roleARNTemplate:      options.roleARNTemplate,
+		accountRoles:         options.accountRoles,
+		mfa:                  options.mfa,
+		imageFilter:          options.imageFilter,
+		patternFilters:       options.patternFilters,
+		endpointURL:          options.endpointURL,
+		session:              options.session,
+		inspector:            options.inspector,
+		assumed:              make(map[AccountRole]aws.Config),
+		found:                make(map[string]bool),
+		describes:            describeCache{calls: make(map[string]*describeCall)},
+		findings:             findingsCache{checked: make(map[string]error)},
+	}
+
+	client.ec2 = client.newEC2Client(cfg)
+	client.sts = client.newSTSClient(cfg)
+
+	return client, nil
+}
+
+func (c *Client) AssumeRole(role AccountRole) (aws.Config, error) {
+	roleARN := role.RoleARN
+
+	sessionName := role.SessionName
+	if sessionName == "" {
+		sessionName = os.Getenv("AWS_ROLE_SESSION_NAME")
 	}
 
-	sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
 	if sessionName == "" {
 		sessionName = "UpdateToLatestAMI"
 	}
 
-	externalID := os.Getenv("AWS_ROLE_EXTERNAL_ID")
+	stsClient := c.newSTSClient(c.cfg)
 
-	stsClient := sts.NewFromConfig(c.cfg)
+	cfg := c.cfg.Copy()
+
+	tokenFile := c.webIdentityTokenFile
+	if tokenFile == "" {
+		tokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+
+	// With a web identity token (EKS IRSA, GitHub OIDC) the role is assumed
+	// directly from the token, so no long-lived source credentials are needed.
+	if tokenFile != "" {
+		webIdentityProvider := stscreds.NewWebIdentityRoleProvider(stsClient, roleARN,
+			stscreds.IdentityTokenFile(tokenFile), func(o *stscreds.WebIdentityRoleOptions) {
+				o.RoleSessionName = sessionName
+				if c.session.duration > 0 {
+					o.Duration = c.session.duration
+				}
+			})
+
+		cfg.Credentials = aws.NewCredentialsCache(webIdentityProvider)
+
+		return cfg, nil
+	}
+
+	externalID := role.ExternalID
+	if externalID == "" {
+		externalID = os.Getenv("AWS_ROLE_EXTERNAL_ID")
+	}
 
 	assumeRoleProvider := stscreds.NewAssumeRoleProvider(stsClient, roleARN, func(o *stscreds.AssumeRoleOptions) {
 		o.RoleSessionName = sessionName
+		c.session.apply(o)
+
 		if externalID != "" {
 			o.ExternalID = aws.String(externalID)
 		}
+
+		if c.mfa.serial != "" {
+			o.SerialNumber = aws.String(c.mfa.serial)
+			o.TokenProvider = c.mfa.tokenCode
+		}
 	})
 
-	cfg := c.cfg.Copy()
 	cfg.Credentials = aws.NewCredentialsCache(assumeRoleProvider)
 
 	return cfg, nil
 }
 
-func (c *Client) GetLatestAMIs(accountID, region string, patterns []string) ([]AMIReplacement, error) {
-	cfg, err := c.getConfig()
+func (c *Client) GetLatestAMIs(ctx context.Context, accountID, region string, patterns []string,
+) ([]AMIReplacement, error) {
+	cfg, err := c.getConfig(accountID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get config for account %s: %w", accountID, err)
 	}
 
 	cfg.Region = region
-	ec2Client := ec2.NewFromConfig(cfg)
+	ec2Client := c.newEC2Client(cfg)
 
 	var replacements []AMIReplacement
 
 	for _, pattern := range patterns {
-		patternReplacements, err := c.processPattern(ec2Client, accountID, pattern)
+		var patternReplacements []AMIReplacement
+
+		if strings.HasPrefix(pattern, ExecPatternPrefix) {
+			patternReplacements, err = runResolverPlugin(ctx, PluginRequest{
+				Pattern: pattern,
+				Account: accountID,
+				Region:  region,
+				AMIs:    referencedAMIIDs(patterns),
+			})
+		} else {
+			patternReplacements, err = c.processPattern(ctx, cfg, ec2Client, accountID, pattern)
+		}
+
 		if err != nil {
 			return nil, err
 		}
 
+		// SSM parameters and plugins name the new AMI rather than choosing it
+		// among filtered candidates
+		if strings.HasPrefix(pattern, ExecPatternPrefix) || strings.HasPrefix(pattern, SSMPatternPrefix) {
+			patternReplacements, err = c.enforcePolicy(ctx, ec2Client, region, pattern, patternReplacements)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		replacements = append(replacements, patternReplacements...)
 	}
 
+	for i := range replacements {
+		replacements[i].Account = accountID
+		replacements[i].Region = region
+	}
+
 	return replacements, nil
 }
 
 func (c *Client) GetRegion() (string, error) {
-	cfg, err := c.getConfig()
+	cfg, err := c.getConfig("")
 	if err != nil {
 		return "", fmt.Errorf("failed to get config: %w", err)
 	}
@@ -137,98 +342,400 @@ func (c *Client) GetRegion() (string, error) {
 	return region, nil
 }
 
-func (c *Client) getConfig() (aws.Config, error) {
-	if c.roleARN != "" || os.Getenv("AWS_ROLE_ARN") != "" {
-		return c.AssumeRole()
+func (c *Client) GetCallerIdentity(ctx context.Context, accountID, region string) (string, error) {
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get config: %w", err)
+	}
+
+	if region != "" {
+		cfg.Region = region
 	}
 
-	return c.cfg, nil
+	result, err := c.newSTSClient(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get caller identity: %w", err)
+	}
+
+	return aws.ToString(result.Arn), nil
 }
 
-func (c *Client) processPattern(ec2Client *ec2.Client, accountID, pattern string) ([]AMIReplacement, error) {
+// Identity returns the ARN of the principal of the client's own credentials,
+// before any role is assumed.
+func (c *Client) Identity(ctx context.Context, region string) (string, error) {
+	cfg := c.cfg.Copy()
+	if region != "" {
+		cfg.Region = region
+	}
+
+	result, err := c.newSTSClient(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get caller identity: %w", err)
+	}
+
+	return aws.ToString(result.Arn), nil
+}
+
+// RoleARN returns the ARN of the role assumed to query accountID, or an empty
+// ARN when the client's own credentials are used.
+func (c *Client) RoleARN(accountID string) string {
+	return c.roleFor(accountID).RoleARN
+}
+
+func (c *Client) CheckDescribeImages(ctx context.Context, accountID, region string) error {
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return fmt.Errorf("failed to get config for account %s: %w", accountID, err)
+	}
+
+	cfg.Region = region
+
+	_, err = c.newEC2Client(cfg).DescribeImages(ctx, &ec2.DescribeImagesInput{
+		DryRun: aws.Bool(true),
+		Owners: []string{accountID},
+	})
+	if err != nil && !strings.Contains(err.Error(), "DryRunOperation") {
+		return fmt.Errorf("failed to describe images: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) ListRegions(ctx context.Context) ([]string, error) {
+	return c.ListEnabledRegions(ctx, "")
+}
+
+// ListEnabledRegions returns the regions enabled for an account: those that
+// need no opt-in and those the account has opted in to.
+func (c *Client) ListEnabledRegions(ctx context.Context, accountID string) ([]string, error) {
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+
+	if cfg.Region == "" {
+		cfg.Region = defaultRegion
+	}
+
+	result, err := c.newEC2Client(cfg).DescribeRegions(ctx, &ec2.DescribeRegionsInput{
+		Filters: []types.Filter{{
+			Name:   aws.String("opt-in-status"),
+			Values: []string{"opt-in-not-required", "opted-in"},
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe regions: %w", err)
+	}
+
+	regions := make([]string, 0, len(result.Regions))
+	for _, region := range result.Regions {
+		regions = append(regions, aws.ToString(region.RegionName))
+	}
+
+	sort.Strings(regions)
+
+	return regions, nil
+}
+
+// getConfig returns the configuration used to query AMIs owned by accountID,
+// assuming the role for that account when one is configured. An empty
+// accountID selects the default role.
+func (c *Client) getConfig(accountID string) (aws.Config, error) {
+	role := c.roleFor(accountID)
+	if role.RoleARN == "" {
+		return c.cfg, nil
+	}
+
+	c.assumedMu.Lock()
+	defer c.assumedMu.Unlock()
+
+	cfg, ok := c.assumed[role]
+	if !ok {
+		var err error
+
+		cfg, err = c.AssumeRole(role)
+		if err != nil {
+			return aws.Config{}, err
+		}
+
+		c.assumed[role] = cfg
+	}
+
+	return cfg.Copy(), nil
+}
+
+// IsOwnerAlias reports whether owner is an owner alias such as amazon or self
+// rather than an account ID.
+func IsOwnerAlias(owner string) bool {
+	return slices.Contains(ownerAliases, owner)
+}
+
+// OwnerAliases returns the owner aliases accepted in place of an account ID.
+func OwnerAliases() []string {
+	return slices.Clone(ownerAliases)
+}
+
+// roleFor picks the role for accountID: an explicit account role, then the
+// role ARN template, then the single role ARN or AWS_ROLE_ARN. Owner aliases
+// are not real accounts, so they always use the single role.
+func (c *Client) roleFor(accountID string) AccountRole {
+	if role, ok := c.accountRoles[accountID]; ok && accountID != "" {
+		return role
+	}
+
+	if c.roleARNTemplate != "" && accountID != "" && !IsOwnerAlias(accountID) {
+		return AccountRole{RoleARN: strings.ReplaceAll(c.roleARNTemplate, AccountIDPlaceholder, accountID)}
+	}
+
+	if c.roleARN != "" {
+		return AccountRole{RoleARN: c.roleARN}
+	}
+
+	return AccountRole{RoleARN: os.Getenv("AWS_ROLE_ARN")}
+}
+
+func (c *Client) processPattern(ctx context.Context, cfg aws.Config, ec2Client *ec2.Client, accountID, pattern string,
+) ([]AMIReplacement, error) {
+	if strings.HasPrefix(pattern, SSMPatternPrefix) {
+		return c.processSSMParameter(ctx, ssm.NewFromConfig(cfg), strings.TrimPrefix(pattern, SSMPatternPrefix))
+	}
+
+	if strings.HasPrefix(pattern, MarketplacePatternPrefix) {
+		return c.processMarketplaceProduct(ctx, ec2Client, accountID, pattern)
+	}
+
 	if strings.HasPrefix(pattern, "ami-") {
-		return c.processAMIID(ec2Client, accountID, pattern)
+		return c.processAMIID(ctx, ec2Client, accountID, pattern)
 	}
 
-	return c.processPatternBased(ec2Client, accountID, pattern)
+	return c.processPatternBased(ctx, ec2Client, accountID, pattern)
 }
 
-func (c *Client) processAMIID(ec2Client *ec2.Client, accountID, amiID string) ([]AMIReplacement, error) {
-	amiInfo, err := c.findAMIByID(ec2Client, accountID, amiID)
+func (c *Client) processAMIID(ctx context.Context, ec2Client *ec2.Client, accountID, amiID string,
+) ([]AMIReplacement, error) {
+	explanation, err := c.explainAMIID(ctx, ec2Client, accountID, amiID)
 	if err != nil {
 		if errors.Is(err, ErrAMINotFound) {
 			return nil, nil
 		}
 
-		return nil, fmt.Errorf("failed to find AMI %s: %w", amiID, err)
+		return nil, err
 	}
 
-	pattern := amiInfo.Name
-	if strings.Contains(amiInfo.Name, "bottlerocket-aws-ecs-2-aarch64-") {
-		pattern = "bottlerocket-aws-ecs-2-aarch64-*"
+	if explanation.Latest == nil || explanation.AMI.ImageID == explanation.Latest.ImageID {
+		return nil, nil
 	}
 
-	amis, err := c.findAMIsByPattern(ec2Client, accountID, pattern)
+	return []AMIReplacement{{
+		OldAMI:  explanation.AMI.ImageID,
+		NewAMI:  explanation.Latest.ImageID,
+		Name:    explanation.AMI.Name,
+		Created: explanation.Latest.CreationDate,
+
+		OldCreated: explanation.AMI.CreationDate,
+	}}, nil
+}
+
+func (c *Client) FindLatestAMI(ctx context.Context, accountID, region, pattern string) (*AMIInfo, error) {
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config for account %s: %w", accountID, err)
+	}
+
+	cfg.Region = region
+
+	filter := c.filterFor(pattern)
+
+	amis, err := c.findAMIsByPattern(ctx, c.newEC2Client(cfg), accountID, pattern, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find AMIs for pattern %s: %w", pattern, err)
 	}
 
+	amis = filter.candidates(amis)
 	if len(amis) == 0 {
-		return nil, nil
+		return nil, ErrAMINotFound
 	}
 
-	sort.Slice(amis, func(i, j int) bool {
-		return amis[i].CreationDate.After(amis[j].CreationDate)
-	})
+	sortNewestFirst(amis, filter.Version)
 
 	latest := amis[0]
-	if amiInfo.ImageID != latest.ImageID {
-		return []AMIReplacement{{
-			OldAMI: amiInfo.ImageID,
-			NewAMI: latest.ImageID,
-			Name:   amiInfo.Name,
-		}}, nil
+	latest.Region = region
+
+	return &latest, nil
+}
+
+// NewestAMI returns the newest of amis, the latest AMIs of pattern found in
+// different regions, ranked as FindLatestAMI ranks the candidates of one
+// region: by the version of the pattern's filter, if any, and else by date.
+func (c *Client) NewestAMI(pattern string, amis []AMIInfo) AMIInfo {
+	ranked := slices.Clone(amis)
+	sortNewestFirst(ranked, c.filterFor(pattern).Version)
+
+	return ranked[0]
+}
+
+// DescribeAMIs returns those of amiIDs that exist in region and are visible to
+// the default credentials, whoever owns them, with Owner set to the account
+// that owns each. AMI IDs that are not found are left out.
+func (c *Client) DescribeAMIs(ctx context.Context, region string, amiIDs []string) ([]AMIInfo, error) {
+	return c.DescribeAccountAMIs(ctx, "", region, amiIDs)
+}
+
+// DescribeAccountAMIs is DescribeAMIs with the role assumed for accountID, so
+// that private AMIs visible only to that account are found too.
+func (c *Client) DescribeAccountAMIs(ctx context.Context, accountID, region string, amiIDs []string,
+) ([]AMIInfo, error) {
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config for account %s: %w", accountID, err)
 	}
 
-	return nil, nil
+	cfg.Region = region
+
+	return describeImageIDs(ctx, c.newEC2Client(cfg), region, amiIDs)
 }
 
-func (c *Client) processPatternBased(ec2Client *ec2.Client, accountID, pattern string) ([]AMIReplacement, error) {
-	amis, err := c.findAMIsByPattern(ec2Client, accountID, pattern)
+func (c *Client) ExplainAMI(ctx context.Context, accountID, region, amiID string) (*Explanation, error) {
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config for account %s: %w", accountID, err)
+	}
+
+	cfg.Region = region
+
+	return c.explainAMIID(ctx, c.newEC2Client(cfg), accountID, amiID)
+}
+
+func (c *Client) explainAMIID(ctx context.Context, ec2Client *ec2.Client, accountID, amiID string,
+) (*Explanation, error) {
+	amiInfo, err := c.findAMIByID(ctx, ec2Client, accountID, amiID)
+	if err != nil {
+		if errors.Is(err, ErrAMINotFound) {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("failed to find AMI %s: %w", amiID, err)
+	}
+
+	pattern := DerivePattern(amiInfo.Name)
+
+	filter, ok := c.filterMatching(*amiInfo)
+	if !ok {
+		return &Explanation{AMI: *amiInfo, Pattern: pattern}, nil
+	}
+
+	amis, err := c.findAMIsByPattern(ctx, ec2Client, accountID, pattern, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find AMIs for pattern %s: %w", pattern, err)
 	}
 
+	amis = filter.candidates(amis)
+	sortNewestFirst(amis, filter.Version)
+
+	explanation := &Explanation{
+		AMI:        *amiInfo,
+		Pattern:    pattern,
+		Candidates: amis,
+	}
+
+	// A rejected AMI that ranks ahead of every candidate that passes the
+	// Inspector check is kept rather than replaced by an older image.
+	latest, ok := c.passingFindings(ctx, accountID, ec2Client.Options().Region, amis)
+	if ok {
+		explanation.Latest = &latest
+
+		if ranksAhead(explanation.AMI, latest, filter.Version) {
+			explanation.Latest = &explanation.AMI
+		}
+	}
+
+	return explanation, nil
+}
+
+// DerivePattern returns the name pattern used to search for newer versions of
+// an AMI with the given name.
+func DerivePattern(name string) string {
+	if strings.Contains(name, "bottlerocket-aws-ecs-2-aarch64-") {
+		return "bottlerocket-aws-ecs-2-aarch64-*"
+	}
+
+	return name
+}
+
+// versionRegex matches the parts of AMI names that change from one build to
+// the next: dotted versions holding a date or timestamp, and ISO dates with
+// an optional time.
+var versionRegex = regexp.MustCompile(
+	`\d*(?:\.\d+)*\.?\d{8,}(?:\.\d+)*|\d{4}[-.]\d{2}[-.]\d{2}(?:[T_-]?\d{2}[-:.]?\d{2}(?:[-:.]?\d{2})?Z?)?`)
+
+// GeneralizeName returns a pattern matching the name of an AMI and those of
+// its later builds, with its build dates and timestamps replaced by
+// wildcards. Names without any are returned as DerivePattern returns them.
+func GeneralizeName(name string) string {
+	if pattern := DerivePattern(name); pattern != name {
+		return pattern
+	}
+
+	return versionRegex.ReplaceAllString(name, "*")
+}
+
+func (c *Client) processPatternBased(ctx context.Context, ec2Client *ec2.Client, accountID, pattern string,
+) ([]AMIReplacement, error) {
+	filter := c.filterFor(pattern)
+
+	amis, err := c.findAMIsByPattern(ctx, ec2Client, accountID, pattern, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find AMIs for pattern %s: %w", pattern, err)
+	}
+
+	return replaceWithNewest(amis, filter, c.findingsCheck(ctx, ec2Client, accountID)), nil
+}
+
+// replaceWithNewest maps every AMI onto the newest AMI of its architecture
+// that passes checks. Broad patterns can match several architectures, so each
+// AMI must only be replaced by an image it can actually be swapped for.
+// Rejected AMIs and those that fail checks are never chosen, and those newer
+// than the chosen AMI are left alone.
+func replaceWithNewest(amis []AMIInfo, filter ImageFilter, passes func(AMIInfo) bool) []AMIReplacement {
 	if len(amis) == 0 {
-		return nil, nil
+		return nil
 	}
 
-	sort.Slice(amis, func(i, j int) bool {
-		return amis[i].CreationDate.After(amis[j].CreationDate)
-	})
+	sortNewestFirst(amis, filter.Version)
 
-	latest := amis[0]
+	latest := make(map[string]AMIInfo)
 	replacements := make([]AMIReplacement, 0, len(amis)-1)
 
-	for _, ami := range amis[1:] {
+	for _, ami := range amis {
+		newest, ok := latest[ami.Architecture]
+		if !ok {
+			if !filter.rejects(ami) && passes(ami) {
+				latest[ami.Architecture] = ami
+			}
+
+			continue
+		}
+
 		replacements = append(replacements, AMIReplacement{
-			OldAMI: ami.ImageID,
-			NewAMI: latest.ImageID,
-			Name:   ami.Name,
+			OldAMI:  ami.ImageID,
+			NewAMI:  newest.ImageID,
+			Name:    ami.Name,
+			Created: newest.CreationDate,
+
+			OldCreated: ami.CreationDate,
 		})
 	}
 
-	return replacements, nil
+	return replacements
 }
 
-func (c *Client) findAMIByID(ec2Client *ec2.Client, owner, amiID string) (*AMIInfo, error) {
-	ctx := context.Background()
+func (c *Client) findAMIByID(ctx context.Context, ec2Client *ec2.Client, owner, amiID string) (*AMIInfo, error) {
 	input := &ec2.DescribeImagesInput{
 		ImageIds: []string{amiID},
 		Owners:   []string{owner},
 	}
 
-	result, err := ec2Client.DescribeImages(ctx, input)
+	result, err := c.describeImages(ctx, ec2Client, input)
 	if err != nil {
 		if strings.Contains(err.Error(), "InvalidAMIID.NotFound") || strings.Contains(err.Error(), "does not exist") {
 			return nil, ErrAMINotFound
@@ -241,63 +748,185 @@ func (c *Client) findAMIByID(ec2Client *ec2.Client, owner, amiID string) (*AMIIn
 		return nil, ErrAMINotFound
 	}
 
-	image := result.Images[0]
-
-	creationDate, err := time.Parse(time.RFC3339, aws.ToString(image.CreationDate))
+	amiInfo, err := newAMIInfo(result.Images[0], owner)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse creation date for AMI %s: %w", amiID, err)
 	}
 
-	return &AMIInfo{
-		ImageID:      aws.ToString(image.ImageId),
-		Name:         aws.ToString(image.Name),
-		CreationDate: creationDate,
-		Owner:        owner,
-	}, nil
+	c.recordFound(amiInfo)
+
+	return &amiInfo, nil
 }
 
-func (c *Client) findAMIsByPattern(ec2Client *ec2.Client, owner, pattern string) ([]AMIInfo, error) {
-	ctx := context.Background()
-	input := &ec2.DescribeImagesInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String("name"),
-				Values: []string{pattern},
-			},
+func (c *Client) findAMIsByPattern(ctx context.Context, ec2Client *ec2.Client, owner, pattern string,
+	filter ImageFilter,
+) ([]AMIInfo, error) {
+	return c.describeAMIs(ctx, ec2Client, owner, append([]types.Filter{
+		{
+			Name:   aws.String("name"),
+			Values: []string{pattern},
 		},
-		Owners: []string{owner},
+	}, filter.ec2Filters()...))
+}
+
+func (c *Client) describeAMIs(ctx context.Context, ec2Client *ec2.Client, owner string, filters []types.Filter,
+) ([]AMIInfo, error) {
+	input := &ec2.DescribeImagesInput{
+		Filters: filters,
+		Owners:  []string{owner},
 	}
 
-	result, err := ec2Client.DescribeImages(ctx, input)
+	result, err := c.describeImages(ctx, ec2Client, input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to describe images: %w", err)
 	}
 
 	amis := make([]AMIInfo, 0, len(result.Images))
 	for _, image := range result.Images {
-		creationDate, err := time.Parse(time.RFC3339, aws.ToString(image.CreationDate))
+		amiInfo, err := newAMIInfo(image, owner)
 		if err != nil {
+			warnUnparsable(image, err)
+
 			continue
 		}
 
-		amis = append(amis, AMIInfo{
-			ImageID:      aws.ToString(image.ImageId),
-			Name:         aws.ToString(image.Name),
-			CreationDate: creationDate,
-			Owner:        owner,
-		})
+		amis = append(amis, amiInfo)
 	}
 
+	c.recordFound(amis...)
+
 	return amis, nil
 }
 
+func (c *Client) recordFound(amis ...AMIInfo) {
+	c.foundMu.Lock()
+	defer c.foundMu.Unlock()
+
+	for _, ami := range amis {
+		c.found[ami.ImageID] = true
+	}
+}
+
+// Found reports whether a lookup has found amiID in any account and region,
+// whether or not it has a replacement.
+func (c *Client) Found(amiID string) bool {
+	c.foundMu.Lock()
+	defer c.foundMu.Unlock()
+
+	return c.found[amiID]
+}
+
+// warnUnparsable logs an image left out of the results, rather than failing
+// the lookup, because its creation date could not be parsed.
+func warnUnparsable(image types.Image, err error) {
+	slog.Warn("Skipping AMI with an unparsable creation date", "ami", aws.ToString(image.ImageId), "error", err)
+}
+
+func newAMIInfo(image types.Image, owner string) (AMIInfo, error) {
+	creationDate, err := time.Parse(time.RFC3339, aws.ToString(image.CreationDate))
+	if err != nil {
+		return AMIInfo{}, fmt.Errorf("invalid creation date: %w", err)
+	}
+
+	return AMIInfo{
+		ImageID:      aws.ToString(image.ImageId),
+		Name:         aws.ToString(image.Name),
+		CreationDate: creationDate,
+		Owner:        owner,
+		Architecture: string(image.Architecture),
+
+		VirtualizationType: string(image.VirtualizationType),
+		RootDeviceType:     string(image.RootDeviceType),
+		BootMode:           string(image.BootMode),
+
+		Tags:      imageTags(image.Tags),
+		Encrypted: encryptedSnapshots(image.BlockDeviceMappings),
+		Public:    aws.ToBool(image.Public),
+	}, nil
+}
+
+func imageTags(tags []types.Tag) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	imageTags := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		imageTags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	return imageTags
+}
+
+// encryptedSnapshots reports whether an AMI has EBS snapshots and all of them
+// are encrypted.
+func encryptedSnapshots(mappings []types.BlockDeviceMapping) bool {
+	encrypted := false
+
+	for _, mapping := range mappings {
+		if mapping.Ebs == nil {
+			continue
+		}
+
+		if !aws.ToBool(mapping.Ebs.Encrypted) {
+			return false
+		}
+
+		encrypted = true
+	}
+
+	return encrypted
+}
+
+// maskProvenance hides the AMI IDs in provenance comments from amiIDRegex.
+func maskProvenance(content string) string {
+	if !strings.Contains(content, ProvenanceMarker) {
+		return content
+	}
+
+	return provenanceRegex.ReplaceAllStringFunc(content, func(comment string) string {
+		return strings.ReplaceAll(comment, "ami-", maskedAMIPrefix)
+	})
+}
+
+func unmaskProvenance(content string) string {
+	return strings.ReplaceAll(content, maskedAMIPrefix, "ami-")
+}
+
+// amiIDIndexes returns the offsets of the AMI IDs in content that are whole
+// tokens, leaving out matches within a longer hex string or another
+// identifier, such as the start of ami-0123456789abcdef0 read as an 8-digit ID.
+func amiIDIndexes(content string) [][]int {
+	var indexes [][]int
+
+	for _, loc := range amiIDRegex.FindAllStringIndex(content, -1) {
+		if !isTokenByte(content, loc[0]-1) && !isTokenByte(content, loc[1]) {
+			indexes = append(indexes, loc)
+		}
+	}
+
+	return indexes
+}
+
+// isTokenByte reports whether the byte at offset of content, if any, would
+// continue an AMI ID into a longer identifier.
+func isTokenByte(content string, offset int) bool {
+	if offset < 0 || offset >= len(content) {
+		return false
+	}
+
+	char := content[offset]
+
+	return char == '-' || char == '_' || (char >= '0' && char <= '9') || (char >= 'a' && char <= 'z') ||
+		(char >= 'A' && char <= 'Z')
+}
+
 func ExtractAMIPatterns(content string) []string {
-	amiRegex := regexp.MustCompile(`ami-[a-f0-9]{8,17}`)
-	amiMatches := amiRegex.FindAllString(content, -1)
+	masked := maskProvenance(content)
 
 	amiMap := make(map[string]bool)
-	for _, ami := range amiMatches {
-		amiMap[ami] = true
+	for _, loc := range amiIDIndexes(masked) {
+		amiMap[masked[loc[0]:loc[1]]] = true
 	}
 
 	amis := make([]string, 0, len(amiMap))
@@ -308,17 +937,113 @@ func ExtractAMIPatterns(content string) []string {
 	return amis
 }
 
-func ReplaceAMIsInContent(content string, replacements []AMIReplacement) (string, int) {
-	replaceCount := 0
-	newContent := content
+func FindAMIReferences(content string) []AMIReference {
+	var references []AMIReference
+
+	for lineIndex, line := range strings.Split(maskProvenance(content), "\n") {
+		for _, loc := range amiIDIndexes(line) {
+			references = append(references, AMIReference{
+				AMI:    line[loc[0]:loc[1]],
+				Line:   lineIndex + 1,
+				Column: loc[0] + 1,
+			})
+		}
+	}
+
+	return references
+}
+
+func ContainsAMI(content []byte) bool {
+	return len(amiIDIndexes(maskProvenance(string(content)))) > 0
+}
+
+// IsPinned reports whether the replacement's old AMI matches one of the pins,
+// either by exact AMI ID or by a name pattern using * and ? wildcards.
+func IsPinned(replacement AMIReplacement, pins []string) bool {
+	for _, pin := range pins {
+		if pin == replacement.OldAMI || MatchNamePattern(pin, replacement.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchNamePattern matches an AMI name against a pattern using the same
+// * and ? wildcards as the DescribeImages name filter.
+func MatchNamePattern(pattern, name string) bool {
+	var expr strings.Builder
+
+	expr.WriteString("^")
+
+	for _, char := range pattern {
+		switch char {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+
+	expr.WriteString("$")
+
+	matched, err := regexp.MatchString(expr.String(), name)
+
+	return err == nil && matched
+}
+
+// ReplaceAMIsInContent replaces the AMI IDs in content that are whole tokens
+// with their replacement, the first one for an AMI ID that has several, and
+// returns the new content, how many AMI IDs were replaced, and the
+// replacements applied. Content is read once, so a new AMI is never replaced
+// in turn.
+func ReplaceAMIsInContent(content string, replacements []AMIReplacement) (string, int, []AMIReplacement) {
+	masked := maskProvenance(content)
+
+	first := make(map[string]int)
+
+	for i, replacement := range replacements {
+		if _, ok := first[replacement.OldAMI]; !ok {
+			first[replacement.OldAMI] = i
+		}
+	}
+
+	var (
+		builder      strings.Builder
+		replaceCount int
+		used         = make(map[int]bool)
+		last         = 0
+	)
+
+	for _, loc := range amiIDIndexes(masked) {
+		index, ok := first[masked[loc[0]:loc[1]]]
+		if !ok {
+			continue
+		}
+
+		builder.WriteString(masked[last:loc[0]])
+		builder.WriteString(replacements[index].NewAMI)
+
+		last = loc[1]
+		replaceCount++
+		used[index] = true
+	}
+
+	if replaceCount == 0 {
+		return content, 0, nil
+	}
+
+	builder.WriteString(masked[last:])
+
+	var applied []AMIReplacement
 
-	for _, replacement := range replacements {
-		oldCount := strings.Count(newContent, replacement.OldAMI)
-		if oldCount > 0 {
-			newContent = strings.ReplaceAll(newContent, replacement.OldAMI, replacement.NewAMI)
-			replaceCount += oldCount
+	for i, replacement := range replacements {
+		if used[i] {
+			applied = append(applied, replacement)
 		}
 	}
 
-	return newContent, replaceCount
+	return unmaskProvenance(builder.String()), replaceCount, applied
 }
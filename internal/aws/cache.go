@@ -0,0 +1,78 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// describeCall is a DescribeImages call made once for every lookup that asks
+// for the same images, including those made while it is in flight.
+type describeCall struct {
+	done   chan struct{}
+	output *ec2.DescribeImagesOutput
+	err    error
+}
+
+// describeCache holds the DescribeImages calls of a client by region and
+// input. The same pattern, owner, and region are often looked up for many
+// AMI IDs, accounts, and targets in one run.
+type describeCache struct {
+	mu    sync.Mutex
+	calls map[string]*describeCall
+}
+
+// describeImages calls DescribeImages, or returns the result of an earlier
+// call with the same input in the same region. The input must name its
+// owners, so that it is answered alike whichever role makes it. Failed calls
+// are not kept, so that later lookups retry them.
+func (c *Client) describeImages(ctx context.Context, ec2Client *ec2.Client, input *ec2.DescribeImagesInput,
+) (*ec2.DescribeImagesOutput, error) {
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode DescribeImages input: %w", err)
+	}
+
+	key := ec2Client.Options().Region + " " + string(encoded)
+
+	c.describes.mu.Lock()
+
+	call, ok := c.describes.calls[key]
+	if !ok {
+		call = &describeCall{done: make(chan struct{})}
+		c.describes.calls[key] = call
+	}
+
+	c.describes.mu.Unlock()
+
+	if ok {
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("interrupted while waiting for DescribeImages: %w", ctx.Err())
+		}
+
+		slog.Debug("Reusing DescribeImages result", "region", ec2Client.Options().Region, "input", string(encoded))
+
+		return call.output, call.err
+	}
+
+	call.output, call.err = ec2Client.DescribeImages(ctx, input)
+	if call.err != nil {
+		c.describes.mu.Lock()
+		delete(c.describes.calls, key)
+		c.describes.mu.Unlock()
+	}
+
+	close(call.done)
+
+	return call.output, call.err
+}
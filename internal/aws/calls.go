@@ -0,0 +1,73 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// APICall is the number of calls made to an AWS API operation, counting
+// retried calls once.
+type APICall struct {
+	Service   string
+	Operation string
+	Count     int
+}
+
+type apiOperation struct {
+	service   string
+	operation string
+}
+
+var apiCalls = struct {
+	mu     sync.Mutex
+	counts map[apiOperation]int
+}{counts: make(map[apiOperation]int)}
+
+// APICalls returns the calls made by every client in this process, sorted by
+// service and operation.
+func APICalls() []APICall {
+	apiCalls.mu.Lock()
+	defer apiCalls.mu.Unlock()
+
+	calls := make([]APICall, 0, len(apiCalls.counts))
+	for operation, count := range apiCalls.counts {
+		calls = append(calls, APICall{Service: operation.service, Operation: operation.operation, Count: count})
+	}
+
+	slices.SortFunc(calls, func(a, b APICall) int {
+		return cmp.Or(cmp.Compare(a.Service, b.Service), cmp.Compare(a.Operation, b.Operation))
+	})
+
+	return calls
+}
+
+// countAPICalls adds a middleware counting each call to the stack of a
+// client's operations. It runs after the operation metadata is registered
+// and before the retry loop.
+func countAPICalls(stack *middleware.Stack) error {
+	count := middleware.InitializeMiddlewareFunc("CountAPICalls", func(ctx context.Context,
+		in middleware.InitializeInput, next middleware.InitializeHandler,
+	) (middleware.InitializeOutput, middleware.Metadata, error) {
+		operation := apiOperation{
+			service:   awsmiddleware.GetServiceID(ctx),
+			operation: awsmiddleware.GetOperationName(ctx),
+		}
+
+		apiCalls.mu.Lock()
+		apiCalls.counts[operation]++
+		apiCalls.mu.Unlock()
+
+		return next.HandleInitialize(ctx, in)
+	})
+
+	return stack.Initialize.Add(count, middleware.After)
+}
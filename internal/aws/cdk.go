@@ -0,0 +1,33 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+)
+
+// ImageLookup is a machine image lookup cached by the AWS CDK: the account and
+// region it ran in, and the DescribeImages filters and owners it used.
+type ImageLookup struct {
+	Account string
+	Region  string
+	Filters map[string][]string
+	Owners  []string
+}
+
+// ResolveImageLookup returns the AMI a CDK machine image lookup selects now,
+// which is the newest matching AMI, so a cached result can be refreshed.
+func (c *Client) ResolveImageLookup(ctx context.Context, lookup ImageLookup) (*AMIInfo, error) {
+	amis, err := c.describeNewestFirst(ctx, lookup.Account, lookup.Region, lookup.Filters, lookup.Owners)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(amis) == 0 {
+		return nil, ErrAMINotFound
+	}
+
+	return &amis[0], nil
+}
@@ -0,0 +1,82 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"slices"
+	"strings"
+)
+
+// Conflict is an AMI that replacements map onto different AMIs where they
+// apply together, as when accounts or regions resolve the same AMI ID
+// differently. Applying them would leave the result to their order.
+type Conflict struct {
+	OldAMI string
+
+	// Region is the region whose scopes the conflicting cross-region
+	// replacements apply in, or empty for in-place replacements.
+	Region string
+
+	// Replacements holds one replacement for each AMI that OldAMI is mapped
+	// onto, in the order they were found.
+	Replacements []AMIReplacement
+}
+
+// conflictKey identifies where a replacement applies: in-place replacements
+// apply together wherever the old AMI is found, and cross-region ones only
+// within the scopes of their region.
+type conflictKey struct {
+	oldAMI string
+	region string
+}
+
+func keyFor(replacement AMIReplacement) conflictKey {
+	if replacement.CrossRegion() {
+		return conflictKey{oldAMI: replacement.OldAMI, region: replacement.Region}
+	}
+
+	return conflictKey{oldAMI: replacement.OldAMI}
+}
+
+// FindConflicts returns the AMIs that replacements map onto more than one
+// AMI where they apply together, sorted by old AMI and region.
+func FindConflicts(replacements []AMIReplacement) []Conflict {
+	byKey := make(map[conflictKey][]AMIReplacement)
+
+	for _, replacement := range replacements {
+		key := keyFor(replacement)
+
+		found := slices.ContainsFunc(byKey[key], func(existing AMIReplacement) bool {
+			return existing.NewAMI == replacement.NewAMI
+		})
+		if !found {
+			byKey[key] = append(byKey[key], replacement)
+		}
+	}
+
+	var conflicts []Conflict
+
+	for key, candidates := range byKey {
+		if len(candidates) > 1 {
+			conflicts = append(conflicts, Conflict{OldAMI: key.oldAMI, Region: key.region, Replacements: candidates})
+		}
+	}
+
+	slices.SortFunc(conflicts, func(a, b Conflict) int {
+		return strings.Compare(a.OldAMI+" "+a.Region, b.OldAMI+" "+b.Region)
+	})
+
+	return conflicts
+}
+
+// ResolveConflict drops the replacements of the conflict that do not map its
+// AMI onto newAMI, or all of them when newAMI is empty.
+func ResolveConflict(replacements []AMIReplacement, conflict Conflict, newAMI string) []AMIReplacement {
+	key := conflictKey{oldAMI: conflict.OldAMI, region: conflict.Region}
+
+	return slices.DeleteFunc(slices.Clone(replacements), func(replacement AMIReplacement) bool {
+		return keyFor(replacement) == key && (newAMI == "" || replacement.NewAMI != newAMI)
+	})
+}
@@ -0,0 +1,57 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// newEC2Client returns an EC2 client for cfg that uses the custom endpoint,
+// if one is configured.
+func (c *Client) newEC2Client(cfg aws.Config) *ec2.Client {
+	return ec2.NewFromConfig(cfg, func(o *ec2.Options) {
+		if c.endpointURL != "" {
+			o.BaseEndpoint = aws.String(c.endpointURL)
+		}
+	})
+}
+
+// newSTSClient returns an STS client for cfg that uses the custom endpoint,
+// if one is configured.
+func (c *Client) newSTSClient(cfg aws.Config) *sts.Client {
+	return sts.NewFromConfig(cfg, withSTSEndpoint(c.endpointURL))
+}
+
+func withSTSEndpoint(endpointURL string) func(*sts.Options) {
+	return func(o *sts.Options) {
+		if endpointURL != "" {
+			o.BaseEndpoint = aws.String(endpointURL)
+		}
+	}
+}
+
+// newAutoScalingClient returns an Auto Scaling client for cfg that uses the
+// custom endpoint, if one is configured.
+func (c *Client) newAutoScalingClient(cfg aws.Config) *autoscaling.Client {
+	return autoscaling.NewFromConfig(cfg, func(o *autoscaling.Options) {
+		if c.endpointURL != "" {
+			o.BaseEndpoint = aws.String(c.endpointURL)
+		}
+	})
+}
+
+// newCloudFormationClient returns a CloudFormation client for cfg that uses
+// the custom endpoint, if one is configured.
+func (c *Client) newCloudFormationClient(cfg aws.Config) *cloudformation.Client {
+	return cloudformation.NewFromConfig(cfg, func(o *cloudformation.Options) {
+		if c.endpointURL != "" {
+			o.BaseEndpoint = aws.String(c.endpointURL)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// FindEquivalentAMIs locates amiID in the first of regions that has it and
+// maps it onto the newest equivalent AMI in each other region. A region only
+// has an equivalent when it holds an image with the same name; the newest AMI
+// matching the same name pattern there is then chosen. The replacements are
+// scoped to their target region, with SourceRegion naming amiID's region.
+func (c *Client) FindEquivalentAMIs(ctx context.Context, accountID, amiID string, regions []string,
+) ([]AMIReplacement, error) {
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config for account %s: %w", accountID, err)
+	}
+
+	var source *AMIInfo
+
+	for _, region := range regions {
+		cfg.Region = region
+
+		source, err = c.findAMIByID(ctx, c.newEC2Client(cfg), accountID, amiID)
+		if err == nil {
+			source.Region = region
+
+			break
+		}
+
+		if !errors.Is(err, ErrAMINotFound) {
+			return nil, fmt.Errorf("failed to find AMI %s in region %s: %w", amiID, region, err)
+		}
+	}
+
+	if source == nil {
+		return nil, nil
+	}
+
+	filter, ok := c.filterMatching(*source)
+	if !ok {
+		return nil, nil
+	}
+
+	pattern := DerivePattern(source.Name)
+
+	var replacements []AMIReplacement
+
+	for _, region := range regions {
+		if region == source.Region {
+			continue
+		}
+
+		cfg.Region = region
+
+		amis, err := c.findAMIsByPattern(ctx, c.newEC2Client(cfg), accountID, pattern, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find AMIs for pattern %s in region %s: %w", pattern, region, err)
+		}
+
+		equivalent := slices.IndexFunc(amis, func(ami AMIInfo) bool {
+			return ami.Name == source.Name
+		})
+		if equivalent < 0 {
+			continue
+		}
+
+		latest := amis[equivalent]
+
+		candidates := filter.candidates(amis)
+		sortNewestFirst(candidates, filter.Version)
+
+		candidate, ok := c.passingFindings(ctx, accountID, region, candidates)
+		if ok && !ranksAhead(latest, candidate, filter.Version) {
+			latest = candidate
+		}
+
+		// The image of the same name is kept over candidates, but not when
+		// the policy forbids it
+		err = filter.violates(latest)
+		if err != nil {
+			slog.Warn("Skipping equivalent AMI rejected by policy", "ami", amiID, "region", region,
+				"equivalent", latest.ImageID, "reason", err)
+
+			continue
+		}
+
+		replacements = append(replacements, AMIReplacement{
+			OldAMI:       amiID,
+			NewAMI:       latest.ImageID,
+			Name:         source.Name,
+			Account:      accountID,
+			Region:       region,
+			SourceRegion: source.Region,
+			Created:      latest.CreationDate,
+			OldCreated:   source.CreationDate,
+		})
+	}
+
+	return replacements, nil
+}
@@ -0,0 +1,133 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ExecPatternPrefix marks a pattern as an external resolver program, such as
+// exec:./bin/my-resolver, followed by any arguments to run it with.
+const ExecPatternPrefix = "exec:"
+
+// PluginTimeout bounds how long a resolver program may run for a single
+// account and region.
+const PluginTimeout = 2 * time.Minute
+
+var (
+	ErrPluginFailed          = errors.New("resolver plugin failed")
+	ErrInvalidPluginResponse = errors.New("invalid resolver plugin response")
+)
+
+// PluginRequest is written as JSON to the standard input of a resolver
+// program.
+type PluginRequest struct {
+	Pattern string `json:"pattern"`
+	Account string `json:"account"`
+	Region  string `json:"region"`
+
+	// AMIs are the AMI IDs being updated, when a file is updated.
+	AMIs []string `json:"amis"`
+}
+
+// PluginResponse is read as JSON from the standard output of a resolver
+// program.
+type PluginResponse struct {
+	Replacements []PluginReplacement `json:"replacements"`
+}
+
+// PluginReplacement maps an old AMI onto its replacement. Created is when the
+// new AMI was created, if known.
+type PluginReplacement struct {
+	OldAMI  string    `json:"old_ami"`
+	NewAMI  string    `json:"new_ami"`
+	Name    string    `json:"name,omitempty"`
+	Created time.Time `json:"created,omitzero"`
+}
+
+// runResolverPlugin runs the program named by an exec: pattern with the
+// request on its standard input and returns the replacements it prints. The
+// program is run directly rather than through a shell, with its arguments
+// split on whitespace.
+func runResolverPlugin(ctx context.Context, request PluginRequest) ([]AMIReplacement, error) {
+	args := strings.Fields(strings.TrimPrefix(request.Pattern, ExecPatternPrefix))
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%w: %s names no program", ErrPluginFailed, request.Pattern)
+	}
+
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode resolver plugin request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, PluginTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+
+	command := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
+	command.Stdin = bytes.NewReader(input)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	err = command.Run()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			return nil, fmt.Errorf("%w: %s: %w", ErrPluginFailed, args[0], err)
+		}
+
+		return nil, fmt.Errorf("%w: %s: %w: %s", ErrPluginFailed, args[0], err, message)
+	}
+
+	var response PluginResponse
+
+	err = json.Unmarshal(stdout.Bytes(), &response)
+	if err != nil {
+		return nil, fmt.Errorf("%w from %s: %w", ErrInvalidPluginResponse, args[0], err)
+	}
+
+	replacements := make([]AMIReplacement, 0, len(response.Replacements))
+
+	for _, replacement := range response.Replacements {
+		if !isAMIID(replacement.OldAMI) || !isAMIID(replacement.NewAMI) {
+			return nil, fmt.Errorf("%w from %s: %q -> %q is not a pair of AMI IDs", ErrInvalidPluginResponse,
+				args[0], replacement.OldAMI, replacement.NewAMI)
+		}
+
+		if replacement.OldAMI == replacement.NewAMI {
+			continue
+		}
+
+		replacements = append(replacements, AMIReplacement{
+			OldAMI:  replacement.OldAMI,
+			NewAMI:  replacement.NewAMI,
+			Name:    replacement.Name,
+			Created: replacement.Created,
+		})
+	}
+
+	return replacements, nil
+}
+
+// referencedAMIIDs returns the patterns that are AMI IDs.
+func referencedAMIIDs(patterns []string) []string {
+	amiIDs := []string{}
+
+	for _, pattern := range patterns {
+		if isAMIID(pattern) {
+			amiIDs = append(amiIDs, pattern)
+		}
+	}
+
+	return amiIDs
+}
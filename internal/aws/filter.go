@@ -0,0 +1,234 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/policy"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// ImageFilter narrows the candidate AMIs considered for a pattern. Empty
+// fields do not filter.
+type ImageFilter struct {
+	Architecture       string
+	VirtualizationType string
+	RootDeviceType     string
+
+	// Tags are exact tag values that every candidate must carry.
+	Tags map[string]string
+
+	// Version extracts a version from candidate names to order them by. It
+	// does not filter candidates.
+	Version *regexp.Regexp
+
+	// Exclude rejects candidates whose names match any of the expressions.
+	// AMIs already in use are still replaced when they match.
+	Exclude []*regexp.Regexp
+
+	// MinAge rejects candidates created more recently than this, so that new
+	// images can soak before they are rolled out.
+	MinAge time.Duration
+
+	// BootMode rejects candidates with a different effective boot mode.
+	// DescribeImages cannot filter on it, so it is only set to match an
+	// existing AMI.
+	BootMode string
+
+	// Policy rejects candidates that do not pass its rules.
+	Policy *policy.Policy
+}
+
+// merge returns f with every non-empty field of override applied on top.
+func (f ImageFilter) merge(override ImageFilter) ImageFilter {
+	if override.Architecture != "" {
+		f.Architecture = override.Architecture
+	}
+
+	if override.VirtualizationType != "" {
+		f.VirtualizationType = override.VirtualizationType
+	}
+
+	if override.RootDeviceType != "" {
+		f.RootDeviceType = override.RootDeviceType
+	}
+
+	if override.Version != nil {
+		f.Version = override.Version
+	}
+
+	if len(override.Tags) > 0 {
+		tags := make(map[string]string, len(f.Tags)+len(override.Tags))
+		maps.Copy(tags, f.Tags)
+		maps.Copy(tags, override.Tags)
+		f.Tags = tags
+	}
+
+	if len(override.Exclude) > 0 {
+		f.Exclude = append(slices.Clip(f.Exclude), override.Exclude...)
+	}
+
+	if override.MinAge != 0 {
+		f.MinAge = override.MinAge
+	}
+
+	return f
+}
+
+// rejects reports whether an AMI may not be chosen as a replacement.
+func (f ImageFilter) rejects(ami AMIInfo) bool {
+	if f.MinAge > 0 && time.Since(ami.CreationDate) < f.MinAge {
+		return true
+	}
+
+	if f.BootMode != "" && f.BootMode != effectiveBootMode(ami) {
+		return true
+	}
+
+	if slices.ContainsFunc(f.Exclude, func(pattern *regexp.Regexp) bool {
+		return pattern.MatchString(ami.Name)
+	}) {
+		return true
+	}
+
+	err := f.violates(ami)
+	if err != nil {
+		slog.Debug("Rejecting candidate AMI", "ami", ami.ImageID, "name", ami.Name, "reason", err)
+
+		return true
+	}
+
+	return false
+}
+
+// matches reports whether an AMI has the attributes and tags of the filter,
+// which DescribeImages otherwise checks for candidates found by name.
+func (f ImageFilter) matches(ami AMIInfo) bool {
+	for _, attribute := range []struct{ configured, value string }{
+		{f.Architecture, ami.Architecture},
+		{f.VirtualizationType, ami.VirtualizationType},
+		{f.RootDeviceType, ami.RootDeviceType},
+	} {
+		if attribute.configured != "" && attribute.configured != attribute.value {
+			return false
+		}
+	}
+
+	for key, value := range f.Tags {
+		if ami.Tags[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// candidates returns the AMIs that may be chosen as a replacement.
+func (f ImageFilter) candidates(amis []AMIInfo) []AMIInfo {
+	return slices.DeleteFunc(slices.Clone(amis), f.rejects)
+}
+
+func (f ImageFilter) ec2Filters() []types.Filter {
+	var filters []types.Filter
+
+	for _, filter := range []struct{ name, value string }{
+		{"architecture", f.Architecture},
+		{"virtualization-type", f.VirtualizationType},
+		{"root-device-type", f.RootDeviceType},
+	} {
+		if filter.value != "" {
+			filters = append(filters, types.Filter{
+				Name:   aws.String(filter.name),
+				Values: []string{filter.value},
+			})
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(f.Tags)) {
+		filters = append(filters, types.Filter{
+			Name:   aws.String("tag:" + key),
+			Values: []string{f.Tags[key]},
+		})
+	}
+
+	return filters
+}
+
+// filterFor returns the filter for a name pattern or AMI name: the default
+// filter with the most specific matching per-pattern filter applied. Patterns
+// match case-insensitively, since configuration map keys are lowercased.
+func (c *Client) filterFor(name string) ImageFilter {
+	name = strings.ToLower(name)
+
+	keys := make([]string, 0, len(c.patternFilters))
+	for key := range c.patternFilters {
+		if lowered := strings.ToLower(key); lowered == name || MatchNamePattern(lowered, name) {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return c.imageFilter
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	return c.imageFilter.merge(c.patternFilters[keys[0]])
+}
+
+// filterMatching returns the filter for replacing ami, narrowed so that every
+// candidate shares its architecture, virtualization type, root device type,
+// and boot mode. It reports false when the configured filter rules out ami
+// itself, in which case ami is not replaced at all.
+func (c *Client) filterMatching(ami AMIInfo) (ImageFilter, bool) {
+	filter := c.filterFor(ami.Name)
+
+	for _, attribute := range []struct {
+		configured *string
+		value      string
+	}{
+		{&filter.Architecture, ami.Architecture},
+		{&filter.VirtualizationType, ami.VirtualizationType},
+		{&filter.RootDeviceType, ami.RootDeviceType},
+	} {
+		if *attribute.configured != "" && *attribute.configured != attribute.value {
+			return ImageFilter{}, false
+		}
+
+		*attribute.configured = attribute.value
+	}
+
+	filter.BootMode = effectiveBootMode(ami)
+
+	return filter, true
+}
+
+// effectiveBootMode returns the boot mode an AMI launches with. AMIs without
+// one use the default of their architecture.
+func effectiveBootMode(ami AMIInfo) string {
+	switch {
+	case ami.BootMode != "":
+		return ami.BootMode
+	case ami.Architecture == string(types.ArchitectureValuesArm64):
+		return string(types.BootModeValuesUefi)
+	default:
+		return string(types.BootModeValuesLegacyBios)
+	}
+}
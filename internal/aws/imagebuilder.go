@@ -0,0 +1,386 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/imagebuilder"
+	"github.com/aws/aws-sdk-go-v2/service/imagebuilder/types"
+)
+
+// Kinds of EC2 Image Builder resources whose ARNs are updated.
+const (
+	ImageBuilderImage  = "image"
+	ImageBuilderRecipe = "image-recipe"
+)
+
+// imageBuilderAmazonAccount is the account of the ARNs of images that Amazon
+// manages.
+const imageBuilderAmazonAccount = "aws"
+
+var (
+	ErrInvalidImageBuilderARN = errors.New("invalid Image Builder ARN")
+	ErrNoImageBuild           = errors.New("no available Image Builder build")
+	ErrNoImageRecipe          = errors.New("no Image Builder image recipe version")
+	ErrRejectedBuildAMI       = errors.New("AMI is rejected by the image filters or policy")
+)
+
+var imageBuilderARNRegex = regexp.MustCompile(
+	`^arn:(aws[\w-]*):imagebuilder:([a-z0-9-]+):(\d{12}|aws):(image|image-recipe)/([a-z0-9_-]+)/` +
+		`((?:\d+|x)\.(?:\d+|x)\.(?:\d+|x))(?:/(\d+))?$`)
+
+// ImageBuilderARN is the ARN of an EC2 Image Builder image or image recipe,
+// such as arn:aws:imagebuilder:us-east-1:123456789012:image/base/1.2.0/3.
+type ImageBuilderARN struct {
+	Partition string
+	Region    string
+	Account   string
+	Resource  string
+	Name      string
+
+	// Version is the semantic version, whose components may be x to select
+	// the latest, and Build the build number of an image, or zero when the
+	// ARN names a version rather than one of its builds.
+	Version string
+	Build   int
+}
+
+// ImageBuild is a build of an Image Builder image and the AMIs it distributed.
+type ImageBuild struct {
+	ARN  ImageBuilderARN
+	AMIs []ImageBuildAMI
+}
+
+// ImageBuildAMI is an AMI that an Image Builder build distributed to a region.
+type ImageBuildAMI struct {
+	ImageID string
+	Name    string
+	Account string
+	Region  string
+}
+
+// ParseImageBuilderARN parses the ARN of an Image Builder image or image
+// recipe.
+func ParseImageBuilderARN(arn string) (ImageBuilderARN, error) {
+	match := imageBuilderARNRegex.FindStringSubmatch(arn)
+	if match == nil || (match[4] == ImageBuilderRecipe && (match[7] != "" || strings.Contains(match[6], "x"))) {
+		return ImageBuilderARN{}, fmt.Errorf("%w: %s", ErrInvalidImageBuilderARN, arn)
+	}
+
+	parsed := ImageBuilderARN{
+		Partition: match[1],
+		Region:    match[2],
+		Account:   match[3],
+		Resource:  match[4],
+		Name:      match[5],
+		Version:   match[6],
+	}
+
+	if match[7] != "" {
+		build, err := strconv.Atoi(match[7])
+		if err != nil {
+			return ImageBuilderARN{}, fmt.Errorf("%w: %s: %w", ErrInvalidImageBuilderARN, arn, err)
+		}
+
+		parsed.Build = build
+	}
+
+	return parsed, nil
+}
+
+func (a ImageBuilderARN) String() string {
+	arn := fmt.Sprintf("arn:%s:imagebuilder:%s:%s:%s/%s/%s", a.Partition, a.Region, a.Account, a.Resource, a.Name,
+		a.Version)
+	if a.Build > 0 {
+		arn += "/" + strconv.Itoa(a.Build)
+	}
+
+	return arn
+}
+
+// Floating reports whether the ARN selects the latest version when it is
+// used, with x in place of version components, so that it is never outdated.
+func (a ImageBuilderARN) Floating() bool {
+	return strings.Contains(a.Version, "x")
+}
+
+// LatestImageBuilderARN returns the ARN of the latest version of the image or
+// image recipe that arn names, in the same form: the latest build of the
+// latest version that has an available build for an image build ARN, and the
+// latest version for the others.
+func (c *Client) LatestImageBuilderARN(ctx context.Context, arn ImageBuilderARN) (ImageBuilderARN, error) {
+	client, owner, err := c.imageBuilderClient(arn)
+	if err != nil {
+		return ImageBuilderARN{}, err
+	}
+
+	if arn.Resource == ImageBuilderRecipe {
+		return latestImageRecipe(ctx, client, owner, arn)
+	}
+
+	versions, err := imageVersions(ctx, client, owner, arn)
+	if err != nil {
+		return ImageBuilderARN{}, err
+	}
+
+	for _, version := range versions {
+		build, err := latestImageBuild(ctx, client, version)
+		if errors.Is(err, ErrNoImageBuild) {
+			continue
+		}
+
+		if err != nil {
+			return ImageBuilderARN{}, err
+		}
+
+		if arn.Build == 0 {
+			build.Build = 0
+		}
+
+		return build, nil
+	}
+
+	return ImageBuilderARN{}, fmt.Errorf("%w for %s", ErrNoImageBuild, arn)
+}
+
+// GetImageBuild returns the build of an image that arn names, the latest
+// build of its version for a version ARN, and the AMIs it distributed.
+func (c *Client) GetImageBuild(ctx context.Context, arn ImageBuilderARN) (*ImageBuild, error) {
+	client, _, err := c.imageBuilderClient(arn)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.GetImage(ctx, &imagebuilder.GetImageInput{ImageBuildVersionArn: aws.String(arn.String())})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Image Builder image %s: %w", arn, err)
+	}
+
+	if result.Image == nil {
+		return nil, fmt.Errorf("%w for %s", ErrNoImageBuild, arn)
+	}
+
+	built, err := ParseImageBuilderARN(aws.ToString(result.Image.Arn))
+	if err != nil {
+		return nil, err
+	}
+
+	build := &ImageBuild{ARN: built}
+
+	if result.Image.OutputResources != nil {
+		for _, ami := range result.Image.OutputResources.Amis {
+			if !isAMIID(aws.ToString(ami.Image)) {
+				continue
+			}
+
+			build.AMIs = append(build.AMIs, ImageBuildAMI{
+				ImageID: aws.ToString(ami.Image),
+				Name:    aws.ToString(ami.Name),
+				Account: aws.ToString(ami.AccountId),
+				Region:  aws.ToString(ami.Region),
+			})
+		}
+	}
+
+	return build, nil
+}
+
+// CheckBuildAMI verifies that newAMI, distributed by an Image Builder build,
+// may replace oldAMI under the filters and policy that candidates for oldAMI
+// must pass: those for its name, narrowed to its architecture, virtualization
+// type, root device type, and boot mode. The AMIs are described in region with
+// the role of accountID.
+func (c *Client) CheckBuildAMI(ctx context.Context, accountID, region, oldAMI, newAMI string) error {
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return fmt.Errorf("failed to get config for account %s: %w", accountID, err)
+	}
+
+	cfg.Region = region
+
+	amis, err := describeImageIDs(ctx, c.newEC2Client(cfg), region, []string{oldAMI, newAMI})
+	if err != nil {
+		return err
+	}
+
+	described := make(map[string]AMIInfo, len(amis))
+	for _, ami := range amis {
+		described[ami.ImageID] = ami
+	}
+
+	old, ok := described[oldAMI]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAMINotFound, oldAMI)
+	}
+
+	candidate, ok := described[newAMI]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAMINotFound, newAMI)
+	}
+
+	filter, ok := c.filterMatching(old)
+	if !ok || !filter.matches(candidate) || filter.rejects(candidate) {
+		return fmt.Errorf("%w: %s", ErrRejectedBuildAMI, newAMI)
+	}
+
+	return nil
+}
+
+// imageBuilderClient returns an Image Builder client for the region of arn,
+// using the role of its account, and the ownership its resources are listed
+// under.
+func (c *Client) imageBuilderClient(arn ImageBuilderARN) (*imagebuilder.Client, types.Ownership, error) {
+	accountID, owner := arn.Account, types.OwnershipSelf
+	if accountID == imageBuilderAmazonAccount {
+		accountID, owner = "", types.OwnershipAmazon
+	}
+
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get config for account %s: %w", accountID, err)
+	}
+
+	cfg.Region = arn.Region
+
+	return imagebuilder.NewFromConfig(cfg), owner, nil
+}
+
+// imageVersions returns the versions of the image that arn names, newest
+// first.
+func imageVersions(ctx context.Context, client *imagebuilder.Client, owner types.Ownership, arn ImageBuilderARN,
+) ([]ImageBuilderARN, error) {
+	var versions []ImageBuilderARN
+
+	paginator := imagebuilder.NewListImagesPaginator(client, &imagebuilder.ListImagesInput{
+		Owner:   owner,
+		Filters: []types.Filter{{Name: aws.String("name"), Values: []string{arn.Name}}},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Image Builder images named %s: %w", arn.Name, err)
+		}
+
+		for _, image := range page.ImageVersionList {
+			versions = appendSameResource(versions, aws.ToString(image.Arn), arn)
+		}
+	}
+
+	sortImageBuilderARNs(versions)
+
+	return versions, nil
+}
+
+// latestImageBuild returns the ARN of the latest available build of an image
+// version.
+func latestImageBuild(ctx context.Context, client *imagebuilder.Client, version ImageBuilderARN,
+) (ImageBuilderARN, error) {
+	var builds []ImageBuilderARN
+
+	paginator := imagebuilder.NewListImageBuildVersionsPaginator(client, &imagebuilder.ListImageBuildVersionsInput{
+		ImageVersionArn: aws.String(version.String()),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return ImageBuilderARN{}, fmt.Errorf("failed to list builds of %s: %w", version, err)
+		}
+
+		for _, image := range page.ImageSummaryList {
+			if image.State == nil || image.State.Status != types.ImageStatusAvailable {
+				continue
+			}
+
+			builds = appendSameResource(builds, aws.ToString(image.Arn), version)
+		}
+	}
+
+	if len(builds) == 0 {
+		return ImageBuilderARN{}, fmt.Errorf("%w for %s", ErrNoImageBuild, version)
+	}
+
+	sortImageBuilderARNs(builds)
+
+	return builds[0], nil
+}
+
+// latestImageRecipe returns the ARN of the latest version of the image recipe
+// that arn names.
+func latestImageRecipe(ctx context.Context, client *imagebuilder.Client, owner types.Ownership,
+	arn ImageBuilderARN,
+) (ImageBuilderARN, error) {
+	var versions []ImageBuilderARN
+
+	paginator := imagebuilder.NewListImageRecipesPaginator(client, &imagebuilder.ListImageRecipesInput{
+		Owner:   owner,
+		Filters: []types.Filter{{Name: aws.String("name"), Values: []string{arn.Name}}},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return ImageBuilderARN{}, fmt.Errorf("failed to list image recipes named %s: %w", arn.Name, err)
+		}
+
+		for _, recipe := range page.ImageRecipeSummaryList {
+			versions = appendSameResource(versions, aws.ToString(recipe.Arn), arn)
+		}
+	}
+
+	if len(versions) == 0 {
+		return ImageBuilderARN{}, fmt.Errorf("%w for %s", ErrNoImageRecipe, arn)
+	}
+
+	sortImageBuilderARNs(versions)
+
+	return versions[0], nil
+}
+
+// appendSameResource appends the ARN listed to arns if it parses and names
+// the same resource as arn, since name filters match names as prefixes.
+func appendSameResource(arns []ImageBuilderARN, listed string, arn ImageBuilderARN) []ImageBuilderARN {
+	parsed, err := ParseImageBuilderARN(listed)
+	if err != nil || parsed.Floating() || parsed.Resource != arn.Resource || parsed.Name != arn.Name ||
+		parsed.Account != arn.Account {
+		return arns
+	}
+
+	return append(arns, parsed)
+}
+
+// sortImageBuilderARNs orders ARNs by version and then build, newest first.
+func sortImageBuilderARNs(arns []ImageBuilderARN) {
+	slices.SortStableFunc(arns, func(a, b ImageBuilderARN) int {
+		result := compareVersions(parseSemanticVersion(b.Version), parseSemanticVersion(a.Version))
+		if result != 0 {
+			return result
+		}
+
+		return b.Build - a.Build
+	})
+}
+
+func parseSemanticVersion(version string) []int {
+	components := strings.Split(version, ".")
+
+	parsed := make([]int, 0, len(components))
+	for _, component := range components {
+		value, err := strconv.Atoi(component)
+		if err != nil {
+			return nil
+		}
+
+		parsed = append(parsed, value)
+	}
+
+	return parsed
+}
@@ -0,0 +1,159 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/inspector2"
+	"github.com/aws/aws-sdk-go-v2/service/inspector2/types"
+)
+
+var (
+	ErrCriticalFindings = errors.New("AMI has critical Inspector findings")
+	ErrNotScanned       = errors.New("AMI has no Inspector findings")
+)
+
+// inspectorSettings are the limits of the Inspector check of candidates.
+type inspectorSettings struct {
+	enabled     bool
+	maxCritical int
+	requireScan bool
+}
+
+// findingsCache holds the outcome of the Inspector check of each AMI by
+// account, region, and AMI ID.
+type findingsCache struct {
+	mu      sync.Mutex
+	checked map[string]error
+}
+
+// WithInspector refuses replacement AMIs with more than maxCritical critical
+// Amazon Inspector findings when enabled, choosing the newest candidate that
+// passes instead. With requireScan, AMIs that Inspector has no findings for
+// are refused too, rather than passing.
+func WithInspector(enabled bool, maxCritical int, requireScan bool) Option {
+	return func(o *clientOptions) {
+		o.inspector = inspectorSettings{enabled: enabled, maxCritical: maxCritical, requireScan: requireScan}
+	}
+}
+
+// CheckFindings verifies, with WithInspector, that Amazon Inspector reports
+// no more critical findings for an AMI than allowed, aggregated over the
+// instances in accountID that run it. Inspector only has findings for AMIs
+// that running instances were launched from, so an AMI it has none for, such
+// as a new one, passes unless scans are required. Each AMI is checked once.
+func (c *Client) CheckFindings(ctx context.Context, accountID, region, amiID string) error {
+	if !c.inspector.enabled {
+		return nil
+	}
+
+	key := accountID + " " + region + " " + amiID
+
+	c.findings.mu.Lock()
+	err, ok := c.findings.checked[key]
+	c.findings.mu.Unlock()
+
+	if ok {
+		return err
+	}
+
+	err = c.checkFindings(ctx, accountID, region, amiID)
+
+	// Interrupted checks are not kept, so that they are not reported as the
+	// AMI's outcome
+	if ctx.Err() == nil {
+		c.findings.mu.Lock()
+		c.findings.checked[key] = err
+		c.findings.mu.Unlock()
+	}
+
+	return err
+}
+
+// passingFindings returns the first of candidates, newest first, that passes
+// the Inspector check, or false when none does. Candidates that fail it, or
+// whose check fails, are skipped.
+func (c *Client) passingFindings(ctx context.Context, accountID, region string, candidates []AMIInfo,
+) (AMIInfo, bool) {
+	for _, candidate := range candidates {
+		if c.passesFindings(ctx, accountID, region, candidate) {
+			return candidate, true
+		}
+	}
+
+	return AMIInfo{}, false
+}
+
+// findingsCheck returns the Inspector check of the candidates found with
+// ec2Client in accountID.
+func (c *Client) findingsCheck(ctx context.Context, ec2Client *ec2.Client, accountID string) func(AMIInfo) bool {
+	region := ec2Client.Options().Region
+
+	return func(candidate AMIInfo) bool {
+		return c.passesFindings(ctx, accountID, region, candidate)
+	}
+}
+
+// passesFindings reports whether candidate passes the Inspector check.
+func (c *Client) passesFindings(ctx context.Context, accountID, region string, candidate AMIInfo) bool {
+	err := c.CheckFindings(ctx, accountID, region, candidate.ImageID)
+	if err != nil && ctx.Err() == nil {
+		slog.Warn("Skipping candidate AMI that fails the Inspector check", "ami", candidate.ImageID,
+			"name", candidate.Name, "account", accountID, "region", region, "error", err)
+	}
+
+	return err == nil
+}
+
+func (c *Client) checkFindings(ctx context.Context, accountID, region, amiID string) error {
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return fmt.Errorf("failed to get config for account %s: %w", accountID, err)
+	}
+
+	cfg.Region = region
+
+	result, err := inspector2.NewFromConfig(cfg).ListFindingAggregations(ctx, &inspector2.ListFindingAggregationsInput{
+		AggregationType: types.AggregationTypeAmi,
+		AggregationRequest: &types.AggregationRequestMemberAmiAggregation{
+			Value: types.AmiAggregation{
+				Amis: []types.StringFilter{{Comparison: types.StringComparisonEquals, Value: aws.String(amiID)}},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get Inspector findings for %s: %w", amiID, err)
+	}
+
+	for _, response := range result.Responses {
+		aggregation, ok := response.(*types.AggregationResponseMemberAmiAggregation)
+		if !ok || aws.ToString(aggregation.Value.Ami) != amiID || aggregation.Value.SeverityCounts == nil {
+			continue
+		}
+
+		critical := aws.ToInt64(aggregation.Value.SeverityCounts.Critical)
+		if critical > int64(c.inspector.maxCritical) {
+			return fmt.Errorf("%w: %s has %d, more than %d", ErrCriticalFindings, amiID, critical,
+				c.inspector.maxCritical)
+		}
+
+		return nil
+	}
+
+	if c.inspector.requireScan {
+		return fmt.Errorf("%w: %s has not been scanned", ErrNotScanned, amiID)
+	}
+
+	slog.Debug("No Inspector findings for AMI", "ami", amiID, "account", accountID, "region", region)
+
+	return nil
+}
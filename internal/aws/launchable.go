@@ -0,0 +1,88 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+var (
+	ErrAMINotAvailable    = errors.New("AMI is not available")
+	ErrNoLaunchPermission = errors.New("AMI is not shared with account")
+)
+
+// CheckLaunchable verifies that an AMI owned by accountID can be launched: it
+// must be available, and either public, owned by, or shared with each of
+// launchAccounts. Launch permissions granted to an organization or OU are
+// assumed to cover the accounts, since membership cannot be checked here.
+func (c *Client) CheckLaunchable(ctx context.Context, accountID, region, amiID string, launchAccounts []string,
+) error {
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return fmt.Errorf("failed to get config for account %s: %w", accountID, err)
+	}
+
+	cfg.Region = region
+	ec2Client := c.newEC2Client(cfg)
+
+	result, err := ec2Client.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		ImageIds: []string{amiID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe image %s: %w", amiID, err)
+	}
+
+	if len(result.Images) == 0 {
+		return ErrAMINotFound
+	}
+
+	image := result.Images[0]
+	if image.State != types.ImageStateAvailable {
+		return fmt.Errorf("%w: %s is %s", ErrAMINotAvailable, amiID, image.State)
+	}
+
+	owner := aws.ToString(image.OwnerId)
+
+	pending := slices.DeleteFunc(slices.Clone(launchAccounts), func(account string) bool {
+		return account == owner
+	})
+	if aws.ToBool(image.Public) || len(pending) == 0 {
+		return nil
+	}
+
+	attribute, err := ec2Client.DescribeImageAttribute(ctx, &ec2.DescribeImageAttributeInput{
+		ImageId:   aws.String(amiID),
+		Attribute: types.ImageAttributeNameLaunchPermission,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get launch permissions of %s: %w", amiID, err)
+	}
+
+	shared := make(map[string]bool, len(attribute.LaunchPermissions))
+
+	for _, permission := range attribute.LaunchPermissions {
+		if permission.Group == types.PermissionGroupAll || permission.OrganizationArn != nil ||
+			permission.OrganizationalUnitArn != nil {
+			return nil
+		}
+
+		shared[aws.ToString(permission.UserId)] = true
+	}
+
+	for _, account := range pending {
+		if !shared[account] {
+			return fmt.Errorf("%w %s: %s", ErrNoLaunchPermission, account, amiID)
+		}
+	}
+
+	return nil
+}
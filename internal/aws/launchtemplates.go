@@ -0,0 +1,154 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const launchTemplateDefaultVersion = "$Default"
+
+// LaunchTemplate is the default version of an EC2 launch template.
+type LaunchTemplate struct {
+	ID      string
+	Name    string
+	Version int64
+	ImageID string
+	Account string
+	Region  string
+}
+
+// FindLaunchTemplates returns the launch templates in an account and region
+// whose names match one of names (with * wildcards) and that carry every tag,
+// along with the AMI of their default version. Empty names and tags match
+// every template.
+func (c *Client) FindLaunchTemplates(ctx context.Context, accountID, region string, names []string,
+	tags map[string]string,
+) ([]LaunchTemplate, error) {
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config for account %s: %w", accountID, err)
+	}
+
+	cfg.Region = region
+	ec2Client := c.newEC2Client(cfg)
+
+	var filters []types.Filter
+	if len(names) > 0 {
+		filters = append(filters, types.Filter{Name: aws.String("launch-template-name"), Values: names})
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		filters = append(filters, types.Filter{Name: aws.String("tag:" + key), Values: []string{tags[key]}})
+	}
+
+	var templates []LaunchTemplate
+
+	paginator := ec2.NewDescribeLaunchTemplatesPaginator(ec2Client, &ec2.DescribeLaunchTemplatesInput{
+		Filters: filters,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe launch templates: %w", err)
+		}
+
+		for _, template := range page.LaunchTemplates {
+			launchTemplate, found, err := describeLaunchTemplateVersion(ctx, ec2Client,
+				aws.ToString(template.LaunchTemplateId), launchTemplateDefaultVersion)
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe launch template %s: %w",
+					aws.ToString(template.LaunchTemplateName), err)
+			}
+
+			if !found {
+				continue
+			}
+
+			launchTemplate.Account = accountID
+			launchTemplate.Region = region
+			templates = append(templates, launchTemplate)
+		}
+	}
+
+	return templates, nil
+}
+
+// describeLaunchTemplateVersion returns a version of a launch template, given
+// as a number, $Default, or $Latest, reporting false when it does not exist.
+func describeLaunchTemplateVersion(ctx context.Context, ec2Client *ec2.Client, templateID, version string,
+) (LaunchTemplate, bool, error) {
+	result, err := ec2Client.DescribeLaunchTemplateVersions(ctx, &ec2.DescribeLaunchTemplateVersionsInput{
+		LaunchTemplateId: aws.String(templateID),
+		Versions:         []string{version},
+	})
+	if err != nil {
+		return LaunchTemplate{}, false, fmt.Errorf("failed to describe launch template versions: %w", err)
+	}
+
+	if len(result.LaunchTemplateVersions) == 0 {
+		return LaunchTemplate{}, false, nil
+	}
+
+	templateVersion := result.LaunchTemplateVersions[0]
+
+	launchTemplate := LaunchTemplate{
+		ID:      aws.ToString(templateVersion.LaunchTemplateId),
+		Name:    aws.ToString(templateVersion.LaunchTemplateName),
+		Version: aws.ToInt64(templateVersion.VersionNumber),
+	}
+
+	if templateVersion.LaunchTemplateData != nil {
+		launchTemplate.ImageID = aws.ToString(templateVersion.LaunchTemplateData.ImageId)
+	}
+
+	return launchTemplate, true, nil
+}
+
+// UpdateLaunchTemplate creates a new version of a launch template from its
+// default version with the AMI replaced, optionally making it the default
+// version, and returns the new version number.
+func (c *Client) UpdateLaunchTemplate(ctx context.Context, template LaunchTemplate, amiID string, setDefault bool,
+) (int64, error) {
+	cfg, err := c.getConfig(template.Account)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get config for account %s: %w", template.Account, err)
+	}
+
+	cfg.Region = template.Region
+	ec2Client := c.newEC2Client(cfg)
+
+	result, err := ec2Client.CreateLaunchTemplateVersion(ctx, &ec2.CreateLaunchTemplateVersionInput{
+		LaunchTemplateId:   aws.String(template.ID),
+		SourceVersion:      aws.String(strconv.FormatInt(template.Version, 10)),
+		VersionDescription: aws.String(fmt.Sprintf("ami-util: %s to %s", template.ImageID, amiID)),
+		LaunchTemplateData: &types.RequestLaunchTemplateData{ImageId: aws.String(amiID)},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create version of launch template %s: %w", template.Name, err)
+	}
+
+	version := aws.ToInt64(result.LaunchTemplateVersion.VersionNumber)
+
+	if setDefault {
+		_, err = ec2Client.ModifyLaunchTemplate(ctx, &ec2.ModifyLaunchTemplateInput{
+			LaunchTemplateId: aws.String(template.ID),
+			DefaultVersion:   aws.String(strconv.FormatInt(version, 10)),
+		})
+		if err != nil {
+			return version, fmt.Errorf("failed to set default version of launch template %s: %w", template.Name, err)
+		}
+	}
+
+	return version, nil
+}
@@ -0,0 +1,39 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// MarketplacePatternPrefix marks a pattern as an AWS Marketplace product code,
+// such as marketplace:prod-abc123xyz.
+const MarketplacePatternPrefix = "marketplace:"
+
+// processMarketplaceProduct resolves the AMIs of a Marketplace product by its
+// product code and maps every older AMI onto the newest one.
+func (c *Client) processMarketplaceProduct(ctx context.Context, ec2Client *ec2.Client, owner, pattern string,
+) ([]AMIReplacement, error) {
+	productCode := strings.TrimPrefix(pattern, MarketplacePatternPrefix)
+	filter := c.filterFor(pattern)
+
+	amis, err := c.describeAMIs(ctx, ec2Client, owner, append([]types.Filter{
+		{
+			Name:   aws.String("product-code"),
+			Values: []string{productCode},
+		},
+	}, filter.ec2Filters()...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find AMIs for product code %s: %w", productCode, err)
+	}
+
+	return replaceWithNewest(amis, filter, c.findingsCheck(ctx, ec2Client, owner)), nil
+}
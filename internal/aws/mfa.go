@@ -0,0 +1,87 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/schnauzersoft/ami-util/internal/progress"
+)
+
+var ErrEmptyMFAToken = errors.New("empty MFA token code")
+
+// mfaTokenProvider supplies MFA token codes for AssumeRole. Codes come from a
+// fixed token, a command, or a prompt on stdin, in that order. Calls are
+// serialized so concurrent lookups never prompt at the same time.
+type mfaTokenProvider struct {
+	mu      sync.Mutex
+	serial  string
+	token   string
+	command string
+}
+
+func (p *mfaTokenProvider) tokenCode() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" {
+		return p.token, nil
+	}
+
+	var (
+		code string
+		err  error
+	)
+
+	if p.command != "" {
+		code, err = p.runCommand()
+	} else {
+		code, err = p.prompt()
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if code == "" {
+		return "", ErrEmptyMFAToken
+	}
+
+	return code, nil
+}
+
+func (p *mfaTokenProvider) runCommand() (string, error) {
+	output, err := exec.Command("sh", "-c", p.command).Output() //nolint:gosec
+	if err != nil {
+		return "", fmt.Errorf("failed to run MFA token command: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (p *mfaTokenProvider) prompt() (string, error) {
+	device := p.serial
+	if device == "" {
+		device = "the MFA device"
+	}
+
+	resume := progress.Pause()
+	defer resume()
+
+	fmt.Fprintf(os.Stderr, "Enter MFA token code for %s: ", device)
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read MFA token code: %w", err)
+	}
+
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,229 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+const (
+	RetryModeStandard = "standard"
+	RetryModeAdaptive = "adaptive"
+)
+
+type clientOptions struct {
+	retryMaxAttempts int
+	retryMode        string
+	retryMaxBackoff  time.Duration
+	retryQuota       int
+	noRetryRateLimit bool
+	timeout          time.Duration
+	ssoProfile       string
+	ssoLogin         bool
+
+	webIdentityTokenFile string
+	roleARNTemplate      string
+	accountRoles         map[string]AccountRole
+	mfa                  *mfaTokenProvider
+	imageFilter          ImageFilter
+	patternFilters       map[string]ImageFilter
+	policyFile           string
+	endpointURL          string
+	session              sessionSettings
+	inspector            inspectorSettings
+}
+
+// sessionSettings are applied to every AssumeRole call.
+type sessionSettings struct {
+	duration          time.Duration
+	tags              map[string]string
+	transitiveTagKeys []string
+	sourceIdentity    string
+}
+
+func (s sessionSettings) apply(o *stscreds.AssumeRoleOptions) {
+	if s.duration > 0 {
+		o.Duration = s.duration
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(s.tags)) {
+		o.Tags = append(o.Tags, types.Tag{Key: aws.String(key), Value: aws.String(s.tags[key])})
+	}
+
+	if len(s.transitiveTagKeys) > 0 {
+		o.TransitiveTagKeys = s.transitiveTagKeys
+	}
+
+	if s.sourceIdentity != "" {
+		o.SourceIdentity = aws.String(s.sourceIdentity)
+	}
+}
+
+type Option func(*clientOptions)
+
+// WithRetry configures the retryer used for every AWS call. Zero values keep
+// the SDK defaults.
+func WithRetry(maxAttempts int, mode string, maxBackoff time.Duration) Option {
+	return func(o *clientOptions) {
+		o.retryMaxAttempts = maxAttempts
+		o.retryMode = mode
+		o.retryMaxBackoff = maxBackoff
+	}
+}
+
+// WithSSO sets the profile whose IAM Identity Center session is checked when
+// credentials cannot be retrieved, defaulting to the client profile. When login
+// is true, an expired session starts the device-code login flow.
+func WithSSO(profile string, login bool) Option {
+	return func(o *clientOptions) {
+		o.ssoProfile = profile
+		o.ssoLogin = login
+	}
+}
+
+// WithWebIdentityTokenFile assumes the role with AssumeRoleWithWebIdentity using
+// the OIDC token in path instead of classic AssumeRole.
+func WithWebIdentityTokenFile(path string) Option {
+	return func(o *clientOptions) {
+		o.webIdentityTokenFile = path
+	}
+}
+
+// WithRoleARNTemplate assumes a separate role for each account, built by
+// replacing AccountIDPlaceholder in template with the account ID.
+func WithRoleARNTemplate(template string) Option {
+	return func(o *clientOptions) {
+		o.roleARNTemplate = template
+	}
+}
+
+// WithAccountRoles sets the role to assume for individual accounts, taking
+// precedence over the role ARN template and the default role.
+func WithAccountRoles(roles map[string]AccountRole) Option {
+	return func(o *clientOptions) {
+		o.accountRoles = roles
+	}
+}
+
+// WithMFA sets the MFA device used when assuming roles. The token code is taken
+// from token, else from the output of command, else prompted for on stdin.
+// Profiles that set mfa_serial in the shared config use the same token source.
+func WithMFA(serial, token, command string) Option {
+	return func(o *clientOptions) {
+		o.mfa = &mfaTokenProvider{serial: serial, token: token, command: command}
+	}
+}
+
+// WithImageFilter sets the filter applied to candidate AMIs for every pattern.
+// Per-pattern filters are keyed by name pattern and override its non-empty
+// fields for the AMI names they match.
+func WithImageFilter(filter ImageFilter, patternFilters map[string]ImageFilter) Option {
+	return func(o *clientOptions) {
+		o.imageFilter = filter
+		o.patternFilters = patternFilters
+	}
+}
+
+// WithEndpointURL sends EC2 and STS calls to endpointURL instead of the
+// public AWS endpoints, for LocalStack or interface VPC endpoints.
+func WithEndpointURL(endpointURL string) Option {
+	return func(o *clientOptions) {
+		o.endpointURL = endpointURL
+	}
+}
+
+// WithSessionDuration sets how long assumed role sessions last. Zero keeps the
+// STS default of one hour.
+func WithSessionDuration(duration time.Duration) Option {
+	return func(o *clientOptions) {
+		o.session.duration = duration
+	}
+}
+
+// WithSessionTags passes session tags, the keys of those tags that carry over
+// to chained role sessions, and a source identity on every AssumeRole call.
+// AssumeRoleWithWebIdentity takes these from the token instead.
+func WithSessionTags(tags map[string]string, transitiveTagKeys []string, sourceIdentity string) Option {
+	return func(o *clientOptions) {
+		o.session.tags = tags
+		o.session.transitiveTagKeys = transitiveTagKeys
+		o.session.sourceIdentity = sourceIdentity
+	}
+}
+
+func (o *clientOptions) loadOptions() []func(*config.LoadOptions) error {
+	if o.mfa == nil {
+		o.mfa = &mfaTokenProvider{}
+	}
+
+	loadOptions := []func(*config.LoadOptions) error{
+		config.WithAssumeRoleCredentialOptions(func(ao *stscreds.AssumeRoleOptions) {
+			ao.TokenProvider = o.mfa.tokenCode
+
+			o.session.apply(ao)
+
+			// Roles assumed through shared config profiles use the custom
+			// endpoint as well.
+			stsClient, ok := ao.Client.(*sts.Client)
+			if ok && o.endpointURL != "" {
+				ao.Client = sts.New(stsClient.Options(), withSTSEndpoint(o.endpointURL))
+			}
+		}),
+	}
+
+	if o.retryMaxAttempts > 0 || o.retryMode != "" || o.retryMaxBackoff > 0 || o.rateLimiter() != nil {
+		loadOptions = append(loadOptions, config.WithRetryer(o.newRetryer))
+	}
+
+	// Set on load, the timeout and retry quota also bound the calls that
+	// obtain credentials for shared config profiles
+	if o.timeout > 0 {
+		loadOptions = append(loadOptions, config.WithAPIOptions([]func(*middleware.Stack) error{
+			limitCallDuration(o.timeout),
+		}))
+	}
+
+	if o.retryQuota > 0 {
+		loadOptions = append(loadOptions, config.WithAPIOptions([]func(*middleware.Stack) error{
+			limitCallRetries(uint(o.retryQuota)),
+		}))
+	}
+
+	return loadOptions
+}
+
+func (o *clientOptions) newRetryer() aws.Retryer {
+	standardOptions := func(so *retry.StandardOptions) {
+		if o.retryMaxAttempts > 0 {
+			so.MaxAttempts = o.retryMaxAttempts
+		}
+
+		if o.retryMaxBackoff > 0 {
+			so.MaxBackoff = o.retryMaxBackoff
+		}
+
+		if limiter := o.rateLimiter(); limiter != nil {
+			so.RateLimiter = limiter
+		}
+	}
+
+	if o.retryMode == RetryModeAdaptive {
+		return retry.NewAdaptiveMode(func(ao *retry.AdaptiveModeOptions) {
+			ao.StandardOptions = append(ao.StandardOptions, standardOptions)
+		})
+	}
+
+	return retry.NewStandard(standardOptions)
+}
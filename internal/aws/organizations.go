@@ -0,0 +1,147 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// ListOrganizationAccounts returns the IDs of the active accounts in the
+// organization, using the base credentials, which must belong to the
+// management account or a delegated administrator. With units, only accounts
+// under those OUs or roots, at any depth, are returned. With tags, only
+// accounts carrying every tag are returned.
+func (c *Client) ListOrganizationAccounts(ctx context.Context, units []string, tags map[string]string,
+) ([]string, error) {
+	cfg, err := c.getConfig("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+
+	// Organizations has a single global endpoint, so any region will do
+	if cfg.Region == "" {
+		cfg.Region = defaultRegion
+	}
+
+	client := organizations.NewFromConfig(cfg)
+
+	var accounts []types.Account
+
+	if len(units) == 0 {
+		paginator := organizations.NewListAccountsPaginator(client, &organizations.ListAccountsInput{})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list organization accounts: %w", err)
+			}
+
+			accounts = append(accounts, page.Accounts...)
+		}
+	}
+
+	for _, unit := range units {
+		unitAccounts, err := listAccountsUnder(ctx, client, unit)
+		if err != nil {
+			return nil, err
+		}
+
+		accounts = append(accounts, unitAccounts...)
+	}
+
+	var accountIDs []string
+
+	for _, account := range accounts {
+		accountID := aws.ToString(account.Id)
+		if account.Status != types.AccountStatusActive || slices.Contains(accountIDs, accountID) {
+			continue
+		}
+
+		if len(tags) > 0 {
+			matches, err := accountHasTags(ctx, client, accountID, tags)
+			if err != nil {
+				return nil, err
+			}
+
+			if !matches {
+				continue
+			}
+		}
+
+		accountIDs = append(accountIDs, accountID)
+	}
+
+	slices.Sort(accountIDs)
+
+	return accountIDs, nil
+}
+
+// listAccountsUnder returns the accounts directly in a parent and in every OU
+// below it.
+func listAccountsUnder(ctx context.Context, client *organizations.Client, parentID string) ([]types.Account, error) {
+	var accounts []types.Account
+
+	accountPaginator := organizations.NewListAccountsForParentPaginator(client,
+		&organizations.ListAccountsForParentInput{ParentId: aws.String(parentID)})
+	for accountPaginator.HasMorePages() {
+		page, err := accountPaginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list accounts in %s: %w", parentID, err)
+		}
+
+		accounts = append(accounts, page.Accounts...)
+	}
+
+	unitPaginator := organizations.NewListOrganizationalUnitsForParentPaginator(client,
+		&organizations.ListOrganizationalUnitsForParentInput{ParentId: aws.String(parentID)})
+	for unitPaginator.HasMorePages() {
+		page, err := unitPaginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list organizational units in %s: %w", parentID, err)
+		}
+
+		for _, unit := range page.OrganizationalUnits {
+			unitAccounts, err := listAccountsUnder(ctx, client, aws.ToString(unit.Id))
+			if err != nil {
+				return nil, err
+			}
+
+			accounts = append(accounts, unitAccounts...)
+		}
+	}
+
+	return accounts, nil
+}
+
+func accountHasTags(ctx context.Context, client *organizations.Client, accountID string, tags map[string]string,
+) (bool, error) {
+	accountTags := make(map[string]string)
+
+	paginator := organizations.NewListTagsForResourcePaginator(client,
+		&organizations.ListTagsForResourceInput{ResourceId: aws.String(accountID)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to list tags of account %s: %w", accountID, err)
+		}
+
+		for _, tag := range page.Tags {
+			accountTags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+	}
+
+	for key, value := range tags {
+		if actual, ok := accountTags[key]; !ok || actual != value {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
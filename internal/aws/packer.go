@@ -0,0 +1,95 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+var ErrAmbiguousSourceFilter = errors.New("filter matches more than one AMI and most_recent is not set")
+
+// SourceAMIFilter is a Packer source_ami_filter: the DescribeImages filters
+// and owners that select the source image of a build.
+type SourceAMIFilter struct {
+	Filters    map[string]string
+	Owners     []string
+	MostRecent bool
+}
+
+// ResolveSourceAMIFilter returns the AMI a Packer source_ami_filter selects in
+// a region, the way Packer does: the newest match with most_recent, and
+// otherwise the only match.
+func (c *Client) ResolveSourceAMIFilter(ctx context.Context, region string, filter SourceAMIFilter,
+) (*AMIInfo, error) {
+	filters := make(map[string][]string, len(filter.Filters))
+	for name, value := range filter.Filters {
+		filters[name] = []string{value}
+	}
+
+	amis, err := c.describeNewestFirst(ctx, "", region, filters, filter.Owners)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(amis) == 0:
+		return nil, ErrAMINotFound
+	case len(amis) > 1 && !filter.MostRecent:
+		return nil, fmt.Errorf("%w: %d AMIs match", ErrAmbiguousSourceFilter, len(amis))
+	}
+
+	return &amis[0], nil
+}
+
+// describeNewestFirst returns the AMIs matching DescribeImages filters and
+// owners in an account and region, newest first.
+func (c *Client) describeNewestFirst(ctx context.Context, accountID, region string, filters map[string][]string,
+	owners []string,
+) ([]AMIInfo, error) {
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config for account %s: %w", accountID, err)
+	}
+
+	cfg.Region = region
+
+	ec2Filters := make([]types.Filter, 0, len(filters))
+	for _, name := range slices.Sorted(maps.Keys(filters)) {
+		ec2Filters = append(ec2Filters, types.Filter{Name: aws.String(name), Values: filters[name]})
+	}
+
+	result, err := c.newEC2Client(cfg).DescribeImages(ctx, &ec2.DescribeImagesInput{
+		Filters: ec2Filters,
+		Owners:  owners,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe images: %w", err)
+	}
+
+	amis := make([]AMIInfo, 0, len(result.Images))
+	for _, image := range result.Images {
+		amiInfo, err := newAMIInfo(image, aws.ToString(image.OwnerId))
+		if err != nil {
+			warnUnparsable(image, err)
+
+			continue
+		}
+
+		amiInfo.Region = region
+		amis = append(amis, amiInfo)
+	}
+
+	sortNewestFirst(amis, nil)
+
+	return amis, nil
+}
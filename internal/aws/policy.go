@@ -0,0 +1,151 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/policy"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const hoursPerDay = 24
+
+// WithPolicyFile sets the policy file whose rules every AMI must pass before
+// it is accepted as a replacement, whatever the pattern that found it.
+func WithPolicyFile(path string) Option {
+	return func(o *clientOptions) {
+		o.policyFile = path
+	}
+}
+
+// violates returns the error of the first policy rule that ami does not pass,
+// or nil without a policy.
+func (f ImageFilter) violates(ami AMIInfo) error {
+	if f.Policy == nil {
+		return nil
+	}
+
+	return f.Policy.Check(policyAttributes(ami))
+}
+
+// policyAttributes returns the metadata of ami that policy rules read as the
+// fields of the ami variable.
+func policyAttributes(ami AMIInfo) map[string]any {
+	tags := make(map[string]string, len(ami.Tags))
+	maps.Copy(tags, ami.Tags)
+
+	return map[string]any{
+		"image_id":            ami.ImageID,
+		"name":                ami.Name,
+		"owner":               ami.Owner,
+		"architecture":        ami.Architecture,
+		"virtualization_type": ami.VirtualizationType,
+		"root_device_type":    ami.RootDeviceType,
+		"boot_mode":           effectiveBootMode(ami),
+		"creation_date":       ami.CreationDate,
+		"age_days":            int64(time.Since(ami.CreationDate).Hours() / hoursPerDay),
+		"tags":                tags,
+		"encrypted":           ami.Encrypted,
+		"public":              ami.Public,
+	}
+}
+
+// enforcePolicy drops the replacements onto AMIs that do not pass the policy,
+// for sources that name the new AMI directly, such as SSM parameters and
+// resolver plugins, rather than choosing it among candidates.
+func (c *Client) enforcePolicy(ctx context.Context, ec2Client *ec2.Client, region, pattern string,
+	replacements []AMIReplacement,
+) ([]AMIReplacement, error) {
+	if c.imageFilter.Policy == nil || len(replacements) == 0 {
+		return replacements, nil
+	}
+
+	newAMIs := make(map[string]bool)
+	for _, replacement := range replacements {
+		newAMIs[replacement.NewAMI] = true
+	}
+
+	amis, err := describeImageIDs(ctx, ec2Client, region, slices.Sorted(maps.Keys(newAMIs)))
+	if err != nil {
+		return nil, err
+	}
+
+	rejected := make(map[string]error, len(newAMIs))
+	for amiID := range newAMIs {
+		rejected[amiID] = ErrAMINotFound
+	}
+
+	for _, ami := range amis {
+		rejected[ami.ImageID] = c.imageFilter.violates(ami)
+	}
+
+	return slices.DeleteFunc(replacements, func(replacement AMIReplacement) bool {
+		err := rejected[replacement.NewAMI]
+		if err != nil {
+			slog.Warn("Skipping replacement rejected by policy", "pattern", pattern, "old_ami", replacement.OldAMI,
+				"new_ami", replacement.NewAMI, "reason", err)
+		}
+
+		return err != nil
+	}), nil
+}
+
+// describeImageIDs returns those of amiIDs that exist, whoever owns them,
+// leaving out those that are not found.
+func describeImageIDs(ctx context.Context, ec2Client *ec2.Client, region string, amiIDs []string,
+) ([]AMIInfo, error) {
+	var amis []AMIInfo
+
+	// Filtering by image ID, rather than naming the IDs, does not fail the
+	// whole call for an AMI that does not exist
+	for batch := range slices.Chunk(amiIDs, maxFilterValues) {
+		result, err := ec2Client.DescribeImages(ctx, &ec2.DescribeImagesInput{
+			Filters:           []types.Filter{{Name: aws.String("image-id"), Values: batch}},
+			IncludeDeprecated: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe images in %s: %w", region, err)
+		}
+
+		for _, image := range result.Images {
+			amiInfo, err := newAMIInfo(image, aws.ToString(image.OwnerId))
+			if err != nil {
+				warnUnparsable(image, err)
+
+				continue
+			}
+
+			amiInfo.Region = region
+			amis = append(amis, amiInfo)
+		}
+	}
+
+	return amis, nil
+}
+
+// loadPolicy loads the policy file of the options into their image filter.
+func (o *clientOptions) loadPolicy() error {
+	if o.policyFile == "" {
+		return nil
+	}
+
+	loaded, err := policy.Load(o.policyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load policy: %w", err)
+	}
+
+	o.imageFilter.Policy = loaded
+
+	return nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// ListProfiles returns the profile names defined in the shared AWS config and
+// credentials files.
+func ListProfiles() ([]string, error) {
+	configFile, credentialsFile := sharedConfigFiles()
+
+	profiles := make(map[string]bool)
+
+	for _, file := range []string{configFile, credentialsFile} {
+		names, err := readProfileNames(file, file == configFile)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			profiles[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// sharedConfigFiles returns the shared config and credentials files, honouring
+// the same environment variables as the SDK.
+func sharedConfigFiles() (string, string) {
+	configFile := os.Getenv("AWS_CONFIG_FILE")
+	if configFile == "" {
+		configFile = config.DefaultSharedConfigFilename()
+	}
+
+	credentialsFile := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credentialsFile == "" {
+		credentialsFile = config.DefaultSharedCredentialsFilename()
+	}
+
+	return configFile, credentialsFile
+}
+
+func readProfileNames(filename string, isConfigFile bool) ([]string, error) {
+	file, err := os.Open(filepath.Clean(filename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to open %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	var names []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+			continue
+		}
+
+		section := strings.TrimSpace(line[1 : len(line)-1])
+
+		if isConfigFile {
+			if section != "default" && !strings.HasPrefix(section, "profile ") {
+				continue
+			}
+
+			section = strings.TrimSpace(strings.TrimPrefix(section, "profile "))
+		}
+
+		names = append(names, section)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// callQuotaKey keys the retry quota of an AWS call in its context.
+type callQuotaKey struct{}
+
+// WithRetryQuota gives each AWS call its own budget of retry tokens, spent as
+// the SDK spends those of its retry token bucket: 5 per retry, and 10 per
+// retry of a timeout. The budget replaces the bucket that the SDK shares
+// between every call of a client, in which throttling in one account or
+// region can use up the retries of all the others. Zero keeps the shared
+// bucket, unless noRateLimit disables it, leaving calls limited by their
+// attempts alone.
+func WithRetryQuota(tokens int, noRateLimit bool) Option {
+	return func(o *clientOptions) {
+		o.retryQuota = tokens
+		o.noRetryRateLimit = noRateLimit
+	}
+}
+
+// rateLimiter returns the retry rate limiter to use in place of the SDK's
+// shared token bucket, or nil to keep it.
+func (o *clientOptions) rateLimiter() retry.RateLimiter {
+	switch {
+	case o.retryQuota > 0:
+		return callRetryQuota{}
+	case o.noRetryRateLimit:
+		return ratelimit.None
+	default:
+		return nil
+	}
+}
+
+// callRetryQuota is a retry rate limiter that spends the tokens of the budget
+// in the context of each call, in place of a bucket shared between calls.
+type callRetryQuota struct{}
+
+func (callRetryQuota) GetToken(ctx context.Context, cost uint) (func() error, error) {
+	quota, ok := ctx.Value(callQuotaKey{}).(*ratelimit.TokenRateLimit)
+	if !ok {
+		return ratelimit.None.GetToken(ctx, cost)
+	}
+
+	release, err := quota.GetToken(ctx, cost)
+	if err != nil {
+		return nil, fmt.Errorf("per-call retry quota: %w", err)
+	}
+
+	return release, nil
+}
+
+// AddTokens is a no-op, since every call starts with a full budget.
+func (callRetryQuota) AddTokens(uint) error {
+	return nil
+}
+
+// limitCallRetries returns a function adding a middleware that gives each of
+// a client's operations a budget of tokens retry tokens. It runs before the
+// retry loop, so that the budget covers every attempt.
+func limitCallRetries(tokens uint) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		quota := middleware.InitializeMiddlewareFunc("LimitCallRetries", func(ctx context.Context,
+			in middleware.InitializeInput, next middleware.InitializeHandler,
+		) (middleware.InitializeOutput, middleware.Metadata, error) {
+			ctx = context.WithValue(ctx, callQuotaKey{}, ratelimit.NewTokenRateLimit(tokens))
+
+			return next.HandleInitialize(ctx, in)
+		})
+
+		return stack.Initialize.Add(quota, middleware.Before)
+	}
+}
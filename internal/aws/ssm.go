@@ -0,0 +1,141 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// SSMPatternPrefix marks a pattern as an SSM parameter name, such as
+// ssm:/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-x86_64.
+const SSMPatternPrefix = "ssm:"
+
+// ssmImageDataType makes SSM validate that a published value is an AMI ID.
+const ssmImageDataType = "aws:ec2:image"
+
+var ErrInvalidSSMValue = errors.New("SSM parameter value is not an AMI ID")
+
+// SSMParameter is the current value and version of an SSM parameter.
+type SSMParameter struct {
+	Name    string
+	Value   string
+	Version int64
+}
+
+// GetSSMParameter returns the current value of an SSM parameter that holds an
+// AMI ID, such as one used by a CloudFormation dynamic reference.
+func (c *Client) GetSSMParameter(ctx context.Context, region, name string) (*SSMParameter, error) {
+	cfg, err := c.getConfig("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+
+	cfg.Region = region
+
+	result, err := ssm.NewFromConfig(cfg).GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(name)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SSM parameter %s: %w", name, err)
+	}
+
+	value := aws.ToString(result.Parameter.Value)
+	if !isAMIID(value) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSSMValue, name)
+	}
+
+	return &SSMParameter{Name: name, Value: value, Version: result.Parameter.Version}, nil
+}
+
+// PublishSSMParameter writes amiID to the SSM parameter name in the account
+// and region, using the role assumed for accountID. A parameter that already
+// holds amiID is left alone so its version history is not padded, and the
+// result reports whether the parameter was written.
+func (c *Client) PublishSSMParameter(ctx context.Context, accountID, region, name, amiID string) (bool, error) {
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get config for account %s: %w", accountID, err)
+	}
+
+	cfg.Region = region
+	ssmClient := ssm.NewFromConfig(cfg)
+
+	current, err := ssmClient.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(name)})
+
+	var notFound *types.ParameterNotFound
+
+	switch {
+	case errors.As(err, &notFound):
+	case err != nil:
+		return false, fmt.Errorf("failed to get SSM parameter %s: %w", name, err)
+	case aws.ToString(current.Parameter.Value) == amiID:
+		return false, nil
+	}
+
+	_, err = ssmClient.PutParameter(ctx, &ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Value:     aws.String(amiID),
+		Type:      types.ParameterTypeString,
+		DataType:  aws.String(ssmImageDataType),
+		Overwrite: aws.Bool(true),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to put SSM parameter %s: %w", name, err)
+	}
+
+	return true, nil
+}
+
+// processSSMParameter resolves the latest AMI from an SSM parameter and maps
+// every AMI the parameter previously pointed to onto it.
+func (c *Client) processSSMParameter(ctx context.Context, ssmClient *ssm.Client, name string,
+) ([]AMIReplacement, error) {
+	result, err := ssmClient.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(name)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SSM parameter %s: %w", name, err)
+	}
+
+	latest := aws.ToString(result.Parameter.Value)
+	if !isAMIID(latest) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSSMValue, name)
+	}
+
+	seen := map[string]bool{latest: true}
+
+	var replacements []AMIReplacement
+
+	paginator := ssm.NewGetParameterHistoryPaginator(ssmClient, &ssm.GetParameterHistoryInput{Name: aws.String(name)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get SSM parameter history for %s: %w", name, err)
+		}
+
+		for _, parameter := range page.Parameters {
+			value := aws.ToString(parameter.Value)
+			if seen[value] || !isAMIID(value) {
+				continue
+			}
+
+			seen[value] = true
+
+			replacements = append(replacements, AMIReplacement{
+				OldAMI: value,
+				NewAMI: latest,
+				Name:   name,
+			})
+		}
+	}
+
+	return replacements, nil
+}
+
+func isAMIID(value string) bool {
+	return value != "" && amiIDRegex.FindString(value) == value
+}
@@ -0,0 +1,286 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/progress"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc/types"
+)
+
+const (
+	ssoClientName        = "ami-util"
+	ssoClientType        = "public"
+	ssoAccessScope       = "sso:account:access"
+	ssoDeviceCodeGrant   = "urn:ietf:params:oauth:grant-type:device_code"
+	ssoSlowDownIncrement = 5 * time.Second
+	ssoCacheDirPerm      = 0o700
+	ssoCacheFilePerm     = 0o600
+)
+
+var ErrSSOLoginRequired = errors.New("SSO session has expired or is missing")
+
+// ssoSettings are the IAM Identity Center settings of the first profile in a
+// profile chain that obtains its credentials through SSO.
+type ssoSettings struct {
+	profile     string
+	sessionName string
+	startURL    string
+	region      string
+}
+
+// ssoCachedToken mirrors the token cache format shared with the AWS CLI.
+type ssoCachedToken struct {
+	AccessToken           string `json:"accessToken"`
+	ExpiresAt             string `json:"expiresAt"`
+	RefreshToken          string `json:"refreshToken,omitempty"`
+	ClientID              string `json:"clientId,omitempty"`
+	ClientSecret          string `json:"clientSecret,omitempty"`
+	RegistrationExpiresAt string `json:"registrationExpiresAt,omitempty"`
+	Region                string `json:"region,omitempty"`
+	StartURL              string `json:"startUrl,omitempty"`
+}
+
+// CheckCredentials retrieves credentials once before any work starts, so that
+// an expired SSO session is reported up front instead of failing every call
+// mid-run. When SSO login is enabled the device-code flow is started instead.
+func (c *Client) CheckCredentials(ctx context.Context) error {
+	cfg, err := c.getConfig("")
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	if cfg.Credentials == nil {
+		return nil
+	}
+
+	_, err = cfg.Credentials.Retrieve(ctx)
+	if err == nil {
+		return nil
+	}
+
+	sso := findSSOSettings(ctx, c.ssoProfile)
+	if sso == nil || sso.tokenValid() {
+		return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+
+	if !c.ssoLogin {
+		return fmt.Errorf("%w for profile %s, run \"aws sso login --profile %s\": %w",
+			ErrSSOLoginRequired, sso.profile, sso.profile, err)
+	}
+
+	err = c.ssoDeviceLogin(ctx, sso)
+	if err != nil {
+		return fmt.Errorf("failed to log in to SSO for profile %s: %w", sso.profile, err)
+	}
+
+	_, err = cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve AWS credentials after SSO login: %w", err)
+	}
+
+	return nil
+}
+
+func findSSOSettings(ctx context.Context, profile string) *ssoSettings {
+	configFile, credentialsFile := sharedConfigFiles()
+
+	shared, err := config.LoadSharedConfigProfile(ctx, profile, func(o *config.LoadSharedConfigOptions) {
+		o.ConfigFiles = []string{configFile}
+		o.CredentialsFiles = []string{credentialsFile}
+	})
+	if err != nil {
+		return nil
+	}
+
+	for current := &shared; current != nil; current = current.Source {
+		if current.SSOSession != nil {
+			return &ssoSettings{
+				profile:     current.Profile,
+				sessionName: current.SSOSession.Name,
+				startURL:    current.SSOSession.SSOStartURL,
+				region:      current.SSOSession.SSORegion,
+			}
+		}
+
+		if current.SSOStartURL != "" {
+			return &ssoSettings{
+				profile:  current.Profile,
+				startURL: current.SSOStartURL,
+				region:   current.SSORegion,
+			}
+		}
+	}
+
+	return nil
+}
+
+// cachePath returns the token cache file used by the SDK, which is keyed by
+// the session name for sso-session profiles and by the start URL otherwise.
+func (s *ssoSettings) cachePath() (string, error) {
+	key := s.startURL
+	if s.sessionName != "" {
+		key = s.sessionName
+	}
+
+	path, err := ssocreds.StandardCachedTokenFilepath(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to locate SSO token cache: %w", err)
+	}
+
+	return path, nil
+}
+
+func (s *ssoSettings) tokenValid() bool {
+	path, err := s.cachePath()
+	if err != nil {
+		return false
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	var token ssoCachedToken
+
+	err = json.Unmarshal(content, &token)
+	if err != nil {
+		return false
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, token.ExpiresAt)
+	if err != nil {
+		return false
+	}
+
+	return time.Now().Before(expiresAt)
+}
+
+func (c *Client) ssoDeviceLogin(ctx context.Context, sso *ssoSettings) error {
+	cfg := c.cfg.Copy()
+	cfg.Region = sso.region
+	cfg.Credentials = aws.AnonymousCredentials{}
+
+	client := ssooidc.NewFromConfig(cfg)
+
+	registerInput := &ssooidc.RegisterClientInput{
+		ClientName: aws.String(ssoClientName),
+		ClientType: aws.String(ssoClientType),
+	}
+	if sso.sessionName != "" {
+		registerInput.Scopes = []string{ssoAccessScope}
+	}
+
+	registration, err := client.RegisterClient(ctx, registerInput)
+	if err != nil {
+		return fmt.Errorf("failed to register SSO client: %w", err)
+	}
+
+	authorization, err := client.StartDeviceAuthorization(ctx, &ssooidc.StartDeviceAuthorizationInput{
+		ClientId:     registration.ClientId,
+		ClientSecret: registration.ClientSecret,
+		StartUrl:     aws.String(sso.startURL),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start SSO device authorization: %w", err)
+	}
+
+	resume := progress.Pause()
+	defer resume()
+
+	fmt.Fprintf(os.Stderr, "To log in to SSO, open %s and confirm the code %s\n",
+		aws.ToString(authorization.VerificationUriComplete), aws.ToString(authorization.UserCode))
+
+	token, err := pollSSOToken(ctx, client, registration, authorization)
+	if err != nil {
+		return err
+	}
+
+	return sso.writeToken(ssoCachedToken{
+		AccessToken:           aws.ToString(token.AccessToken),
+		ExpiresAt:             time.Now().Add(time.Duration(token.ExpiresIn) * time.Second).UTC().Format(time.RFC3339),
+		RefreshToken:          aws.ToString(token.RefreshToken),
+		ClientID:              aws.ToString(registration.ClientId),
+		ClientSecret:          aws.ToString(registration.ClientSecret),
+		RegistrationExpiresAt: time.Unix(registration.ClientSecretExpiresAt, 0).UTC().Format(time.RFC3339),
+		Region:                sso.region,
+		StartURL:              sso.startURL,
+	})
+}
+
+// pollSSOToken waits for the user to approve the device authorization,
+// honouring the polling interval requested by the service.
+func pollSSOToken(ctx context.Context, client *ssooidc.Client, registration *ssooidc.RegisterClientOutput,
+	authorization *ssooidc.StartDeviceAuthorizationOutput,
+) (*ssooidc.CreateTokenOutput, error) {
+	interval := time.Duration(max(authorization.Interval, 1)) * time.Second
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("SSO login cancelled: %w", ctx.Err())
+		case <-time.After(interval):
+		}
+
+		token, err := client.CreateToken(ctx, &ssooidc.CreateTokenInput{
+			ClientId:     registration.ClientId,
+			ClientSecret: registration.ClientSecret,
+			GrantType:    aws.String(ssoDeviceCodeGrant),
+			DeviceCode:   authorization.DeviceCode,
+		})
+		if err == nil {
+			return token, nil
+		}
+
+		var pending *types.AuthorizationPendingException
+
+		var slowDown *types.SlowDownException
+
+		switch {
+		case errors.As(err, &slowDown):
+			interval += ssoSlowDownIncrement
+		case errors.As(err, &pending):
+		default:
+			return nil, fmt.Errorf("failed to create SSO token: %w", err)
+		}
+	}
+}
+
+func (s *ssoSettings) writeToken(token ssoCachedToken) error {
+	path, err := s.cachePath()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to encode SSO token: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), ssoCacheDirPerm)
+	if err != nil {
+		return fmt.Errorf("failed to create SSO token cache: %w", err)
+	}
+
+	err = os.WriteFile(path, content, ssoCacheFilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to write SSO token cache: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// CloudFormation parameter types that hold AMI IDs.
+const (
+	ParameterTypeImageID     = "AWS::EC2::Image::Id"
+	ParameterTypeImageIDList = "List<AWS::EC2::Image::Id>"
+	parameterTypeString      = "String"
+)
+
+var exactAMIIDRegex = regexp.MustCompile(`^ami-[a-f0-9]{8,17}$`)
+
+// updatableStackStatuses are the stack statuses UpdateStack and
+// CreateChangeSet accept.
+var updatableStackStatuses = []types.StackStatus{
+	types.StackStatusCreateComplete,
+	types.StackStatusUpdateComplete,
+	types.StackStatusUpdateRollbackComplete,
+	types.StackStatusImportComplete,
+	types.StackStatusImportRollbackComplete,
+}
+
+// Stack is a CloudFormation stack and its parameters.
+type Stack struct {
+	Name         string
+	ID           string
+	Account      string
+	Region       string
+	Parameters   []StackParameter
+	Capabilities []string
+}
+
+// StackParameter is a parameter of a stack with its declared type.
+type StackParameter struct {
+	Key   string
+	Value string
+	Type  string
+}
+
+// HoldsAMIs reports whether a parameter takes AMI IDs: it is AMI-typed, or it
+// is a String parameter whose value is an AMI ID.
+func (p StackParameter) HoldsAMIs() bool {
+	switch p.Type {
+	case ParameterTypeImageID, ParameterTypeImageIDList:
+		return true
+	case parameterTypeString:
+		return exactAMIIDRegex.MatchString(p.Value)
+	default:
+		return false
+	}
+}
+
+// FindStacks returns the stacks in an account and region that can be updated,
+// whose names match one of names (with * wildcards) and that carry every tag.
+// Empty names and tags match every stack. Nested stacks are left out, since
+// they are updated through their root stack.
+func (c *Client) FindStacks(ctx context.Context, accountID, region string, names []string,
+	tags map[string]string,
+) ([]Stack, error) {
+	cfg, err := c.getConfig(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config for account %s: %w", accountID, err)
+	}
+
+	cfg.Region = region
+	cloudFormationClient := c.newCloudFormationClient(cfg)
+
+	var stacks []Stack
+
+	paginator := cloudformation.NewDescribeStacksPaginator(cloudFormationClient, &cloudformation.DescribeStacksInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe stacks: %w", err)
+		}
+
+		for _, stack := range page.Stacks {
+			name := aws.ToString(stack.StackName)
+
+			if stack.ParentId != nil || !slices.Contains(updatableStackStatuses, stack.StackStatus) ||
+				!stackMatches(stack, name, names, tags) {
+				continue
+			}
+
+			parameterTypes, err := stackParameterTypes(ctx, cloudFormationClient, aws.ToString(stack.StackId))
+			if err != nil {
+				return nil, fmt.Errorf("failed to get template of stack %s: %w", name, err)
+			}
+
+			result := Stack{
+				Name:    name,
+				ID:      aws.ToString(stack.StackId),
+				Account: accountID,
+				Region:  region,
+			}
+
+			for _, parameter := range stack.Parameters {
+				key := aws.ToString(parameter.ParameterKey)
+
+				result.Parameters = append(result.Parameters, StackParameter{
+					Key:   key,
+					Value: aws.ToString(parameter.ParameterValue),
+					Type:  parameterTypes[key],
+				})
+			}
+
+			for _, capability := range stack.Capabilities {
+				result.Capabilities = append(result.Capabilities, string(capability))
+			}
+
+			stacks = append(stacks, result)
+		}
+	}
+
+	return stacks, nil
+}
+
+func stackMatches(stack types.Stack, name string, names []string, tags map[string]string) bool {
+	if len(names) > 0 && !slices.ContainsFunc(names, func(pattern string) bool {
+		return MatchNamePattern(pattern, name)
+	}) {
+		return false
+	}
+
+	for key, value := range tags {
+		if !slices.ContainsFunc(stack.Tags, func(tag types.Tag) bool {
+			return aws.ToString(tag.Key) == key && aws.ToString(tag.Value) == value
+		}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// stackParameterTypes returns the declared type of each parameter of a
+// stack's template.
+func stackParameterTypes(ctx context.Context, cloudFormationClient *cloudformation.Client, stackID string,
+) (map[string]string, error) {
+	summary, err := cloudFormationClient.GetTemplateSummary(ctx, &cloudformation.GetTemplateSummaryInput{
+		StackName: aws.String(stackID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template summary: %w", err)
+	}
+
+	parameterTypes := make(map[string]string, len(summary.Parameters))
+	for _, declaration := range summary.Parameters {
+		parameterTypes[aws.ToString(declaration.ParameterKey)] = aws.ToString(declaration.ParameterType)
+	}
+
+	return parameterTypes, nil
+}
+
+// UpdateStackParameters updates a stack with its current template and new
+// values for some of its parameters, keeping the previous value of every
+// other parameter. With changeSet, a change set is created for review instead
+// and its name is returned.
+func (c *Client) UpdateStackParameters(ctx context.Context, stack Stack, values map[string]string, changeSet bool,
+) (string, error) {
+	cfg, err := c.getConfig(stack.Account)
+	if err != nil {
+		return "", fmt.Errorf("failed to get config for account %s: %w", stack.Account, err)
+	}
+
+	cfg.Region = stack.Region
+	cloudFormationClient := c.newCloudFormationClient(cfg)
+
+	parameters := make([]types.Parameter, 0, len(stack.Parameters))
+	for _, parameter := range stack.Parameters {
+		if value, ok := values[parameter.Key]; ok {
+			parameters = append(parameters, types.Parameter{
+				ParameterKey:   aws.String(parameter.Key),
+				ParameterValue: aws.String(value),
+			})
+
+			continue
+		}
+
+		parameters = append(parameters, types.Parameter{
+			ParameterKey:     aws.String(parameter.Key),
+			UsePreviousValue: aws.Bool(true),
+		})
+	}
+
+	capabilities := make([]types.Capability, 0, len(stack.Capabilities))
+	for _, capability := range stack.Capabilities {
+		capabilities = append(capabilities, types.Capability(capability))
+	}
+
+	if changeSet {
+		name := "ami-util-" + time.Now().UTC().Format("20060102150405")
+
+		_, err = cloudFormationClient.CreateChangeSet(ctx, &cloudformation.CreateChangeSetInput{
+			StackName:           aws.String(stack.ID),
+			ChangeSetName:       aws.String(name),
+			ChangeSetType:       types.ChangeSetTypeUpdate,
+			UsePreviousTemplate: aws.Bool(true),
+			Parameters:          parameters,
+			Capabilities:        capabilities,
+			Description:         aws.String("ami-util: update AMI parameters"),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to create change set for stack %s: %w", stack.Name, err)
+		}
+
+		return name, nil
+	}
+
+	_, err = cloudFormationClient.UpdateStack(ctx, &cloudformation.UpdateStackInput{
+		StackName:           aws.String(stack.ID),
+		UsePreviousTemplate: aws.Bool(true),
+		Parameters:          parameters,
+		Capabilities:        capabilities,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to update stack %s: %w", stack.Name, err)
+	}
+
+	return "", nil
+}
@@ -0,0 +1,48 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/smithy-go/middleware"
+)
+
+var ErrCallTimeout = errors.New("AWS call timed out")
+
+// WithTimeout limits how long each AWS call may take, including its retries,
+// so that a call that hangs fails rather than stalling the run. Zero leaves
+// calls unbounded.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.timeout = timeout
+	}
+}
+
+// limitCallDuration returns a function adding a middleware that bounds the
+// context of each of a client's operations by timeout. It runs before the
+// retry loop, so that the timeout covers every attempt.
+func limitCallDuration(timeout time.Duration) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		limit := middleware.InitializeMiddlewareFunc("LimitCallDuration", func(ctx context.Context,
+			in middleware.InitializeInput, next middleware.InitializeHandler,
+		) (middleware.InitializeOutput, middleware.Metadata, error) {
+			callCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			out, metadata, err := next.HandleInitialize(callCtx, in)
+			if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("%w after %s: %w", ErrCallTimeout, timeout, err)
+			}
+
+			return out, metadata, err
+		})
+
+		return stack.Initialize.Add(limit, middleware.Before)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package aws
+
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+var versionComponentRegex = regexp.MustCompile(`\d+`)
+
+// sortNewestFirst orders AMIs newest first. Without a version regex only the
+// creation date counts. With one, the version parsed from each name decides,
+// the creation date breaks ties, and names without a version sort last, so a
+// re-published build of an older version never wins on date alone.
+func sortNewestFirst(amis []AMIInfo, version *regexp.Regexp) {
+	if version == nil {
+		slices.SortStableFunc(amis, func(a, b AMIInfo) int {
+			return b.CreationDate.Compare(a.CreationDate)
+		})
+
+		return
+	}
+
+	versions := make(map[string][]int, len(amis))
+	for _, ami := range amis {
+		versions[ami.ImageID] = parseVersion(version, ami.Name)
+	}
+
+	slices.SortStableFunc(amis, func(a, b AMIInfo) int {
+		versionA, versionB := versions[a.ImageID], versions[b.ImageID]
+
+		switch {
+		case versionA == nil && versionB != nil:
+			return 1
+		case versionA != nil && versionB == nil:
+			return -1
+		}
+
+		result := compareVersions(versionB, versionA)
+		if result != 0 {
+			return result
+		}
+
+		return b.CreationDate.Compare(a.CreationDate)
+	})
+}
+
+// ranksAhead reports whether a sorts strictly before b, so that an AMI only
+// gives way to a candidate that is actually newer.
+func ranksAhead(a, b AMIInfo, version *regexp.Regexp) bool {
+	ranked := []AMIInfo{b, a}
+	sortNewestFirst(ranked, version)
+
+	return ranked[0].ImageID == a.ImageID
+}
+
+// parseVersion returns the numeric components of the version in name, taken
+// from the regex's first capture group or else its whole match.
+func parseVersion(version *regexp.Regexp, name string) []int {
+	match := version.FindStringSubmatch(name)
+	if match == nil {
+		return nil
+	}
+
+	text := match[0]
+	if len(match) > 1 {
+		text = match[1]
+	}
+
+	components := versionComponentRegex.FindAllString(text, -1)
+	if len(components) == 0 {
+		return nil
+	}
+
+	parsed := make([]int, 0, len(components))
+
+	for _, component := range components {
+		number, err := strconv.Atoi(component)
+		if err != nil {
+			return nil
+		}
+
+		parsed = append(parsed, number)
+	}
+
+	return parsed
+}
+
+func compareVersions(a, b []int) int {
+	for i := range min(len(a), len(b)) {
+		result := cmp.Compare(a[i], b[i])
+		if result != 0 {
+			return result
+		}
+	}
+
+	return cmp.Compare(len(a), len(b))
+}
@@ -5,36 +5,456 @@ Copyright © 2025 Ben Sapp ya.bsapp.ru
 package config
 
 import (
+	"cmp"
+	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/logging"
+	"github.com/schnauzersoft/ami-util/internal/metrics"
 
 	"github.com/spf13/viper"
 )
 
 const (
-	DefaultDirPerm = 0o755
+	DefaultDirPerm        = 0o755
+	DefaultMaxConcurrency = 4
+	DefaultFileWorkers    = 8
+	DefaultGitRemote      = "origin"
+
+	// MinDurationSeconds and MaxDurationSeconds bound the assumed role session
+	// duration STS accepts.
+	MinDurationSeconds = 900
+	MaxDurationSeconds = 43200
+
+	DynamicReferencesReport  = "report"
+	DynamicReferencesRewrite = "rewrite"
+
+	CDKContextRefresh = "refresh"
+	CDKContextDelete  = "delete"
 )
 
 var (
-	ErrNoAccountID = errors.New("at least one account ID is required")
-	ErrNoFilePath  = errors.New("file path is required")
+	ErrNoAccountID        = errors.New("at least one account ID is required")
+	ErrNoFilePath         = errors.New("file path is required")
+	ErrInvalidAccountID   = errors.New("invalid account ID")
+	ErrInvalidRegion      = errors.New("invalid region")
+	ErrInvalidRoleARN     = errors.New("invalid role ARN")
+	ErrInvalidPattern     = errors.New("invalid pattern")
+	ErrInvalidRetry       = errors.New("invalid retry setting")
+	ErrInvalidConcurrency = errors.New("invalid concurrency setting")
+	ErrInvalidWebIdentity = errors.New("invalid web identity setting")
+	ErrInvalidFilter      = errors.New("invalid image filter")
+	ErrInvalidEndpointURL = errors.New("invalid endpoint URL")
+	ErrInvalidDynamicRefs = errors.New("invalid dynamic references setting")
+	ErrInvalidPublish     = errors.New("invalid publish parameter")
+	ErrInvalidOrg         = errors.New("invalid organization setting")
+	ErrInvalidDuration    = errors.New("invalid session duration")
+	ErrInvalidSessionTag  = errors.New("invalid session tag")
+	ErrInvalidCDKContext  = errors.New("invalid CDK context setting")
+	ErrInvalidMaxDepth    = errors.New("invalid max depth")
+	ErrInvalidBackup      = errors.New("invalid backup setting")
+	ErrInvalidGit         = errors.New("invalid git setting")
+	ErrInvalidLogging     = errors.New("invalid logging setting")
+	ErrInvalidMetrics     = errors.New("invalid metrics setting")
+	ErrInvalidInspector   = errors.New("invalid Inspector setting")
+	ErrInvalidStaleAfter  = errors.New("invalid stale AMI threshold")
+	ErrUnknownEnvironment = errors.New("unknown environment")
+	ErrIncludeCycle       = errors.New("configuration files include each other")
+	ErrInvalidInclude     = errors.New("invalid include")
 )
 
+var (
+	accountIDRegex = regexp.MustCompile(`^\d{12}$`)
+	regionRegex    = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-\d+$`)
+	roleARNRegex   = regexp.MustCompile(`^arn:aws[a-z-]*:iam::\d{12}:role/[\w+=,.@/-]+$`)
+	amiIDRegex     = regexp.MustCompile(`^ami-[a-f0-9]{8,17}$`)
+	sourceIDRegex  = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+	orgUnitRegex   = regexp.MustCompile(`^(r-[0-9a-z]{4,32}|ou-[0-9a-z]{4,32}-[a-z0-9]{8,32})$`)
+	labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+var (
+	architectures       = []string{"i386", "x86_64", "arm64", "x86_64_mac", "arm64_mac"}
+	virtualizationTypes = []string{"hvm", "paravirtual"}
+	rootDeviceTypes     = []string{"ebs", "instance-store"}
+)
+
+// AccountRole overrides the role assumed for a single account.
+type AccountRole struct {
+	RoleARN     string `mapstructure:"role_arn"     toml:"role_arn"     yaml:"role_arn"`
+	SessionName string `mapstructure:"session_name" toml:"session_name" yaml:"session_name"`
+	ExternalID  string `mapstructure:"external_id"  toml:"external_id"  yaml:"external_id"`
+}
+
+// PublishParameter is an SSM parameter that the publish command keeps pointed
+// at the latest AMI matching a pattern.
+type PublishParameter struct {
+	Pattern   string `mapstructure:"pattern"   toml:"pattern"   yaml:"pattern"`
+	Parameter string `mapstructure:"parameter" toml:"parameter" yaml:"parameter"`
+}
+
+// FileRegion assigns the AMI IDs of the files matching a path, glob pattern,
+// or directory to a region.
+type FileRegion struct {
+	Path   string `mapstructure:"path"   toml:"path"   yaml:"path"`
+	Region string `mapstructure:"region" toml:"region" yaml:"region"`
+}
+
+// Target is a set of files updated with the AMIs found in its own accounts
+// and regions for its own patterns. Accounts, regions, and patterns left
+// empty fall back to the top-level settings.
+type Target struct {
+	Files    []string `mapstructure:"file"     toml:"file"     yaml:"file"`
+	Accounts []string `mapstructure:"accounts" toml:"accounts" yaml:"accounts"`
+	Regions  []string `mapstructure:"regions"  toml:"regions"  yaml:"regions"`
+	Patterns []string `mapstructure:"patterns" toml:"patterns" yaml:"patterns"`
+}
+
+// PatternFilter narrows the candidate AMIs for AMI names matching a pattern.
+type PatternFilter struct {
+	Architecture       string `mapstructure:"architecture"        toml:"architecture"        yaml:"architecture"`
+	VirtualizationType string `mapstructure:"virtualization_type" toml:"virtualization_type" yaml:"virtualization_type"`
+	RootDeviceType     string `mapstructure:"root_device_type"    toml:"root_device_type"    yaml:"root_device_type"`
+
+	// Tags are Key=Value pairs. They are kept as a list because configuration
+	// map keys are case-insensitive while tag keys are not.
+	Tags []string `mapstructure:"tags" toml:"tags" yaml:"tags"`
+
+	// VersionRegex extracts a version from candidate names, from its first
+	// capture group if it has one, to order candidates by version.
+	VersionRegex string `mapstructure:"version_regex" toml:"version_regex" yaml:"version_regex"`
+
+	// ExcludePatterns are regexes matched against candidate names. Matching
+	// candidates are never chosen as a replacement.
+	ExcludePatterns []string `mapstructure:"exclude_patterns" toml:"exclude_patterns" yaml:"exclude_patterns"`
+
+	// MinAge is how long a candidate must have existed before it is chosen.
+	MinAge time.Duration `mapstructure:"min_age" toml:"min_age" yaml:"min_age"`
+}
+
+// VersionRegexp returns the compiled version regex, or nil when it is unset or
+// invalid.
+func (f PatternFilter) VersionRegexp() *regexp.Regexp {
+	if f.VersionRegex == "" {
+		return nil
+	}
+
+	version, err := regexp.Compile(f.VersionRegex)
+	if err != nil {
+		return nil
+	}
+
+	return version
+}
+
+// ExcludeRegexps returns the compiled exclude patterns, skipping invalid ones.
+func (f PatternFilter) ExcludeRegexps() []*regexp.Regexp {
+	excludes := make([]*regexp.Regexp, 0, len(f.ExcludePatterns))
+	for _, pattern := range f.ExcludePatterns {
+		exclude, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+
+		excludes = append(excludes, exclude)
+	}
+
+	return excludes
+}
+
+// TagMap returns the filter's tags keyed by tag key.
+func (f PatternFilter) TagMap() map[string]string {
+	return ParseTags(f.Tags)
+}
+
+// ParseTags converts Key=Value pairs into a map keyed by tag key.
+func ParseTags(pairs []string) map[string]string {
+	tags := make(map[string]string, len(pairs))
+	for _, tag := range pairs {
+		key, value, _ := strings.Cut(tag, "=")
+		tags[key] = value
+	}
+
+	return tags
+}
+
 type Config struct {
 	Accounts []string `mapstructure:"accounts" toml:"accounts" yaml:"accounts"`
-	File     string   `mapstructure:"file"     toml:"file"     yaml:"file"`
+	Files    []string `mapstructure:"file"     toml:"file"     yaml:"file"`
 	Profile  string   `mapstructure:"profile"  toml:"profile"  yaml:"profile"`
-	Verbose  bool     `mapstructure:"verbose"  toml:"verbose"  yaml:"verbose"`
+	Verbose  int      `mapstructure:"verbose"  toml:"verbose"  yaml:"verbose"`
 	Regions  []string `mapstructure:"regions"  toml:"regions"  yaml:"regions"`
 	RoleARN  string   `mapstructure:"role_arn" toml:"role_arn" yaml:"roleArn"`
 	Patterns []string `mapstructure:"patterns" toml:"patterns" yaml:"patterns"`
+	Pins     []string `mapstructure:"pins"     toml:"pins"     yaml:"pins"`
+
+	MaxConcurrency   int           `mapstructure:"max_concurrency"    toml:"max_concurrency"    yaml:"max_concurrency"`
+	FileWorkers      int           `mapstructure:"file_workers"       toml:"file_workers"       yaml:"file_workers"`
+	RetryMaxAttempts int           `mapstructure:"retry_max_attempts" toml:"retry_max_attempts" yaml:"retry_max_attempts"`
+	RetryMode        string        `mapstructure:"retry_mode"         toml:"retry_mode"         yaml:"retry_mode"`
+	RetryMaxBackoff  time.Duration `mapstructure:"retry_max_backoff"  toml:"retry_max_backoff"  yaml:"retry_max_backoff"`
+	AWSTimeout       time.Duration `mapstructure:"aws_timeout"        toml:"aws_timeout"        yaml:"aws_timeout"`
+	SSOProfile       string        `mapstructure:"sso_profile"        toml:"sso_profile"        yaml:"sso_profile"`
+	SSOLogin         bool          `mapstructure:"sso_login"          toml:"sso_login"          yaml:"sso_login"`
+
+	// RetryQuota is the retry tokens each AWS call may spend, in place of the
+	// SDK's bucket shared by every call, which NoRetryRateLimit disables.
+	RetryQuota       int  `mapstructure:"retry_quota"         toml:"retry_quota"         yaml:"retry_quota"`
+	NoRetryRateLimit bool `mapstructure:"no_retry_rate_limit" toml:"no_retry_rate_limit" yaml:"no_retry_rate_limit"`
+
+	RoleARNTemplate string `mapstructure:"role_arn_template" toml:"role_arn_template" yaml:"role_arn_template"`
+	MFASerial       string `mapstructure:"mfa_serial"        toml:"mfa_serial"        yaml:"mfa_serial"`
+	MFAToken        string `mapstructure:"mfa_token"         toml:"mfa_token"         yaml:"mfa_token"`
+	MFATokenCommand string `mapstructure:"mfa_token_command" toml:"mfa_token_command" yaml:"mfa_token_command"`
+
+	// DurationSeconds is how long assumed role sessions last, or zero for the
+	// STS default of one hour.
+	DurationSeconds int `mapstructure:"duration_seconds" toml:"duration_seconds" yaml:"duration_seconds"`
+
+	// SessionTags are Key=Value session tags passed when assuming roles, and
+	// TransitiveTagKeys the keys among them that carry over to chained roles.
+	SessionTags       []string `mapstructure:"session_tags"        toml:"session_tags"        yaml:"session_tags"`
+	TransitiveTagKeys []string `mapstructure:"transitive_tag_keys" toml:"transitive_tag_keys" yaml:"transitive_tag_keys"`
+	SourceIdentity    string   `mapstructure:"source_identity"     toml:"source_identity"     yaml:"source_identity"`
+
+	AccountRoles map[string]AccountRole `mapstructure:"account_roles" toml:"account_roles" yaml:"account_roles"`
+
+	// AccountRegions lists the regions searched in an account, in place of
+	// Regions or those discovered with AllRegions.
+	AccountRegions map[string][]string `mapstructure:"account_regions" toml:"account_regions" yaml:"account_regions"`
+
+	PatternFilter  `mapstructure:",squash" yaml:",inline"`
+	PatternFilters map[string]PatternFilter `mapstructure:"pattern_filters" toml:"pattern_filters" yaml:"pattern_filters"`
+
+	// PatternAliases name patterns, so that patterns, targets, flags, and
+	// pattern_filters keys can use the name in place of the pattern.
+	PatternAliases map[string]string `mapstructure:"pattern_aliases" toml:"pattern_aliases" yaml:"pattern_aliases"`
+
+	// PatternOwners lists the accounts or owner aliases each pattern is
+	// searched in, instead of every account. Patterns not listed are searched
+	// in every account.
+	PatternOwners map[string][]string `mapstructure:"pattern_owners" toml:"pattern_owners" yaml:"pattern_owners"`
+
+	WebIdentityTokenFile string `mapstructure:"web_identity_token_file" toml:"web_identity_token_file" yaml:"web_identity_token_file"` //nolint:lll
+
+	EndpointURL string `mapstructure:"endpoint_url" toml:"endpoint_url" yaml:"endpoint_url"`
+
+	// PolicyFile holds the CEL rules that every replacement AMI must pass.
+	PolicyFile string `mapstructure:"policy_file" toml:"policy_file" yaml:"policy_file"`
+
+	// LaunchAccounts must all be able to launch a replacement AMI before it is
+	// written to files.
+	LaunchAccounts []string `mapstructure:"launch_accounts" toml:"launch_accounts" yaml:"launch_accounts"`
+
+	// Inspector refuses replacement AMIs with more than InspectorMaxCritical
+	// critical Amazon Inspector findings, choosing the newest candidate that
+	// passes instead. InspectorRequireScan refuses AMIs that Inspector has no
+	// findings for as well.
+	Inspector            bool `mapstructure:"inspector" toml:"inspector" yaml:"inspector"`
+	InspectorMaxCritical int  `mapstructure:"inspector_max_critical" toml:"inspector_max_critical" yaml:"inspector_max_critical"` //nolint:lll
+	InspectorRequireScan bool `mapstructure:"inspector_require_scan" toml:"inspector_require_scan" yaml:"inspector_require_scan"` //nolint:lll
+
+	// StaleAfter reports referenced AMIs at least this old that have no
+	// replacement, along with those that no longer exist, when set.
+	StaleAfter time.Duration `mapstructure:"stale_after" toml:"stale_after" yaml:"stale_after"`
+
+	// DynamicReferences is how CloudFormation dynamic references are handled:
+	// DynamicReferencesReport, DynamicReferencesRewrite, or empty to ignore them.
+	DynamicReferences string `mapstructure:"dynamic_references" toml:"dynamic_references" yaml:"dynamic_references"`
+
+	// CDKContext is how cached AMI lookups in cdk.context.json files are
+	// handled: CDKContextRefresh, CDKContextDelete, or empty to update them
+	// like any other file.
+	CDKContext string `mapstructure:"cdk_context" toml:"cdk_context" yaml:"cdk_context"`
+
+	// ImageBuilder moves EC2 Image Builder image and image recipe ARNs onto
+	// their latest versions, and the AMIs of image builds onto those of the
+	// latest build.
+	ImageBuilder bool `mapstructure:"image_builder" toml:"image_builder" yaml:"image_builder"`
+
+	PublishParameters []PublishParameter `mapstructure:"publish_parameters" toml:"publish_parameters" yaml:"publish_parameters"` //nolint:lll
+
+	// AccountsFromOrg adds the active accounts of the AWS Organization to
+	// Accounts, optionally limited to the accounts under OrgUnits (searched
+	// recursively) that carry every OrgAccountTags Key=Value pair.
+	AccountsFromOrg bool     `mapstructure:"accounts_from_org" toml:"accounts_from_org" yaml:"accounts_from_org"`
+	OrgUnits        []string `mapstructure:"org_units"         toml:"org_units"         yaml:"org_units"`
+	OrgAccountTags  []string `mapstructure:"org_account_tags"  toml:"org_account_tags"  yaml:"org_account_tags"`
+
+	// AllRegions searches every region enabled for each account instead of
+	// Regions.
+	AllRegions bool `mapstructure:"all_regions" toml:"all_regions" yaml:"all_regions"`
+
+	// YAMLKeys limits replacements in YAML files to the values under these
+	// dot-separated key paths.
+	YAMLKeys []string `mapstructure:"yaml_keys" toml:"yaml_keys" yaml:"yaml_keys"`
+
+	// HCL limits replacements in Terraform files to the expressions assigned
+	// to HCLAttributes.
+	HCL           bool     `mapstructure:"hcl"            toml:"hcl"            yaml:"hcl"`
+	HCLAttributes []string `mapstructure:"hcl_attributes" toml:"hcl_attributes" yaml:"hcl_attributes"`
+
+	// Ansible limits replacements in YAML files to the image arguments of EC2
+	// tasks and the values in vars files.
+	Ansible bool `mapstructure:"ansible" toml:"ansible" yaml:"ansible"`
+
+	// Gitignore skips paths ignored by .gitignore files when searching
+	// directories.
+	Gitignore bool `mapstructure:"gitignore" toml:"gitignore" yaml:"gitignore"`
+
+	// MaxDepth limits directory searches to files at most this many levels
+	// below the directory, or zero for no limit.
+	MaxDepth       int  `mapstructure:"max_depth"       toml:"max_depth"       yaml:"max_depth"`
+	FollowSymlinks bool `mapstructure:"follow_symlinks" toml:"follow_symlinks" yaml:"follow_symlinks"`
+
+	// NoBackup skips the backups saved before files are updated, and
+	// BackupDir saves them under a separate directory tree instead of next
+	// to the updated files. BackupKeep timestamps backups and keeps this many
+	// per file, or a single one replaced on every run when zero.
+	NoBackup   bool   `mapstructure:"no_backup"   toml:"no_backup"   yaml:"no_backup"`
+	BackupDir  string `mapstructure:"backup_dir"  toml:"backup_dir"  yaml:"backup_dir"`
+	BackupKeep int    `mapstructure:"backup_keep" toml:"backup_keep" yaml:"backup_keep"`
+
+	// ProvenanceComments appends a comment to each updated line recording
+	// the AMI it held before, the new AMI's name, and the date of the update.
+	ProvenanceComments bool `mapstructure:"provenance_comments" toml:"provenance_comments" yaml:"provenance_comments"`
+
+	// FileRegions assigns files to regions, so their AMI IDs only receive
+	// replacements from that region unless the file says otherwise.
+	FileRegions []FileRegion `mapstructure:"file_regions" toml:"file_regions" yaml:"file_regions"`
+
+	// Targets are processed in the same run as the top-level files, each
+	// with its own files, accounts, regions, and patterns.
+	Targets []Target `mapstructure:"targets" toml:"targets" yaml:"targets"`
+
+	// GitBranch creates a branch, named by this template, for the files a run
+	// changes; GitCommit commits them; and GitPush pushes the commit to
+	// GitRemote.
+	GitBranch string `mapstructure:"git_branch" toml:"git_branch" yaml:"git_branch"`
+	GitCommit bool   `mapstructure:"git_commit" toml:"git_commit" yaml:"git_commit"`
+	GitPush   bool   `mapstructure:"git_push"   toml:"git_push"   yaml:"git_push"`
+	GitRemote string `mapstructure:"git_remote" toml:"git_remote" yaml:"git_remote"`
+
+	// GitHubPR opens a pull request for the pushed branch into GitHubBase, or
+	// the branch checked out before the run when it is empty.
+	GitHubPR   bool   `mapstructure:"github_pr"   toml:"github_pr"   yaml:"github_pr"`
+	GitHubBase string `mapstructure:"github_base" toml:"github_base" yaml:"github_base"`
+
+	// LogFormat writes logs as text or as JSON lines, and LogLevel drops the
+	// records below it. Without LogLevel, the level follows Verbose, the
+	// number of -v flags, or Quiet, which logs only warnings and errors.
+	LogFormat string `mapstructure:"log_format" toml:"log_format" yaml:"log_format"`
+	LogLevel  string `mapstructure:"log_level"  toml:"log_level"  yaml:"log_level"`
+	Quiet     bool   `mapstructure:"quiet"      toml:"quiet"      yaml:"quiet"`
+
+	// NoProgress turns off the progress bar drawn on terminals, and the
+	// progress lines logged periodically elsewhere.
+	NoProgress bool `mapstructure:"no_progress" toml:"no_progress" yaml:"no_progress"`
+
+	// Strict fails the run, before any file is written, when anything was
+	// logged as a warning or an AMI reference was left unresolved.
+	Strict bool `mapstructure:"strict" toml:"strict" yaml:"strict"`
+
+	// MetricsFile writes the metrics of each run to a file for the node
+	// exporter's textfile collector, and MetricsPushgateway pushes them to a
+	// Prometheus Pushgateway. MetricsLabels are Key=Value labels added to
+	// every metric, which also group the pushed metrics.
+	MetricsFile        string   `mapstructure:"metrics_file"        toml:"metrics_file"        yaml:"metrics_file"`
+	MetricsPushgateway string   `mapstructure:"metrics_pushgateway" toml:"metrics_pushgateway" yaml:"metrics_pushgateway"`
+	MetricsLabels      []string `mapstructure:"metrics_labels"      toml:"metrics_labels"      yaml:"metrics_labels"`
+
+	// AuditLog appends every replacement written to files to this JSON
+	// lines file, along with the user and AWS identity that made it.
+	AuditLog string `mapstructure:"audit_log" toml:"audit_log" yaml:"audit_log"`
+
+	// ReportJUnit writes a JUnit XML report of each run to this file, with a
+	// test case per file that passes when its AMI IDs are up to date.
+	ReportJUnit string `mapstructure:"report_junit" toml:"report_junit" yaml:"report_junit"`
+
+	// SummaryMD writes a Markdown summary of each run to this file, for pull
+	// request descriptions and change tickets.
+	SummaryMD string `mapstructure:"summary_md" toml:"summary_md" yaml:"summary_md"`
+
+	// ReportCSV writes the replacements of each run to this CSV file, one row
+	// per replacement with the AMIs' creation dates and the files affected.
+	ReportCSV string `mapstructure:"report_csv" toml:"report_csv" yaml:"report_csv"`
+}
+
+// HasAccounts reports whether any accounts are configured or will be
+// discovered from the organization.
+func (c *Config) HasAccounts() bool {
+	return len(c.Accounts) > 0 || c.AccountsFromOrg
+}
+
+// TargetConfigs returns the configuration of every target to process: the
+// top-level files, when set, and each of Targets, with their settings in
+// place of the top-level ones.
+func (c *Config) TargetConfigs() []*Config {
+	var configs []*Config
+
+	if len(c.Files) > 0 || len(c.Targets) == 0 {
+		configs = append(configs, c)
+	}
+
+	for _, target := range c.Targets {
+		configs = append(configs, c.ForTarget(target))
+	}
+
+	return configs
+}
+
+// ForTarget returns a copy of the configuration with the files of target
+// and, where set, its accounts, regions, and patterns.
+func (c *Config) ForTarget(target Target) *Config {
+	config := *c
+	config.Files = target.Files
+	config.Targets = nil
+
+	if len(target.Accounts) > 0 {
+		config.Accounts = target.Accounts
+	}
+
+	if len(target.Regions) > 0 {
+		config.Regions = target.Regions
+		config.AllRegions = false
+	}
+
+	if len(target.Patterns) > 0 {
+		config.Patterns = target.Patterns
+	}
+
+	return &config
+}
+
+// AllFiles returns the top-level files and those of every target.
+func (c *Config) AllFiles() []string {
+	files := slices.Clone(c.Files)
+
+	for _, target := range c.Targets {
+		files = append(files, target.Files...)
+	}
+
+	return files
 }
 
-func LoadConfig() (*Config, error) {
+func LoadConfig(ctx context.Context) (*Config, error) {
 	viper.SetDefault("profile", "default")
-	viper.SetDefault("verbose", false)
+	viper.SetDefault("verbose", 0)
+	viper.SetDefault("max_concurrency", DefaultMaxConcurrency)
+	viper.SetDefault("file_workers", DefaultFileWorkers)
+	viper.SetDefault("git_remote", DefaultGitRemote)
 	viper.SetDefault("patterns", []string{
 		"al2023-ami-*",
 		"al2023-ami-kernel-*",
@@ -44,6 +464,274 @@ func LoadConfig() (*Config, error) {
 		"al2023-ami-eks-*",
 	})
 
+	_ = viper.BindEnv("config", "AMI_CONFIG")
+	_ = viper.BindEnv("config_sha256", "AMI_CONFIG_SHA256")
+	_ = viper.BindEnv("env", "AMI_ENV")
+
+	// An explicit configuration file replaces the search paths and must exist
+	if configFile := viper.GetString("config"); configFile != "" {
+		err := readConfigFile(ctx, configFile)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		readSearchedConfig()
+	}
+
+	err := applyIncludes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = selectEnvironment(viper.GetString("env"))
+	if err != nil {
+		return nil, err
+	}
+
+	viper.SetEnvPrefix("AMI")
+	viper.AutomaticEnv()
+
+	_ = viper.BindEnv("accounts", "AMI_ACCOUNTS")
+	_ = viper.BindEnv("file", "AMI_FILE")
+	_ = viper.BindEnv("profile", "AMI_PROFILE")
+	_ = viper.BindEnv("verbose", "AMI_VERBOSE")
+	_ = viper.BindEnv("regions", "AMI_REGIONS")
+	_ = viper.BindEnv("role_arn", "AMI_ROLE_ARN")
+	_ = viper.BindEnv("patterns", "AMI_PATTERNS")
+	_ = viper.BindEnv("pins", "AMI_PINS")
+	_ = viper.BindEnv("max_concurrency", "AMI_MAX_CONCURRENCY")
+	_ = viper.BindEnv("file_workers", "AMI_FILE_WORKERS")
+	_ = viper.BindEnv("retry_max_attempts", "AMI_RETRY_MAX_ATTEMPTS")
+	_ = viper.BindEnv("retry_mode", "AMI_RETRY_MODE")
+	_ = viper.BindEnv("retry_max_backoff", "AMI_RETRY_MAX_BACKOFF")
+	_ = viper.BindEnv("retry_quota", "AMI_RETRY_QUOTA")
+	_ = viper.BindEnv("no_retry_rate_limit", "AMI_NO_RETRY_RATE_LIMIT")
+	_ = viper.BindEnv("aws_timeout", "AMI_AWS_TIMEOUT")
+	_ = viper.BindEnv("sso_profile", "AMI_SSO_PROFILE")
+	_ = viper.BindEnv("sso_login", "AMI_SSO_LOGIN")
+	_ = viper.BindEnv("web_identity_token_file", "AMI_WEB_IDENTITY_TOKEN_FILE")
+	_ = viper.BindEnv("endpoint_url", "AMI_ENDPOINT_URL")
+	_ = viper.BindEnv("policy_file", "AMI_POLICY_FILE")
+	_ = viper.BindEnv("launch_accounts", "AMI_LAUNCH_ACCOUNTS")
+	_ = viper.BindEnv("inspector", "AMI_INSPECTOR")
+	_ = viper.BindEnv("inspector_max_critical", "AMI_INSPECTOR_MAX_CRITICAL")
+	_ = viper.BindEnv("inspector_require_scan", "AMI_INSPECTOR_REQUIRE_SCAN")
+	_ = viper.BindEnv("stale_after", "AMI_STALE_AFTER")
+	_ = viper.BindEnv("dynamic_references", "AMI_DYNAMIC_REFERENCES")
+	_ = viper.BindEnv("cdk_context", "AMI_CDK_CONTEXT")
+	_ = viper.BindEnv("image_builder", "AMI_IMAGE_BUILDER")
+	_ = viper.BindEnv("accounts_from_org", "AMI_ACCOUNTS_FROM_ORG")
+	_ = viper.BindEnv("all_regions", "AMI_ALL_REGIONS")
+	_ = viper.BindEnv("yaml_keys", "AMI_YAML_KEYS")
+	_ = viper.BindEnv("hcl", "AMI_HCL")
+	_ = viper.BindEnv("hcl_attributes", "AMI_HCL_ATTRIBUTES")
+	_ = viper.BindEnv("ansible", "AMI_ANSIBLE")
+	_ = viper.BindEnv("gitignore", "AMI_GITIGNORE")
+	_ = viper.BindEnv("max_depth", "AMI_MAX_DEPTH")
+	_ = viper.BindEnv("follow_symlinks", "AMI_FOLLOW_SYMLINKS")
+	_ = viper.BindEnv("no_backup", "AMI_NO_BACKUP")
+	_ = viper.BindEnv("backup_dir", "AMI_BACKUP_DIR")
+	_ = viper.BindEnv("backup_keep", "AMI_BACKUP_KEEP")
+	_ = viper.BindEnv("provenance_comments", "AMI_PROVENANCE_COMMENTS")
+	_ = viper.BindEnv("git_branch", "AMI_GIT_BRANCH")
+	_ = viper.BindEnv("git_commit", "AMI_GIT_COMMIT")
+	_ = viper.BindEnv("git_push", "AMI_GIT_PUSH")
+	_ = viper.BindEnv("git_remote", "AMI_GIT_REMOTE")
+	_ = viper.BindEnv("github_pr", "AMI_GITHUB_PR")
+	_ = viper.BindEnv("github_base", "AMI_GITHUB_BASE")
+	_ = viper.BindEnv("log_format", "AMI_LOG_FORMAT")
+	_ = viper.BindEnv("log_level", "AMI_LOG_LEVEL")
+	_ = viper.BindEnv("quiet", "AMI_QUIET")
+	_ = viper.BindEnv("no_progress", "AMI_NO_PROGRESS")
+	_ = viper.BindEnv("strict", "AMI_STRICT")
+	_ = viper.BindEnv("metrics_file", "AMI_METRICS_FILE")
+	_ = viper.BindEnv("metrics_pushgateway", "AMI_METRICS_PUSHGATEWAY")
+	_ = viper.BindEnv("metrics_labels", "AMI_METRICS_LABELS")
+	_ = viper.BindEnv("audit_log", "AMI_AUDIT_LOG")
+	_ = viper.BindEnv("report_junit", "AMI_REPORT_JUNIT")
+	_ = viper.BindEnv("summary_md", "AMI_SUMMARY_MD")
+	_ = viper.BindEnv("report_csv", "AMI_REPORT_CSV")
+	_ = viper.BindEnv("org_units", "AMI_ORG_UNITS")
+	_ = viper.BindEnv("org_account_tags", "AMI_ORG_ACCOUNT_TAGS")
+	_ = viper.BindEnv("role_arn_template", "AMI_ROLE_ARN_TEMPLATE")
+	_ = viper.BindEnv("mfa_serial", "AMI_MFA_SERIAL")
+	_ = viper.BindEnv("mfa_token", "AMI_MFA_TOKEN")
+	_ = viper.BindEnv("mfa_token_command", "AMI_MFA_TOKEN_COMMAND")
+	_ = viper.BindEnv("duration_seconds", "AMI_DURATION_SECONDS")
+	_ = viper.BindEnv("session_tags", "AMI_SESSION_TAGS")
+	_ = viper.BindEnv("transitive_tag_keys", "AMI_TRANSITIVE_TAG_KEYS")
+	_ = viper.BindEnv("source_identity", "AMI_SOURCE_IDENTITY")
+	_ = viper.BindEnv("architecture", "AMI_ARCHITECTURE")
+	_ = viper.BindEnv("virtualization_type", "AMI_VIRTUALIZATION_TYPE")
+	_ = viper.BindEnv("root_device_type", "AMI_ROOT_DEVICE_TYPE")
+	_ = viper.BindEnv("version_regex", "AMI_VERSION_REGEX")
+	_ = viper.BindEnv("exclude_patterns", "AMI_EXCLUDE_PATTERNS")
+	_ = viper.BindEnv("min_age", "AMI_MIN_AGE")
+
+	normalizeVerbose()
+
+	var config Config
+
+	err = viper.Unmarshal(&config)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling config: %w", err)
+	}
+
+	config.expandPatternAliases()
+
+	return &config, nil
+}
+
+// expandPatternAliases replaces the names of pattern aliases with their
+// patterns. Names are matched regardless of case, like configuration keys.
+func (c *Config) expandPatternAliases() {
+	if len(c.PatternAliases) == 0 {
+		return
+	}
+
+	c.Patterns = c.ExpandPatterns(c.Patterns)
+
+	for i := range c.Targets {
+		c.Targets[i].Patterns = c.ExpandPatterns(c.Targets[i].Patterns)
+	}
+
+	if len(c.PatternFilters) > 0 {
+		filters := make(map[string]PatternFilter, len(c.PatternFilters))
+		for pattern, filter := range c.PatternFilters {
+			filters[c.ExpandPattern(pattern)] = filter
+		}
+
+		c.PatternFilters = filters
+	}
+
+	if len(c.PatternOwners) > 0 {
+		owners := make(map[string][]string, len(c.PatternOwners))
+		for pattern, accounts := range c.PatternOwners {
+			owners[c.ExpandPattern(pattern)] = accounts
+		}
+
+		c.PatternOwners = owners
+	}
+}
+
+// OwnersOf returns the accounts a pattern is searched in, and false when
+// it is searched in every account. Patterns match regardless of case, since
+// configuration map keys are lowercased.
+func (c *Config) OwnersOf(pattern string) ([]string, bool) {
+	for key, owners := range c.PatternOwners {
+		if strings.EqualFold(key, pattern) {
+			return owners, true
+		}
+	}
+
+	return nil, false
+}
+
+// SearchedAccounts returns the configured accounts and the owners that
+// pattern_owners assigns any of patterns to.
+func (c *Config) SearchedAccounts(patterns []string) []string {
+	accounts := slices.Clone(c.Accounts)
+
+	for _, pattern := range patterns {
+		owners, _ := c.OwnersOf(pattern)
+		for _, owner := range owners {
+			if !slices.Contains(accounts, owner) {
+				accounts = append(accounts, owner)
+			}
+		}
+	}
+
+	return accounts
+}
+
+// PatternsFor returns the patterns searched in an account: those assigned to
+// it by pattern_owners and, for configured accounts, those assigned to no
+// owners at all.
+func (c *Config) PatternsFor(accountID string, patterns []string) []string {
+	configured := slices.Contains(c.Accounts, accountID)
+
+	var searched []string
+
+	for _, pattern := range patterns {
+		owners, ok := c.OwnersOf(pattern)
+		if ok && slices.Contains(owners, accountID) || !ok && configured {
+			searched = append(searched, pattern)
+		}
+	}
+
+	return searched
+}
+
+// ExpandPatterns returns patterns with the names of pattern aliases replaced
+// by their patterns.
+func (c *Config) ExpandPatterns(patterns []string) []string {
+	if len(patterns) == 0 {
+		return patterns
+	}
+
+	expanded := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		expanded = append(expanded, c.ExpandPattern(pattern))
+	}
+
+	return expanded
+}
+
+// ExpandPattern returns the pattern named by an alias, or pattern itself.
+func (c *Config) ExpandPattern(pattern string) string {
+	for name, aliased := range c.PatternAliases {
+		if strings.EqualFold(name, pattern) {
+			return aliased
+		}
+	}
+
+	return pattern
+}
+
+// selectEnvironment applies the settings of the named environment, from the
+// environments of the configuration file, over its top-level settings. Flags
+// and environment variables still take precedence.
+func selectEnvironment(name string) error {
+	if name == "" {
+		return nil
+	}
+
+	key := "environments." + name
+	if !viper.IsSet(key) {
+		return fmt.Errorf("%w: %q is not defined under environments in %s", ErrUnknownEnvironment, name,
+			cmp.Or(viper.ConfigFileUsed(), "the configuration file"))
+	}
+
+	err := viper.MergeConfigMap(viper.GetStringMap(key))
+	if err != nil {
+		return fmt.Errorf("failed to apply environment %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// readConfigFile reads the configuration file at source, a path, S3 object,
+// or HTTPS URL, in the format named by its extension, or YAML without one.
+func readConfigFile(ctx context.Context, source string) error {
+	path, err := localConfigFile(ctx, source, viper.GetString("config_sha256"))
+	if err != nil {
+		return err
+	}
+
+	viper.SetConfigFile(path)
+	viper.SetConfigType(cmp.Or(strings.TrimPrefix(filepath.Ext(path), "."), "yaml"))
+
+	err = viper.ReadInConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", source, err)
+	}
+
+	return nil
+}
+
+// readSearchedConfig reads the first ami.yaml, ami.yml, or ami.toml found in
+// the search paths, if any.
+func readSearchedConfig() {
 	viper.SetConfigName("ami")
 	viper.AddConfigPath(".")
 	viper.AddConfigPath("$HOME/.ami-util")
@@ -64,28 +752,62 @@ func LoadConfig() (*Config, error) {
 			continue
 		}
 	}
+}
 
-	viper.SetEnvPrefix("AMI")
-	viper.AutomaticEnv()
+// normalizeVerbose turns a true or false verbose setting, from before it
+// counted -v flags, into one or none.
+func normalizeVerbose() {
+	verbose, err := strconv.ParseBool(viper.GetString("verbose"))
+	if err != nil {
+		return
+	}
 
-	_ = viper.BindEnv("accounts", "AMI_ACCOUNTS")
-	_ = viper.BindEnv("file", "AMI_FILE")
-	_ = viper.BindEnv("profile", "AMI_PROFILE")
-	_ = viper.BindEnv("verbose", "AMI_VERBOSE")
-	_ = viper.BindEnv("regions", "AMI_REGIONS")
-	_ = viper.BindEnv("role_arn", "AMI_ROLE_ARN")
-	_ = viper.BindEnv("patterns", "AMI_PATTERNS")
+	if verbose {
+		viper.Set("verbose", 1)
+	} else {
+		viper.Set("verbose", 0)
+	}
+}
+
+// LoadConfigFile loads a single configuration file on its own, without search
+// paths, environment variables, flags, or defaults.
+func LoadConfigFile(ctx context.Context, filename string) (*Config, error) {
+	settings, err := resolveConfigFile(ctx, filename, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := viper.New()
+
+	err = parser.MergeConfigMap(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", filename, err)
+	}
 
 	var config Config
 
-	err := viper.Unmarshal(&config)
+	err = parser.Unmarshal(&config)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
 
+	config.expandPatternAliases()
+
 	return &config, nil
 }
 
+func ParseConfigFile(filename string) error {
+	parser := viper.New()
+	parser.SetConfigFile(filename)
+
+	err := parser.ReadInConfig()
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", filename, err)
+	}
+
+	return nil
+}
+
 func SaveConfig(config *Config, filename string) error {
 	dir := filepath.Dir(filename)
 
@@ -97,12 +819,17 @@ func SaveConfig(config *Config, filename string) error {
 	viper.SetConfigFile(filename)
 
 	viper.Set("accounts", config.Accounts)
-	viper.Set("file", config.File)
+	viper.Set("file", config.Files)
 	viper.Set("profile", config.Profile)
 	viper.Set("verbose", config.Verbose)
 	viper.Set("regions", config.Regions)
 	viper.Set("role_arn", config.RoleARN)
 	viper.Set("patterns", config.Patterns)
+	viper.Set("pins", config.Pins)
+
+	if len(config.PatternOwners) > 0 {
+		viper.Set("pattern_owners", config.PatternOwners)
+	}
 
 	err = viper.WriteConfigAs(filename)
 	if err != nil {
@@ -113,13 +840,580 @@ func SaveConfig(config *Config, filename string) error {
 }
 
 func ValidateConfig(config *Config) error {
-	if len(config.Accounts) == 0 {
-		return ErrNoAccountID
+	return errors.Join(Diagnose(config)...)
+}
+
+// Diagnose returns every problem found in the configuration, rather than
+// stopping at the first one.
+func Diagnose(config *Config) []error {
+	return diagnose(config, true)
+}
+
+// DiagnoseWithoutFiles returns the problems Diagnose finds, other than the
+// lack of files, for the commands and callers that do not update files.
+func DiagnoseWithoutFiles(config *Config) []error {
+	return diagnose(config, false)
+}
+
+func diagnose(config *Config, requireFiles bool) []error {
+	var problems []error
+
+	// Without top-level files, the targets name the files and may name the
+	// accounts too
+	if !config.HasAccounts() && (len(config.Targets) == 0 || len(config.Files) > 0) {
+		problems = append(problems, ErrNoAccountID)
+	}
+
+	if requireFiles && len(config.Files) == 0 && len(config.Targets) == 0 {
+		problems = append(problems, ErrNoFilePath)
+	}
+
+	for i, account := range config.Accounts {
+		if !accountIDRegex.MatchString(account) && !aws.IsOwnerAlias(account) {
+			problems = append(problems, fmt.Errorf("%w: accounts[%d] %q must be a 12-digit account ID or one of %s",
+				ErrInvalidAccountID, i, account, strings.Join(aws.OwnerAliases(), ", ")))
+		}
+	}
+
+	for i, account := range config.LaunchAccounts {
+		if !accountIDRegex.MatchString(account) {
+			problems = append(problems, fmt.Errorf("%w: launch_accounts[%d] %q must be a 12-digit account ID",
+				ErrInvalidAccountID, i, account))
+		}
+	}
+
+	if config.StaleAfter < 0 {
+		problems = append(problems, fmt.Errorf("%w: stale_after %s must not be negative",
+			ErrInvalidStaleAfter, config.StaleAfter))
+	}
+
+	if config.InspectorMaxCritical < 0 {
+		problems = append(problems, fmt.Errorf("%w: inspector_max_critical %d must not be negative",
+			ErrInvalidInspector, config.InspectorMaxCritical))
+	}
+
+	problems = append(problems, diagnoseOrganization(config)...)
+
+	if config.AllRegions && len(config.Regions) > 0 {
+		problems = append(problems, fmt.Errorf("%w: regions and all_regions cannot both be set", ErrInvalidRegion))
+	}
+
+	for i, region := range config.Regions {
+		if !regionRegex.MatchString(region) {
+			problems = append(problems, fmt.Errorf("%w: regions[%d] %q is not a region code such as us-east-1",
+				ErrInvalidRegion, i, region))
+		}
+	}
+
+	if config.RoleARN != "" && !roleARNRegex.MatchString(config.RoleARN) {
+		problems = append(problems, fmt.Errorf("%w: %q must look like arn:aws:iam::123456789012:role/Name",
+			ErrInvalidRoleARN, config.RoleARN))
+	}
+
+	problems = append(problems, diagnoseAccountRoles(config.AccountRoles)...)
+	problems = append(problems, diagnoseAccountRegions(config.AccountRegions)...)
+	problems = append(problems, diagnoseFilters(config)...)
+
+	if config.RoleARNTemplate != "" {
+		problems = append(problems, diagnoseRoleARNTemplate(config.RoleARNTemplate)...)
+	}
+
+	if config.DurationSeconds != 0 &&
+		(config.DurationSeconds < MinDurationSeconds || config.DurationSeconds > MaxDurationSeconds) {
+		problems = append(problems, fmt.Errorf("%w: duration_seconds %d must be between %d and %d",
+			ErrInvalidDuration, config.DurationSeconds, MinDurationSeconds, MaxDurationSeconds))
+	}
+
+	problems = append(problems, diagnoseSessionTags(config)...)
+
+	for i, keyPath := range config.YAMLKeys {
+		if slices.Contains(strings.Split(keyPath, "."), "") {
+			problems = append(problems, fmt.Errorf("%w: yaml_keys[%d] %q must be dot-separated keys such as spec.amiID",
+				ErrInvalidPattern, i, keyPath))
+		}
+	}
+
+	if config.WebIdentityTokenFile != "" && config.RoleARN == "" && config.RoleARNTemplate == "" &&
+		os.Getenv("AWS_ROLE_ARN") == "" {
+		problems = append(problems, fmt.Errorf("%w: web_identity_token_file requires role_arn or AWS_ROLE_ARN",
+			ErrInvalidWebIdentity))
+	}
+
+	if config.EndpointURL != "" {
+		endpoint, err := url.Parse(config.EndpointURL)
+		if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+			problems = append(problems, fmt.Errorf("%w: endpoint_url %q must be an absolute URL",
+				ErrInvalidEndpointURL, config.EndpointURL))
+		}
+	}
+
+	if config.DynamicReferences != "" && config.DynamicReferences != DynamicReferencesReport &&
+		config.DynamicReferences != DynamicReferencesRewrite {
+		problems = append(problems, fmt.Errorf("%w: dynamic_references %q must be %s or %s", ErrInvalidDynamicRefs,
+			config.DynamicReferences, DynamicReferencesReport, DynamicReferencesRewrite))
+	}
+
+	if config.CDKContext != "" && config.CDKContext != CDKContextRefresh && config.CDKContext != CDKContextDelete {
+		problems = append(problems, fmt.Errorf("%w: cdk_context %q must be %s or %s", ErrInvalidCDKContext,
+			config.CDKContext, CDKContextRefresh, CDKContextDelete))
+	}
+
+	problems = append(problems, diagnosePublishParameters(config.PublishParameters)...)
+	problems = append(problems, diagnoseFileRegions(config.FileRegions)...)
+	problems = append(problems, diagnoseTargets(config)...)
+
+	if config.MaxConcurrency < 0 {
+		problems = append(problems, fmt.Errorf("%w: max_concurrency must not be negative", ErrInvalidConcurrency))
+	}
+
+	if config.FileWorkers < 0 {
+		problems = append(problems, fmt.Errorf("%w: file_workers must not be negative", ErrInvalidConcurrency))
 	}
 
-	if config.File == "" {
-		return ErrNoFilePath
+	if config.MaxDepth < 0 {
+		problems = append(problems, fmt.Errorf("%w: max_depth must not be negative", ErrInvalidMaxDepth))
+	}
+
+	if config.NoBackup && config.BackupDir != "" {
+		problems = append(problems, fmt.Errorf("%w: no_backup and backup_dir cannot both be set", ErrInvalidBackup))
+	}
+
+	if config.BackupKeep < 0 {
+		problems = append(problems, fmt.Errorf("%w: backup_keep must not be negative", ErrInvalidBackup))
+	}
+
+	if config.GitPush && !config.GitCommit {
+		problems = append(problems, fmt.Errorf("%w: git_push requires git_commit", ErrInvalidGit))
+	}
+
+	if config.GitHubPR && (!config.GitPush || config.GitBranch == "") {
+		problems = append(problems, fmt.Errorf("%w: github_pr requires git_branch and git_push", ErrInvalidGit))
+	}
+
+	problems = append(problems, diagnoseLogging(config)...)
+	problems = append(problems, diagnoseMetrics(config)...)
+	problems = append(problems, diagnoseRetry(config)...)
+
+	for i, pattern := range config.Patterns {
+		problem := diagnosePattern(pattern)
+		if problem != "" {
+			problems = append(problems, fmt.Errorf("%w: patterns[%d] %q %s", ErrInvalidPattern, i, pattern, problem))
+		}
+	}
+
+	for _, pattern := range slices.Sorted(maps.Keys(config.PatternOwners)) {
+		if len(config.PatternOwners[pattern]) == 0 {
+			problems = append(problems, fmt.Errorf("%w: pattern_owners[%s] must list at least one account",
+				ErrInvalidAccountID, pattern))
+		}
+
+		for i, owner := range config.PatternOwners[pattern] {
+			if !accountIDRegex.MatchString(owner) && !aws.IsOwnerAlias(owner) {
+				problems = append(problems, fmt.Errorf("%w: pattern_owners[%s][%d] %q must be a 12-digit account ID or one of %s",
+					ErrInvalidAccountID, pattern, i, owner, strings.Join(aws.OwnerAliases(), ", ")))
+			}
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(config.PatternAliases)) {
+		problem := diagnosePattern(config.PatternAliases[name])
+		if problem != "" {
+			problems = append(problems, fmt.Errorf("%w: pattern_aliases[%s] %q %s",
+				ErrInvalidPattern, name, config.PatternAliases[name], problem))
+		}
+	}
+
+	return problems
+}
+
+func diagnoseAccountRegions(accountRegions map[string][]string) []error {
+	var problems []error
+
+	for _, accountID := range slices.Sorted(maps.Keys(accountRegions)) {
+		if !accountIDRegex.MatchString(accountID) && !aws.IsOwnerAlias(accountID) {
+			problems = append(problems, fmt.Errorf("%w: account_regions key %q must be a 12-digit account ID or one of %s",
+				ErrInvalidAccountID, accountID, strings.Join(aws.OwnerAliases(), ", ")))
+		}
+
+		if len(accountRegions[accountID]) == 0 {
+			problems = append(problems, fmt.Errorf("%w: account_regions[%s] must list at least one region",
+				ErrInvalidRegion, accountID))
+		}
+
+		for i, region := range accountRegions[accountID] {
+			if !regionRegex.MatchString(region) {
+				problems = append(problems, fmt.Errorf("%w: account_regions[%s][%d] %q is not a region code such as us-east-1",
+					ErrInvalidRegion, accountID, i, region))
+			}
+		}
+	}
+
+	return problems
+}
+
+func diagnoseAccountRoles(roles map[string]AccountRole) []error {
+	accountIDs := make([]string, 0, len(roles))
+	for accountID := range roles {
+		accountIDs = append(accountIDs, accountID)
+	}
+
+	sort.Strings(accountIDs)
+
+	var problems []error
+
+	for _, accountID := range accountIDs {
+		if !accountIDRegex.MatchString(accountID) {
+			problems = append(problems, fmt.Errorf("%w: account_roles key %q must be a 12-digit account ID",
+				ErrInvalidAccountID, accountID))
+		}
+
+		if !roleARNRegex.MatchString(roles[accountID].RoleARN) {
+			problems = append(problems, fmt.Errorf("%w: account_roles[%s].role_arn %q must look like "+
+				"arn:aws:iam::123456789012:role/Name", ErrInvalidRoleARN, accountID, roles[accountID].RoleARN))
+		}
+	}
+
+	return problems
+}
+
+func diagnoseFilters(config *Config) []error {
+	problems := diagnosePatternFilter("", config.PatternFilter)
+
+	patterns := make([]string, 0, len(config.PatternFilters))
+	for pattern := range config.PatternFilters {
+		patterns = append(patterns, pattern)
+	}
+
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		problems = append(problems,
+			diagnosePatternFilter("pattern_filters["+pattern+"].", config.PatternFilters[pattern])...)
+	}
+
+	return problems
+}
+
+// diagnosePatternFilter checks a filter's fields, naming each one with prefix.
+func diagnosePatternFilter(prefix string, filter PatternFilter) []error {
+	var problems []error
+
+	for _, field := range []struct {
+		name    string
+		value   string
+		allowed []string
+	}{
+		{"architecture", filter.Architecture, architectures},
+		{"virtualization_type", filter.VirtualizationType, virtualizationTypes},
+		{"root_device_type", filter.RootDeviceType, rootDeviceTypes},
+	} {
+		if field.value != "" && !slices.Contains(field.allowed, field.value) {
+			problems = append(problems, fmt.Errorf("%w: %s%s %q must be one of %s",
+				ErrInvalidFilter, prefix, field.name, field.value, strings.Join(field.allowed, ", ")))
+		}
+	}
+
+	if filter.VersionRegex != "" {
+		_, err := regexp.Compile(filter.VersionRegex)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%w: %sversion_regex %q is not a valid regex: %w",
+				ErrInvalidFilter, prefix, filter.VersionRegex, err))
+		}
+	}
+
+	if filter.MinAge < 0 {
+		problems = append(problems, fmt.Errorf("%w: %smin_age must not be negative", ErrInvalidFilter, prefix))
+	}
+
+	for i, pattern := range filter.ExcludePatterns {
+		_, err := regexp.Compile(pattern)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%w: %sexclude_patterns[%d] %q is not a valid regex: %w",
+				ErrInvalidFilter, prefix, i, pattern, err))
+		}
+	}
+
+	for i, tag := range filter.Tags {
+		key, _, found := strings.Cut(tag, "=")
+		if !found || key == "" {
+			problems = append(problems, fmt.Errorf("%w: %stags[%d] %q must look like Key=Value",
+				ErrInvalidFilter, prefix, i, tag))
+		}
+	}
+
+	return problems
+}
+
+func diagnosePublishParameters(parameters []PublishParameter) []error {
+	var problems []error
+
+	for i, parameter := range parameters {
+		if parameter.Pattern == "" {
+			problems = append(problems, fmt.Errorf("%w: publish_parameters[%d].pattern is required", ErrInvalidPublish, i))
+		}
+
+		// Parameter names beginning with aws or ssm are reserved by AWS.
+		name := strings.ToLower(strings.TrimPrefix(parameter.Parameter, "/"))
+
+		switch {
+		case parameter.Parameter == "":
+			problems = append(problems, fmt.Errorf("%w: publish_parameters[%d].parameter is required",
+				ErrInvalidPublish, i))
+		case strings.HasPrefix(name, "aws") || strings.HasPrefix(name, "ssm"):
+			problems = append(problems, fmt.Errorf("%w: publish_parameters[%d].parameter %q uses a reserved prefix",
+				ErrInvalidPublish, i, parameter.Parameter))
+		}
+	}
+
+	return problems
+}
+
+func diagnoseFileRegions(fileRegions []FileRegion) []error {
+	var problems []error
+
+	for i, fileRegion := range fileRegions {
+		_, err := filepath.Match(fileRegion.Path, "")
+
+		switch {
+		case fileRegion.Path == "":
+			problems = append(problems, fmt.Errorf("%w: file_regions[%d].path is required", ErrInvalidRegion, i))
+		case err != nil:
+			problems = append(problems, fmt.Errorf("%w: file_regions[%d].path %q is not a valid pattern",
+				ErrInvalidRegion, i, fileRegion.Path))
+		}
+
+		if !regionRegex.MatchString(fileRegion.Region) {
+			problems = append(problems, fmt.Errorf("%w: file_regions[%d].region %q is not a region code such as us-east-1",
+				ErrInvalidRegion, i, fileRegion.Region))
+		}
+	}
+
+	return problems
+}
+
+func diagnoseTargets(config *Config) []error {
+	var problems []error
+
+	for i, target := range config.Targets {
+		if len(target.Files) == 0 {
+			problems = append(problems, fmt.Errorf("%w: targets[%d].file is required", ErrNoFilePath, i))
+		}
+
+		if len(target.Accounts) == 0 && !config.HasAccounts() {
+			problems = append(problems, fmt.Errorf("%w: targets[%d] has no accounts and none are set at the top level",
+				ErrNoAccountID, i))
+		}
+
+		for j, account := range target.Accounts {
+			if !accountIDRegex.MatchString(account) && !aws.IsOwnerAlias(account) {
+				problems = append(problems, fmt.Errorf("%w: targets[%d].accounts[%d] %q must be a 12-digit account ID or one of %s",
+					ErrInvalidAccountID, i, j, account, strings.Join(aws.OwnerAliases(), ", ")))
+			}
+		}
+
+		for j, pattern := range target.Patterns {
+			problem := diagnosePattern(pattern)
+			if problem != "" {
+				problems = append(problems, fmt.Errorf("%w: targets[%d].patterns[%d] %q %s",
+					ErrInvalidPattern, i, j, pattern, problem))
+			}
+		}
+
+		for j, region := range target.Regions {
+			if !regionRegex.MatchString(region) {
+				problems = append(problems, fmt.Errorf("%w: targets[%d].regions[%d] %q is not a region code such as us-east-1",
+					ErrInvalidRegion, i, j, region))
+			}
+		}
+	}
+
+	return problems
+}
+
+func diagnoseRoleARNTemplate(template string) []error {
+	if !strings.Contains(template, aws.AccountIDPlaceholder) {
+		return []error{fmt.Errorf("%w: role_arn_template %q must contain %s",
+			ErrInvalidRoleARN, template, aws.AccountIDPlaceholder)}
+	}
+
+	if !roleARNRegex.MatchString(strings.ReplaceAll(template, aws.AccountIDPlaceholder, "123456789012")) {
+		return []error{fmt.Errorf("%w: role_arn_template %q must look like arn:aws:iam::%s:role/Name",
+			ErrInvalidRoleARN, template, aws.AccountIDPlaceholder)}
 	}
 
 	return nil
 }
+
+func diagnoseLogging(config *Config) []error {
+	var problems []error
+
+	if config.LogFormat != "" && config.LogFormat != logging.FormatText && config.LogFormat != logging.FormatJSON {
+		problems = append(problems, fmt.Errorf("%w: log_format %q must be %s or %s", ErrInvalidLogging,
+			config.LogFormat, logging.FormatText, logging.FormatJSON))
+	}
+
+	if config.LogLevel != "" {
+		_, err := logging.ParseLevel(config.LogLevel)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%w: log_level %q must be trace, debug, info, warn, or error",
+				ErrInvalidLogging, config.LogLevel))
+		}
+	}
+
+	if config.Quiet && config.Verbose > 0 {
+		problems = append(problems, fmt.Errorf("%w: quiet and verbose cannot both be set", ErrInvalidLogging))
+	}
+
+	return problems
+}
+
+// reservedLabels are the labels that metrics_labels cannot set: the job of
+// pushed metrics, and the labels of the AWS API call metrics.
+var reservedLabels = []string{"job", "service", "operation"}
+
+func diagnoseMetrics(config *Config) []error {
+	var problems []error
+
+	if config.MetricsFile != "" && !strings.HasSuffix(config.MetricsFile, metrics.FileSuffix) {
+		problems = append(problems, fmt.Errorf("%w: metrics_file %q must end in %s for the textfile collector",
+			ErrInvalidMetrics, config.MetricsFile, metrics.FileSuffix))
+	}
+
+	if config.MetricsPushgateway != "" {
+		parsed, err := url.Parse(config.MetricsPushgateway)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			problems = append(problems, fmt.Errorf("%w: metrics_pushgateway %q must be an http or https URL",
+				ErrInvalidMetrics, config.MetricsPushgateway))
+		}
+	}
+
+	for i, label := range config.MetricsLabels {
+		name, _, found := strings.Cut(label, "=")
+
+		switch {
+		case !found || !labelNameRegex.MatchString(name) || strings.HasPrefix(name, "__"):
+			problems = append(problems, fmt.Errorf("%w: metrics_labels[%d] %q must look like name=value",
+				ErrInvalidMetrics, i, label))
+		case slices.Contains(reservedLabels, name):
+			problems = append(problems, fmt.Errorf("%w: metrics_labels[%d] %q cannot set the reserved label %s",
+				ErrInvalidMetrics, i, label, name))
+		}
+	}
+
+	return problems
+}
+
+func diagnoseRetry(config *Config) []error {
+	var problems []error
+
+	if config.RetryMaxAttempts < 0 {
+		problems = append(problems, fmt.Errorf("%w: retry_max_attempts must not be negative", ErrInvalidRetry))
+	}
+
+	if config.RetryMode != "" && config.RetryMode != "standard" && config.RetryMode != "adaptive" {
+		problems = append(problems, fmt.Errorf("%w: retry_mode %q must be standard or adaptive",
+			ErrInvalidRetry, config.RetryMode))
+	}
+
+	if config.RetryMaxBackoff < 0 {
+		problems = append(problems, fmt.Errorf("%w: retry_max_backoff must not be negative", ErrInvalidRetry))
+	}
+
+	if config.RetryQuota < 0 {
+		problems = append(problems, fmt.Errorf("%w: retry_quota must not be negative", ErrInvalidRetry))
+	}
+
+	if config.AWSTimeout < 0 {
+		problems = append(problems, fmt.Errorf("%w: aws_timeout must not be negative", ErrInvalidRetry))
+	}
+
+	return problems
+}
+
+func diagnosePattern(pattern string) string {
+	switch {
+	case strings.TrimSpace(pattern) == "":
+		return "is empty"
+	case strings.TrimSpace(pattern) != pattern:
+		return "has leading or trailing whitespace"
+	case strings.Contains(pattern, ","):
+		return "contains a comma; list patterns separately"
+	case strings.HasPrefix(pattern, "ssm:") && !strings.HasPrefix(pattern, "ssm:/"):
+		return "must name an SSM parameter path such as ssm:/aws/service/..."
+	case pattern == "marketplace:":
+		return "must name a Marketplace product code such as marketplace:prod-abc123"
+	case strings.HasPrefix(pattern, "exec:") && strings.TrimSpace(strings.TrimPrefix(pattern, "exec:")) == "":
+		return "must name a resolver program such as exec:./bin/my-resolver"
+	case strings.HasPrefix(pattern, "ami-") && !strings.ContainsAny(pattern, "*?") && !amiIDRegex.MatchString(pattern):
+		return "looks like an AMI ID but is not a valid one"
+	case strings.Trim(pattern, "*?") == "":
+		return "matches every image"
+	}
+
+	return ""
+}
+
+func diagnoseOrganization(config *Config) []error {
+	var problems []error
+
+	if !config.AccountsFromOrg && (len(config.OrgUnits) > 0 || len(config.OrgAccountTags) > 0) {
+		problems = append(problems, fmt.Errorf("%w: org_units and org_account_tags require accounts_from_org",
+			ErrInvalidOrg))
+	}
+
+	for i, unit := range config.OrgUnits {
+		if !orgUnitRegex.MatchString(unit) {
+			problems = append(problems, fmt.Errorf("%w: org_units[%d] %q must be an OU ID (ou-...) or root ID (r-...)",
+				ErrInvalidOrg, i, unit))
+		}
+	}
+
+	for i, tag := range config.OrgAccountTags {
+		key, _, found := strings.Cut(tag, "=")
+		if !found || key == "" {
+			problems = append(problems, fmt.Errorf("%w: org_account_tags[%d] %q must look like Key=Value",
+				ErrInvalidOrg, i, tag))
+		}
+	}
+
+	return problems
+}
+
+// maxSessionTags is the number of session tags STS accepts on one call.
+const maxSessionTags = 50
+
+func diagnoseSessionTags(config *Config) []error {
+	var problems []error
+
+	if len(config.SessionTags) > maxSessionTags {
+		problems = append(problems, fmt.Errorf("%w: at most %d session_tags may be set",
+			ErrInvalidSessionTag, maxSessionTags))
+	}
+
+	keys := make([]string, 0, len(config.SessionTags))
+
+	for i, tag := range config.SessionTags {
+		key, _, found := strings.Cut(tag, "=")
+		if !found || key == "" {
+			problems = append(problems, fmt.Errorf("%w: session_tags[%d] %q must look like Key=Value",
+				ErrInvalidSessionTag, i, tag))
+		}
+
+		keys = append(keys, key)
+	}
+
+	for i, key := range config.TransitiveTagKeys {
+		if !slices.Contains(keys, key) {
+			problems = append(problems, fmt.Errorf("%w: transitive_tag_keys[%d] %q is not a key in session_tags",
+				ErrInvalidSessionTag, i, key))
+		}
+	}
+
+	if config.SourceIdentity != "" &&
+		(!sourceIDRegex.MatchString(config.SourceIdentity) || strings.HasPrefix(config.SourceIdentity, "aws:")) {
+		problems = append(problems, fmt.Errorf("%w: source_identity %q must be 2 to 64 letters, digits, "+
+			"or the characters +=,.@_- and must not start with aws:", ErrInvalidSessionTag, config.SourceIdentity))
+	}
+
+	return problems
+}
@@ -0,0 +1,203 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package config
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/schnauzersoft/ami-util/internal/remote"
+
+	"github.com/spf13/viper"
+)
+
+// includeKey lists the configuration files a configuration file includes.
+const includeKey = "include"
+
+// include is a configuration file included by another, with the SHA-256
+// checksum it must have if it is remote, if set.
+type include struct {
+	Path   string
+	SHA256 string
+}
+
+// applyIncludes merges the files included by the configuration file read
+// into viper beneath its own settings.
+func applyIncludes(ctx context.Context) error {
+	if viper.ConfigFileUsed() == "" || viper.Get(includeKey) == nil {
+		return nil
+	}
+
+	// Includes of a remote configuration file are relative to its URL rather
+	// than to its cached copy
+	source := viper.ConfigFileUsed()
+	if configFile := viper.GetString("config"); configFile != "" {
+		source = configFile
+	}
+
+	settings, err := resolveConfigFile(ctx, source, viper.GetString("config_sha256"), nil)
+	if err != nil {
+		return err
+	}
+
+	// The file's own settings are already read and win over its includes
+	err = viper.MergeConfigMap(settings)
+	if err != nil {
+		return fmt.Errorf("failed to merge included config files: %w", err)
+	}
+
+	return nil
+}
+
+// resolveConfigFile returns the settings of the configuration file at source,
+// a path or a remote URL, merged over those of the files it includes.
+// Included paths are relative to the including file. Includes are merged in
+// order, so later files override earlier ones: maps are merged key by key, and
+// lists and other values are replaced. including holds the files that include
+// source, to detect cycles.
+func resolveConfigFile(ctx context.Context, source, checksum string, including []string) (map[string]any, error) {
+	location := source
+	if !remote.IsRemote(source) {
+		absolute, err := filepath.Abs(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve config file %s: %w", source, err)
+		}
+
+		location = absolute
+	}
+
+	if slices.Contains(including, location) {
+		return nil, fmt.Errorf("%w: %s", ErrIncludeCycle, strings.Join(append(including, location), " -> "))
+	}
+
+	path, err := localConfigFile(ctx, location, checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := viper.New()
+	parser.SetConfigFile(path)
+	parser.SetConfigType(cmp.Or(strings.TrimPrefix(filepath.Ext(path), "."), "yaml"))
+
+	err = parser.ReadInConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", source, err)
+	}
+
+	includes, err := parseIncludes(parser.Get(includeKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", source, err)
+	}
+
+	if len(includes) == 0 {
+		return parser.AllSettings(), nil
+	}
+
+	merged := viper.New()
+
+	for _, include := range includes {
+		included, err := includedLocation(location, include.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		settings, err := resolveConfigFile(ctx, included, include.SHA256, append(slices.Clone(including), location))
+		if err != nil {
+			return nil, err
+		}
+
+		err = merged.MergeConfigMap(settings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge config file %s: %w", included, err)
+		}
+	}
+
+	err = merged.MergeConfigMap(parser.AllSettings())
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge config file %s: %w", source, err)
+	}
+
+	return merged.AllSettings(), nil
+}
+
+// parseIncludes returns the files listed under include, each either a path
+// or URL, or a path and the checksum it must have.
+func parseIncludes(value any) ([]include, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []include{{Path: value}}, nil
+	}
+
+	entries, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: include must be a list", ErrInvalidInclude)
+	}
+
+	includes := make([]include, 0, len(entries))
+
+	for i, entry := range entries {
+		if path, ok := entry.(string); ok {
+			includes = append(includes, include{Path: path})
+
+			continue
+		}
+
+		fields, _ := entry.(map[string]any)
+		path, _ := fields["path"].(string)
+		checksum, _ := fields["sha256"].(string)
+
+		if path == "" {
+			return nil, fmt.Errorf("%w: include[%d] must be a path, or have a path and a sha256", ErrInvalidInclude, i)
+		}
+
+		includes = append(includes, include{Path: path, SHA256: checksum})
+	}
+
+	return includes, nil
+}
+
+// includedLocation returns the location of a file included by the file at
+// location: remote URLs as they are, and other paths relative to the
+// including file, or to its URL.
+func includedLocation(location, include string) (string, error) {
+	switch {
+	case remote.IsRemote(location):
+		resolved, err := remote.Resolve(location, include)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve include %s: %w", include, err)
+		}
+
+		return resolved, nil
+	case remote.IsRemote(include), filepath.IsAbs(include):
+		return include, nil
+	default:
+		return filepath.Join(filepath.Dir(location), include), nil
+	}
+}
+
+// localConfigFile returns the path of the configuration file at source,
+// fetching it into the local cache first if it is an S3 object or an HTTPS
+// URL. checksum is the SHA-256 the file must have, if set.
+func localConfigFile(ctx context.Context, source, checksum string) (string, error) {
+	if !remote.IsRemote(source) {
+		return source, nil
+	}
+
+	path, err := remote.Fetch(ctx, source, remote.Options{
+		Profile: viper.GetString("profile"),
+		SHA256:  checksum,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch config file: %w", err)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package exitcode
+
+import (
+	"context"
+	"errors"
+)
+
+// Exit codes of the commands that update files, so automation can tell an
+// up-to-date target from one that changed and from runs that failed.
+const (
+	// UpToDate means no file needed changing.
+	UpToDate = 0
+
+	// Failure means the run stopped with an error.
+	Failure = 1
+
+	// Changed means files were changed, or would have been with --diff-only.
+	Changed = 2
+
+	// PartialFailure means the run finished, but some AMI lookups or files
+	// failed along the way. It wins over Changed.
+	PartialFailure = 3
+
+	// ConfigError means the configuration or command line is invalid, so
+	// nothing was attempted.
+	ConfigError = 4
+
+	// Interrupted means the run was stopped by an interrupt or SIGTERM.
+	Interrupted = 130
+)
+
+// ErrConfig matches the errors marked with Config.
+var ErrConfig = errors.New("invalid configuration")
+
+type configError struct {
+	err error
+}
+
+func (e configError) Error() string {
+	return e.err.Error()
+}
+
+func (e configError) Unwrap() []error {
+	return []error{e.err, ErrConfig}
+}
+
+// Config marks err as an error in the configuration or command line, without
+// changing its message.
+func Config(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return configError{err: err}
+}
+
+// For returns the exit code of a run that ended with err, changed files, and
+// had failures that did not stop it.
+func For(err error, changed bool, failures int) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return Interrupted
+	case errors.Is(err, ErrConfig):
+		return ConfigError
+	case err != nil:
+		return Failure
+	case failures > 0:
+		return PartialFailure
+	case changed:
+		return Changed
+	default:
+		return UpToDate
+	}
+}
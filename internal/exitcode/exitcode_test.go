@@ -0,0 +1,88 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package exitcode_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/exitcode"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+	"github.com/schnauzersoft/ami-util/internal/results"
+)
+
+var errLookup = errors.New("lookup failed")
+
+func TestFor(t *testing.T) {
+	t.Parallel()
+
+	// A --diff-only run reports the files it would have changed as updated
+	diffOnly := results.New(time.Now())
+	diffOnly.DiffOnly = true
+	diffOnly.AddFiles([]fileprocessor.FileResult{{Path: "main.tf", Count: 1}})
+
+	tests := []struct {
+		name     string
+		err      error
+		changed  bool
+		failures int
+		want     int
+	}{
+		{name: "up to date", want: exitcode.UpToDate},
+		{name: "changed", changed: true, want: exitcode.Changed},
+		{name: "diff only", changed: diffOnly.Changed(), failures: diffOnly.Failures(), want: exitcode.Changed},
+		{name: "failures", failures: 1, want: exitcode.PartialFailure},
+		{name: "failures win over changed", changed: true, failures: 2, want: exitcode.PartialFailure},
+		{name: "error", err: errLookup, changed: true, failures: 1, want: exitcode.Failure},
+		{
+			name: "wrapped config error",
+			err:  fmt.Errorf("failed to load: %w", exitcode.Config(errLookup)),
+			want: exitcode.ConfigError,
+		},
+		{name: "canceled", err: context.Canceled, want: exitcode.Interrupted},
+		{
+			name:    "wrapped cancellation",
+			err:     fmt.Errorf("processing cancelled: %w", context.Canceled),
+			changed: true,
+			want:    exitcode.Interrupted,
+		},
+		{
+			name: "cancellation wins over config",
+			err:  errors.Join(exitcode.Config(errLookup), context.Canceled),
+			want: exitcode.Interrupted,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := exitcode.For(test.err, test.changed, test.failures)
+			if got != test.want {
+				t.Errorf("For(%v, %t, %d) = %d, want %d", test.err, test.changed, test.failures, got, test.want)
+			}
+		})
+	}
+}
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+
+	if exitcode.Config(nil) != nil {
+		t.Error("Config(nil) is not nil")
+	}
+
+	err := exitcode.Config(errLookup)
+	if err.Error() != errLookup.Error() {
+		t.Errorf("Config changed the message to %q", err.Error())
+	}
+
+	if !errors.Is(err, errLookup) || !errors.Is(err, exitcode.ErrConfig) {
+		t.Error("Config does not match both the error and ErrConfig")
+	}
+}
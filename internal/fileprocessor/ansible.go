@@ -0,0 +1,107 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+var (
+	// ansibleModules are the modules, without their collection, whose tasks
+	// set an AMI.
+	ansibleModules = []string{"ec2_instance", "ec2_launch_template"}
+
+	// ansibleImageKeys are the module arguments that hold the AMI: image_id,
+	// and image.id for ec2_instance.
+	ansibleImageKeys = [][]string{{"image_id"}, {"image"}}
+
+	// ansibleVarsDirs are the directories whose YAML files only define
+	// variables.
+	ansibleVarsDirs = []string{"group_vars", "host_vars", "vars", "defaults"}
+)
+
+// SetAnsible limits replacements in YAML files to Ansible usages: the image
+// arguments of ec2_instance and ec2_launch_template tasks in playbooks and
+// task files, and variable values in vars files.
+func (p *Processor) SetAnsible(enabled bool) {
+	p.ansible = enabled
+}
+
+// isAnsibleVarsFile reports whether a YAML file defines Ansible variables,
+// such as group_vars/all.yml or roles/web/defaults/main.yml.
+func isAnsibleVarsFile(file string) bool {
+	directories := strings.Split(filepath.ToSlash(filepath.Dir(file)), "/")
+
+	return slices.ContainsFunc(ansibleVarsDirs, func(dir string) bool {
+		return slices.Contains(directories, dir)
+	})
+}
+
+// ansibleSpans returns the spans of the YAML scalars an Ansible file sets AMIs
+// with. In vars files every variable value is a span; elsewhere only the image
+// arguments of ec2_instance and ec2_launch_template tasks, with or without
+// their collection prefix, are. Comments are never part of a span.
+func ansibleSpans(content []byte, file string) ([]span, error) {
+	if isAnsibleVarsFile(file) {
+		return yamlSpans(content, []string{"*"})
+	}
+
+	lines := newLineIndex(content)
+	decoder := yaml.NewDecoder(strings.NewReader(string(content)))
+
+	var spans []span
+
+	for {
+		var document yaml.Node
+
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+
+		spans = appendTaskSpans(spans, &document, lines)
+	}
+
+	return spans, nil
+}
+
+// appendTaskSpans appends the spans of the image arguments of every EC2 task
+// under node, including tasks nested in blocks, roles, and handlers.
+func appendTaskSpans(spans []span, node *yaml.Node, lines lineIndex) []span {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			spans = appendTaskSpans(spans, child, lines)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if isAnsibleEC2Module(node.Content[i].Value) {
+				spans = appendYAMLSpans(spans, node.Content[i+1], nil, ansibleImageKeys, false, lines)
+
+				continue
+			}
+
+			spans = appendTaskSpans(spans, node.Content[i+1], lines)
+		}
+	case yaml.ScalarNode, yaml.AliasNode:
+	}
+
+	return spans
+}
+
+func isAnsibleEC2Module(name string) bool {
+	return slices.Contains(ansibleModules, name[strings.LastIndex(name, ".")+1:])
+}
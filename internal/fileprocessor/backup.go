@@ -0,0 +1,171 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/logging"
+)
+
+// BackupTimestampLayout is the UTC time format appended to the backups of
+// runs that keep more than one, as in main.tf.backup.20250101T010101.
+const BackupTimestampLayout = "20060102T150405"
+
+var timestampedBackupRegex = regexp.MustCompile(`\.backup\.\d{8}T\d{6}$`)
+
+// SetNoBackup disables the backups saved before files are updated, for
+// files that are already under version control.
+func (p *Processor) SetNoBackup(disabled bool) {
+	p.noBackup = disabled
+}
+
+// SetBackupDir saves backups under dir, mirroring the paths of the updated
+// files, instead of next to them. An empty dir restores sibling backups.
+func (p *Processor) SetBackupDir(dir string) {
+	p.backupDir = dir
+}
+
+// SetBackupKeep saves timestamped backups and keeps the newest keep of each
+// file, removing older ones. Zero keeps a single backup per file, replaced on
+// every run.
+func (p *Processor) SetBackupKeep(keep int) {
+	p.backupKeep = keep
+	p.backupStamp = time.Now().UTC().Format(BackupTimestampLayout)
+}
+
+// backUp saves the original content of file as its backup and returns the
+// backup's path. A file updated twice by the same processor keeps the backup
+// of its content from before the first update.
+func (p *Processor) backUp(file string, originalContent []byte) (string, error) {
+	backupPath, err := p.backupPath(file)
+	if err != nil {
+		return "", err
+	}
+
+	p.backedUpMu.Lock()
+	backedUp := p.backedUp[file]
+	p.backedUpMu.Unlock()
+
+	if backedUp {
+		return backupPath, nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(backupPath), BackupDirPerm)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	err = writeFileAtomic(backupPath, originalContent)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	p.backedUpMu.Lock()
+	p.backedUp[file] = true
+	p.backedUpMu.Unlock()
+
+	if p.backupKeep > 0 {
+		p.pruneBackups(backupPath)
+	}
+
+	return backupPath, nil
+}
+
+// pruneBackups removes the oldest timestamped backups of the file backupPath
+// belongs to, keeping the configured number.
+func (p *Processor) pruneBackups(backupPath string) {
+	dir := filepath.Dir(backupPath)
+	prefix := strings.TrimSuffix(filepath.Base(backupPath), p.backupStamp)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Warn("Failed to list backups", "dir", dir, "error", err)
+
+		return
+	}
+
+	var backups []string
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, prefix) && timestampedBackupRegex.MatchString(name) {
+			backups = append(backups, name)
+		}
+	}
+
+	// Timestamps sort chronologically, so the oldest backups come first.
+	slices.Sort(backups)
+
+	for _, name := range backups[:max(len(backups)-p.backupKeep, 0)] {
+		err := os.Remove(filepath.Join(dir, name))
+		if err != nil {
+			slog.Warn("Failed to remove old backup", "path", filepath.Join(dir, name), "error", err)
+
+			continue
+		}
+
+		logging.Trace("Removed old backup", "path", filepath.Join(dir, name))
+	}
+}
+
+// backupPath returns where the backup of file is saved. Under a backup
+// directory, files below the working directory keep their relative path and
+// other files their absolute one, so backups of different files never
+// collide.
+func (p *Processor) backupPath(file string) (string, error) {
+	suffix := BackupSuffix
+	if p.backupKeep > 0 {
+		suffix += "." + p.backupStamp
+	}
+
+	if p.backupDir == "" {
+		return file + suffix, nil
+	}
+
+	absolute, err := filepath.Abs(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", file, err)
+	}
+
+	mirrored := strings.TrimPrefix(absolute, filepath.VolumeName(absolute))
+
+	workingDir, err := os.Getwd()
+	if err == nil {
+		relative, err := filepath.Rel(workingDir, absolute)
+		if err == nil && filepath.IsLocal(relative) {
+			mirrored = relative
+		}
+	}
+
+	return filepath.Join(p.backupDir, mirrored) + suffix, nil
+}
+
+// isBackupFile reports whether path is a backup, timestamped or not.
+func isBackupFile(path string) bool {
+	return strings.HasSuffix(path, BackupSuffix) || timestampedBackupRegex.MatchString(path)
+}
+
+// logUpdate logs message about an update of file with args, adding its
+// backup, or that it was not written with --diff-only.
+func (p *Processor) logUpdate(message, file, backupPath string, args ...any) {
+	args = append([]any{"file", file}, args...)
+
+	switch {
+	case p.diffOnly:
+		args = append(args, "diff_only", true)
+	case backupPath != "":
+		args = append(args, "backup", backupPath)
+	}
+
+	logging.Trace(message, args...)
+}
@@ -0,0 +1,328 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+)
+
+const (
+	cdkContextFile = "cdk.context.json"
+	cdkAMIPrefix   = "ami:"
+)
+
+var (
+	ErrInvalidCDKContext = errors.New("CDK context file is not a JSON object")
+
+	// cdkLookupPropertyRegex matches the properties of a cached lookup key,
+	// such as :region= or :filters.tag:Name.0=. Filter names may contain
+	// colons, and values are everything up to the next property.
+	cdkLookupPropertyRegex = regexp.MustCompile(`:(filters\.[\w:-]+?\.\d+|owners\.\d+|[a-zA-Z]+)=`)
+)
+
+// CDKContextLookup is a machine image lookup cached in a cdk.context.json
+// file, as written by ec2.MachineImage.lookup.
+type CDKContextLookup struct {
+	File string
+	Key  string
+	AMI  string
+
+	aws.ImageLookup
+}
+
+// CDKContextUpdate changes the cached AMI of a lookup, or deletes the lookup
+// so that the CDK resolves it again on the next synth. Replacement is of the
+// cached AMI by the one the lookup selects now.
+type CDKContextUpdate struct {
+	File        string
+	Key         string
+	Replacement aws.AMIReplacement
+	Delete      bool
+}
+
+type cdkContextEntry struct {
+	key   string
+	value json.RawMessage
+}
+
+// isCDKContextFile reports whether a file is an AWS CDK context cache.
+func isCDKContextFile(file string) bool {
+	return filepath.Base(file) == cdkContextFile
+}
+
+// SetManageCDKContext leaves cdk.context.json files to RewriteCDKContext
+// instead of replacing the AMIs in them.
+func (p *Processor) SetManageCDKContext(manage bool) {
+	p.manageCDKContext = manage
+}
+
+// parseCDKLookupKey returns the lookup a cached ami: context key describes,
+// reporting false for other keys.
+func parseCDKLookupKey(key string) (aws.ImageLookup, bool) {
+	if !strings.HasPrefix(key, cdkAMIPrefix) {
+		return aws.ImageLookup{}, false
+	}
+
+	properties := ":" + strings.TrimPrefix(key, cdkAMIPrefix)
+	matches := cdkLookupPropertyRegex.FindAllStringSubmatchIndex(properties, -1)
+	lookup := aws.ImageLookup{Filters: make(map[string][]string)}
+
+	for i, match := range matches {
+		end := len(properties)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+
+		name, value := properties[match[2]:match[3]], properties[match[1]:end]
+
+		switch {
+		case name == "account":
+			lookup.Account = value
+		case name == "region":
+			lookup.Region = value
+		case strings.HasPrefix(name, "owners."):
+			lookup.Owners = append(lookup.Owners, value)
+		case strings.HasPrefix(name, "filters."):
+			filter := strings.TrimPrefix(name[:strings.LastIndex(name, ".")], "filters.")
+			lookup.Filters[filter] = append(lookup.Filters[filter], value)
+		}
+	}
+
+	return lookup, lookup.Region != ""
+}
+
+// FindCDKContextLookups returns the cached machine image lookups in
+// cdk.context.json files, named directly or found under directories.
+func (p *Processor) FindCDKContextLookups(paths ...string) ([]CDKContextLookup, error) {
+	files, err := p.filesIn(paths, aws.ContainsAMI)
+	if err != nil {
+		return nil, err
+	}
+
+	var lookups []CDKContextLookup
+
+	for _, file := range files {
+		if !isCDKContextFile(file) {
+			continue
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			slog.Warn("Failed to read file", "file", file, "error", err)
+
+			continue
+		}
+
+		entries, err := parseCDKContext(content)
+		if err != nil {
+			slog.Warn("Failed to parse file", "file", file, "error", err)
+
+			continue
+		}
+
+		for _, entry := range entries {
+			lookup, ok := parseCDKLookupKey(entry.key)
+
+			var cached string
+			if !ok || json.Unmarshal(entry.value, &cached) != nil {
+				continue
+			}
+
+			lookups = append(lookups, CDKContextLookup{File: file, Key: entry.key, AMI: cached, ImageLookup: lookup})
+		}
+	}
+
+	return lookups, nil
+}
+
+// RewriteCDKContext applies updates to the cdk.context.json files they belong
+// to, keeping the order of the other entries.
+func (p *Processor) RewriteCDKContext(ctx context.Context, updates []CDKContextUpdate) ([]FileResult, error) {
+	var files []string
+
+	byFile := make(map[string]map[string]CDKContextUpdate)
+
+	for _, update := range updates {
+		if byFile[update.File] == nil {
+			byFile[update.File] = make(map[string]CDKContextUpdate)
+			files = append(files, update.File)
+		}
+
+		byFile[update.File][update.Key] = update
+	}
+
+	results := make([]FileResult, 0, len(files))
+
+	for _, file := range files {
+		err := ctx.Err()
+		if err != nil {
+			return results, fmt.Errorf("processing cancelled: %w", err)
+		}
+
+		result, err := p.rewriteCDKContextFile(file, byFile[file])
+		if err != nil {
+			slog.Warn("Failed to rewrite CDK context", "file", file, "error", err)
+
+			results = append(results, FileResult{Path: file, Err: err})
+
+			continue
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func (p *Processor) rewriteCDKContextFile(file string, updates map[string]CDKContextUpdate) (FileResult, error) {
+	result := FileResult{Path: file}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return result, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	entries, err := parseCDKContext(content)
+	if err != nil {
+		return result, err
+	}
+
+	kept := make([]cdkContextEntry, 0, len(entries))
+	refreshed, deleted := 0, 0
+
+	for _, entry := range entries {
+		update, ok := updates[entry.key]
+
+		switch {
+		case !ok:
+		case update.Delete:
+			deleted++
+
+			result.Replacements = append(result.Replacements, update.Replacement)
+
+			continue
+		default:
+			entry.value, err = json.Marshal(update.Replacement.NewAMI)
+			if err != nil {
+				return result, fmt.Errorf("failed to encode %s: %w", update.Replacement.NewAMI, err)
+			}
+
+			refreshed++
+
+			result.Replacements = append(result.Replacements, update.Replacement)
+		}
+
+		kept = append(kept, entry)
+	}
+
+	if refreshed+deleted == 0 {
+		return FileResult{Path: file}, nil
+	}
+
+	newContent, err := formatCDKContext(kept, bytes.HasSuffix(content, []byte("\n")))
+	if err != nil {
+		return result, err
+	}
+
+	result.BackupPath, err = p.updateFileWithBackup(file, content, newContent)
+	if errors.Is(err, ErrNotConfirmed) {
+		p.skippedUpdate(file)
+
+		return FileResult{Path: file, Skipped: true}, nil
+	}
+
+	if err != nil {
+		return FileResult{Path: file, BackupPath: result.BackupPath}, err
+	}
+
+	result.Count = refreshed + deleted
+
+	p.logUpdate("Updated cached AMI lookups", file, result.BackupPath, "refreshed", refreshed, "deleted", deleted)
+
+	return result, nil
+}
+
+// parseCDKContext returns the top-level entries of a context file in order.
+func parseCDKContext(content []byte) ([]cdkContextEntry, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+
+	token, err := decoder.Token()
+	if err != nil || token != json.Delim('{') {
+		return nil, ErrInvalidCDKContext
+	}
+
+	var entries []cdkContextEntry
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CDK context: %w", err)
+		}
+
+		key, _ := token.(string)
+
+		var value json.RawMessage
+
+		err = decoder.Decode(&value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CDK context: %w", err)
+		}
+
+		entries = append(entries, cdkContextEntry{key: key, value: value})
+	}
+
+	return entries, nil
+}
+
+// formatCDKContext encodes entries the way the CDK writes its context file,
+// as an object indented by two spaces.
+func formatCDKContext(entries []cdkContextEntry, trailingNewline bool) (string, error) {
+	var builder strings.Builder
+
+	builder.WriteString("{")
+
+	for i, entry := range entries {
+		key, err := json.Marshal(entry.key)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode %s: %w", entry.key, err)
+		}
+
+		var value bytes.Buffer
+
+		err = json.Indent(&value, entry.value, "  ", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to encode %s: %w", entry.key, err)
+		}
+
+		if i > 0 {
+			builder.WriteString(",")
+		}
+
+		builder.WriteString("\n  " + string(key) + ": " + value.String())
+	}
+
+	if len(entries) > 0 {
+		builder.WriteString("\n")
+	}
+
+	builder.WriteString("}")
+
+	if trailingNewline {
+		builder.WriteString("\n")
+	}
+
+	return builder.String(), nil
+}
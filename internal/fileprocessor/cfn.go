@@ -0,0 +1,53 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"slices"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// mappingValue returns the value of key in the mapping among nodes, if any.
+func mappingValue(nodes []*yaml.Node, key string) *yaml.Node {
+	for _, node := range nodes {
+		if node.Kind != yaml.MappingNode {
+			continue
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i+1]
+			}
+		}
+	}
+
+	return nil
+}
+
+// gapSpans returns the spans of content of the given length not covered by
+// spans, which must not overlap.
+func gapSpans(length int, spans []span) []span {
+	sorted := slices.Clone(spans)
+	slices.SortFunc(sorted, func(a, b span) int { return a.start - b.start })
+
+	var gaps []span
+
+	start := 0
+
+	for _, s := range sorted {
+		if s.start > start {
+			gaps = append(gaps, span{start: start, end: s.start})
+		}
+
+		start = max(start, s.end)
+	}
+
+	if start < length {
+		gaps = append(gaps, span{start: start, end: length})
+	}
+
+	return gaps
+}
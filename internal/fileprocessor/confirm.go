@@ -0,0 +1,77 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/schnauzersoft/ami-util/internal/logging"
+	"github.com/schnauzersoft/ami-util/internal/progress"
+)
+
+var ErrNotConfirmed = errors.New("change was not confirmed")
+
+// SetConfirmFunc consults confirm with the diff of each file before it is
+// written, colored when color is set.
+func (p *Processor) SetConfirmFunc(confirm ConfirmFunc, color bool) {
+	p.confirm = confirm
+	p.diffColor = color
+}
+
+// confirmWrite asks whether file may be written, returning ErrNotConfirmed
+// when it may not. Prompts for files processed concurrently are asked one at
+// a time.
+func (p *Processor) confirmWrite(file string, originalContent []byte, newContent string) error {
+	if p.confirm == nil {
+		return nil
+	}
+
+	p.confirmMu.Lock()
+	defer p.confirmMu.Unlock()
+
+	switch {
+	case p.confirmQuit:
+		return ErrNotConfirmed
+	case p.confirmAll:
+		return nil
+	}
+
+	diff, err := p.unifiedDiff(file, originalContent, newContent)
+	if err != nil {
+		return err
+	}
+
+	resume := progress.Pause()
+	decision, err := p.confirm(file, diff)
+
+	resume()
+
+	if err != nil {
+		return fmt.Errorf("failed to get confirmation for %s: %w", file, err)
+	}
+
+	switch decision {
+	case DecisionAccept:
+	case DecisionAcceptAll:
+		p.confirmAll = true
+	case DecisionSkip:
+		return ErrNotConfirmed
+	case DecisionQuit:
+		p.confirmQuit = true
+
+		slog.Info("Quitting: no further files will be written")
+
+		return ErrNotConfirmed
+	}
+
+	return nil
+}
+
+// skippedUpdate logs that an update of file was not confirmed.
+func (p *Processor) skippedUpdate(file string) {
+	logging.Trace("Skipping file: not confirmed", "file", file)
+}
@@ -0,0 +1,130 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/schnauzersoft/ami-util/internal/progress"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const (
+	diffContextLines = 3
+
+	colorReset = "\033[0m"
+	colorBold  = "\033[1m"
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorCyan  = "\033[36m"
+)
+
+// SetDiff prints a unified diff of every change to out before it is written,
+// colored when color is set. A nil out prints nothing.
+func (p *Processor) SetDiff(out io.Writer, color bool) {
+	p.diffOut = out
+	p.diffColor = color
+}
+
+// SetDiffOnly prints the diffs of changes without writing them or saving
+// backups. It requires SetDiff.
+func (p *Processor) SetDiffOnly(diffOnly bool) {
+	p.diffOnly = diffOnly
+}
+
+// printDiff writes the unified diff between the original and new content of
+// file. Diffs of files processed concurrently are never interleaved.
+func (p *Processor) printDiff(file string, originalContent []byte, newContent string) {
+	if p.diffOut == nil {
+		return
+	}
+
+	diff, err := p.unifiedDiff(file, originalContent, newContent)
+	if err != nil {
+		slog.Warn("Failed to diff file", "file", file, "error", err)
+
+		return
+	}
+
+	p.diffMu.Lock()
+	defer p.diffMu.Unlock()
+
+	resume := progress.Pause()
+	defer resume()
+
+	_, err = io.WriteString(p.diffOut, diff)
+	if err != nil {
+		slog.Warn("Failed to print diff", "file", file, "error", err)
+	}
+}
+
+// unifiedDiff returns the unified diff between the original and new content
+// of file, colored when diffs are.
+func (p *Processor) unifiedDiff(file string, originalContent []byte, newContent string) (string, error) {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        diffLines(string(originalContent)),
+		B:        diffLines(newContent),
+		FromFile: "a/" + file,
+		ToFile:   "b/" + file,
+		Context:  diffContextLines,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to diff %s: %w", file, err)
+	}
+
+	if p.diffColor {
+		diff = colorDiff(diff)
+	}
+
+	return diff, nil
+}
+
+// diffLines splits content into lines that each end in a newline, without
+// the empty line difflib.SplitLines adds after a final newline.
+func diffLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+
+	lines[len(lines)-1] += "\n"
+
+	return lines
+}
+
+// colorDiff colors the headers, hunk markers, and changed lines of a unified
+// diff the way git does.
+func colorDiff(diff string) string {
+	var builder strings.Builder
+
+	for line := range strings.Lines(diff) {
+		text := strings.TrimSuffix(line, "\n")
+
+		var color string
+
+		switch {
+		case strings.HasPrefix(text, "---"), strings.HasPrefix(text, "+++"):
+			color = colorBold
+		case strings.HasPrefix(text, "@@"):
+			color = colorCyan
+		case strings.HasPrefix(text, "-"):
+			color = colorRed
+		case strings.HasPrefix(text, "+"):
+			color = colorGreen
+		default:
+			builder.WriteString(line)
+
+			continue
+		}
+
+		fmt.Fprintf(&builder, "%s%s%s%s", color, text, colorReset, line[len(text):])
+	}
+
+	return builder.String()
+}
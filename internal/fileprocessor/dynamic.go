@@ -0,0 +1,245 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/schnauzersoft/ami-util/internal/logging"
+)
+
+// Kinds of dynamic AMI references found in CloudFormation templates and
+// Kubernetes manifests.
+const (
+	DynamicSSM       = "ssm"
+	DynamicFindInMap = "find-in-map"
+	DynamicKarpenter = "karpenter"
+)
+
+var (
+	ssmDynamicRegex = regexp.MustCompile(`\{\{resolve:ssm:([\w.\-/]+)(?::(\d+))?\}\}`)
+	findInMapRegex  = regexp.MustCompile(
+		`ImageId"?\s*:\s*(?:!FindInMap\s*\[|\{\s*"Fn::FindInMap"\s*:\s*\[)\s*"?([\w-]+)`)
+)
+
+// DynamicReference is an AMI usage in a template that does not spell out the
+// AMI ID: an SSM dynamic reference such as {{resolve:ssm:/path/to/param}}, an
+// ImageId taken from a mapping with FindInMap, or a Karpenter EC2NodeClass
+// amiSelectorTerms entry that selects AMIs by alias, name, owner, or tags.
+type DynamicReference struct {
+	File   string
+	Line   int
+	Column int
+	Kind   string
+
+	// Name is the SSM parameter name, the mapping name, or the selector term
+	// such as alias:al2023@latest.
+	Name string
+
+	// Version is the parameter version an SSM reference is pinned to, or zero
+	// when it always resolves to the latest version.
+	Version int64
+
+	// Region is the region of the innermost region scope containing an SSM
+	// reference, or empty outside them.
+	Region string
+}
+
+// ParameterRegion is an SSM parameter in a region, whose parameter versions
+// are numbered apart from those of other regions. An empty region stands for
+// the references outside region scopes.
+type ParameterRegion struct {
+	Name   string
+	Region string
+}
+
+// FindDynamicReferences returns the dynamic AMI references in content.
+func FindDynamicReferences(file, content string) []DynamicReference {
+	var references []DynamicReference
+
+	for lineIndex, line := range strings.Split(content, "\n") {
+		for _, match := range ssmDynamicRegex.FindAllStringSubmatchIndex(line, -1) {
+			reference := DynamicReference{
+				File:   file,
+				Line:   lineIndex + 1,
+				Column: match[0] + 1,
+				Kind:   DynamicSSM,
+				Name:   line[match[2]:match[3]],
+			}
+
+			if match[4] >= 0 {
+				reference.Version, _ = strconv.ParseInt(line[match[4]:match[5]], 10, 64)
+			}
+
+			references = append(references, reference)
+		}
+
+		for _, match := range findInMapRegex.FindAllStringSubmatchIndex(line, -1) {
+			references = append(references, DynamicReference{
+				File:   file,
+				Line:   lineIndex + 1,
+				Column: match[0] + 1,
+				Kind:   DynamicFindInMap,
+				Name:   line[match[2]:match[3]],
+			})
+		}
+	}
+
+	return append(references, findKarpenterSelectors(file, []byte(content))...)
+}
+
+// ScanDynamicReferences returns the dynamic AMI references in files and in
+// every file under directories.
+func (p *Processor) ScanDynamicReferences(paths ...string) ([]DynamicReference, error) {
+	files, err := p.filesIn(paths, containsDynamicReference)
+	if err != nil {
+		return nil, err
+	}
+
+	var references []DynamicReference
+
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			slog.Warn("Failed to read file", "file", file, "error", err)
+
+			continue
+		}
+
+		scopes := p.regionScopes(file, content)
+		lines := newLineIndex(content)
+
+		for _, reference := range FindDynamicReferences(file, string(content)) {
+			if reference.Kind == DynamicSSM {
+				offset := lines.offset(reference.Line, 1) + reference.Column - 1
+				reference.Region = innermostRegion(scopes, offset, offset+1)
+			}
+
+			references = append(references, reference)
+		}
+	}
+
+	return references, nil
+}
+
+// RewriteDynamicReferences updates SSM dynamic references pinned to an old
+// parameter version to the latest version in versions, keyed by parameter
+// and the region of the innermost region scope containing the reference.
+// References without a version for their region, and those that always
+// resolve to the latest version, are left alone.
+func (p *Processor) RewriteDynamicReferences(ctx context.Context, references []DynamicReference,
+	versions map[ParameterRegion]int64,
+) ([]FileResult, error) {
+	var files []string
+
+	seen := make(map[string]bool)
+
+	for _, reference := range references {
+		if reference.Kind == DynamicSSM && reference.Version > 0 && !seen[reference.File] {
+			seen[reference.File] = true
+			files = append(files, reference.File)
+		}
+	}
+
+	results := make([]FileResult, 0, len(files))
+
+	for _, file := range files {
+		err := ctx.Err()
+		if err != nil {
+			return results, fmt.Errorf("processing cancelled: %w", err)
+		}
+
+		result, err := p.rewriteDynamicFile(file, versions)
+		if err != nil {
+			slog.Warn("Failed to rewrite dynamic references", "file", file, "error", err)
+
+			results = append(results, FileResult{Path: file, Err: err})
+
+			continue
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func (p *Processor) rewriteDynamicFile(file string, versions map[ParameterRegion]int64) (FileResult, error) {
+	result := FileResult{Path: file}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return result, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var (
+		text    = string(content)
+		scopes  = p.regionScopes(file, content)
+		updated strings.Builder
+		last    int
+		count   int
+	)
+
+	for _, match := range ssmDynamicRegex.FindAllStringSubmatchIndex(text, -1) {
+		if match[4] < 0 {
+			continue
+		}
+
+		name := text[match[2]:match[3]]
+		version, _ := strconv.ParseInt(text[match[4]:match[5]], 10, 64)
+
+		latest, ok := versions[ParameterRegion{Name: name, Region: innermostRegion(scopes, match[0], match[0]+1)}]
+		if !ok || latest <= version {
+			continue
+		}
+
+		updated.WriteString(text[last:match[0]])
+		fmt.Fprintf(&updated, "{{resolve:ssm:%s:%d}}", name, latest)
+
+		last = match[1]
+		count++
+	}
+
+	updated.WriteString(text[last:])
+	newContent := updated.String()
+
+	if count == 0 {
+		logging.Trace("No dynamic references to update", "file", file)
+
+		return result, nil
+	}
+
+	result.BackupPath, err = p.updateFileWithBackup(file, content, newContent)
+	if errors.Is(err, ErrNotConfirmed) {
+		p.skippedUpdate(file)
+
+		result.Skipped = true
+
+		return result, nil
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	result.Count = count
+
+	p.logUpdate("Updated dynamic references", file, result.BackupPath, "count", count)
+
+	return result, nil
+}
+
+func containsDynamicReference(content []byte) bool {
+	return ssmDynamicRegex.Match(content) || findInMapRegex.Match(content) ||
+		bytes.Contains(content, []byte(karpenterNodeClassKind))
+}
@@ -0,0 +1,263 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"slices"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+)
+
+// FormatHandler finds and replaces the AMI IDs of the files of one format.
+// The processor selects the first handler that detects a file, trying the
+// registered handlers before the built-in ones.
+type FormatHandler interface {
+	// Name identifies the format in logs.
+	Name() string
+
+	// Detect reports whether the handler applies to file.
+	Detect(file string, content []byte) bool
+
+	// FindAMIs returns the spans of content in which AMI IDs are replaced, or
+	// nil to replace them anywhere in content.
+	FindAMIs(file string, content []byte) ([]Span, error)
+
+	// Replace applies replacements within spans of content, as returned by
+	// FindAMIs and limited to the region scopes of the file.
+	Replace(content []byte, spans []Span, replacements []aws.AMIReplacement) (Replaced, error)
+}
+
+// Span is a byte range of a file's content in which AMI IDs are replaced.
+type Span struct {
+	Start int
+	End   int
+
+	// Address identifies what the span belongs to, such as a Terraform
+	// address, a variable name, or a Packer source.
+	Address string
+
+	// Region limits the span to the replacements for that region, if set.
+	Region string
+}
+
+// Replaced is the outcome of replacing the AMI IDs of a file.
+type Replaced struct {
+	Content      string
+	Count        int
+	Replacements []aws.AMIReplacement
+
+	// Changed are the spans whose content changed.
+	Changed []Span
+
+	// Variables are the names of the variables whose values changed, for
+	// formats with variables.
+	Variables []string
+}
+
+// ReplaceSpans applies replacements within spans of content, or anywhere in
+// content when spans is nil, in which case only in-place replacements apply.
+// Spans must not overlap. It is the Replace of the built-in handlers.
+func ReplaceSpans(content []byte, spans []Span, replacements []aws.AMIReplacement) Replaced {
+	if spans == nil {
+		newContent, count, applied := aws.ReplaceAMIsInContent(string(content),
+			replacementsForRegion(replacements, ""))
+
+		return Replaced{Content: newContent, Count: count, Replacements: applied}
+	}
+
+	internal := make([]span, 0, len(spans))
+	for _, s := range spans {
+		internal = append(internal, span{start: s.Start, end: s.End, region: s.Region})
+	}
+
+	newContent, count, applied, changed := replaceInSpans(string(content), internal, replacements)
+
+	result := Replaced{Content: newContent, Count: count, Replacements: applied}
+	for _, index := range changed {
+		result.Changed = append(result.Changed, spans[index])
+	}
+
+	return result
+}
+
+// RegisterFormat adds a handler for a file format, tried before the built-in
+// handlers and those registered earlier.
+func (p *Processor) RegisterFormat(handler FormatHandler) {
+	p.formats = append([]FormatHandler{handler}, p.formats...)
+}
+
+// handlerFor returns the handler of the first format that detects file.
+func (p *Processor) handlerFor(file string, content []byte) FormatHandler {
+	for _, handler := range p.handlers() {
+		if handler.Detect(file, content) {
+			return handler
+		}
+	}
+
+	return plainFormat{}
+}
+
+// handlers returns the registered handlers followed by the built-in ones
+// enabled by the processor's settings, in the order they are tried.
+func (p *Processor) handlers() []FormatHandler {
+	handlers := slices.Clone(p.formats)
+
+	if p.manageCDKContext {
+		handlers = append(handlers, cdkContextFormat{})
+	}
+
+	handlers = append(handlers, tfvarsFormat{}, packerFormat{})
+
+	if p.ansible {
+		handlers = append(handlers, ansibleFormat{})
+	}
+
+	if len(p.yamlKeys) > 0 {
+		handlers = append(handlers, yamlKeysFormat{keyPaths: p.yamlKeys})
+	}
+
+	if len(p.hclAttributes) > 0 {
+		handlers = append(handlers, hclFormat{attributes: p.hclAttributes})
+	}
+
+	return append(handlers, plainFormat{})
+}
+
+// spanReplacer gives the built-in handlers their Replace.
+type spanReplacer struct{}
+
+func (spanReplacer) Replace(content []byte, spans []Span, replacements []aws.AMIReplacement) (Replaced, error) {
+	return ReplaceSpans(content, spans, replacements), nil
+}
+
+// cdkContextFormat leaves CDK context files untouched, since their lookups
+// are refreshed instead.
+type cdkContextFormat struct{ spanReplacer }
+
+func (cdkContextFormat) Name() string { return "cdk-context" }
+
+func (cdkContextFormat) Detect(file string, _ []byte) bool { return isCDKContextFile(file) }
+
+func (cdkContextFormat) FindAMIs(string, []byte) ([]Span, error) { return []Span{}, nil }
+
+// tfvarsFormat replaces AMI IDs within the variable values of Terraform
+// variable definitions files.
+type tfvarsFormat struct{ spanReplacer }
+
+func (tfvarsFormat) Name() string { return "tfvars" }
+
+func (tfvarsFormat) Detect(file string, _ []byte) bool { return isTFVarsFile(file) }
+
+func (tfvarsFormat) FindAMIs(file string, content []byte) ([]Span, error) {
+	spans, err := tfvarsSpans(content, file)
+
+	return exportAddressedSpans(spans), err
+}
+
+func (tfvarsFormat) Replace(content []byte, spans []Span, replacements []aws.AMIReplacement) (Replaced, error) {
+	result := ReplaceSpans(content, spans, replacements)
+	result.Variables = changedAddresses(result.Changed)
+
+	return result, nil
+}
+
+// packerFormat replaces AMI IDs within the source_ami values of Packer
+// templates.
+type packerFormat struct{ spanReplacer }
+
+func (packerFormat) Name() string { return "packer" }
+
+func (packerFormat) Detect(file string, _ []byte) bool { return isPackerFile(file) }
+
+func (packerFormat) FindAMIs(file string, content []byte) ([]Span, error) {
+	spans, _, err := packerSpans(content, file)
+
+	return exportAddressedSpans(spans), err
+}
+
+// ansibleFormat replaces AMI IDs within the usages Ansible playbooks and
+// roles make of them.
+type ansibleFormat struct{ spanReplacer }
+
+func (ansibleFormat) Name() string { return "ansible" }
+
+func (ansibleFormat) Detect(file string, _ []byte) bool { return isYAMLFile(file) }
+
+func (ansibleFormat) FindAMIs(file string, content []byte) ([]Span, error) {
+	spans, err := ansibleSpans(content, file)
+
+	return exportSpans(spans), err
+}
+
+// yamlKeysFormat replaces AMI IDs within the values under the configured key
+// paths of YAML files.
+type yamlKeysFormat struct {
+	spanReplacer
+
+	keyPaths []string
+}
+
+func (yamlKeysFormat) Name() string { return "yaml" }
+
+func (yamlKeysFormat) Detect(file string, _ []byte) bool { return isYAMLFile(file) }
+
+func (f yamlKeysFormat) FindAMIs(_ string, content []byte) ([]Span, error) {
+	spans, err := yamlSpans(content, f.keyPaths)
+
+	return exportSpans(spans), err
+}
+
+// hclFormat replaces AMI IDs within the expressions assigned to the
+// configured attributes of Terraform files.
+type hclFormat struct {
+	spanReplacer
+
+	attributes []string
+}
+
+func (hclFormat) Name() string { return "hcl" }
+
+func (hclFormat) Detect(file string, _ []byte) bool { return isHCLFile(file) }
+
+func (f hclFormat) FindAMIs(file string, content []byte) ([]Span, error) {
+	spans, err := hclSpans(content, file, f.attributes)
+
+	return exportAddressedSpans(spans), err
+}
+
+// plainFormat replaces AMI IDs anywhere in a file, except for the parts of
+// Karpenter EC2NodeClass resources outside their amiSelectorTerms IDs.
+type plainFormat struct{ spanReplacer }
+
+func (plainFormat) Name() string { return "plain" }
+
+func (plainFormat) Detect(string, []byte) bool { return true }
+
+func (plainFormat) FindAMIs(_ string, content []byte) ([]Span, error) {
+	nodeClassIDs, nodeClasses := karpenterSpans(content)
+	if len(nodeClasses) == 0 {
+		return nil, nil
+	}
+
+	return exportSpans(slices.Concat(nodeClassIDs, gapSpans(len(content), nodeClasses))), nil
+}
+
+func exportSpans(spans []span) []Span {
+	exported := make([]Span, 0, len(spans))
+	for _, s := range spans {
+		exported = append(exported, Span{Start: s.start, End: s.end, Region: s.region})
+	}
+
+	return exported
+}
+
+func exportAddressedSpans(spans []addressedSpan) []Span {
+	exported := make([]Span, 0, len(spans))
+	for _, s := range spans {
+		exported = append(exported, Span{Start: s.start, End: s.end, Address: s.address, Region: s.region})
+	}
+
+	return exported
+}
@@ -0,0 +1,181 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const gitignoreFile = ".gitignore"
+
+// SkippedDirs are the version control, dependency, and tool cache directories
+// that are never searched for AMI references.
+var SkippedDirs = []string{".git", ".hg", ".svn", "node_modules", "vendor", ".terraform", ".terragrunt-cache"}
+
+// ignoreRule is a pattern from a .gitignore file, relative to the directory
+// holding the file.
+type ignoreRule struct {
+	base    string
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+
+	// anchored rules match the whole path under base, others any name.
+	anchored bool
+}
+
+// gitignore collects the rules of the .gitignore files found while walking a
+// directory tree.
+type gitignore struct {
+	rules []ignoreRule
+}
+
+// SetGitignore makes directory walks skip the files and directories ignored
+// by .gitignore files under the walked directory.
+func (p *Processor) SetGitignore(enabled bool) {
+	p.gitignore = enabled
+}
+
+// load adds the rules of the .gitignore file in dir, whose path relative to
+// the walked directory is rel.
+func (g *gitignore) load(dir, rel string) {
+	file, err := os.Open(filepath.Join(dir, gitignoreFile))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		rule, ok := parseIgnoreRule(scanner.Text(), rel)
+		if ok {
+			g.rules = append(g.rules, rule)
+		}
+	}
+}
+
+// ignored reports whether a path relative to the walked directory is ignored.
+// As with git, the last matching rule wins.
+func (g *gitignore) ignored(rel string, isDir bool) bool {
+	ignored := false
+
+	for _, rule := range g.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		sub := rel
+		if rule.base != "." {
+			var ok bool
+			if sub, ok = strings.CutPrefix(rel, rule.base+"/"); !ok {
+				continue
+			}
+		}
+
+		if !rule.anchored {
+			sub = path.Base(sub)
+		}
+
+		if rule.pattern.MatchString(sub) {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
+
+func parseIgnoreRule(line, base string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " ")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	rule.anchored = strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	pattern, err := regexp.Compile("^" + globToRegex(line) + "$")
+	if err != nil {
+		return ignoreRule{}, false
+	}
+
+	rule.pattern = pattern
+
+	return rule, true
+}
+
+// globToRegex converts a .gitignore glob to a regular expression, where *
+// and ? do not match slashes and ** matches across directories.
+func globToRegex(glob string) string {
+	var builder strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			builder.WriteString("(.*/)?")
+
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**"):
+			builder.WriteString("(/.*)?")
+
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			builder.WriteString(".*")
+
+			i++
+		case glob[i] == '*':
+			builder.WriteString("[^/]*")
+		case glob[i] == '?':
+			builder.WriteString("[^/]")
+		case glob[i] == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				builder.WriteString(`\[`)
+
+				continue
+			}
+
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			builder.WriteString("[" + class + "]")
+
+			i += end
+		default:
+			builder.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+
+	return builder.String()
+}
+
+func isSkippedDir(name string) bool {
+	return slices.Contains(SkippedDirs, name)
+}
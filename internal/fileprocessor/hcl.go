@@ -0,0 +1,168 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// DefaultHCLAttributes are the Terraform attributes that hold AMI IDs.
+var DefaultHCLAttributes = []string{"ami", "image_id"}
+
+// addressedSpan is a span of an HCL attribute's expression along with the
+// Terraform address of the block it belongs to.
+type addressedSpan struct {
+	span
+
+	address string
+}
+
+// isHCLFile reports whether a file is processed as HCL when HCL mode is on.
+func isHCLFile(file string) bool {
+	return strings.EqualFold(filepath.Ext(file), ".tf")
+}
+
+// hclSpans returns the spans of the expressions assigned to the named
+// attributes anywhere in a Terraform file, including nested blocks, variable
+// defaults of variables with those names, and locals with those names.
+// Comments inside an expression are left out of its spans.
+func hclSpans(content []byte, file string, attributes []string) ([]addressedSpan, error) {
+	parsed, diagnostics := hclsyntax.ParseConfig(content, file, hcl.InitialPos)
+	if diagnostics.HasErrors() {
+		return nil, fmt.Errorf("failed to parse HCL: %w", diagnostics)
+	}
+
+	body, ok := parsed.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, nil
+	}
+
+	var spans []addressedSpan
+
+	for _, name := range sortedAttributeNames(body) {
+		if slices.Contains(attributes, name) {
+			spans = append(spans, expressionSpan(body.Attributes[name], name))
+		}
+	}
+
+	for _, block := range body.Blocks {
+		address := blockAddress(block)
+
+		switch {
+		case block.Type == "variable" && len(block.Labels) == 1 && slices.Contains(attributes, block.Labels[0]):
+			if attribute, ok := block.Body.Attributes["default"]; ok {
+				spans = append(spans, expressionSpan(attribute, address))
+			}
+		case block.Type == "locals":
+			for _, name := range sortedAttributeNames(block.Body) {
+				if slices.Contains(attributes, name) {
+					spans = append(spans, expressionSpan(block.Body.Attributes[name], "local."+name))
+				}
+			}
+		default:
+			spans = appendBlockSpans(spans, block.Body, address, attributes)
+		}
+	}
+
+	return withoutComments(content, file, spans), nil
+}
+
+func appendBlockSpans(spans []addressedSpan, body *hclsyntax.Body, address string, attributes []string,
+) []addressedSpan {
+	for _, name := range sortedAttributeNames(body) {
+		if slices.Contains(attributes, name) {
+			spans = append(spans, expressionSpan(body.Attributes[name], address))
+		}
+	}
+
+	for _, block := range body.Blocks {
+		spans = appendBlockSpans(spans, block.Body, address, attributes)
+	}
+
+	return spans
+}
+
+func sortedAttributeNames(body *hclsyntax.Body) []string {
+	names := make([]string, 0, len(body.Attributes))
+	for name := range body.Attributes {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+func expressionSpan(attribute *hclsyntax.Attribute, address string) addressedSpan {
+	exprRange := attribute.Expr.Range()
+
+	return addressedSpan{
+		span:    span{start: exprRange.Start.Byte, end: exprRange.End.Byte},
+		address: address,
+	}
+}
+
+// blockAddress returns the Terraform address of a top-level block, such as
+// aws_instance.web, data.aws_ami.base, module.app, or var.ami.
+func blockAddress(block *hclsyntax.Block) string {
+	switch block.Type {
+	case "resource":
+		return strings.Join(block.Labels, ".")
+	case "variable":
+		return "var." + strings.Join(block.Labels, ".")
+	default:
+		return strings.Join(append([]string{block.Type}, block.Labels...), ".")
+	}
+}
+
+// withoutComments splits spans around the comments inside them.
+func withoutComments(content []byte, file string, spans []addressedSpan) []addressedSpan {
+	tokens, _ := hclsyntax.LexConfig(content, file, hcl.InitialPos)
+
+	var comments []span
+
+	for _, token := range tokens {
+		if token.Type == hclsyntax.TokenComment {
+			comments = append(comments, span{start: token.Range.Start.Byte, end: token.Range.End.Byte})
+		}
+	}
+
+	if len(comments) == 0 {
+		return spans
+	}
+
+	result := make([]addressedSpan, 0, len(spans))
+
+	for _, s := range spans {
+		start := s.start
+
+		for _, comment := range comments {
+			if comment.end <= start || comment.start >= s.end {
+				continue
+			}
+
+			if comment.start > start {
+				result = append(result, addressedSpan{
+					span:    span{start: start, end: comment.start, region: s.region},
+					address: s.address,
+				})
+			}
+
+			start = comment.end
+		}
+
+		if start < s.end {
+			result = append(result, addressedSpan{span: span{start: start, end: s.end, region: s.region}, address: s.address})
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,166 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/logging"
+)
+
+var imageBuilderARNRegex = regexp.MustCompile(
+	`arn:aws[\w-]*:imagebuilder:[a-z0-9-]+:(?:\d{12}|aws):image(?:-recipe)?/[a-z0-9_-]+/[\dx]+\.[\dx]+\.[\dx]+(?:/\d+)?`)
+
+// ImageBuilderReference is the ARN of an EC2 Image Builder image or image
+// recipe in a file, such as the image ARN a Terraform data source reads the
+// AMIs of a pipeline from.
+type ImageBuilderReference struct {
+	File   string
+	Line   int
+	Column int
+	ARN    aws.ImageBuilderARN
+}
+
+// FindImageBuilderReferences returns the Image Builder ARNs in content.
+func FindImageBuilderReferences(file, content string) []ImageBuilderReference {
+	var references []ImageBuilderReference
+
+	for lineIndex, line := range strings.Split(content, "\n") {
+		for _, match := range imageBuilderARNRegex.FindAllStringIndex(line, -1) {
+			arn, err := aws.ParseImageBuilderARN(line[match[0]:match[1]])
+			if err != nil {
+				logging.Trace("Skipping Image Builder ARN", "file", file, "line", lineIndex+1, "error", err)
+
+				continue
+			}
+
+			references = append(references, ImageBuilderReference{
+				File:   file,
+				Line:   lineIndex + 1,
+				Column: match[0] + 1,
+				ARN:    arn,
+			})
+		}
+	}
+
+	return references
+}
+
+// ScanImageBuilderReferences returns the Image Builder ARNs in files and in
+// every file under directories.
+func (p *Processor) ScanImageBuilderReferences(paths ...string) ([]ImageBuilderReference, error) {
+	files, err := p.filesIn(paths, imageBuilderARNRegex.Match)
+	if err != nil {
+		return nil, err
+	}
+
+	var references []ImageBuilderReference
+
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			slog.Warn("Failed to read file", "file", file, "error", err)
+
+			continue
+		}
+
+		references = append(references, FindImageBuilderReferences(file, string(content))...)
+	}
+
+	return references, nil
+}
+
+// RewriteImageBuilderReferences replaces the Image Builder ARNs in the files
+// of references with their latest versions in latest, keyed by ARN.
+func (p *Processor) RewriteImageBuilderReferences(ctx context.Context, references []ImageBuilderReference,
+	latest map[string]string,
+) ([]FileResult, error) {
+	var files []string
+
+	seen := make(map[string]bool)
+
+	for _, reference := range references {
+		if latest[reference.ARN.String()] != "" && !seen[reference.File] {
+			seen[reference.File] = true
+			files = append(files, reference.File)
+		}
+	}
+
+	results := make([]FileResult, 0, len(files))
+
+	for _, file := range files {
+		err := ctx.Err()
+		if err != nil {
+			return results, fmt.Errorf("processing cancelled: %w", err)
+		}
+
+		result, err := p.rewriteImageBuilderFile(file, latest)
+		if err != nil {
+			slog.Warn("Failed to rewrite Image Builder ARNs", "file", file, "error", err)
+
+			results = append(results, FileResult{Path: file, Err: err})
+
+			continue
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func (p *Processor) rewriteImageBuilderFile(file string, latest map[string]string) (FileResult, error) {
+	result := FileResult{Path: file}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return result, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	count := 0
+
+	newContent := imageBuilderARNRegex.ReplaceAllStringFunc(string(content), func(arn string) string {
+		newARN, ok := latest[arn]
+		if !ok || newARN == arn {
+			return arn
+		}
+
+		count++
+
+		return newARN
+	})
+
+	if count == 0 {
+		logging.Trace("No Image Builder ARNs to update", "file", file)
+
+		return result, nil
+	}
+
+	result.BackupPath, err = p.updateFileWithBackup(file, content, newContent)
+	if errors.Is(err, ErrNotConfirmed) {
+		p.skippedUpdate(file)
+
+		result.Skipped = true
+
+		return result, nil
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	result.Count = count
+
+	p.logUpdate("Updated Image Builder ARNs", file, result.BackupPath, "count", count)
+
+	return result, nil
+}
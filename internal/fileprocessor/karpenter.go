@@ -0,0 +1,169 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+const karpenterNodeClassKind = "EC2NodeClass"
+
+// karpenterSelectorKeys are the amiSelectorTerms fields that select AMIs
+// without naming them, in the order they are reported.
+var karpenterSelectorKeys = []string{"alias", "name", "owner", "ssmParameter", "tags"}
+
+// nodeClassTerm is an amiSelectorTerms entry of an EC2NodeClass.
+type nodeClassTerm struct {
+	node *yaml.Node
+	id   *yaml.Node
+}
+
+// karpenterSpans returns the spans of the explicit amiSelectorTerms[].id values
+// of the EC2NodeClass resources in a Kubernetes manifest, along with the spans
+// of those resources' documents so that nothing else in them is rewritten.
+func karpenterSpans(content []byte) ([]span, []span) {
+	var ids, documents []span
+
+	lines := newLineIndex(content)
+
+	forEachNodeClass(content, func(document span, terms []nodeClassTerm) {
+		documents = append(documents, document)
+
+		for _, term := range terms {
+			if term.id != nil && term.id.Kind == yaml.ScalarNode {
+				ids = append(ids, scalarSpan(term.id, lines))
+			}
+		}
+	})
+
+	return ids, documents
+}
+
+// findKarpenterSelectors returns the amiSelectorTerms of the EC2NodeClass
+// resources in content that select AMIs by alias, name, owner, SSM parameter,
+// or tags rather than by ID.
+func findKarpenterSelectors(file string, content []byte) []DynamicReference {
+	var references []DynamicReference
+
+	forEachNodeClass(content, func(_ span, terms []nodeClassTerm) {
+		for _, term := range terms {
+			if term.id != nil {
+				continue
+			}
+
+			selector := describeSelectorTerm(term.node)
+			if selector == "" {
+				continue
+			}
+
+			references = append(references, DynamicReference{
+				File:   file,
+				Line:   term.node.Line,
+				Column: term.node.Column,
+				Kind:   DynamicKarpenter,
+				Name:   selector,
+			})
+		}
+	})
+
+	return references
+}
+
+// forEachNodeClass calls fn with the document span and amiSelectorTerms of
+// every EC2NodeClass in a manifest. Content that is not YAML has none.
+func forEachNodeClass(content []byte, fn func(document span, terms []nodeClassTerm)) {
+	if !bytes.Contains(content, []byte(karpenterNodeClassKind)) {
+		return
+	}
+
+	lines := newLineIndex(content)
+	decoder := yaml.NewDecoder(strings.NewReader(string(content)))
+
+	var roots []*yaml.Node
+
+	for {
+		var document yaml.Node
+
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return
+		}
+
+		if len(document.Content) > 0 {
+			roots = append(roots, document.Content[0])
+		}
+	}
+
+	for i, root := range roots {
+		kind := mappingValue([]*yaml.Node{root}, "kind")
+		if kind == nil || kind.Value != karpenterNodeClassKind {
+			continue
+		}
+
+		document := span{start: lines.offset(root.Line, 1), end: len(content)}
+		if i+1 < len(roots) {
+			document.end = lines.offset(roots[i+1].Line, 1)
+		}
+
+		var terms []nodeClassTerm
+
+		spec := mappingValue([]*yaml.Node{root}, "spec")
+		if spec != nil {
+			selectorTerms := mappingValue([]*yaml.Node{spec}, "amiSelectorTerms")
+			for _, term := range sequenceItems(selectorTerms) {
+				terms = append(terms, nodeClassTerm{node: term, id: mappingValue([]*yaml.Node{term}, "id")})
+			}
+		}
+
+		fn(document, terms)
+	}
+}
+
+func sequenceItems(node *yaml.Node) []*yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	return node.Content
+}
+
+// describeSelectorTerm describes a selector term, such as alias:al2023@latest
+// or name:golden-*,owner:self.
+func describeSelectorTerm(term *yaml.Node) string {
+	var parts []string
+
+	for _, key := range karpenterSelectorKeys {
+		value := mappingValue([]*yaml.Node{term}, key)
+
+		switch {
+		case value == nil:
+		case value.Kind == yaml.MappingNode:
+			tags := make(map[string]string)
+			for i := 0; i+1 < len(value.Content); i += 2 {
+				tags[value.Content[i].Value] = value.Content[i+1].Value
+			}
+
+			for _, tag := range slices.Sorted(maps.Keys(tags)) {
+				parts = append(parts, fmt.Sprintf("%s:%s=%s", key, tag, tags[tag]))
+			}
+		default:
+			parts = append(parts, key+":"+value.Value)
+		}
+	}
+
+	return strings.Join(parts, ",")
+}
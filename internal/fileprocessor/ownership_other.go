@@ -0,0 +1,12 @@
+//go:build !unix
+
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import "io/fs"
+
+// preserveOwnership does nothing on platforms without Unix file ownership.
+func preserveOwnership(string, fs.FileInfo) {}
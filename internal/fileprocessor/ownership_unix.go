@@ -0,0 +1,28 @@
+//go:build unix
+
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// preserveOwnership gives file the owner and group of info. Unprivileged
+// processes can usually only keep the group, and failing to keep either is
+// not an error.
+func preserveOwnership(file string, info fs.FileInfo) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+
+	err := os.Lchown(file, int(stat.Uid), int(stat.Gid))
+	if err != nil {
+		_ = os.Lchown(file, -1, int(stat.Gid))
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/json"
+)
+
+var (
+	packerFileSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "source", LabelNames: []string{"type", "name"}}},
+	}
+	packerSourceSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "source_ami"}, {Name: "region"}},
+		Blocks:     []hcl.BlockHeaderSchema{{Type: "source_ami_filter"}},
+	}
+)
+
+// PackerSourceFilter is a source_ami_filter block of a Packer template.
+type PackerSourceFilter struct {
+	File string
+	Line int
+
+	// Source is the address of the source the filter belongs to, such as
+	// source.amazon-ebs.base.
+	Source string
+
+	// Region is the region the source builds in, when it is set literally.
+	Region string
+
+	aws.SourceAMIFilter
+}
+
+type sourceAMIFilterBlock struct {
+	Filters    map[string]string `hcl:"filters,optional"`
+	Owners     []string          `hcl:"owners,optional"`
+	MostRecent bool              `hcl:"most_recent,optional"`
+	Remain     hcl.Body          `hcl:",remain"`
+}
+
+// isPackerFile reports whether a file is a Packer template, in HCL or JSON
+// syntax.
+func isPackerFile(file string) bool {
+	name := strings.ToLower(file)
+
+	return strings.HasSuffix(name, ".pkr.hcl") || strings.HasSuffix(name, ".pkr.json")
+}
+
+// packerSpans returns the spans of the source_ami values of the sources in a
+// Packer template, addressed by source, along with their source_ami_filter
+// blocks. AMI IDs inside a filter are never part of a span: the filter selects
+// its image when Packer runs, so it is resolved rather than rewritten.
+func packerSpans(content []byte, file string) ([]addressedSpan, []PackerSourceFilter, error) {
+	isJSON := strings.HasSuffix(strings.ToLower(file), ".json")
+
+	var (
+		parsed      *hcl.File
+		diagnostics hcl.Diagnostics
+	)
+
+	if isJSON {
+		parsed, diagnostics = json.Parse(content, file)
+	} else {
+		parsed, diagnostics = hclsyntax.ParseConfig(content, file, hcl.InitialPos)
+	}
+
+	if diagnostics.HasErrors() {
+		return nil, nil, fmt.Errorf("failed to parse Packer template: %w", diagnostics)
+	}
+
+	fileContent, _, diagnostics := parsed.Body.PartialContent(packerFileSchema)
+	if diagnostics.HasErrors() {
+		return nil, nil, fmt.Errorf("failed to parse Packer template: %w", diagnostics)
+	}
+
+	var (
+		spans   []addressedSpan
+		filters []PackerSourceFilter
+	)
+
+	for _, block := range fileContent.Blocks {
+		address := "source." + strings.Join(block.Labels, ".")
+
+		sourceContent, _, diagnostics := block.Body.PartialContent(packerSourceSchema)
+		if diagnostics.HasErrors() {
+			return nil, nil, fmt.Errorf("failed to parse %s: %w", address, diagnostics)
+		}
+
+		if attribute, ok := sourceContent.Attributes["source_ami"]; ok {
+			exprRange := attribute.Expr.Range()
+			spans = append(spans, addressedSpan{
+				span:    span{start: exprRange.Start.Byte, end: exprRange.End.Byte},
+				address: address,
+			})
+		}
+
+		var region string
+		if attribute, ok := sourceContent.Attributes["region"]; ok {
+			// A region taken from a variable is left empty
+			_ = gohcl.DecodeExpression(attribute.Expr, nil, &region)
+		}
+
+		for _, filterBlock := range sourceContent.Blocks {
+			var decoded sourceAMIFilterBlock
+
+			diagnostics := gohcl.DecodeBody(filterBlock.Body, nil, &decoded)
+			if diagnostics.HasErrors() {
+				slog.Warn("Cannot read source_ami_filter", "file", file, "line", filterBlock.DefRange.Start.Line,
+					"source", address, "error", diagnostics)
+
+				continue
+			}
+
+			filters = append(filters, PackerSourceFilter{
+				File:   file,
+				Line:   filterBlock.DefRange.Start.Line,
+				Source: address,
+				Region: region,
+				SourceAMIFilter: aws.SourceAMIFilter{
+					Filters:    decoded.Filters,
+					Owners:     decoded.Owners,
+					MostRecent: decoded.MostRecent,
+				},
+			})
+		}
+	}
+
+	if !isJSON {
+		spans = withoutComments(content, file, spans)
+	}
+
+	return spans, filters, nil
+}
+
+// FindPackerSourceFilters returns the source_ami_filter blocks of the Packer
+// templates among files and under directories.
+func (p *Processor) FindPackerSourceFilters(paths ...string) ([]PackerSourceFilter, error) {
+	files, err := p.filesIn(paths, containsSourceAMIFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	var filters []PackerSourceFilter
+
+	for _, file := range files {
+		if !isPackerFile(file) {
+			continue
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			slog.Warn("Failed to read file", "file", file, "error", err)
+
+			continue
+		}
+
+		_, fileFilters, err := packerSpans(content, file)
+		if err != nil {
+			slog.Warn("Failed to parse file", "file", file, "error", err)
+
+			continue
+		}
+
+		filters = append(filters, fileFilters...)
+	}
+
+	return filters, nil
+}
+
+func containsSourceAMIFilter(content []byte) bool {
+	return bytes.Contains(content, []byte("source_ami_filter"))
+}
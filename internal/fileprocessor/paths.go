@@ -0,0 +1,88 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var ErrNoMatchingPaths = errors.New("pattern matches no files or directories")
+
+// ExpandPaths returns the files and directories named by paths, which may be
+// glob patterns such as envs/*/main.tf. Every path must exist and every
+// pattern must match something. Paths named more than once are returned once,
+// in the order they are first named.
+func ExpandPaths(paths []string) ([]string, error) {
+	var expanded []string
+
+	for _, path := range paths {
+		matches := []string{path}
+
+		if strings.ContainsAny(path, "*?[") {
+			var err error
+
+			matches, err = filepath.Glob(path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %w", path, err)
+			}
+
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%w: %s", ErrNoMatchingPaths, path)
+			}
+		}
+
+		for _, match := range matches {
+			_, err := os.Stat(match)
+			if err != nil {
+				return nil, fmt.Errorf("file path does not exist: %w", err)
+			}
+
+			match = filepath.Clean(match)
+			if !slices.Contains(expanded, match) {
+				expanded = append(expanded, match)
+			}
+		}
+	}
+
+	return expanded, nil
+}
+
+// filesIn returns the files named by paths: each file itself, and the files
+// under each directory whose content satisfies match. A file found through
+// more than one path is returned once.
+func (p *Processor) filesIn(paths []string, match func(content []byte) bool) ([]string, error) {
+	var files []string
+
+	seen := make(map[string]bool)
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+
+		found := []string{path}
+		if info.IsDir() {
+			found, err = p.collectFilesMatching(path, match)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, file := range found {
+			if !seen[filepath.Clean(file)] {
+				seen[filepath.Clean(file)] = true
+				files = append(files, file)
+			}
+		}
+	}
+
+	return files, nil
+}
@@ -5,75 +5,297 @@ Copyright © 2025 Ben Sapp ya.bsapp.ru
 package fileprocessor
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/logging"
+	"github.com/schnauzersoft/ami-util/internal/progress"
+	"github.com/schnauzersoft/ami-util/internal/tracing"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 const (
-	FilePerm = 0o600
+	FilePerm      = 0o600
+	BackupDirPerm = 0o700
+	BackupSuffix  = ".backup"
 )
 
+type Decision int
+
+const (
+	DecisionAccept Decision = iota
+	DecisionSkip
+	DecisionAcceptAll
+	DecisionQuit
+)
+
+// DecisionFunc is consulted once for each pair of old and new AMI that affects
+// at least one file before it is applied, with the replacements of the pair,
+// such as those found in different accounts or regions.
+type DecisionFunc func(replacements []aws.AMIReplacement, files []string) (Decision, error)
+
+// ConfirmFunc is consulted with the unified diff of each file before it is
+// written. DecisionQuit leaves this and every later file unwritten.
+type ConfirmFunc func(file, diff string) (Decision, error)
+
+type FileReference struct {
+	File string
+	aws.AMIReference
+
+	// Address is the Terraform address of the block referencing the AMI, set
+	// in HCL mode for references in matched attributes, the variable name for
+	// references in .tfvars files, or the source for references in Packer
+	// templates.
+	Address string
+
+	// Region is the region of the innermost region scope the reference lies
+	// in, if any.
+	Region string
+}
+
+// FileResult describes the outcome of processing a single file.
+type FileResult struct {
+	Path         string
+	BackupPath   string
+	Count        int
+	Replacements []aws.AMIReplacement
+
+	// Variables are the names of the variables whose values changed, for
+	// Terraform variable definitions files.
+	Variables []string
+
+	// Skipped is set when the update of the file was not confirmed, and Err
+	// when the file could not be processed. Neither file is changed.
+	Skipped bool
+	Err     error
+}
+
 type Processor struct {
-	verbose bool
+	decide   DecisionFunc
+	backedUp map[string]bool
+	yamlKeys []string
+
+	hclAttributes []string
+	formats       []FormatHandler
+
+	manageCDKContext bool
+	ansible          bool
+	gitignore        bool
+	maxDepth         int
+	followSymlinks   bool
+	workers          int
+	noBackup         bool
+	backupDir        string
+	backupKeep       int
+	backupStamp      string
+	diffOut          io.Writer
+	diffColor        bool
+	diffOnly         bool
+	confirm          ConfirmFunc
+	fileRegions      []FileRegion
+	provenance       bool
+	provenanceDate   string
+
+	// backedUpMu guards backedUp, which workers update concurrently, diffMu
+	// the diffs they print, confirmMu the confirmation prompts along with
+	// confirmAll and confirmQuit, and decideMu the replacement decisions
+	// along with decided and decideAll.
+	backedUpMu  sync.Mutex
+	diffMu      sync.Mutex
+	confirmMu   sync.Mutex
+	confirmAll  bool
+	confirmQuit bool
+	decideMu    sync.Mutex
+	decided     map[string]bool
+	decideAll   bool
 }
 
-func NewProcessor(verbose bool) *Processor {
+func NewProcessor() *Processor {
 	return &Processor{
-		verbose: verbose,
+		backedUp: make(map[string]bool),
+		workers:  1,
 	}
 }
 
-func (p *Processor) ProcessFile(filePath string, replacements []aws.AMIReplacement) error {
-	content, err := os.ReadFile(filePath)
+// SetWorkers sets how many files are processed concurrently when processing
+// a directory.
+func (p *Processor) SetWorkers(workers int) {
+	p.workers = workers
+}
+
+func (p *Processor) SetDecisionFunc(decide DecisionFunc) {
+	p.decide = decide
+}
+
+// SetYAMLKeys limits replacements in YAML files to the values under the given
+// key paths, leaving comments and every other value untouched.
+func (p *Processor) SetYAMLKeys(keyPaths []string) {
+	p.yamlKeys = keyPaths
+}
+
+func (p *Processor) ProcessFile(ctx context.Context, filePath string, replacements []aws.AMIReplacement,
+) ([]FileResult, error) {
+	replacements, err := p.approveReplacements([]string{filePath}, replacements)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ctx.Err()
+	if err != nil {
+		return nil, fmt.Errorf("processing cancelled: %w", err)
+	}
+
+	result, err := p.traceFile(ctx, filePath, replacements)
 	if err != nil {
-		return fmt.Errorf("failed to read file %s: %w", filePath, err)
+		return nil, fmt.Errorf("failed to process %s: %w", filePath, err)
 	}
 
-	originalContent := string(content)
-	newContent, replaceCount := aws.ReplaceAMIsInContent(originalContent, replacements)
+	logTotals([]FileResult{result}, 1)
 
-	if replaceCount == 0 {
-		if p.verbose {
-			log.Printf("No AMI replacements needed in %s", filePath)
+	return []FileResult{result}, nil
+}
+
+// ProcessPaths processes files and every file under directories that contains
+// an AMI ID. A single file is processed like ProcessFile, failing if it fails;
+// otherwise files that fail are reported and skipped.
+func (p *Processor) ProcessPaths(ctx context.Context, paths []string, replacements []aws.AMIReplacement,
+) ([]FileResult, error) {
+	if len(paths) == 1 {
+		info, err := os.Stat(paths[0])
+		if err == nil && !info.IsDir() {
+			return p.ProcessFile(ctx, paths[0], replacements)
 		}
+	}
 
-		return nil
+	replacements, err := p.approveReplacements(paths, replacements)
+	if err != nil {
+		return nil, err
 	}
 
-	backupPath := filePath + ".backup"
+	files, err := p.filesIn(paths, aws.ContainsAMI)
+	if err != nil {
+		return nil, err
+	}
 
-	err = os.WriteFile(backupPath, content, FilePerm)
+	results, err := p.processFiles(ctx, files, replacements)
 	if err != nil {
-		return fmt.Errorf("failed to create backup file: %w", err)
+		slog.Warn("Interrupted", "replacements", totalReplacements(results), "processed_files", len(results),
+			"files", len(files))
+
+		return results, err
 	}
 
-	err = os.WriteFile(filePath, []byte(newContent), FilePerm)
+	logTotals(results, len(files))
+
+	return results, nil
+}
+
+// logTotals logs the summary of processing files: the replacements made, and
+// how many of the files they updated.
+func logTotals(results []FileResult, files int) {
+	updatedFiles := 0
+
+	for _, result := range results {
+		if result.Count > 0 {
+			updatedFiles++
+		}
+	}
+
+	slog.Info("Total AMI replacements made", "replacements", totalReplacements(results),
+		"updated_files", updatedFiles, "files", files)
+}
+
+func totalReplacements(results []FileResult) int {
+	total := 0
+	for _, result := range results {
+		total += result.Count
+	}
+
+	return total
+}
+
+// FindBackups returns the backups of the file at path, or the backups under
+// the directory at path, skipping the directories a scan skips, that are at
+// least olderThan old.
+func (p *Processor) FindBackups(path string, olderThan time.Duration) ([]string, error) {
+	info, err := os.Stat(path)
 	if err != nil {
-		return fmt.Errorf("failed to write updated file: %w", err)
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
 	}
 
-	log.Printf("Updated %d AMI references in %s (backup created at %s)", replaceCount, filePath, backupPath)
+	var files []string
 
-	return nil
+	if info.IsDir() {
+		err = p.walkFiles(path, func(file string) {
+			files = append(files, file)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk %s: %w", path, err)
+		}
+	} else {
+		files, err = siblingBackups(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var backups []string
+
+	for _, file := range files {
+		if !isBackupFile(file) {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			slog.Warn("Failed to stat backup", "path", file, "error", err)
+
+			continue
+		}
+
+		if olderThan > 0 && time.Since(info.ModTime()) < olderThan {
+			continue
+		}
+
+		backups = append(backups, file)
+	}
+
+	return backups, nil
 }
 
-func (p *Processor) ProcessDirectory(dirPath string, replacements []aws.AMIReplacement) error {
-	files, err := p.collectFiles(dirPath)
+// siblingBackups returns the files named <file>.backup* next to file, as a
+// glob would without reading the characters of file as a pattern.
+func siblingBackups(file string) ([]string, error) {
+	dir := filepath.Dir(file)
+
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to read directory %s: %w", dir, err)
 	}
 
-	totalReplacements := p.processFiles(files, replacements)
+	prefix := filepath.Base(file) + BackupSuffix
+
+	var files []string
 
-	log.Printf("Total AMI replacements made: %d across %d files", totalReplacements, len(files))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), prefix) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
 
-	return nil
+	return files, nil
 }
 
 func (p *Processor) FindAMIsInFile(filePath string) ([]string, error) {
@@ -85,23 +307,177 @@ func (p *Processor) FindAMIsInFile(filePath string) ([]string, error) {
 	return aws.ExtractAMIPatterns(string(content)), nil
 }
 
-func (p *Processor) collectFiles(dirPath string) ([]string, error) {
-	var files []string
+// ScanPath returns the AMI references in files and in every file under
+// directories.
+func (p *Processor) ScanPath(paths ...string) ([]FileReference, error) {
+	files, err := p.filesIn(paths, aws.ContainsAMI)
+	if err != nil {
+		return nil, err
+	}
+
+	var references []FileReference
 
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	for _, file := range files {
+		content, err := os.ReadFile(file)
 		if err != nil {
-			return err
+			slog.Warn("Failed to read file", "file", file, "error", err)
+
+			continue
 		}
 
-		if info.IsDir() || strings.HasSuffix(path, ".backup") {
-			return nil
+		addresses := p.referenceAddresses(file, content)
+		scopes := p.regionScopes(file, content)
+		lines := newLineIndex(content)
+
+		for _, ref := range aws.FindAMIReferences(string(content)) {
+			offset := lines.offset(ref.Line, 1) + ref.Column - 1
+
+			references = append(references, FileReference{
+				File:         file,
+				AMIReference: ref,
+				Address:      addresses(ref),
+				Region:       innermostRegion(scopes, offset, offset+len(ref.AMI)),
+			})
 		}
+	}
 
-		if p.isTextFile(path) {
-			files = append(files, path)
+	return references, nil
+}
+
+// referenceAddresses returns a function giving the Terraform address of a
+// reference in file, or an empty address outside .tfvars files, Packer
+// templates, HCL mode, and matched attributes.
+func (p *Processor) referenceAddresses(file string, content []byte) func(aws.AMIReference) string {
+	spans, err := p.handlerFor(file, content).FindAMIs(file, content)
+	if err != nil {
+		slog.Warn("Failed to parse file", "file", file, "error", err)
+	}
+
+	if !slices.ContainsFunc(spans, func(s Span) bool { return s.Address != "" }) {
+		return func(aws.AMIReference) string { return "" }
+	}
+
+	lines := newLineIndex(content)
+
+	return func(ref aws.AMIReference) string {
+		// Reference columns are byte-based, unlike parser columns
+		offset := lines.offset(ref.Line, 1) + ref.Column - 1
+
+		for _, s := range spans {
+			if offset >= s.Start && offset < s.End {
+				return s.Address
+			}
+		}
+
+		return ""
+	}
+}
+
+func FilesByAMI(references []FileReference) map[string][]string {
+	seen := make(map[string]map[string]bool)
+	filesByAMI := make(map[string][]string)
+
+	for _, ref := range references {
+		if seen[ref.AMI] == nil {
+			seen[ref.AMI] = make(map[string]bool)
+		}
+
+		if !seen[ref.AMI][ref.File] {
+			seen[ref.AMI][ref.File] = true
+			filesByAMI[ref.AMI] = append(filesByAMI[ref.AMI], ref.File)
+		}
+	}
+
+	for _, files := range filesByAMI {
+		sort.Strings(files)
+	}
+
+	return filesByAMI
+}
+
+func (p *Processor) approveReplacements(paths []string, replacements []aws.AMIReplacement,
+) ([]aws.AMIReplacement, error) {
+	if p.decide == nil {
+		return replacements, nil
+	}
+
+	references, err := p.ScanPath(paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	filesByAMI := FilesByAMI(references)
+
+	pairs := make(map[string][]aws.AMIReplacement)
+	for _, replacement := range replacements {
+		key := replacement.OldAMI + " " + replacement.NewAMI
+		pairs[key] = append(pairs[key], replacement)
+	}
+
+	approved := make([]aws.AMIReplacement, 0, len(replacements))
+
+	// Decisions are kept for the whole run, so that a pair replaced in
+	// several targets is only asked about once
+	p.decideMu.Lock()
+	defer p.decideMu.Unlock()
+
+	if p.decided == nil {
+		p.decided = make(map[string]bool)
+	}
+
+	for _, replacement := range replacements {
+		files := filesByAMI[replacement.OldAMI]
+		if len(files) == 0 {
+			continue
 		}
 
-		return nil
+		key := replacement.OldAMI + " " + replacement.NewAMI
+
+		// The replacements of a pair share the decision made for the first
+		decided, ok := p.decided[key]
+		if !ok {
+			decided = p.decideAll
+
+			if !p.decideAll {
+				decision, err := p.decide(pairs[key], files)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get decision for %s: %w", replacement.OldAMI, err)
+				}
+
+				p.decideAll = decision == DecisionAcceptAll
+				decided = decision == DecisionAccept || p.decideAll
+			}
+
+			p.decided[key] = decided
+		}
+
+		if !decided {
+			slog.Debug("Skipping replacement", "old_ami", replacement.OldAMI, "new_ami", replacement.NewAMI,
+				"region", replacement.Region)
+
+			continue
+		}
+
+		approved = append(approved, replacement)
+	}
+
+	return approved, nil
+}
+
+// collectFilesMatching returns the files under dirPath, other than backups,
+// whose content satisfies match.
+func (p *Processor) collectFilesMatching(dirPath string, match func(content []byte) bool) ([]string, error) {
+	var files []string
+
+	err := p.walkFiles(dirPath, func(path string) {
+		if isBackupFile(path) {
+			return
+		}
+
+		content, err := os.ReadFile(path)
+		if err == nil && match(content) {
+			files = append(files, path)
+		}
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to walk directory %s: %w", dirPath, err)
@@ -110,69 +486,232 @@ func (p *Processor) collectFiles(dirPath string) ([]string, error) {
 	return files, nil
 }
 
-func (p *Processor) processFiles(files []string, replacements []aws.AMIReplacement) int {
-	totalReplacements := 0
+// processFiles processes files using at most the configured number of
+// workers, returning the results of the files processed in the same order as
+// files, including those of files that failed. Cancellation is checked
+// between files, so a file that is being written is always finished before
+// stopping.
+func (p *Processor) processFiles(ctx context.Context, files []string, replacements []aws.AMIReplacement,
+) ([]FileResult, error) {
+	type outcome struct {
+		result FileResult
+		done   bool
+	}
 
-	for _, file := range files {
-		replaceCount, err := p.processSingleFile(file, replacements)
-		if err != nil {
-			log.Printf("Warning: failed to process file %s: %v", file, err)
+	outcomes := make([]outcome, len(files))
+	indexes := make(chan int)
 
-			continue
+	workers := min(max(p.workers, 1), len(files))
+
+	phase := progress.Start("Processing files", "files", len(files))
+
+	var wg sync.WaitGroup
+
+	for range workers {
+		wg.Go(func() {
+			for index := range indexes {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				result, err := p.traceFile(ctx, files[index], replacements)
+				if err != nil {
+					slog.Warn("Failed to process file", "file", files[index], "error", err)
+
+					result = FileResult{Path: files[index], Err: err}
+				}
+
+				outcomes[index] = outcome{result: result, done: true}
+
+				if result.Count > 0 {
+					phase.StepUpdated()
+				} else {
+					phase.Step()
+				}
+			}
+		})
+	}
+
+	for index := range files {
+		indexes <- index
+	}
+
+	close(indexes)
+	wg.Wait()
+	phase.Finish()
+
+	results := make([]FileResult, 0, len(files))
+
+	for _, outcome := range outcomes {
+		if outcome.done {
+			results = append(results, outcome.result)
 		}
+	}
 
-		totalReplacements += replaceCount
+	err := ctx.Err()
+	if err != nil {
+		return results, fmt.Errorf("processing cancelled: %w", err)
 	}
 
-	return totalReplacements
+	return results, nil
+}
+
+// traceFile processes a single file in a span of the run's trace.
+func (p *Processor) traceFile(ctx context.Context, file string, replacements []aws.AMIReplacement,
+) (FileResult, error) {
+	_, span := tracing.Start(ctx, "Process file", semconv.FilePath(file))
+
+	result, err := p.processSingleFile(file, replacements)
+	span.SetAttributes(tracing.ReplacementsKey.Int(result.Count))
+	tracing.End(span, err)
+
+	return result, err
 }
 
-func (p *Processor) processSingleFile(file string, replacements []aws.AMIReplacement) (int, error) {
+func (p *Processor) processSingleFile(file string, replacements []aws.AMIReplacement) (FileResult, error) {
+	result := FileResult{Path: file}
+
 	content, err := os.ReadFile(file)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read file: %w", err)
+		return result, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	replaced, err := p.replaceAMIs(file, content, replacements)
+	if err != nil {
+		return result, err
 	}
 
-	originalContent := string(content)
-	newContent, replaceCount := aws.ReplaceAMIsInContent(originalContent, replacements)
+	if replaced.Count > 0 {
+		newContent := replaced.Content
+		if p.provenance {
+			newContent = p.annotateProvenance(file, string(content), newContent, replaced)
+		}
+
+		backupPath, err := p.updateFileWithBackup(file, content, newContent)
+		if errors.Is(err, ErrNotConfirmed) {
+			p.skippedUpdate(file)
+
+			result.Skipped = true
+
+			return result, nil
+		}
 
-	if replaceCount > 0 {
-		err := p.updateFileWithBackup(file, content, newContent)
 		if err != nil {
-			return 0, err
+			return result, err
 		}
 
-		log.Printf("Updated %d AMI references in %s (backup created at %s)", replaceCount, file, file+".backup")
-	} else if p.verbose {
-		log.Printf("No AMI replacements needed in %s", file)
+		result.BackupPath = backupPath
+		result.Count = replaced.Count
+		result.Replacements = replaced.Replacements
+		result.Variables = replaced.Variables
+
+		p.logUpdate("Updated AMI references", file, backupPath, "count", replaced.Count)
+
+		if len(replaced.Variables) > 0 {
+			logging.Trace("Updated variables", "file", file, "variables", replaced.Variables)
+		}
+	} else {
+		logging.Trace("No AMI replacements needed", "file", file)
 	}
 
-	return replaceCount, nil
+	return result, nil
 }
 
-func (p *Processor) updateFileWithBackup(file string, originalContent []byte, newContent string) error {
-	backupPath := file + ".backup"
+// SetHCLAttributes limits replacements in Terraform files to the expressions
+// assigned to the named attributes, leaving comments and every other
+// expression untouched.
+func (p *Processor) SetHCLAttributes(attributes []string) {
+	p.hclAttributes = attributes
+}
 
-	err := os.WriteFile(backupPath, originalContent, FilePerm)
+// replaceAMIs applies replacements to a file's content within the spans the
+// handler of its format finds: variable values for .tfvars files, source_ami
+// values for Packer templates, Ansible usages or the configured key paths for
+// YAML files, the configured attributes for Terraform files, and the
+// amiSelectorTerms IDs of Karpenter EC2NodeClass resources. Parts of the file
+// within a region scope only receive replacements for that region, including
+// cross-region ones, while the rest only receives in-place replacements.
+func (p *Processor) replaceAMIs(file string, content []byte, replacements []aws.AMIReplacement) (Replaced, error) {
+	handler := p.handlerFor(file, content)
+	logging.Trace("Replacing AMIs", "file", file, "format", handler.Name())
+
+	spans, err := handler.FindAMIs(file, content)
 	if err != nil {
-		return fmt.Errorf("failed to create backup: %w", err)
+		return Replaced{}, err
+	}
+
+	scopes := p.regionScopes(file, content)
+	if spans == nil && len(scopes) > 0 {
+		spans = []Span{{Start: 0, End: len(content)}}
 	}
 
-	err = os.WriteFile(file, []byte(newContent), FilePerm)
+	if spans != nil {
+		spans = scopeFormatSpans(spans, scopes)
+	}
+
+	result, err := handler.Replace(content, spans, replacements)
 	if err != nil {
-		return fmt.Errorf("failed to write updated file: %w", err)
+		return Replaced{}, fmt.Errorf("failed to replace AMIs in %s file: %w", handler.Name(), err)
 	}
 
-	return nil
+	return result, nil
 }
 
-func (p *Processor) isTextFile(filePath string) bool {
-	content, err := os.ReadFile(filePath)
+// scopeFormatSpans scopes spans found by a format handler, keeping the
+// address of each part.
+func scopeFormatSpans(spans []Span, scopes []span) []Span {
+	internal := make([]span, 0, len(spans))
+	for _, s := range spans {
+		internal = append(internal, span{start: s.Start, end: s.End, region: s.Region})
+	}
+
+	parts, origins := scopeSpans(internal, scopes)
+
+	scoped := make([]Span, 0, len(parts))
+	for i, part := range parts {
+		scoped = append(scoped, Span{
+			Start:   part.start,
+			End:     part.end,
+			Address: spans[origins[i]].Address,
+			Region:  part.region,
+		})
+	}
+
+	return scoped
+}
+
+// updateFileWithBackup atomically writes newContent to file after saving its
+// original content as a backup, returning the backup's path, or an empty path
+// when backups are disabled. With SetDiffOnly, only the diff is printed.
+func (p *Processor) updateFileWithBackup(file string, originalContent []byte, newContent string) (string, error) {
+	if p.confirm == nil || p.diffOnly {
+		p.printDiff(file, originalContent, newContent)
+	}
+
+	if p.diffOnly {
+		return "", nil
+	}
+
+	err := p.confirmWrite(file, originalContent, newContent)
 	if err != nil {
-		return false
+		return "", err
+	}
+
+	var backupPath string
+
+	if !p.noBackup {
+		var err error
+
+		backupPath, err = p.backUp(file, originalContent)
+		if err != nil {
+			return "", err
+		}
 	}
 
-	amiRegex := regexp.MustCompile(`ami-[a-f0-9]{8,17}`)
+	err = writeFileAtomic(file, []byte(newContent))
+	if err != nil {
+		return "", fmt.Errorf("failed to write updated file: %w", err)
+	}
 
-	return amiRegex.Match(content)
+	return backupPath, nil
 }
@@ -0,0 +1,325 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+)
+
+// commentPrefixes are the line comment prefixes of the file types that get
+// provenance comments, by extension. Formats without comments, such as JSON,
+// and formats where a trailing comment would become part of a value, such as
+// Dockerfiles and .properties files, are left out.
+var commentPrefixes = map[string]string{
+	".tf":        "#",
+	".tfvars":    "#",
+	".hcl":       "#",
+	".yaml":      "#",
+	".yml":       "#",
+	".toml":      "#",
+	".sh":        "#",
+	".bash":      "#",
+	".zsh":       "#",
+	".py":        "#",
+	".rb":        "#",
+	".go":        "//",
+	".js":        "//",
+	".mjs":       "//",
+	".cjs":       "//",
+	".ts":        "//",
+	".java":      "//",
+	".kt":        "//",
+	".kts":       "//",
+	".cs":        "//",
+	".rs":        "//",
+	".scala":     "//",
+	".groovy":    "//",
+	".jsonnet":   "//",
+	".libsonnet": "//",
+	".sql":       "--",
+	".lua":       "--",
+}
+
+// SetProvenanceComments appends a comment to each line whose AMI IDs are
+// replaced, recording the AMI it held before, the new AMI's name, and the
+// date of the update. The comment is updated when the line changes again.
+func (p *Processor) SetProvenanceComments(enabled bool) {
+	p.provenance = enabled
+	p.provenanceDate = time.Now().UTC().Format(time.DateOnly)
+}
+
+// commentPrefix returns the line comment prefix of file, or an empty prefix
+// when it does not get provenance comments.
+func commentPrefix(file string) string {
+	return commentPrefixes[strings.ToLower(filepath.Ext(file))]
+}
+
+var (
+	// heredocRegex matches the start of a heredoc in Terraform, shell, and
+	// Ruby files, capturing its delimiter
+	heredocRegex = regexp.MustCompile(`<<[-~]?[ \t]*["']?([A-Za-z_]\w*)`)
+
+	// blockScalarRegex matches a YAML key or list item starting a literal or
+	// folded block scalar
+	blockScalarRegex = regexp.MustCompile(`^([ \t]*)(?:-[ \t]+|[^#]*:[ \t]+)[|>][-+0-9]*[ \t]*(?:#.*)?$`)
+)
+
+// stringDelimiter opens and closes a string that may span several lines.
+type stringDelimiter struct {
+	open  string
+	close string
+}
+
+var (
+	tripleQuotes = []stringDelimiter{{`"""`, `"""`}, {`'''`, `'''`}}
+	textBlocks   = []stringDelimiter{{`"""`, `"""`}}
+	backticks    = []stringDelimiter{{"`", "`"}}
+)
+
+// multilineDelimiters are the delimiters of the multi-line strings of the
+// file types that have them besides heredocs and YAML block scalars, by
+// extension.
+var multilineDelimiters = map[string][]stringDelimiter{
+	".toml":      tripleQuotes,
+	".py":        tripleQuotes,
+	".groovy":    tripleQuotes,
+	".kt":        textBlocks,
+	".kts":       textBlocks,
+	".java":      textBlocks,
+	".scala":     textBlocks,
+	".go":        backticks,
+	".js":        backticks,
+	".mjs":       backticks,
+	".cjs":       backticks,
+	".ts":        backticks,
+	".jsonnet":   {{"|||", "|||"}},
+	".libsonnet": {{"|||", "|||"}},
+	".lua":       {{"[[", "]]"}},
+}
+
+// annotateProvenance appends or updates the provenance comments of the lines
+// of newContent that replacements changed. Lines are matched one to one, as
+// replacements never add or remove lines. Only lines whose last value is a
+// replaced AMI ID get a comment: lines ending in a backslash continuation,
+// lines inside heredocs, YAML block scalars, and other multi-line strings, and
+// lines that a changed span of the file's format does not start and end on
+// are left alone, since the comment would become part of a value.
+func (p *Processor) annotateProvenance(file, originalContent, newContent string, replaced Replaced) string {
+	prefix := commentPrefix(file)
+	if prefix == "" {
+		return newContent
+	}
+
+	originalLines := strings.Split(originalContent, "\n")
+	newLines := strings.Split(newContent, "\n")
+
+	if len(originalLines) != len(newLines) {
+		return newContent
+	}
+
+	multiline := multilineStringLines(file, originalLines)
+	spanLines := singleLineSpans(originalContent, replaced.Changed)
+
+	existing := regexp.MustCompile(`[ \t]*` + regexp.QuoteMeta(prefix+" "+aws.ProvenanceMarker) + `.*$`)
+
+	// What may follow an AMI ID that ends the last value on its line: a closing
+	// quote, closing punctuation, and a comment
+	tokenEnd := regexp.MustCompile(`^["'\x60]?[,;)\]}]*(?:[ \t]+` + regexp.QuoteMeta(prefix) + `.*)?[ \t]*$`)
+
+	for i, line := range newLines {
+		if line == originalLines[i] || multiline[i] || (spanLines != nil && !spanLines[i]) {
+			continue
+		}
+
+		carriageReturn := ""
+		if strings.HasSuffix(line, "\r") {
+			line, carriageReturn = strings.TrimSuffix(line, "\r"), "\r"
+		}
+
+		original := existing.ReplaceAllString(originalLines[i], "")
+		line = existing.ReplaceAllString(line, "")
+
+		if strings.HasSuffix(strings.TrimRight(line, " \t"), "\\") {
+			continue
+		}
+
+		var entries []string
+
+		for _, replacement := range replaced.Replacements {
+			if !strings.Contains(original, replacement.OldAMI) || !strings.Contains(line, replacement.NewAMI) {
+				continue
+			}
+
+			entry := replacement.OldAMI
+			if replacement.Name != "" {
+				entry += ", " + replacement.Name
+			}
+
+			entries = append(entries, entry)
+		}
+
+		if len(entries) == 0 || !endsWithAMI(line, replaced.Replacements, tokenEnd) {
+			continue
+		}
+
+		newLines[i] = line + "  " + prefix + " " + aws.ProvenanceMarker + strings.Join(entries, "; ") +
+			", updated " + p.provenanceDate + carriageReturn
+	}
+
+	return strings.Join(newLines, "\n")
+}
+
+// endsWithAMI reports whether the last value on line is the new AMI ID of one
+// of replacements, followed by what tokenEnd matches.
+func endsWithAMI(line string, replacements []aws.AMIReplacement, tokenEnd *regexp.Regexp) bool {
+	return slices.ContainsFunc(replacements, func(replacement aws.AMIReplacement) bool {
+		index := strings.LastIndex(line, replacement.NewAMI)
+
+		return index >= 0 && tokenEnd.MatchString(line[index+len(replacement.NewAMI):])
+	})
+}
+
+// singleLineSpans reports the lines of content that a changed span starts and
+// ends on, or nil when the format did not report spans. A span over several
+// lines holds a multi-line value.
+func singleLineSpans(content string, changed []Span) []bool {
+	if len(changed) == 0 {
+		return nil
+	}
+
+	lines := make([]bool, strings.Count(content, "\n")+1)
+
+	for _, span := range changed {
+		start := strings.Count(content[:span.Start], "\n")
+		if start == strings.Count(content[:max(span.End-1, span.Start)], "\n") {
+			lines[start] = true
+		}
+	}
+
+	return lines
+}
+
+// multilineStringLines reports the lines of file that are part of a heredoc,
+// a YAML block scalar, or another multi-line string, including the lines
+// that open and close one.
+func multilineStringLines(file string, lines []string) []bool {
+	inside := make([]bool, len(lines))
+
+	switch extension := strings.ToLower(filepath.Ext(file)); extension {
+	case ".yaml", ".yml":
+		markBlockScalars(lines, inside)
+	case ".tf", ".tfvars", ".hcl", ".sh", ".bash", ".zsh", ".rb":
+		markHeredocs(lines, inside)
+	default:
+		markDelimited(lines, inside, multilineDelimiters[extension])
+	}
+
+	return inside
+}
+
+// markBlockScalars marks the lines of YAML block scalars, which continue for
+// as long as lines are blank or indented deeper than the line starting them.
+func markBlockScalars(lines []string, inside []bool) {
+	indent := -1
+
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+
+		if indent >= 0 {
+			if strings.TrimSpace(line) == "" || len(line)-len(trimmed) > indent {
+				inside[i] = true
+
+				continue
+			}
+
+			indent = -1
+		}
+
+		match := blockScalarRegex.FindStringSubmatch(line)
+		if match != nil {
+			indent = len(match[1])
+		}
+	}
+}
+
+// markHeredocs marks the lines of heredocs up to and including the line of
+// their closing delimiter.
+func markHeredocs(lines []string, inside []bool) {
+	delimiter := ""
+
+	for i, line := range lines {
+		if delimiter != "" {
+			inside[i] = true
+
+			if strings.TrimSpace(line) == delimiter {
+				delimiter = ""
+			}
+
+			continue
+		}
+
+		match := heredocRegex.FindStringSubmatch(line)
+		if match != nil {
+			delimiter = match[1]
+		}
+	}
+}
+
+// markDelimited marks the lines of the strings between delimiters that span
+// several lines.
+func markDelimited(lines []string, inside []bool, delimiters []stringDelimiter) {
+	if len(delimiters) == 0 {
+		return
+	}
+
+	closing := ""
+
+	for i, line := range lines {
+		inside[i] = closing != ""
+
+		for line != "" {
+			if closing != "" {
+				index := strings.Index(line, closing)
+				if index < 0 {
+					break
+				}
+
+				line, closing = line[index+len(closing):], ""
+
+				continue
+			}
+
+			index, delimiter := firstDelimiter(line, delimiters)
+			if index < 0 {
+				break
+			}
+
+			line, closing = line[index+len(delimiter.open):], delimiter.close
+		}
+
+		inside[i] = inside[i] || closing != ""
+	}
+}
+
+// firstDelimiter returns the index of the first opening delimiter in line,
+// and its delimiter, or -1 when there is none.
+func firstDelimiter(line string, delimiters []stringDelimiter) (int, stringDelimiter) {
+	first, found := -1, stringDelimiter{}
+
+	for _, delimiter := range delimiters {
+		index := strings.Index(line, delimiter.open)
+		if index >= 0 && (first < 0 || index < first) {
+			first, found = index, delimiter
+		}
+	}
+
+	return first, found
+}
@@ -0,0 +1,403 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// regionNameRegex finds region codes anywhere in content, so files that
+// cannot have a region context are not parsed for one.
+var regionNameRegex = regexp.MustCompile(`[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-\d`)
+
+// FileRegion assigns the files matching Path, where a pattern or directory
+// covers the files below it, to Region.
+type FileRegion struct {
+	Path   string
+	Region string
+}
+
+// SetFileRegions assigns the AMI IDs of the files matching each entry to its
+// region, unless a region context inside the file says otherwise. When
+// several entries match a file, the longest path wins.
+func (p *Processor) SetFileRegions(fileRegions []FileRegion) {
+	p.fileRegions = fileRegions
+}
+
+// fileRegion returns the region configured for file, if any.
+func (p *Processor) fileRegion(file string) string {
+	var best FileRegion
+
+	for _, fileRegion := range p.fileRegions {
+		if len(fileRegion.Path) > len(best.Path) && matchesPathOrParent(fileRegion.Path, file) {
+			best = fileRegion
+		}
+	}
+
+	return best.Region
+}
+
+// matchesPathOrParent reports whether file, or a directory above it, matches
+// pattern. A pattern without a separator also matches base names.
+func matchesPathOrParent(pattern, file string) bool {
+	pattern = filepath.Clean(pattern)
+
+	if !strings.ContainsRune(pattern, filepath.Separator) {
+		matched, _ := filepath.Match(pattern, filepath.Base(file))
+		if matched {
+			return true
+		}
+	}
+
+	for path := filepath.Clean(file); ; path = filepath.Dir(path) {
+		matched, _ := filepath.Match(pattern, path)
+		if matched {
+			return true
+		}
+
+		if parent := filepath.Dir(path); parent == path {
+			return false
+		}
+	}
+}
+
+// regionScopes returns the spans of file whose AMI IDs belong to a known
+// region: the whole file for a configured region, and the parts of the file
+// that name their region. In Terraform and Packer files, these are blocks
+// with a literal region argument, blocks using an aliased AWS provider
+// configured in the same file, the whole file for the file's default AWS
+// provider, and map values under region keys. In YAML and JSON files, they
+// are the values under region keys, such as the RegionMap.us-east-1.AMI of a
+// CloudFormation mapping, and the values of mappings with a region key, such
+// as an Ansible task's region argument. Scopes nest, and a span lying inside
+// several belongs to the innermost one.
+func (p *Processor) regionScopes(file string, content []byte) []span {
+	var scopes []span
+
+	if region := p.fileRegion(file); region != "" {
+		scopes = append(scopes, span{start: 0, end: len(content), region: region})
+	}
+
+	if !regionNameRegex.Match(content) {
+		return scopes
+	}
+
+	if isNativeHCLFile(file) {
+		return append(scopes, hclRegionScopes(content, file)...)
+	}
+
+	return append(scopes, yamlRegionScopes(content)...)
+}
+
+// isNativeHCLFile reports whether a file is written in native HCL syntax.
+func isNativeHCLFile(file string) bool {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".tf", ".tfvars", ".hcl":
+		return true
+	default:
+		return false
+	}
+}
+
+// hclRegionScopes returns the region scopes of a Terraform or Packer file,
+// which has none when it cannot be parsed.
+func hclRegionScopes(content []byte, file string) []span {
+	parsed, diagnostics := hclsyntax.ParseConfig(content, file, hcl.InitialPos)
+	if diagnostics.HasErrors() {
+		return nil
+	}
+
+	body, ok := parsed.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil
+	}
+
+	var scopes []span
+
+	aliases := make(map[string]string)
+
+	for _, block := range body.Blocks {
+		if block.Type != "provider" || len(block.Labels) != 1 || block.Labels[0] != "aws" {
+			continue
+		}
+
+		region := literalAttribute(block.Body, "region")
+		if region == "" {
+			continue
+		}
+
+		alias := literalAttribute(block.Body, "alias")
+		if alias == "" {
+			scopes = append(scopes, span{start: 0, end: len(content), region: region})
+		}
+
+		aliases[alias] = region
+	}
+
+	for _, name := range sortedAttributeNames(body) {
+		scopes = appendMapRegionScopes(scopes, body.Attributes[name].Expr)
+	}
+
+	for _, block := range body.Blocks {
+		scopes = appendBlockRegionScopes(scopes, block, aliases)
+	}
+
+	return scopes
+}
+
+func appendBlockRegionScopes(scopes []span, block *hclsyntax.Block, aliases map[string]string) []span {
+	region := literalAttribute(block.Body, "region")
+	if region == "" {
+		region = aliases[providerAlias(block.Body)]
+	}
+
+	if region != "" {
+		blockRange := block.Range()
+		scopes = append(scopes, span{start: blockRange.Start.Byte, end: blockRange.End.Byte, region: region})
+	}
+
+	for _, name := range sortedAttributeNames(block.Body) {
+		scopes = appendMapRegionScopes(scopes, block.Body.Attributes[name].Expr)
+	}
+
+	for _, nested := range block.Body.Blocks {
+		scopes = appendBlockRegionScopes(scopes, nested, aliases)
+	}
+
+	return scopes
+}
+
+// literalAttribute returns the value of the named attribute when it is a
+// literal string, or an empty string.
+func literalAttribute(body *hclsyntax.Body, name string) string {
+	attribute, ok := body.Attributes[name]
+	if !ok {
+		return ""
+	}
+
+	var value string
+
+	if gohcl.DecodeExpression(attribute.Expr, nil, &value).HasErrors() {
+		return ""
+	}
+
+	return value
+}
+
+// providerAlias returns the alias of the AWS provider configuration a block
+// uses through its provider argument, or the aws entry of a module's
+// providers argument, or an empty alias.
+func providerAlias(body *hclsyntax.Body) string {
+	expr := hcl.Expression(nil)
+
+	if attribute, ok := body.Attributes["provider"]; ok {
+		expr = attribute.Expr
+	} else if attribute, ok := body.Attributes["providers"]; ok {
+		pairs, diagnostics := hcl.ExprMap(attribute.Expr)
+		if diagnostics.HasErrors() {
+			return ""
+		}
+
+		for _, pair := range pairs {
+			if hcl.ExprAsKeyword(pair.Key) == "aws" {
+				expr = pair.Value
+			}
+		}
+	}
+
+	if expr == nil {
+		return ""
+	}
+
+	traversal, diagnostics := hcl.AbsTraversalForExpr(expr)
+	if diagnostics.HasErrors() || len(traversal) != 2 || traversal.RootName() != "aws" {
+		return ""
+	}
+
+	attribute, ok := traversal[1].(hcl.TraverseAttr)
+	if !ok {
+		return ""
+	}
+
+	return attribute.Name
+}
+
+// appendMapRegionScopes appends the scopes of the values under region keys
+// of the maps and objects in expr, at any depth.
+func appendMapRegionScopes(scopes []span, expr hcl.Expression) []span {
+	if items, diagnostics := hcl.ExprList(expr); !diagnostics.HasErrors() {
+		for _, item := range items {
+			scopes = appendMapRegionScopes(scopes, item)
+		}
+
+		return scopes
+	}
+
+	pairs, diagnostics := hcl.ExprMap(expr)
+	if diagnostics.HasErrors() {
+		return scopes
+	}
+
+	for _, pair := range pairs {
+		var key string
+
+		if !gohcl.DecodeExpression(pair.Key, nil, &key).HasErrors() && regionKeyRegex.MatchString(key) {
+			valueRange := pair.Value.Range()
+			scopes = append(scopes, span{start: valueRange.Start.Byte, end: valueRange.End.Byte, region: key})
+		}
+
+		scopes = appendMapRegionScopes(scopes, pair.Value)
+	}
+
+	return scopes
+}
+
+// yamlRegionScopes returns the region scopes of a YAML or JSON file as the
+// spans of the scalars under each region context, which has none when it
+// cannot be parsed. Deeper contexts come later, so they win over the contexts
+// around them.
+func yamlRegionScopes(content []byte) []span {
+	lines := newLineIndex(content)
+	decoder := yaml.NewDecoder(strings.NewReader(string(content)))
+
+	var scopes []span
+
+	for {
+		var document yaml.Node
+
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil
+		}
+
+		scopes = appendYAMLRegionScopes(scopes, &document, lines)
+	}
+
+	return scopes
+}
+
+func appendYAMLRegionScopes(scopes []span, node *yaml.Node, lines lineIndex) []span {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			scopes = appendYAMLRegionScopes(scopes, child, lines)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+
+			if isRegionArgument(key.Value) && value.Kind == yaml.ScalarNode && regionKeyRegex.MatchString(value.Value) {
+				scopes = appendRegionSpans(scopes, node, value.Value, lines)
+
+				break
+			}
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+
+			if regionKeyRegex.MatchString(key) {
+				scopes = appendRegionSpans(scopes, value, key, lines)
+			}
+
+			scopes = appendYAMLRegionScopes(scopes, value, lines)
+		}
+	case yaml.ScalarNode, yaml.AliasNode:
+	}
+
+	return scopes
+}
+
+// appendRegionSpans appends the spans of the scalars under node, limited to
+// region.
+func appendRegionSpans(spans []span, node *yaml.Node, region string, lines lineIndex) []span {
+	for _, s := range appendYAMLSpans(nil, node, nil, nil, true, lines) {
+		s.region = region
+		spans = append(spans, s)
+	}
+
+	return spans
+}
+
+// isRegionArgument reports whether a mapping key names the region of the
+// mapping's other values.
+func isRegionArgument(key string) bool {
+	return strings.EqualFold(key, "region") || strings.EqualFold(key, "aws_region")
+}
+
+// scopeSpans splits spans at the boundaries of region scopes and limits each
+// part without a region of its own to the region of the innermost scope
+// containing it. It also returns the index in spans each part came from.
+func scopeSpans(spans, scopes []span) ([]span, []int) {
+	var (
+		scoped  []span
+		origins []int
+	)
+
+	for index, s := range spans {
+		if s.region != "" || len(scopes) == 0 {
+			scoped = append(scoped, s)
+			origins = append(origins, index)
+
+			continue
+		}
+
+		cuts := []int{s.start, s.end}
+
+		for _, scope := range scopes {
+			for _, offset := range []int{scope.start, scope.end} {
+				if offset > s.start && offset < s.end {
+					cuts = append(cuts, offset)
+				}
+			}
+		}
+
+		slices.Sort(cuts)
+		cuts = slices.Compact(cuts)
+
+		for i := 0; i+1 < len(cuts); i++ {
+			part := span{start: cuts[i], end: cuts[i+1]}
+			part.region = innermostRegion(scopes, part.start, part.end)
+
+			scoped = append(scoped, part)
+			origins = append(origins, index)
+		}
+	}
+
+	return scoped, origins
+}
+
+// innermostRegion returns the region of the smallest scope containing the
+// range from start to end, preferring later scopes among equals, or an empty
+// region when no scope contains it.
+func innermostRegion(scopes []span, start, end int) string {
+	var (
+		region string
+		size   = -1
+	)
+
+	for _, scope := range scopes {
+		if scope.start <= start && end <= scope.end && (size < 0 || scope.end-scope.start <= size) {
+			region, size = scope.region, scope.end-scope.start
+		}
+	}
+
+	return region
+}
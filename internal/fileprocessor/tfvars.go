@@ -0,0 +1,111 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/json"
+)
+
+var regionKeyRegex = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-\d+$`)
+
+// isTFVarsFile reports whether a file is a Terraform variable definitions
+// file, in native or JSON syntax.
+func isTFVarsFile(file string) bool {
+	name := strings.ToLower(file)
+
+	return strings.HasSuffix(name, ".tfvars") || strings.HasSuffix(name, ".tfvars.json")
+}
+
+// tfvarsSpans returns the spans of the values assigned to the variables of a
+// Terraform variable definitions file, addressed by variable name. Maps are
+// split into their values, and values under a key named after a region are
+// limited to that region's replacements, so a map of region to AMI only ever
+// receives each region's own AMI. Comments are never part of a span.
+func tfvarsSpans(content []byte, file string) ([]addressedSpan, error) {
+	isJSON := strings.HasSuffix(strings.ToLower(file), ".json")
+
+	var (
+		parsed      *hcl.File
+		diagnostics hcl.Diagnostics
+	)
+
+	if isJSON {
+		parsed, diagnostics = json.Parse(content, file)
+	} else {
+		parsed, diagnostics = hclsyntax.ParseConfig(content, file, hcl.InitialPos)
+	}
+
+	if diagnostics.HasErrors() {
+		return nil, fmt.Errorf("failed to parse Terraform variables: %w", diagnostics)
+	}
+
+	attributes, diagnostics := parsed.Body.JustAttributes()
+	if diagnostics.HasErrors() {
+		return nil, fmt.Errorf("failed to parse Terraform variables: %w", diagnostics)
+	}
+
+	var spans []addressedSpan
+
+	for _, name := range slices.Sorted(maps.Keys(attributes)) {
+		spans = appendValueSpans(spans, attributes[name].Expr, name, "")
+	}
+
+	if isJSON {
+		return spans, nil
+	}
+
+	return withoutComments(content, file, spans), nil
+}
+
+// appendValueSpans appends the spans of the values of a variable, descending
+// into maps and objects.
+func appendValueSpans(spans []addressedSpan, expr hcl.Expression, name, region string) []addressedSpan {
+	pairs, diagnostics := hcl.ExprMap(expr)
+	if diagnostics.HasErrors() || len(pairs) == 0 {
+		exprRange := expr.Range()
+
+		return append(spans, addressedSpan{
+			span:    span{start: exprRange.Start.Byte, end: exprRange.End.Byte, region: region},
+			address: name,
+		})
+	}
+
+	for _, pair := range pairs {
+		var key string
+
+		entryRegion := region
+		if !gohcl.DecodeExpression(pair.Key, nil, &key).HasErrors() && regionKeyRegex.MatchString(key) {
+			entryRegion = key
+		}
+
+		spans = appendValueSpans(spans, pair.Value, name, entryRegion)
+	}
+
+	return spans
+}
+
+// changedAddresses returns the sorted, distinct addresses of spans.
+func changedAddresses(spans []Span) []string {
+	var addresses []string
+
+	for _, s := range spans {
+		if !slices.Contains(addresses, s.Address) {
+			addresses = append(addresses, s.Address)
+		}
+	}
+
+	slices.Sort(addresses)
+
+	return addresses
+}
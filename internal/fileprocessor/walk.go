@@ -0,0 +1,123 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/schnauzersoft/ami-util/internal/logging"
+)
+
+// walker visits the files below a directory.
+type walker struct {
+	processor *Processor
+	ignore    gitignore
+	visit     func(path string)
+
+	// visited holds the resolved paths of the directories walked so far, so
+	// that following a symlink never walks a directory twice.
+	visited map[string]bool
+}
+
+// SetMaxDepth limits directory walks to files at most depth levels below the
+// walked directory, where 1 is the directory's own files. Zero means no limit.
+func (p *Processor) SetMaxDepth(depth int) {
+	p.maxDepth = depth
+}
+
+// SetFollowSymlinks makes directory walks descend into symlinked directories.
+// Symlinked files are always processed, and a directory reached more than
+// once, such as through a link back to a parent, is only walked the first
+// time.
+func (p *Processor) SetFollowSymlinks(follow bool) {
+	p.followSymlinks = follow
+}
+
+// walkFiles calls visit for every file below dirPath in lexical order,
+// skipping SkippedDirs, paths ignored by .gitignore files when enabled, and
+// anything deeper than the maximum depth.
+func (p *Processor) walkFiles(dirPath string, visit func(path string)) error {
+	w := &walker{processor: p, visit: visit, visited: make(map[string]bool)}
+
+	return w.walkDir(dirPath, ".", 0)
+}
+
+func (w *walker) walkDir(dir, rel string, depth int) error {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	if w.visited[resolved] {
+		logging.Trace("Skipping directory that was already walked", "dir", dir, "resolved", resolved)
+
+		return nil
+	}
+
+	w.visited[resolved] = true
+
+	if w.processor.gitignore {
+		w.ignore.load(dir, rel)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(dir, entry.Name())
+		entryRel := path.Join(rel, entry.Name())
+
+		isDir := entry.IsDir()
+		if entry.Type()&fs.ModeSymlink != 0 {
+			info, err := os.Stat(entryPath)
+			if err != nil {
+				// Dangling link
+				continue
+			}
+
+			isDir = info.IsDir()
+			if isDir && !w.processor.followSymlinks {
+				continue
+			}
+		}
+
+		if w.skipped(entry.Name(), entryRel, isDir) {
+			continue
+		}
+
+		if !isDir {
+			w.visit(entryPath)
+
+			continue
+		}
+
+		if w.processor.maxDepth > 0 && depth+1 >= w.processor.maxDepth {
+			continue
+		}
+
+		err := w.walkDir(entryPath, entryRel, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// skipped reports whether a path below the walked directory is left out of
+// the walk.
+func (w *walker) skipped(name, rel string, isDir bool) bool {
+	if isDir && isSkippedDir(name) {
+		return true
+	}
+
+	return w.processor.gitignore && w.ignore.ignored(rel, isDir)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// preservedModeBits are the bits of an existing file's mode that a rewrite
+// carries over.
+const preservedModeBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+// writeFileAtomic replaces the content of file by writing a temporary file in
+// the same directory and renaming it over the original, so that a crash never
+// leaves a truncated file behind. An existing file's mode is kept, along with
+// its owner and group where the process is allowed to set them; new files are
+// created with FilePerm. Symlinks are followed, so the link itself survives.
+func writeFileAtomic(file string, content []byte) error {
+	target, err := filepath.EvalSymlinks(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to resolve %s: %w", file, err)
+	}
+
+	if err != nil {
+		target = file
+	}
+
+	info, err := os.Stat(target)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to stat %s: %w", target, err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	tempPath := temp.Name()
+	renamed := false
+
+	defer func() {
+		if !renamed {
+			_ = os.Remove(tempPath)
+		}
+	}()
+
+	_, err = temp.Write(content)
+	if err == nil {
+		err = temp.Sync()
+	}
+
+	closeErr := temp.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	mode := fs.FileMode(FilePerm)
+	if info != nil {
+		// Ownership is set before the mode, since changing it clears the
+		// setuid and setgid bits.
+		preserveOwnership(tempPath, info)
+
+		mode = info.Mode() & preservedModeBits
+	}
+
+	err = os.Chmod(tempPath, mode)
+	if err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+
+	err = os.Rename(tempPath, target)
+	if err != nil {
+		return fmt.Errorf("failed to replace %s: %w", target, err)
+	}
+
+	renamed = true
+
+	return nil
+}
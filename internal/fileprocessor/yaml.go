@@ -0,0 +1,266 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package fileprocessor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// span is a byte range of a file that replacements may touch.
+type span struct {
+	start int
+	end   int
+
+	// region, when set, limits the span to replacements for that region.
+	region string
+}
+
+// isYAMLFile reports whether a file is processed as YAML when key paths are
+// configured.
+func isYAMLFile(file string) bool {
+	extension := strings.ToLower(filepath.Ext(file))
+
+	return extension == ".yaml" || extension == ".yml"
+}
+
+// yamlSpans returns the spans of the scalar values found under the key paths
+// in every document of a YAML file. A key path is a dot-separated list of
+// mapping keys, where * matches any single key, and it matches keys at any
+// depth: image_id matches every image_id key, spec.amiID every amiID key
+// directly under a spec key. Sequences do not add a path segment, so a key
+// path also covers every item of a list under it. Comments are never part of
+// a span.
+func yamlSpans(content []byte, keyPaths []string) ([]span, error) {
+	patterns := make([][]string, 0, len(keyPaths))
+	for _, keyPath := range keyPaths {
+		patterns = append(patterns, strings.Split(keyPath, "."))
+	}
+
+	lines := newLineIndex(content)
+	decoder := yaml.NewDecoder(strings.NewReader(string(content)))
+
+	var spans []span
+
+	for {
+		var document yaml.Node
+
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+
+		spans = appendYAMLSpans(spans, &document, nil, patterns, false, lines)
+	}
+
+	return spans, nil
+}
+
+func appendYAMLSpans(spans []span, node *yaml.Node, path []string, patterns [][]string, matched bool,
+	lines lineIndex,
+) []span {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			spans = appendYAMLSpans(spans, child, path, patterns, matched, lines)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			childPath := append(slices.Clip(path), node.Content[i].Value)
+			childMatched := matched || slices.ContainsFunc(patterns, func(pattern []string) bool {
+				return matchesKeyPath(pattern, childPath)
+			})
+
+			spans = appendYAMLSpans(spans, node.Content[i+1], childPath, patterns, childMatched, lines)
+		}
+	case yaml.ScalarNode:
+		if matched {
+			spans = append(spans, scalarSpan(node, lines))
+		}
+	case yaml.AliasNode:
+	}
+
+	return spans
+}
+
+// matchesKeyPath reports whether pattern matches the trailing keys of path.
+func matchesKeyPath(pattern, path []string) bool {
+	if len(pattern) > len(path) {
+		return false
+	}
+
+	tail := path[len(path)-len(pattern):]
+	for i, key := range pattern {
+		if key != "*" && key != tail[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// scalarSpan returns the span of a scalar's text in the file, excluding any
+// comment that follows it.
+func scalarSpan(node *yaml.Node, lines lineIndex) span {
+	start := lines.offset(node.Line, node.Column)
+
+	switch node.Style {
+	case yaml.LiteralStyle, yaml.FoldedStyle:
+		// The scalar starts at its | or > indicator; its text is on the lines
+		// below
+		count := strings.Count(strings.TrimRight(node.Value, "\n"), "\n") + 1
+
+		return span{start: lines.lineEnd(node.Line), end: lines.lineEnd(node.Line + count)}
+	case yaml.DoubleQuotedStyle, yaml.SingleQuotedStyle:
+		return span{start: start, end: quotedEnd(lines.content, start)}
+	default:
+		end := start + len(node.Value)
+		if end > len(lines.content) || string(lines.content[start:end]) != node.Value {
+			end = lines.lineEnd(node.Line)
+		}
+
+		return span{start: start, end: end}
+	}
+}
+
+// quotedEnd returns the offset just past the closing quote of the quoted
+// scalar starting at start.
+func quotedEnd(content []byte, start int) int {
+	quote := content[start]
+
+	for i := start + 1; i < len(content); i++ {
+		switch {
+		case quote == '"' && content[i] == '\\':
+			i++
+		case content[i] == quote && quote == '\'' && i+1 < len(content) && content[i+1] == '\'':
+			i++
+		case content[i] == quote:
+			return i + 1
+		}
+	}
+
+	return len(content)
+}
+
+// lineIndex converts the 1-based line and rune column positions reported by
+// parsers into byte offsets.
+type lineIndex struct {
+	content []byte
+	starts  []int
+}
+
+func newLineIndex(content []byte) lineIndex {
+	starts := []int{0}
+
+	for i, char := range content {
+		if char == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+
+	return lineIndex{content: content, starts: starts}
+}
+
+func (l lineIndex) offset(line, column int) int {
+	if line < 1 || line > len(l.starts) {
+		return len(l.content)
+	}
+
+	offset := l.starts[line-1]
+	for range column - 1 {
+		if offset >= len(l.content) || l.content[offset] == '\n' {
+			break
+		}
+
+		_, size := utf8.DecodeRune(l.content[offset:])
+		offset += size
+	}
+
+	return offset
+}
+
+// lineEnd returns the offset of the end of a line, before its newline.
+func (l lineIndex) lineEnd(line int) int {
+	if line < 1 || line >= len(l.starts) {
+		return len(l.content)
+	}
+
+	return l.starts[line] - 1
+}
+
+// replaceInSpans applies replacements only within spans of content and returns
+// the indexes of the spans it changed. Spans must not overlap.
+func replaceInSpans(content string, spans []span, replacements []aws.AMIReplacement,
+) (string, int, []aws.AMIReplacement, []int) {
+	order := make([]int, len(spans))
+	for i := range spans {
+		order[i] = i
+	}
+
+	slices.SortFunc(order, func(a, b int) int { return spans[b].start - spans[a].start })
+
+	total := 0
+	used := make(map[aws.AMIReplacement]bool)
+
+	var changed []int
+
+	for _, index := range order {
+		s := spans[index]
+
+		replaced, count, spanApplied := aws.ReplaceAMIsInContent(content[s.start:s.end],
+			replacementsForRegion(replacements, s.region))
+		if count == 0 {
+			continue
+		}
+
+		content = content[:s.start] + replaced + content[s.end:]
+		total += count
+		changed = append(changed, index)
+
+		for _, replacement := range spanApplied {
+			used[replacement] = true
+		}
+	}
+
+	var applied []aws.AMIReplacement
+
+	for _, replacement := range replacements {
+		if used[replacement] {
+			applied = append(applied, replacement)
+		}
+	}
+
+	slices.Sort(changed)
+
+	return content, total, applied, changed
+}
+
+// replacementsForRegion returns the replacements that apply in region, or the
+// in-place ones when region is empty, since a reference without a region
+// context cannot take another region's AMI.
+func replacementsForRegion(replacements []aws.AMIReplacement, region string) []aws.AMIReplacement {
+	var kept []aws.AMIReplacement
+
+	for _, replacement := range replacements {
+		if (region == "" && !replacement.CrossRegion()) || replacement.Region == "" || replacement.Region == region {
+			kept = append(kept, replacement)
+		}
+	}
+
+	return kept
+}
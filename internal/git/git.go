@@ -0,0 +1,137 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrNotWorktree       = errors.New("not inside a git worktree")
+	ErrMultipleWorktrees = errors.New("paths belong to different git worktrees")
+)
+
+// Repo is a git worktree, operated on with the git command.
+type Repo struct {
+	root string
+}
+
+// Open returns the worktree containing every path, which may be files or
+// directories.
+func Open(ctx context.Context, paths []string) (*Repo, error) {
+	var root string
+
+	for _, path := range paths {
+		dir := path
+
+		info, err := os.Stat(path)
+		if err == nil && !info.IsDir() {
+			dir = filepath.Dir(path)
+		}
+
+		output, err := run(ctx, dir, "rev-parse", "--show-toplevel")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrNotWorktree, path)
+		}
+
+		switch {
+		case root == "":
+			root = output
+		case root != output:
+			return nil, fmt.Errorf("%w: %s and %s", ErrMultipleWorktrees, root, output)
+		}
+	}
+
+	if root == "" {
+		return nil, ErrNotWorktree
+	}
+
+	return &Repo{root: root}, nil
+}
+
+// CreateBranch creates a branch at the current commit and switches to it,
+// carrying over uncommitted changes.
+func (r *Repo) CreateBranch(ctx context.Context, name string) error {
+	_, err := run(ctx, r.root, "switch", "--create", name)
+
+	return err
+}
+
+// Switch switches to the existing branch name, carrying over uncommitted
+// changes.
+func (r *Repo) Switch(ctx context.Context, name string) error {
+	_, err := run(ctx, r.root, "switch", name)
+
+	return err
+}
+
+// Commit commits files, and only files, with message, leaving anything else
+// that is staged uncommitted. It returns the new commit's hash.
+func (r *Repo) Commit(ctx context.Context, files []string, message string) (string, error) {
+	paths := make([]string, 0, len(files))
+
+	for _, file := range files {
+		absolute, err := filepath.Abs(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve %s: %w", file, err)
+		}
+
+		paths = append(paths, absolute)
+	}
+
+	_, err := run(ctx, r.root, append([]string{"add", "--"}, paths...)...)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = run(ctx, r.root, append([]string{"commit", "--only", "--message", message, "--"}, paths...)...)
+	if err != nil {
+		return "", err
+	}
+
+	return run(ctx, r.root, "rev-parse", "HEAD")
+}
+
+// CurrentBranch returns the name of the checked out branch.
+func (r *Repo) CurrentBranch(ctx context.Context) (string, error) {
+	return run(ctx, r.root, "rev-parse", "--abbrev-ref", "HEAD")
+}
+
+// RemoteURL returns the URL of remote.
+func (r *Repo) RemoteURL(ctx context.Context, remote string) (string, error) {
+	return run(ctx, r.root, "remote", "get-url", remote)
+}
+
+// Push pushes branch to remote and sets it as the branch's upstream.
+func (r *Repo) Push(ctx context.Context, remote, branch string) error {
+	_, err := run(ctx, r.root, "push", "--set-upstream", remote, branch)
+
+	return err
+}
+
+// run runs git in dir and returns its trimmed standard output. Failures
+// include what git wrote to standard error.
+func run(ctx context.Context, dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package github
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const actionsFilePerm = 0o644
+
+// Output is a step output of a GitHub Actions workflow.
+type Output struct {
+	Name  string
+	Value string
+}
+
+// Annotation is a message a GitHub Actions workflow shows on a line of a
+// file, on the run and on pull requests; Level is notice, warning, or error.
+type Annotation struct {
+	Level   string
+	File    string
+	Line    int
+	Column  int
+	Title   string
+	Message string
+}
+
+var (
+	// dataEscaper escapes the message of a workflow command.
+	dataEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+	// propertyEscaper escapes the properties of a workflow command.
+	propertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// InActions reports whether ami-util runs in a GitHub Actions workflow.
+func InActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// SetOutputs appends step outputs to the file named by GITHUB_OUTPUT. Values
+// spanning several lines are written between random delimiters.
+func SetOutputs(outputs []Output) error {
+	var builder strings.Builder
+
+	for _, output := range outputs {
+		if !strings.ContainsAny(output.Value, "\r\n") {
+			fmt.Fprintf(&builder, "%s=%s\n", output.Name, output.Value)
+
+			continue
+		}
+
+		delimiter := "ami_util_" + rand.Text()
+		fmt.Fprintf(&builder, "%s<<%s\n%s\n%s\n", output.Name, delimiter, output.Value, delimiter)
+	}
+
+	return appendToFile("GITHUB_OUTPUT", builder.String())
+}
+
+// AppendStepSummary appends Markdown to the job summary, the file named by
+// GITHUB_STEP_SUMMARY.
+func AppendStepSummary(markdown string) error {
+	return appendToFile("GITHUB_STEP_SUMMARY", markdown)
+}
+
+// WriteAnnotation writes the workflow command showing annotation, which the
+// runner picks up from the step's output.
+func WriteAnnotation(writer io.Writer, annotation Annotation) error {
+	properties := []string{"file=" + propertyEscaper.Replace(annotation.File)}
+
+	if annotation.Line > 0 {
+		properties = append(properties, fmt.Sprintf("line=%d", annotation.Line))
+	}
+
+	if annotation.Column > 0 {
+		properties = append(properties, fmt.Sprintf("col=%d", annotation.Column))
+	}
+
+	if annotation.Title != "" {
+		properties = append(properties, "title="+propertyEscaper.Replace(annotation.Title))
+	}
+
+	_, err := fmt.Fprintf(writer, "::%s %s::%s\n", annotation.Level, strings.Join(properties, ","),
+		dataEscaper.Replace(annotation.Message))
+	if err != nil {
+		return fmt.Errorf("failed to write annotation: %w", err)
+	}
+
+	return nil
+}
+
+// WorkspacePath returns path relative to GITHUB_WORKSPACE, the checkout that
+// annotations name files in, or path itself when it lies outside it.
+func WorkspacePath(path string) string {
+	workspace := os.Getenv("GITHUB_WORKSPACE")
+	if workspace == "" {
+		return path
+	}
+
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	relative, err := filepath.Rel(workspace, absolute)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return path
+	}
+
+	return filepath.ToSlash(relative)
+}
+
+// appendToFile appends content to the file named by the environment variable
+// name, or does nothing when it is not set.
+func appendToFile(name, content string) error {
+	path := os.Getenv(name)
+	if path == "" || content == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(filepath.Clean(path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, actionsFilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(content)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	return nil
+}
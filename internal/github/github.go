@@ -0,0 +1,130 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultAPIURL = "https://api.github.com"
+
+	requestTimeout = 30 * time.Second
+	maxErrorBytes  = 4096
+)
+
+var (
+	ErrNoToken           = errors.New("GITHUB_TOKEN or GH_TOKEN must be set")
+	ErrNotGitHubRemote   = errors.New("remote is not a GitHub repository")
+	ErrPullRequestFailed = errors.New("failed to create pull request")
+
+	// remoteRegex matches the owner and name of a repository in HTTPS, SSH,
+	// and scp-like remote URLs, with or without the .git suffix.
+	remoteRegex = regexp.MustCompile(`^(?:https://|ssh://git@|git@)[^/:]+[/:]([^/]+)/([^/]+?)(?:\.git)?/?$`)
+)
+
+// PullRequest is a pull request to open from Head into Base.
+type PullRequest struct {
+	Title string `json:"title"`
+	Head  string `json:"head"`
+	Base  string `json:"base"`
+	Body  string `json:"body"`
+}
+
+// Client opens pull requests through the GitHub REST API.
+type Client struct {
+	apiURL     string
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient returns a client authenticated with GITHUB_TOKEN, or GH_TOKEN,
+// for the API at GITHUB_API_URL, or github.com when it is not set.
+func NewClient() (*Client, error) {
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		token = os.Getenv("GH_TOKEN")
+	}
+
+	if token == "" {
+		return nil, ErrNoToken
+	}
+
+	apiURL := os.Getenv("GITHUB_API_URL")
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+
+	return &Client{
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+// ParseRemote returns the owner and name of the GitHub repository a git
+// remote URL points to, such as git@github.com:owner/name.git.
+func ParseRemote(remoteURL string) (string, string, error) {
+	match := remoteRegex.FindStringSubmatch(remoteURL)
+	if match == nil {
+		return "", "", fmt.Errorf("%w: %s", ErrNotGitHubRemote, remoteURL)
+	}
+
+	return match[1], match[2], nil
+}
+
+// CreatePullRequest opens a pull request in owner/name and returns its URL.
+func (c *Client) CreatePullRequest(ctx context.Context, owner, name string, pullRequest PullRequest,
+) (string, error) {
+	payload, err := json.Marshal(pullRequest)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode pull request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/pulls", c.apiURL, owner, name)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to build request: %w", err)
+	}
+
+	request.Header.Set("Accept", "application/vnd.github+json")
+	request.Header.Set("Authorization", "Bearer "+c.token)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to call GitHub API: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBytes))
+
+		return "", fmt.Errorf("%w: %s: %s", ErrPullRequestFailed, response.Status, strings.TrimSpace(string(message)))
+	}
+
+	var created struct {
+		HTMLURL string `json:"html_url"`
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&created)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode pull request: %w", err)
+	}
+
+	return created.HTMLURL, nil
+}
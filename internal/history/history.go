@@ -0,0 +1,190 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+)
+
+const (
+	DirPerm  = 0o700
+	FilePerm = 0o600
+
+	historyFile  = "history.jsonl"
+	runIDFormat  = "20060102T150405Z"
+	runIDSuffix  = 0x10000
+	maxLineBytes = 16 * 1024 * 1024
+)
+
+var ErrRunNotFound = errors.New("run not found")
+
+type Replacement struct {
+	OldAMI  string `json:"oldAmi"`
+	NewAMI  string `json:"newAmi"`
+	Name    string `json:"name"`
+	Account string `json:"account"`
+	Region  string `json:"region"`
+}
+
+type FileChange struct {
+	Path         string        `json:"path"`
+	Count        int           `json:"count"`
+	Replacements []Replacement `json:"replacements"`
+}
+
+type Run struct {
+	ID        string       `json:"id"`
+	Timestamp time.Time    `json:"timestamp"`
+	User      string       `json:"user"`
+	Target    string       `json:"target"`
+	Accounts  []string     `json:"accounts"`
+	Regions   []string     `json:"regions"`
+	Files     []FileChange `json:"files"`
+}
+
+// NewRun builds a history entry from the files changed during a run. Its ID
+// is the time of the run with a random suffix, so that runs started in the
+// same second, such as those of parallel CI jobs, can be told apart.
+func NewRun(user, target string, accounts, regions []string, results []fileprocessor.FileResult) Run {
+	now := time.Now().UTC()
+
+	run := Run{
+		ID:        fmt.Sprintf("%s-%04x", now.Format(runIDFormat), rand.N(runIDSuffix)), //nolint:gosec
+		Timestamp: now,
+		User:      user,
+		Target:    target,
+		Accounts:  accounts,
+		Regions:   regions,
+		Files:     []FileChange{},
+	}
+
+	for _, result := range results {
+		if result.Count == 0 {
+			continue
+		}
+
+		change := FileChange{
+			Path:         result.Path,
+			Count:        result.Count,
+			Replacements: make([]Replacement, 0, len(result.Replacements)),
+		}
+
+		for _, replacement := range result.Replacements {
+			change.Replacements = append(change.Replacements, newReplacement(replacement))
+		}
+
+		run.Files = append(run.Files, change)
+	}
+
+	return run
+}
+
+func (r Run) ReplacementCount() int {
+	count := 0
+	for _, file := range r.Files {
+		count += file.Count
+	}
+
+	return count
+}
+
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+
+	return filepath.Join(home, ".ami-util", historyFile), nil
+}
+
+func Append(path string, run Run) error {
+	err := os.MkdirAll(filepath.Dir(path), DirPerm)
+	if err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	line, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode run: %w", err)
+	}
+
+	file, err := os.OpenFile(filepath.Clean(path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, FilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+
+	return nil
+}
+
+func Load(path string) ([]Run, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	var runs []Run
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxLineBytes)
+
+	for scanner.Scan() {
+		var run Run
+
+		err := json.Unmarshal(scanner.Bytes(), &run)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode history entry: %w", err)
+		}
+
+		runs = append(runs, run)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	return runs, nil
+}
+
+func Find(runs []Run, id string) (Run, error) {
+	for _, run := range runs {
+		if run.ID == id {
+			return run, nil
+		}
+	}
+
+	return Run{}, fmt.Errorf("%w: %s", ErrRunNotFound, id)
+}
+
+func newReplacement(replacement aws.AMIReplacement) Replacement {
+	return Replacement{
+		OldAMI:  replacement.OldAMI,
+		NewAMI:  replacement.NewAMI,
+		Name:    replacement.Name,
+		Account: replacement.Account,
+		Region:  replacement.Region,
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package junit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/schnauzersoft/ami-util/internal/results"
+)
+
+const (
+	FilePerm = 0o644
+
+	suiteName       = "ami-util"
+	filesClass      = "ami-util.files"
+	lookupsClass    = "ami-util.lookups"
+	runClass        = "ami-util.run"
+	failureOutdated = "outdated"
+	errorFailed     = "error"
+)
+
+// TestSuites is a JUnit XML report of a run.
+type TestSuites struct {
+	XMLName  xml.Name    `xml:"testsuites"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Suites   []TestSuite `xml:"testsuite"`
+}
+
+type TestSuite struct {
+	Name      string     `xml:"name,attr"`
+	Tests     int        `xml:"tests,attr"`
+	Failures  int        `xml:"failures,attr"`
+	Errors    int        `xml:"errors,attr"`
+	Time      string     `xml:"time,attr"`
+	Timestamp string     `xml:"timestamp,attr"`
+	Cases     []TestCase `xml:"testcase"`
+}
+
+type TestCase struct {
+	ClassName string   `xml:"classname,attr"`
+	Name      string   `xml:"name,attr"`
+	Failure   *Problem `xml:"failure,omitempty"`
+	Error     *Problem `xml:"error,omitempty"`
+}
+
+// Problem is the failure or error of a test case, with the details in its
+// text.
+type Problem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Details string `xml:",chardata"`
+}
+
+// New returns the report of the finished run described by summary. Every
+// file becomes a test case: files the run did not change pass as up to date,
+// files that needed new AMI IDs fail as outdated, whether or not they were
+// written, and files that could not be processed are errors. Failed lookups
+// and the error that stopped the run, if any, are errors too.
+func New(summary *results.Summary, files []string) *TestSuites {
+	suite := TestSuite{
+		Name:      suiteName,
+		Time:      seconds(summary),
+		Timestamp: summary.StartedAt.Format("2006-01-02T15:04:05"),
+	}
+
+	outcomes := make(map[string]results.File, len(summary.Files))
+
+	for _, file := range summary.Files {
+		outcomes[file.Path] = file
+
+		if !slices.Contains(files, file.Path) {
+			files = append(files, file.Path)
+		}
+	}
+
+	slices.Sort(files)
+
+	for _, file := range files {
+		suite.Cases = append(suite.Cases, fileCase(file, outcomes[file]))
+	}
+
+	for _, runError := range summary.Errors {
+		testCase := TestCase{ClassName: runClass, Name: "run"}
+		if runError.Account != "" || runError.Region != "" {
+			testCase = TestCase{ClassName: lookupsClass, Name: runError.Account + "/" + runError.Region}
+		}
+
+		testCase.Error = &Problem{Message: runError.Message, Type: errorFailed, Details: runError.Message}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	for _, testCase := range suite.Cases {
+		suite.Tests++
+
+		switch {
+		case testCase.Error != nil:
+			suite.Errors++
+		case testCase.Failure != nil:
+			suite.Failures++
+		}
+	}
+
+	return &TestSuites{
+		Name:     suiteName,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Time:     suite.Time,
+		Suites:   []TestSuite{suite},
+	}
+}
+
+func fileCase(path string, outcome results.File) TestCase {
+	testCase := TestCase{ClassName: filesClass, Name: path}
+
+	switch outcome.Status {
+	case results.StatusFailed:
+		testCase.Error = &Problem{Message: outcome.Error, Type: errorFailed, Details: outcome.Error}
+	case results.StatusUpdated, results.StatusSkipped:
+		var details strings.Builder
+
+		for _, replacement := range outcome.Replacements {
+			fmt.Fprintf(&details, "%s -> %s (%s)\n", replacement.OldAMI, replacement.NewAMI, replacement.Name)
+		}
+
+		testCase.Failure = &Problem{
+			Message: fmt.Sprintf("%d outdated AMI IDs", max(outcome.Count, len(outcome.Replacements))),
+			Type:    failureOutdated,
+			Details: details.String(),
+		}
+	}
+
+	return testCase
+}
+
+func seconds(summary *results.Summary) string {
+	return strconv.FormatFloat(summary.FinishedAt.Sub(summary.StartedAt).Seconds(), 'f', 3, 64)
+}
+
+func (s *TestSuites) Write(writer io.Writer) error {
+	_, err := io.WriteString(writer, xml.Header)
+	if err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+
+	encoder := xml.NewEncoder(writer)
+	encoder.Indent("", "  ")
+
+	err = encoder.Encode(s)
+	if err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+
+	_, err = io.WriteString(writer, "\n")
+	if err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+
+	return nil
+}
+
+// WriteFile writes the report to path, replacing any earlier report.
+func WriteFile(path string, suites *TestSuites) error {
+	file, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, FilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create JUnit report: %w", err)
+	}
+	defer file.Close()
+
+	return suites.Write(file)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Log formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// LevelTrace is the level of per-file detail, below the per-account and
+// per-region progress logged at debug.
+const LevelTrace = slog.LevelDebug - 4
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported log format")
+	ErrUnsupportedLevel  = errors.New("unsupported log level")
+)
+
+// ParseLevel parses a log level: trace, debug, info, warn, or error.
+func ParseLevel(level string) (slog.Level, error) {
+	if strings.EqualFold(level, "trace") {
+		return LevelTrace, nil
+	}
+
+	var parsed slog.Level
+
+	err := parsed.UnmarshalText([]byte(level))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s (must be trace, debug, info, warn, or error)", ErrUnsupportedLevel, level)
+	}
+
+	return parsed, nil
+}
+
+// VerbosityLevel returns the log level for a verbosity, the number of -v
+// flags given: info, debug for -v, and trace for -vv. Quiet logs only
+// warnings and errors.
+func VerbosityLevel(verbosity int, quiet bool) slog.Level {
+	switch {
+	case quiet:
+		return slog.LevelWarn
+	case verbosity >= 2:
+		return LevelTrace
+	case verbosity == 1:
+		return slog.LevelDebug
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// New returns a logger writing the records at level or above to writer, as
+// logfmt-style text or as one JSON object per line. An empty format is text.
+func New(writer io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: replaceLevelName}
+
+	switch format {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(writer, options)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(writer, options)), nil
+	default:
+		return nil, fmt.Errorf("%w: %s (must be %s or %s)", ErrUnsupportedFormat, format, FormatText, FormatJSON)
+	}
+}
+
+// Trace logs per-file detail with the default logger.
+func Trace(msg string, args ...any) {
+	slog.Default().Log(context.Background(), LevelTrace, msg, args...)
+}
+
+// replaceLevelName names LevelTrace TRACE rather than DEBUG-4.
+func replaceLevelName(_ []string, attr slog.Attr) slog.Attr {
+	if attr.Key == slog.LevelKey {
+		if level, ok := attr.Value.Any().(slog.Level); ok && level == LevelTrace {
+			attr.Value = slog.StringValue("TRACE")
+		}
+	}
+
+	return attr
+}
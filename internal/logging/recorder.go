@@ -0,0 +1,100 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Recorder is a handler that keeps the warnings and errors logged through it,
+// whatever the level of the handler it passes records on to, so that they can
+// be reported together when the run ends.
+type Recorder struct {
+	handler slog.Handler
+	attrs   []slog.Attr
+	store   *recorded
+}
+
+type recorded struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+// NewRecorder returns a Recorder passing records on to handler.
+func NewRecorder(handler slog.Handler) *Recorder {
+	return &Recorder{handler: handler, store: &recorded{}}
+}
+
+// Warnings returns the warnings and errors logged so far, as their message
+// followed by their attributes.
+func (r *Recorder) Warnings() []string {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	return append([]string(nil), r.store.warnings...)
+}
+
+// Reset forgets the warnings and errors logged so far, such as between the
+// runs of a schedule.
+func (r *Recorder) Reset() {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.warnings = nil
+}
+
+func (r *Recorder) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || r.handler.Enabled(ctx, level)
+}
+
+func (r *Recorder) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelWarn {
+		r.record(record)
+	}
+
+	if !r.handler.Enabled(ctx, record.Level) {
+		return nil
+	}
+
+	return r.handler.Handle(ctx, record) //nolint:wrapcheck
+}
+
+func (r *Recorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Recorder{
+		handler: r.handler.WithAttrs(attrs),
+		attrs:   append(append([]slog.Attr(nil), r.attrs...), attrs...),
+		store:   r.store,
+	}
+}
+
+func (r *Recorder) WithGroup(name string) slog.Handler {
+	return &Recorder{handler: r.handler.WithGroup(name), attrs: r.attrs, store: r.store}
+}
+
+func (r *Recorder) record(record slog.Record) {
+	var builder strings.Builder
+
+	builder.WriteString(record.Message)
+
+	writeAttr := func(attr slog.Attr) bool {
+		builder.WriteString(" " + attr.Key + "=" + attr.Value.String())
+
+		return true
+	}
+
+	for _, attr := range r.attrs {
+		writeAttr(attr)
+	}
+
+	record.Attrs(writeAttr)
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.warnings = append(r.store.warnings, builder.String())
+}
@@ -0,0 +1,113 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package mapping
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+)
+
+const (
+	DirPerm  = 0o755
+	FilePerm = 0o600
+)
+
+type Entry struct {
+	OldAMI  string `json:"oldAmi"`
+	NewAMI  string `json:"newAmi"`
+	Name    string `json:"name"`
+	Account string `json:"account"`
+	Region  string `json:"region"`
+
+	// SourceRegion is set when OldAMI belongs to another region and NewAMI is
+	// its equivalent in Region.
+	SourceRegion string `json:"sourceRegion,omitempty"`
+}
+
+// Mapping is the old→new AMI mapping computed by a run, in a form that can be
+// handed to other tooling or applied later without AWS access.
+type Mapping struct {
+	GeneratedAt  time.Time `json:"generatedAt"`
+	Replacements []Entry   `json:"replacements"`
+}
+
+func New(replacements []aws.AMIReplacement) *Mapping {
+	entries := make([]Entry, 0, len(replacements))
+
+	for _, replacement := range replacements {
+		entries = append(entries, Entry{
+			OldAMI:  replacement.OldAMI,
+			NewAMI:  replacement.NewAMI,
+			Name:    replacement.Name,
+			Account: replacement.Account,
+			Region:  replacement.Region,
+
+			SourceRegion: replacement.SourceRegion,
+		})
+	}
+
+	return &Mapping{
+		GeneratedAt:  time.Now().UTC(),
+		Replacements: entries,
+	}
+}
+
+func Load(filename string) (*Mapping, error) {
+	content, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping file: %w", err)
+	}
+
+	var loaded Mapping
+
+	err = json.Unmarshal(content, &loaded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode mapping file %s: %w", filename, err)
+	}
+
+	return &loaded, nil
+}
+
+func (m *Mapping) AMIReplacements() []aws.AMIReplacement {
+	replacements := make([]aws.AMIReplacement, 0, len(m.Replacements))
+
+	for _, entry := range m.Replacements {
+		replacements = append(replacements, aws.AMIReplacement{
+			OldAMI:  entry.OldAMI,
+			NewAMI:  entry.NewAMI,
+			Name:    entry.Name,
+			Account: entry.Account,
+			Region:  entry.Region,
+
+			SourceRegion: entry.SourceRegion,
+		})
+	}
+
+	return replacements
+}
+
+func (m *Mapping) Save(filename string) error {
+	err := os.MkdirAll(filepath.Dir(filename), DirPerm)
+	if err != nil {
+		return fmt.Errorf("failed to create mapping directory: %w", err)
+	}
+
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode mapping: %w", err)
+	}
+
+	err = os.WriteFile(filename, append(content, '\n'), FilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to write mapping file: %w", err)
+	}
+
+	return nil
+}
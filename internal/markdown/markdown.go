@@ -0,0 +1,272 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package markdown
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/results"
+)
+
+const FilePerm = 0o644
+
+// cellEscaper keeps values from breaking out of table cells.
+var cellEscaper = strings.NewReplacer("|", `\|`, "\r", " ", "\n", " ")
+
+// New returns a summary of the finished run for people, in Markdown, to paste
+// into pull request descriptions or change tickets: the replacements by
+// account and region, the files affected, and what was skipped or failed.
+func New(summary *results.Summary) string {
+	var builder strings.Builder
+
+	builder.WriteString("# AMI Update Summary\n\n")
+	builder.WriteString(overview(summary))
+
+	writeReplacements(&builder, summary)
+	writeFiles(&builder, summary)
+	writeAttention(&builder, summary)
+	writeSkipped(&builder, summary)
+	writeFailures(&builder, summary)
+
+	return builder.String()
+}
+
+// WriteFile writes the summary of the run to path, replacing any earlier
+// summary.
+func WriteFile(path string, summary *results.Summary) error {
+	err := os.WriteFile(filepath.Clean(path), []byte(New(summary)), FilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to write Markdown summary: %w", err)
+	}
+
+	return nil
+}
+
+func overview(summary *results.Summary) string {
+	replaced, changed := 0, 0
+
+	for _, file := range summary.Files {
+		if file.Status == results.StatusUpdated {
+			replaced += file.Count
+			changed++
+		}
+	}
+
+	var builder strings.Builder
+
+	switch {
+	case changed == 0:
+		builder.WriteString("No AMI IDs needed replacing.\n")
+	case summary.DiffOnly:
+		fmt.Fprintf(&builder, "%d AMI IDs in %d files would be replaced. Diff only, no files were written.\n",
+			replaced, changed)
+	default:
+		fmt.Fprintf(&builder, "Replaced %d AMI IDs in %d files.\n", replaced, changed)
+	}
+
+	fmt.Fprintf(&builder, "\n- Started: %s\n", summary.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(&builder, "- Duration: %s\n", summary.FinishedAt.Sub(summary.StartedAt).Round(time.Millisecond))
+
+	if len(summary.Paths) > 0 {
+		fmt.Fprintf(&builder, "- Paths: %s\n", code(summary.Paths))
+	}
+
+	if len(summary.Accounts) > 0 {
+		fmt.Fprintf(&builder, "- Accounts: %s\n", code(summary.Accounts))
+	}
+
+	if len(summary.Regions) > 0 {
+		fmt.Fprintf(&builder, "- Regions: %s\n", code(summary.Regions))
+	}
+
+	fmt.Fprintf(&builder, "- Exit code: %d\n", summary.ExitCode)
+
+	return builder.String()
+}
+
+// writeReplacements writes a table of the resolved replacements for every
+// account and region, with the files that received each.
+func writeReplacements(builder *strings.Builder, summary *results.Summary) {
+	if len(summary.Resolutions) == 0 {
+		return
+	}
+
+	resolutions := slices.Clone(summary.Resolutions)
+	slices.SortStableFunc(resolutions, func(a, b results.Resolution) int {
+		return cmp.Or(cmp.Compare(a.Account, b.Account), cmp.Compare(a.Region, b.Region))
+	})
+
+	builder.WriteString("\n## Replacements\n")
+
+	for index, resolution := range resolutions {
+		if index == 0 || resolution.Account != resolutions[index-1].Account ||
+			resolution.Region != resolutions[index-1].Region {
+			fmt.Fprintf(builder, "\n### %s / %s\n\n", cmp.Or(resolution.Account, "-"), cmp.Or(resolution.Region, "-"))
+			builder.WriteString("| Old AMI | New AMI | Name | Created | Files |\n")
+			builder.WriteString("|---|---|---|---|---|\n")
+		}
+
+		created := "-"
+		if resolution.Created != nil {
+			created = resolution.Created.Format(time.DateOnly)
+		}
+
+		files := "-"
+		if received := filesReceiving(summary, resolution); len(received) > 0 {
+			files = code(received)
+		}
+
+		fmt.Fprintf(builder, "| `%s` | `%s` | %s | %s | %s |\n", resolution.OldAMI, resolution.NewAMI,
+			cell(cmp.Or(resolution.Name, "-")), created, files)
+	}
+}
+
+// filesReceiving returns the files the run replaced, or would have, the old
+// AMI of resolution in.
+func filesReceiving(summary *results.Summary, resolution results.Resolution) []string {
+	var files []string
+
+	for _, file := range summary.Files {
+		if file.Status != results.StatusUpdated {
+			continue
+		}
+
+		for _, replacement := range file.Replacements {
+			if replacement.OldAMI == resolution.OldAMI && replacement.NewAMI == resolution.NewAMI &&
+				!slices.Contains(files, file.Path) {
+				files = append(files, file.Path)
+			}
+		}
+	}
+
+	return files
+}
+
+func writeFiles(builder *strings.Builder, summary *results.Summary) {
+	var rows []results.File
+
+	for _, file := range summary.Files {
+		if file.Status == results.StatusUpdated {
+			rows = append(rows, file)
+		}
+	}
+
+	if len(rows) == 0 {
+		return
+	}
+
+	builder.WriteString("\n## Affected Files\n\n")
+	builder.WriteString("| File | Replacements | Backup |\n")
+	builder.WriteString("|---|---|---|\n")
+
+	for _, file := range rows {
+		backup := "-"
+		if file.BackupPath != "" {
+			backup = code([]string{file.BackupPath})
+		}
+
+		fmt.Fprintf(builder, "| %s | %d | %s |\n", code([]string{file.Path}), file.Count, backup)
+	}
+}
+
+// writeAttention lists the referenced AMIs that are stale or no longer exist.
+func writeAttention(builder *strings.Builder, summary *results.Summary) {
+	if len(summary.Attention) == 0 {
+		return
+	}
+
+	builder.WriteString("\n## Attention Needed\n\n")
+	builder.WriteString("| AMI | Status | Name | Created | Files |\n")
+	builder.WriteString("|---|---|---|---|---|\n")
+
+	for _, entry := range summary.Attention {
+		created := "-"
+		if entry.Created != nil {
+			created = fmt.Sprintf("%s (%d days)", entry.Created.Format(time.DateOnly), entry.AgeDays)
+		}
+
+		fmt.Fprintf(builder, "| `%s` | %s | %s | %s | %s |\n", entry.AMI, entry.Status,
+			cell(cmp.Or(entry.Name, "-")), created, code(entry.Files))
+	}
+}
+
+// writeSkipped lists the files whose replacements were not confirmed.
+func writeSkipped(builder *strings.Builder, summary *results.Summary) {
+	var skipped []results.File
+
+	for _, file := range summary.Files {
+		if file.Status == results.StatusSkipped {
+			skipped = append(skipped, file)
+		}
+	}
+
+	if len(skipped) == 0 {
+		return
+	}
+
+	builder.WriteString("\n## Skipped\n\n")
+	builder.WriteString("| File | Replacements not made |\n")
+	builder.WriteString("|---|---|\n")
+
+	for _, file := range skipped {
+		fmt.Fprintf(builder, "| %s | %d |\n", code([]string{file.Path}), max(file.Count, len(file.Replacements)))
+	}
+}
+
+// writeFailures lists the files that could not be processed, the lookups
+// that failed, and the error that stopped the run, if any.
+func writeFailures(builder *strings.Builder, summary *results.Summary) {
+	type row struct{ subject, message string }
+
+	var rows []row
+
+	for _, file := range summary.Files {
+		if file.Status == results.StatusFailed {
+			rows = append(rows, row{code([]string{file.Path}), file.Error})
+		}
+	}
+
+	for _, runError := range summary.Errors {
+		subject := "Run"
+		if runError.Account != "" || runError.Region != "" {
+			subject = fmt.Sprintf("Lookup in %s / %s", cmp.Or(runError.Account, "-"), cmp.Or(runError.Region, "-"))
+		}
+
+		rows = append(rows, row{subject, runError.Message})
+	}
+
+	if len(rows) == 0 {
+		return
+	}
+
+	builder.WriteString("\n## Failures\n\n")
+	builder.WriteString("| Item | Error |\n")
+	builder.WriteString("|---|---|\n")
+
+	for _, r := range rows {
+		fmt.Fprintf(builder, "| %s | %s |\n", r.subject, cell(r.message))
+	}
+}
+
+// code formats values as inline code, separated by commas.
+func code(values []string) string {
+	formatted := make([]string, 0, len(values))
+
+	for _, value := range values {
+		formatted = append(formatted, "`"+cell(value)+"`")
+	}
+
+	return strings.Join(formatted, ", ")
+}
+
+func cell(value string) string {
+	return cellEscaper.Replace(value)
+}
@@ -0,0 +1,287 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/results"
+)
+
+const (
+	// Job is the job label of metrics pushed to a Pushgateway.
+	Job = "ami-util"
+
+	// FileSuffix is the suffix of the files the textfile collector reads.
+	FileSuffix = ".prom"
+
+	FilePerm = 0o644
+
+	contentType    = "text/plain; version=0.0.4"
+	requestTimeout = 30 * time.Second
+	maxErrorBytes  = 4096
+)
+
+var ErrPushFailed = errors.New("failed to push metrics")
+
+// labelValueReplacer escapes label values in the text exposition format.
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Run is the metrics of a single run. Labels are added to every metric.
+type Run struct {
+	Labels map[string]string
+
+	FinishedAt time.Time
+	Duration   time.Duration
+	Success    bool
+	ExitCode   int
+
+	Resolutions    int
+	Replacements   int
+	FilesProcessed int
+	FilesChanged   int
+	Errors         int
+
+	// UpdateLag is the age of the oldest replacement AMI applied, or that
+	// would have been applied with DiffOnly: how long the files were behind
+	// the latest AMI.
+	UpdateLag time.Duration
+
+	APICalls []aws.APICall
+}
+
+// New returns the metrics of the finished run described by summary.
+func New(summary *results.Summary, labels map[string]string, apiCalls []aws.APICall) Run {
+	run := Run{
+		Labels:      labels,
+		FinishedAt:  summary.FinishedAt,
+		Duration:    summary.FinishedAt.Sub(summary.StartedAt),
+		Success:     summary.Success,
+		ExitCode:    summary.ExitCode,
+		Resolutions: len(summary.Resolutions),
+		Errors:      summary.Failures(),
+		APICalls:    apiCalls,
+	}
+
+	created := make(map[string]time.Time, len(summary.Resolutions))
+
+	for _, resolution := range summary.Resolutions {
+		if resolution.Created != nil {
+			created[resolution.NewAMI] = *resolution.Created
+		}
+	}
+
+	run.FilesProcessed = len(summary.Files)
+
+	for _, file := range summary.Files {
+		if file.Status != results.StatusUpdated {
+			continue
+		}
+
+		run.FilesChanged++
+		run.Replacements += file.Count
+
+		for _, replacement := range file.Replacements {
+			published, ok := created[replacement.NewAMI]
+			if ok {
+				run.UpdateLag = max(run.UpdateLag, summary.FinishedAt.Sub(published))
+			}
+		}
+	}
+
+	return run
+}
+
+// Write writes the metrics in the Prometheus text exposition format.
+func (r Run) Write(writer io.Writer) error {
+	var buffer bytes.Buffer
+
+	success := 0
+	if r.Success {
+		success = 1
+	}
+
+	gauges := []struct {
+		name  string
+		help  string
+		value float64
+	}{
+		{"ami_util_last_run_timestamp_seconds", "Time the last run finished, in seconds since the epoch.",
+			float64(r.FinishedAt.Unix())},
+		{"ami_util_last_run_duration_seconds", "Duration of the last run.", r.Duration.Seconds()},
+		{"ami_util_last_run_success", "Whether the last run succeeded.", float64(success)},
+		{"ami_util_last_run_exit_code", "Exit code of the last run.", float64(r.ExitCode)},
+		{"ami_util_resolutions", "AMI replacements resolved by the last run.", float64(r.Resolutions)},
+		{"ami_util_replacements", "AMI IDs replaced in files by the last run.", float64(r.Replacements)},
+		{"ami_util_files_processed", "Files processed by the last run.", float64(r.FilesProcessed)},
+		{"ami_util_files_changed", "Files changed by the last run.", float64(r.FilesChanged)},
+		{"ami_util_errors", "Failed lookups and files of the last run.", float64(r.Errors)},
+		{"ami_util_update_lag_seconds", "Age of the oldest replacement AMI the last run applied.",
+			r.UpdateLag.Seconds()},
+	}
+
+	labels := r.labelPairs()
+
+	for _, gauge := range gauges {
+		fmt.Fprintf(&buffer, "# HELP %s %s\n# TYPE %s gauge\n", gauge.name, gauge.help, gauge.name)
+		fmt.Fprintf(&buffer, "%s%s %s\n", gauge.name, formatLabels(labels),
+			strconv.FormatFloat(gauge.value, 'g', -1, 64))
+	}
+
+	buffer.WriteString("# HELP ami_util_aws_api_calls AWS API calls made by the last run.\n")
+	buffer.WriteString("# TYPE ami_util_aws_api_calls gauge\n")
+
+	for _, call := range r.APICalls {
+		callLabels := append(slices.Clone(labels), [2]string{"service", call.Service},
+			[2]string{"operation", call.Operation})
+
+		fmt.Fprintf(&buffer, "ami_util_aws_api_calls%s %d\n", formatLabels(callLabels), call.Count)
+	}
+
+	_, err := writer.Write(buffer.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+
+	return nil
+}
+
+// WriteFile writes the metrics to path for the node exporter's textfile
+// collector, replacing the file at once so it is never read half written.
+func WriteFile(path string, run Run) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+
+	defer os.Remove(temp.Name())
+
+	err = run.Write(temp)
+	if err != nil {
+		_ = temp.Close()
+
+		return err
+	}
+
+	err = temp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+
+	err = os.Chmod(temp.Name(), FilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+
+	err = os.Rename(temp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+
+	return nil
+}
+
+// Push replaces the metrics of the run's group on the Pushgateway at
+// gatewayURL. The group is the ami-util job and the run's labels.
+func Push(ctx context.Context, gatewayURL string, run Run) error {
+	var buffer bytes.Buffer
+
+	// The group's labels are added by the Pushgateway
+	grouped := run
+	grouped.Labels = nil
+
+	err := grouped.Write(&buffer)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, groupURL(gatewayURL, run.labelPairs()), &buffer)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", contentType)
+
+	httpClient := &http.Client{Timeout: requestTimeout}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPushFailed, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBytes))
+
+		return fmt.Errorf("%w: %s: %s", ErrPushFailed, response.Status, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
+
+// groupURL returns the Pushgateway URL of the group of labels, encoding
+// values that cannot be path segments in base64.
+func groupURL(gatewayURL string, labels [][2]string) string {
+	var builder strings.Builder
+
+	builder.WriteString(strings.TrimSuffix(gatewayURL, "/"))
+	builder.WriteString("/metrics/job/" + Job)
+
+	for _, label := range labels {
+		name, value := label[0], label[1]
+
+		// An empty value is a lone padding character
+		if value == "" || strings.Contains(value, "/") {
+			fmt.Fprintf(&builder, "/%s@base64/%s", name, cmp.Or(base64.URLEncoding.EncodeToString([]byte(value)), "="))
+
+			continue
+		}
+
+		fmt.Fprintf(&builder, "/%s/%s", name, url.PathEscape(value))
+	}
+
+	return builder.String()
+}
+
+// labelPairs returns the run's labels sorted by name.
+func (r Run) labelPairs() [][2]string {
+	pairs := make([][2]string, 0, len(r.Labels))
+
+	for _, name := range slices.Sorted(maps.Keys(r.Labels)) {
+		pairs = append(pairs, [2]string{name, r.Labels[name]})
+	}
+
+	return pairs
+}
+
+func formatLabels(labels [][2]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	formatted := make([]string, 0, len(labels))
+
+	for _, label := range labels {
+		formatted = append(formatted, label[0]+`="`+labelValueReplacer.Replace(label[1])+`"`)
+	}
+
+	return "{" + strings.Join(formatted, ",") + "}"
+}
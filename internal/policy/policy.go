@@ -0,0 +1,157 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"go.yaml.in/yaml/v3"
+)
+
+// Variable is the name the metadata of the AMI under evaluation is bound to
+// in rule expressions.
+const Variable = "ami"
+
+var (
+	ErrViolation       = errors.New("policy violation")
+	ErrInvalidPolicy   = errors.New("invalid policy")
+	ErrEmptyExpression = errors.New("expression is empty")
+	ErrNotBool         = errors.New("expression must evaluate to a bool")
+)
+
+// Rule is a CEL expression that every AMI accepted as a replacement must
+// satisfy.
+type Rule struct {
+	Name       string `yaml:"name"`
+	Expression string `yaml:"expression"`
+
+	// Message explains a violation of the rule, in place of its expression.
+	Message string `yaml:"message"`
+}
+
+type file struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+type compiledRule struct {
+	Rule
+
+	program cel.Program
+}
+
+// Policy is a set of rules that AMIs must pass before they are accepted as
+// replacements.
+type Policy struct {
+	rules []compiledRule
+}
+
+// Load reads and compiles the policy file at path.
+func Load(path string) (*Policy, error) {
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	policy, err := Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return policy, nil
+}
+
+// Parse compiles a policy from YAML content holding a list of rules, each a
+// CEL expression over the metadata of an AMI that must evaluate to true.
+func Parse(content []byte) (*Policy, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	var parsed file
+
+	err := decoder.Decode(&parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPolicy, err)
+	}
+
+	if len(parsed.Rules) == 0 {
+		return nil, fmt.Errorf("%w: no rules", ErrInvalidPolicy)
+	}
+
+	env, err := cel.NewEnv(cel.Variable(Variable, cel.MapType(cel.StringType, cel.DynType)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL environment: %w", err)
+	}
+
+	policy := &Policy{rules: make([]compiledRule, 0, len(parsed.Rules))}
+
+	for i, rule := range parsed.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rules[%d]", i)
+		}
+
+		program, err := compile(env, rule.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("%w: rule %s: %w", ErrInvalidPolicy, rule.Name, err)
+		}
+
+		policy.rules = append(policy.rules, compiledRule{Rule: rule, program: program})
+	}
+
+	return policy, nil
+}
+
+func compile(env *cel.Env, expression string) (cel.Program, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, ErrEmptyExpression
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("%w, not %s", ErrNotBool, ast.OutputType())
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build program: %w", err)
+	}
+
+	return program, nil
+}
+
+// Check evaluates every rule against the metadata of an AMI, returning an
+// error wrapping ErrViolation for the first one it does not pass. Rules that
+// fail to evaluate, such as those reading a missing tag, are not passed.
+func (p *Policy) Check(ami map[string]any) error {
+	for _, rule := range p.rules {
+		out, _, err := rule.program.Eval(map[string]any{Variable: ami})
+		if err != nil {
+			return fmt.Errorf("%w: rule %s: %w", ErrViolation, rule.Name, err)
+		}
+
+		if passed, ok := out.Value().(bool); !ok || !passed {
+			return fmt.Errorf("%w: rule %s: %s", ErrViolation, rule.Name, rule.describe())
+		}
+	}
+
+	return nil
+}
+
+func (r compiledRule) describe() string {
+	if r.Message != "" {
+		return r.Message
+	}
+
+	return "not satisfied: " + r.Expression
+}
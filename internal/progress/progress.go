@@ -0,0 +1,233 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package progress
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultInterval is how often progress lines are logged when stderr is
+	// not a terminal.
+	DefaultInterval = 10 * time.Second
+
+	// redrawInterval limits how often the progress bar is redrawn.
+	redrawInterval = 100 * time.Millisecond
+
+	barWidth = 30
+
+	// clearLine returns the cursor to the start of the line and erases it.
+	clearLine = "\r\033[K"
+)
+
+// reporter draws the progress bar of the current phase on a terminal, or logs
+// progress lines periodically anywhere else, such as in CI. It guards the bar
+// line, which log records written through Writer are kept clear of.
+type reporter struct {
+	mu       sync.Mutex
+	out      io.Writer
+	terminal bool
+	enabled  bool
+	paused   int
+	interval time.Duration
+	bar      string
+}
+
+var std = &reporter{out: os.Stderr, terminal: isTerminal(os.Stderr), enabled: true, interval: DefaultInterval}
+
+// SetEnabled turns progress reporting on or off, for runs that are quiet or
+// whose terminal is busy with prompts.
+func SetEnabled(enabled bool) {
+	std.mu.Lock()
+	defer std.mu.Unlock()
+
+	std.enabled = enabled
+}
+
+// Pause clears the progress bar and stops drawing it until the returned
+// function is called, so a prompt can use the terminal.
+func Pause() func() {
+	std.mu.Lock()
+	defer std.mu.Unlock()
+
+	std.paused++
+
+	if std.terminal && std.bar != "" {
+		_, _ = io.WriteString(std.out, clearLine)
+	}
+
+	return func() {
+		std.mu.Lock()
+		defer std.mu.Unlock()
+
+		std.paused--
+		if std.paused == 0 && std.bar != "" {
+			_, _ = io.WriteString(std.out, std.bar)
+		}
+	}
+}
+
+// Writer returns a writer to stderr for log records. On a terminal, it clears
+// the progress bar before each record and draws it again after.
+func Writer() io.Writer {
+	if !std.terminal {
+		return os.Stderr
+	}
+
+	return logWriter{}
+}
+
+type logWriter struct{}
+
+func (logWriter) Write(record []byte) (int, error) {
+	std.mu.Lock()
+	defer std.mu.Unlock()
+
+	if std.bar == "" || std.paused > 0 {
+		return std.out.Write(record)
+	}
+
+	_, _ = io.WriteString(std.out, clearLine)
+
+	written, err := std.out.Write(record)
+
+	_, _ = io.WriteString(std.out, std.bar)
+
+	return written, err
+}
+
+// isTerminal reports whether file is an interactive terminal that can redraw
+// a line in place.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+}
+
+// Phase is a part of a run with a known number of steps, such as the
+// account/region lookups or the files to process. Its methods are safe for
+// concurrent use, and do nothing on a nil Phase.
+type Phase struct {
+	name    string
+	unit    string
+	total   int
+	done    int
+	updated int
+
+	lastDraw time.Time
+	lastLog  time.Time
+}
+
+// Start starts a phase of total steps, counted in unit. It returns nil when
+// progress reporting is disabled or there is at most one step.
+func Start(name, unit string, total int) *Phase {
+	std.mu.Lock()
+	defer std.mu.Unlock()
+
+	if !std.enabled || total <= 1 {
+		return nil
+	}
+
+	return &Phase{name: name, unit: unit, total: total, lastLog: time.Now()}
+}
+
+// Step records a completed step.
+func (p *Phase) Step() {
+	p.step(false)
+}
+
+// StepUpdated records a completed step that updated something, such as a
+// file that received replacements.
+func (p *Phase) StepUpdated() {
+	p.step(true)
+}
+
+func (p *Phase) step(updated bool) {
+	if p == nil {
+		return
+	}
+
+	std.mu.Lock()
+
+	p.done++
+	if updated {
+		p.updated++
+	}
+
+	now := time.Now()
+
+	if std.terminal {
+		if p.done == p.total || now.Sub(p.lastDraw) >= redrawInterval {
+			p.lastDraw = now
+			std.bar = p.render()
+
+			if std.paused == 0 {
+				_, _ = io.WriteString(std.out, clearLine+std.bar)
+			}
+		}
+
+		std.mu.Unlock()
+
+		return
+	}
+
+	due := now.Sub(p.lastLog) >= std.interval && p.done < p.total
+	if due {
+		p.lastLog = now
+	}
+
+	done, total, changed := p.done, p.total, p.updated
+
+	// Log records are written without holding the lock, which the log
+	// writer takes on a terminal.
+	std.mu.Unlock()
+
+	if due {
+		args := []any{"phase", p.name, "done", done, "total", total}
+		if changed > 0 {
+			args = append(args, "updated", changed)
+		}
+
+		slog.Info("Progress", args...)
+	}
+}
+
+// Finish ends the phase, clearing its progress bar.
+func (p *Phase) Finish() {
+	if p == nil {
+		return
+	}
+
+	std.mu.Lock()
+	defer std.mu.Unlock()
+
+	if std.terminal && std.bar != "" && std.paused == 0 {
+		_, _ = io.WriteString(std.out, clearLine)
+	}
+
+	std.bar = ""
+}
+
+// render returns the progress bar line of the phase.
+func (p *Phase) render() string {
+	filled := barWidth * p.done / p.total
+
+	line := fmt.Sprintf("%s [%s%s] %d/%d %s", p.name, strings.Repeat("=", filled),
+		strings.Repeat(" ", barWidth-filled), p.done, p.total, p.unit)
+	if p.updated > 0 {
+		line += fmt.Sprintf(", %d updated", p.updated)
+	}
+
+	return line
+}
@@ -0,0 +1,294 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+const (
+	DirPerm  = 0o700
+	FilePerm = 0o600
+
+	// FetchTimeout bounds how long fetching a remote file may take.
+	FetchTimeout = 30 * time.Second
+
+	cacheDir      = "cache"
+	etagExtension = ".etag"
+	maxFileBytes  = 16 * 1024 * 1024
+)
+
+var (
+	ErrUnsupportedSource = errors.New("unsupported remote source")
+	ErrChecksumMismatch  = errors.New("checksum mismatch")
+	ErrFetchFailed       = errors.New("failed to fetch remote file")
+)
+
+// Options configure how remote files are fetched.
+type Options struct {
+	// Profile is the AWS profile whose credentials read S3 objects.
+	Profile string
+	// SHA256 is the hex-encoded SHA-256 checksum the file must have, if set.
+	SHA256 string
+	// CacheDir holds the fetched files, ~/.ami-util/cache if empty.
+	CacheDir string
+}
+
+// IsRemote reports whether source names an S3 object or an HTTPS URL rather
+// than a local file.
+func IsRemote(source string) bool {
+	return strings.HasPrefix(source, "s3://") || strings.HasPrefix(source, "https://")
+}
+
+// Resolve returns the location of ref relative to the remote source, as a
+// relative include path is resolved relative to the including file.
+func Resolve(source, ref string) (string, error) {
+	base, err := url.Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %w", ErrUnsupportedSource, source, err)
+	}
+
+	relative, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %w", ErrUnsupportedSource, ref, err)
+	}
+
+	return base.ResolveReference(relative).String(), nil
+}
+
+// Fetch downloads the S3 object or HTTPS URL named by source into the local
+// cache and returns the path of the cached copy. The ETag of the cached copy
+// is sent with the request, so an unchanged file is not downloaded again, and
+// the contents are checked against the expected checksum, if any, whether
+// they were downloaded or cached.
+func Fetch(ctx context.Context, source string, options Options) (string, error) {
+	cached, err := cachePath(source, options.CacheDir)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, FetchTimeout)
+	defer cancel()
+
+	etag := readETag(cached)
+
+	var fetched *fetchResult
+
+	switch {
+	case strings.HasPrefix(source, "s3://"):
+		fetched, err = fetchS3(ctx, source, etag, options.Profile)
+	case strings.HasPrefix(source, "https://"):
+		fetched, err = fetchHTTPS(ctx, source, etag)
+	default:
+		err = fmt.Errorf("%w: %s must start with s3:// or https://", ErrUnsupportedSource, source)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	content := fetched.content
+	if fetched.notModified {
+		content, err = os.ReadFile(filepath.Clean(cached))
+		if err != nil {
+			return "", fmt.Errorf("failed to read cached copy of %s: %w", source, err)
+		}
+	}
+
+	err = verify(source, content, options.SHA256)
+	if err != nil {
+		return "", err
+	}
+
+	if !fetched.notModified {
+		err = store(cached, content, fetched.etag)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return cached, nil
+}
+
+type fetchResult struct {
+	content     []byte
+	etag        string
+	notModified bool
+}
+
+func fetchHTTPS(ctx context.Context, source, etag string) (*fetchResult, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrFetchFailed, source, err)
+	}
+
+	if etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrFetchFailed, source, err)
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusNotModified:
+		return &fetchResult{notModified: true}, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("%w %s: %s", ErrFetchFailed, source, response.Status)
+	}
+
+	content, err := readAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrFetchFailed, source, err)
+	}
+
+	return &fetchResult{content: content, etag: response.Header.Get("ETag")}, nil
+}
+
+func fetchS3(ctx context.Context, source, etag, profile string) (*fetchResult, error) {
+	bucket, key, found := strings.Cut(strings.TrimPrefix(source, "s3://"), "/")
+	if !found || bucket == "" || key == "" {
+		return nil, fmt.Errorf("%w: %s must be s3://bucket/key", ErrUnsupportedSource, source)
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithSharedConfigProfile(profile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	input := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if etag != "" {
+		input.IfNoneMatch = aws.String(etag)
+	}
+
+	output, err := s3.NewFromConfig(cfg).GetObject(ctx, input)
+	if err != nil {
+		var responseError *smithyhttp.ResponseError
+		if errors.As(err, &responseError) && responseError.HTTPStatusCode() == http.StatusNotModified {
+			return &fetchResult{notModified: true}, nil
+		}
+
+		return nil, fmt.Errorf("%w %s: %w", ErrFetchFailed, source, err)
+	}
+	defer output.Body.Close()
+
+	content, err := readAll(output.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrFetchFailed, source, err)
+	}
+
+	return &fetchResult{content: content, etag: aws.ToString(output.ETag)}, nil
+}
+
+func readAll(reader io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(reader, maxFileBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) > maxFileBytes {
+		return nil, fmt.Errorf("file is larger than %d bytes", maxFileBytes)
+	}
+
+	return content, nil
+}
+
+func verify(source string, content []byte, expected string) error {
+	if expected == "" {
+		return nil
+	}
+
+	sum := sha256.Sum256(content)
+	if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%w: %s has SHA-256 %s, expected %s", ErrChecksumMismatch, source, actual, expected)
+	}
+
+	return nil
+}
+
+// cachePath returns where the cached copy of source is kept. The name keeps
+// the extension of source, so that its format is still known.
+func cachePath(source, dir string) (string, error) {
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find home directory: %w", err)
+		}
+
+		dir = filepath.Join(home, ".ami-util", cacheDir)
+	}
+
+	sum := sha256.Sum256([]byte(source))
+	extension := path.Ext(strings.SplitN(source, "?", 2)[0])
+
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+extension), nil
+}
+
+func readETag(cached string) string {
+	if _, err := os.Stat(cached); err != nil {
+		return ""
+	}
+
+	etag, err := os.ReadFile(filepath.Clean(cached + etagExtension))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(etag))
+}
+
+// store replaces the cached copy and its ETag, writing the copy to a
+// temporary file first so a failed write never leaves a partial one.
+func store(cached string, content []byte, etag string) error {
+	err := os.MkdirAll(filepath.Dir(cached), DirPerm)
+	if err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	temporary := cached + ".tmp"
+
+	err = os.WriteFile(temporary, content, FilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to cache remote file: %w", err)
+	}
+
+	err = os.Rename(temporary, cached)
+	if err != nil {
+		return fmt.Errorf("failed to cache remote file: %w", err)
+	}
+
+	if etag == "" {
+		_ = os.Remove(cached + etagExtension)
+
+		return nil
+	}
+
+	err = os.WriteFile(cached+etagExtension, []byte(etag), FilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to cache remote file: %w", err)
+	}
+
+	return nil
+}
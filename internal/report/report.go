@@ -0,0 +1,311 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+	"github.com/schnauzersoft/ami-util/internal/results"
+
+	"go.yaml.in/yaml/v3"
+)
+
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+	FormatCSV   = "csv"
+
+	FilePerm = 0o644
+
+	tableColumnPadding = 2
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported report format")
+
+// Formats lists the formats reports can be written in.
+var Formats = []string{FormatTable, FormatJSON, FormatYAML, FormatCSV}
+
+type Replacement struct {
+	OldAMI  string   `json:"oldAmi"  yaml:"oldAmi"`
+	NewAMI  string   `json:"newAmi"  yaml:"newAmi"`
+	Name    string   `json:"name"    yaml:"name"`
+	Account string   `json:"account" yaml:"account"`
+	Region  string   `json:"region"  yaml:"region"`
+	Files   []string `json:"files"   yaml:"files"`
+
+	SourceRegion string `json:"sourceRegion,omitempty" yaml:"sourceRegion,omitempty"`
+
+	// Created is when NewAMI was created, and OldCreated when OldAMI was, or
+	// zero when it is not known.
+	Created    time.Time `json:"created,omitzero"    yaml:"created,omitempty"`
+	OldCreated time.Time `json:"oldCreated,omitzero" yaml:"oldCreated,omitempty"`
+}
+
+// Attention is a referenced AMI that is stale or no longer exists, with the
+// files that reference it.
+type Attention struct {
+	AMI     string    `json:"ami"               yaml:"ami"`
+	Status  string    `json:"status"            yaml:"status"`
+	Name    string    `json:"name,omitempty"    yaml:"name,omitempty"`
+	Owner   string    `json:"owner,omitempty"   yaml:"owner,omitempty"`
+	Region  string    `json:"region,omitempty"  yaml:"region,omitempty"`
+	Created time.Time `json:"created,omitzero"  yaml:"created,omitempty"`
+	AgeDays int       `json:"ageDays,omitempty" yaml:"ageDays,omitempty"`
+	Files   []string  `json:"files"             yaml:"files"`
+}
+
+type Report struct {
+	Replacements []Replacement `json:"replacements" yaml:"replacements"`
+
+	// Attention lists the referenced AMIs without a replacement that need
+	// attention.
+	Attention []Attention `json:"attention,omitempty" yaml:"attention,omitempty"`
+}
+
+// AddAttention adds the referenced AMIs that need attention.
+func (r *Report) AddAttention(attention []results.Attention) {
+	for _, entry := range attention {
+		added := Attention{
+			AMI:     entry.AMI,
+			Status:  entry.Status,
+			Name:    entry.Name,
+			Owner:   entry.Owner,
+			Region:  entry.Region,
+			AgeDays: entry.AgeDays,
+			Files:   entry.Files,
+		}
+
+		if entry.Created != nil {
+			added.Created = *entry.Created
+		}
+
+		r.Attention = append(r.Attention, added)
+	}
+}
+
+func New(replacements []aws.AMIReplacement, references []fileprocessor.FileReference) *Report {
+	filesByAMI := fileprocessor.FilesByAMI(references)
+	entries := make([]Replacement, 0, len(replacements))
+
+	for _, replacement := range replacements {
+		files := filesByAMI[replacement.OldAMI]
+		if files == nil {
+			files = []string{}
+		}
+
+		entries = append(entries, Replacement{
+			OldAMI:  replacement.OldAMI,
+			NewAMI:  replacement.NewAMI,
+			Name:    replacement.Name,
+			Account: replacement.Account,
+			Region:  replacement.Region,
+			Files:   files,
+
+			SourceRegion: replacement.SourceRegion,
+			Created:      replacement.Created,
+			OldCreated:   replacement.OldCreated,
+		})
+	}
+
+	return &Report{Replacements: entries}
+}
+
+// FromSummary returns the report of a finished run: the replacements it
+// resolved, each with the files that received it, or would have with
+// --diff-only.
+func FromSummary(summary *results.Summary) *Report {
+	entries := make([]Replacement, 0, len(summary.Resolutions))
+
+	for _, resolution := range summary.Resolutions {
+		entry := Replacement{
+			OldAMI:  resolution.OldAMI,
+			NewAMI:  resolution.NewAMI,
+			Name:    resolution.Name,
+			Account: resolution.Account,
+			Region:  resolution.Region,
+			Files:   []string{},
+
+			SourceRegion: resolution.SourceRegion,
+		}
+
+		if resolution.Created != nil {
+			entry.Created = *resolution.Created
+		}
+
+		if resolution.OldCreated != nil {
+			entry.OldCreated = *resolution.OldCreated
+		}
+
+		for _, file := range summary.Files {
+			if file.Status != results.StatusUpdated || slices.Contains(entry.Files, file.Path) {
+				continue
+			}
+
+			if slices.ContainsFunc(file.Replacements, func(replacement results.Replacement) bool {
+				return replacement.OldAMI == entry.OldAMI && replacement.NewAMI == entry.NewAMI
+			}) {
+				entry.Files = append(entry.Files, file.Path)
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	report := &Report{Replacements: entries}
+	report.AddAttention(summary.Attention)
+
+	return report
+}
+
+// CheckFormat returns an error if reports cannot be written in format.
+func CheckFormat(format string) error {
+	if !slices.Contains(Formats, format) {
+		return fmt.Errorf("%w: %s (must be %s)", ErrUnsupportedFormat, format, strings.Join(Formats, ", "))
+	}
+
+	return nil
+}
+
+func (r *Report) Write(writer io.Writer, format string) error {
+	switch format {
+	case FormatTable:
+		return r.writeTable(writer)
+	case FormatJSON:
+		return r.writeJSON(writer)
+	case FormatYAML:
+		return r.writeYAML(writer)
+	case FormatCSV:
+		return r.writeCSV(writer)
+	default:
+		return CheckFormat(format)
+	}
+}
+
+func (r *Report) writeTable(writer io.Writer) error {
+	table := tabwriter.NewWriter(writer, 0, 0, tableColumnPadding, ' ', 0)
+
+	fmt.Fprintln(table, "OLD AMI\tNEW AMI\tNAME\tACCOUNT\tREGION\tFILES")
+
+	for _, replacement := range r.Replacements {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			replacement.OldAMI, replacement.NewAMI, replacement.Name,
+			replacement.Account, replacement.Region, strings.Join(replacement.Files, ","))
+	}
+
+	err := table.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write table report: %w", err)
+	}
+
+	if len(r.Attention) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(table, "\nATTENTION\tAMI\tNAME\tCREATED\tREGION\tFILES")
+
+	for _, entry := range r.Attention {
+		created := ""
+		if !entry.Created.IsZero() {
+			created = fmt.Sprintf("%s (%d days)", entry.Created.Format(time.DateOnly), entry.AgeDays)
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Status, entry.AMI, entry.Name, created, entry.Region,
+			strings.Join(entry.Files, ","))
+	}
+
+	err = table.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write table report: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Report) writeJSON(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(r)
+	if err != nil {
+		return fmt.Errorf("failed to write JSON report: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Report) writeYAML(writer io.Writer) error {
+	encoder := yaml.NewEncoder(writer)
+
+	err := encoder.Encode(r)
+	if err != nil {
+		return fmt.Errorf("failed to write YAML report: %w", err)
+	}
+
+	err = encoder.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write YAML report: %w", err)
+	}
+
+	return nil
+}
+
+// writeCSV writes a row per replacement, with the files that reference the
+// old AMI separated by semicolons. Unknown creation dates are left empty.
+func (r *Report) writeCSV(writer io.Writer) error {
+	csvWriter := csv.NewWriter(writer)
+
+	_ = csvWriter.Write([]string{
+		"account", "region", "old_ami", "new_ami", "name", "old_ami_created", "new_ami_created", "files",
+	})
+
+	for _, replacement := range r.Replacements {
+		_ = csvWriter.Write([]string{
+			replacement.Account, replacement.Region, replacement.OldAMI, replacement.NewAMI, replacement.Name,
+			formatDate(replacement.OldCreated), formatDate(replacement.Created), strings.Join(replacement.Files, ";"),
+		})
+	}
+
+	csvWriter.Flush()
+
+	err := csvWriter.Error()
+	if err != nil {
+		return fmt.Errorf("failed to write CSV report: %w", err)
+	}
+
+	return nil
+}
+
+// WriteFile writes the report to path in format, replacing any earlier
+// report.
+func (r *Report) WriteFile(path, format string) error {
+	file, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, FilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	defer file.Close()
+
+	return r.Write(file, format)
+}
+
+func formatDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+
+	return date.UTC().Format(time.RFC3339)
+}
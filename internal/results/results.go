@@ -0,0 +1,233 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+)
+
+// File statuses.
+const (
+	StatusUpdated   = "updated"
+	StatusUnchanged = "unchanged"
+	StatusSkipped   = "skipped"
+	StatusFailed    = "failed"
+)
+
+// Attention statuses.
+const (
+	AttentionStale   = "stale"
+	AttentionMissing = "missing"
+)
+
+// Resolution is a replacement resolved for an AMI ID, whether or not any
+// file received it.
+type Resolution struct {
+	OldAMI  string     `json:"oldAmi"`
+	NewAMI  string     `json:"newAmi"`
+	Name    string     `json:"name"`
+	Account string     `json:"account"`
+	Region  string     `json:"region"`
+	Created *time.Time `json:"created,omitempty"`
+
+	// OldCreated is when OldAMI was created, if known.
+	OldCreated *time.Time `json:"oldCreated,omitempty"`
+
+	SourceRegion string `json:"sourceRegion,omitempty"`
+}
+
+// Replacement is a replacement applied to a file.
+type Replacement struct {
+	OldAMI string `json:"oldAmi"`
+	NewAMI string `json:"newAmi"`
+	Name   string `json:"name"`
+	Region string `json:"region"`
+}
+
+// File is the outcome of processing a single file. Skipped files were not
+// confirmed, and failed files could not be processed.
+type File struct {
+	Path         string        `json:"path"`
+	Status       string        `json:"status"`
+	Count        int           `json:"count"`
+	BackupPath   string        `json:"backupPath,omitempty"`
+	Replacements []Replacement `json:"replacements"`
+	Variables    []string      `json:"variables,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// Attention is an AMI referenced in files that needs attention although no
+// replacement was resolved for it: one older than the stale threshold, or
+// one that no longer exists.
+type Attention struct {
+	AMI     string     `json:"ami"`
+	Status  string     `json:"status"`
+	Name    string     `json:"name,omitempty"`
+	Owner   string     `json:"owner,omitempty"`
+	Region  string     `json:"region,omitempty"`
+	Created *time.Time `json:"created,omitempty"`
+	AgeDays int        `json:"ageDays,omitempty"`
+	Files   []string   `json:"files"`
+}
+
+// Error is a failure during a run. Failures of AMI lookups name the account
+// and region looked up, and the final error of a failed run neither.
+type Error struct {
+	Message string `json:"message"`
+	Account string `json:"account,omitempty"`
+	Region  string `json:"region,omitempty"`
+}
+
+// Summary describes a run for automation, as a single JSON document. With
+// DiffOnly, updated files were only diffed and not written.
+type Summary struct {
+	StartedAt   time.Time    `json:"startedAt"`
+	FinishedAt  time.Time    `json:"finishedAt"`
+	Success     bool         `json:"success"`
+	ExitCode    int          `json:"exitCode"`
+	DiffOnly    bool         `json:"diffOnly"`
+	Paths       []string     `json:"paths"`
+	Accounts    []string     `json:"accounts"`
+	Regions     []string     `json:"regions"`
+	Resolutions []Resolution `json:"resolutions"`
+	Files       []File       `json:"files"`
+	Attention   []Attention  `json:"attention"`
+	Errors      []Error      `json:"errors"`
+}
+
+func New(startedAt time.Time) *Summary {
+	return &Summary{
+		StartedAt:   startedAt.UTC(),
+		Paths:       []string{},
+		Accounts:    []string{},
+		Regions:     []string{},
+		Resolutions: []Resolution{},
+		Files:       []File{},
+		Attention:   []Attention{},
+		Errors:      []Error{},
+	}
+}
+
+// AddResolutions adds the replacements resolved for a run.
+func (s *Summary) AddResolutions(replacements []aws.AMIReplacement) {
+	for _, replacement := range replacements {
+		resolution := Resolution{
+			OldAMI:  replacement.OldAMI,
+			NewAMI:  replacement.NewAMI,
+			Name:    replacement.Name,
+			Account: replacement.Account,
+			Region:  replacement.Region,
+
+			SourceRegion: replacement.SourceRegion,
+		}
+
+		if !replacement.Created.IsZero() {
+			created := replacement.Created.UTC()
+			resolution.Created = &created
+		}
+
+		if !replacement.OldCreated.IsZero() {
+			oldCreated := replacement.OldCreated.UTC()
+			resolution.OldCreated = &oldCreated
+		}
+
+		s.Resolutions = append(s.Resolutions, resolution)
+	}
+}
+
+// AddFiles adds the outcomes of processing files.
+func (s *Summary) AddFiles(results []fileprocessor.FileResult) {
+	for _, result := range results {
+		file := File{
+			Path:         result.Path,
+			Status:       StatusUnchanged,
+			Count:        result.Count,
+			BackupPath:   result.BackupPath,
+			Replacements: make([]Replacement, 0, len(result.Replacements)),
+			Variables:    result.Variables,
+		}
+
+		switch {
+		case result.Err != nil:
+			file.Status = StatusFailed
+			file.Error = result.Err.Error()
+		case result.Skipped:
+			file.Status = StatusSkipped
+		case result.Count > 0:
+			file.Status = StatusUpdated
+		}
+
+		for _, replacement := range result.Replacements {
+			file.Replacements = append(file.Replacements, Replacement{
+				OldAMI: replacement.OldAMI,
+				NewAMI: replacement.NewAMI,
+				Name:   replacement.Name,
+				Region: replacement.Region,
+			})
+		}
+
+		s.Files = append(s.Files, file)
+	}
+}
+
+// Changed reports whether any file was changed, or would have been with
+// DiffOnly.
+func (s *Summary) Changed() bool {
+	for _, file := range s.Files {
+		if file.Status == StatusUpdated {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Failures returns the number of errors and failed files that did not stop
+// the run.
+func (s *Summary) Failures() int {
+	failures := len(s.Errors)
+
+	for _, file := range s.Files {
+		if file.Status == StatusFailed {
+			failures++
+		}
+	}
+
+	return failures
+}
+
+// AddError adds a failure that did not stop the run.
+func (s *Summary) AddError(err Error) {
+	s.Errors = append(s.Errors, err)
+}
+
+// Finish records the end of the run and runErr, the error that stopped it,
+// if any.
+func (s *Summary) Finish(finishedAt time.Time, runErr error) {
+	s.FinishedAt = finishedAt.UTC()
+	s.Success = runErr == nil
+
+	if runErr != nil {
+		s.Errors = append(s.Errors, Error{Message: runErr.Error()})
+	}
+}
+
+func (s *Summary) Write(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(s)
+	if err != nil {
+		return fmt.Errorf("failed to write JSON results: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/mapping"
+)
+
+const (
+	// MaxRequestBytes bounds the size of a request body.
+	MaxRequestBytes = 16 * 1024 * 1024
+
+	readHeaderTimeout = 10 * time.Second
+	shutdownTimeout   = 30 * time.Second
+)
+
+// ErrInvalidRequest marks the errors of a ResolveFunc caused by the request
+// rather than by the lookups.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// ResolveRequest is the body of POST /resolve. Empty fields fall back to the
+// configured accounts, regions, and patterns.
+type ResolveRequest struct {
+	Patterns []string `json:"patterns"`
+	Accounts []string `json:"accounts"`
+	Regions  []string `json:"regions"`
+}
+
+// ResolveResponse is the body returned by POST /resolve: the replacements
+// found, and the lookups that failed.
+type ResolveResponse struct {
+	*mapping.Mapping
+
+	Errors []string `json:"errors,omitempty"`
+}
+
+// RewriteRequest is the body of POST /rewrite.
+type RewriteRequest struct {
+	Content string          `json:"content"`
+	Mapping mapping.Mapping `json:"mapping"`
+}
+
+// RewriteResponse is the body returned by POST /rewrite.
+type RewriteResponse struct {
+	Content string `json:"content"`
+	Count   int    `json:"count"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// ResolveFunc resolves the latest AMIs for a request. It returns every
+// replacement found along with the lookups that failed, joined into one
+// error.
+type ResolveFunc func(ctx context.Context, request ResolveRequest) ([]aws.AMIReplacement, error)
+
+// Server serves the REST API.
+type Server struct {
+	resolve ResolveFunc
+	token   string
+}
+
+// New returns a Server resolving AMIs with resolve. Requests must carry token
+// as a bearer token, unless it is empty.
+func New(resolve ResolveFunc, token string) *Server {
+	return &Server{resolve: resolve, token: token}
+}
+
+// Handler returns the HTTP handler of the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("POST /resolve", s.authorized(s.handleResolve))
+	mux.HandleFunc("POST /rewrite", s.authorized(s.handleRewrite))
+
+	return mux
+}
+
+// ListenAndServe serves the API on address until ctx is done, then waits for
+// the requests in flight to finish.
+func (s *Server) ListenAndServe(ctx context.Context, address string) error {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: readHeaderTimeout,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	slog.Info("Serving API", "address", address)
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("failed to serve API: %w", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("Stopping API server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		return fmt.Errorf("failed to stop API server: %w", err)
+	}
+
+	return nil
+}
+
+// authorized rejects requests without the server's bearer token.
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+
+				return
+			}
+		}
+
+		handler(w, r)
+	}
+}
+
+func (s *Server) handleResolve(w http.ResponseWriter, r *http.Request) {
+	var request ResolveRequest
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	replacements, err := s.resolve(r.Context(), request)
+
+	response := ResolveResponse{Mapping: mapping.New(replacements)}
+
+	if err != nil {
+		if errors.Is(err, ErrInvalidRequest) {
+			writeError(w, http.StatusBadRequest, err.Error())
+
+			return
+		}
+
+		if len(replacements) == 0 {
+			writeError(w, http.StatusBadGateway, err.Error())
+
+			return
+		}
+
+		response.Errors = strings.Split(err.Error(), "\n")
+	}
+
+	slog.Info("Resolved AMIs", "patterns", len(request.Patterns), "replacements", len(replacements),
+		"failed", len(response.Errors))
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleRewrite(w http.ResponseWriter, r *http.Request) {
+	var request RewriteRequest
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	// Without a file's region scopes, only in-place replacements apply, as
+	// for the parts of files outside any region scope
+	var replacements []aws.AMIReplacement
+
+	for _, replacement := range request.Mapping.AMIReplacements() {
+		if !replacement.CrossRegion() {
+			replacements = append(replacements, replacement)
+		}
+	}
+
+	content, count, _ := aws.ReplaceAMIsInContent(request.Content, replacements)
+
+	writeJSON(w, http.StatusOK, RewriteResponse{Content: content, Count: count})
+}
+
+// readJSON decodes the request body into value, answering the request with
+// an error and reporting false if it cannot.
+func readJSON(w http.ResponseWriter, r *http.Request, value any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxRequestBytes))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(value)
+	if err != nil {
+		status := http.StatusBadRequest
+
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		writeError(w, status, "invalid request body: "+err.Error())
+
+		return false
+	}
+
+	return true
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		slog.Warn("Failed to write response", "error", err)
+	}
+}
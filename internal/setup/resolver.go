@@ -0,0 +1,112 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package setup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/config"
+)
+
+// Resolver resolves AMIs with an AMI lookup in every account and region of
+// a configuration.
+type Resolver struct {
+	cfg    *config.Config
+	client *aws.Client
+}
+
+// NewResolver returns a Resolver searching the accounts and regions of cfg,
+// with its credentials, roles, and image filters. Without regions, the
+// region of the AWS profile is searched.
+func NewResolver(ctx context.Context, cfg *config.Config) (*Resolver, error) {
+	client, err := aws.NewClient(ctx, cfg.Profile, cfg.RoleARN, AWSOptions(cfg)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS client: %w", err)
+	}
+
+	return &Resolver{cfg: cfg, client: client}, nil
+}
+
+// Resolve returns the replacements for patterns: AMI IDs, replaced by the
+// latest AMI with the same name, and name patterns, whose matching AMIs are
+// replaced by the latest match. Replacements of pinned AMIs are dropped. It
+// returns every replacement found along with the lookups that failed, joined
+// into one error.
+func (r *Resolver) Resolve(ctx context.Context, patterns []string) ([]aws.AMIReplacement, error) {
+	patterns = r.cfg.ExpandPatterns(patterns)
+
+	var (
+		replacements []aws.AMIReplacement
+		failures     []error
+	)
+
+	for _, accountID := range r.cfg.SearchedAccounts(patterns) {
+		searched := r.cfg.PatternsFor(accountID, patterns)
+		if len(searched) == 0 {
+			continue
+		}
+
+		regions, err := r.regionsFor(ctx, accountID)
+		if err != nil {
+			failures = append(failures, err)
+
+			continue
+		}
+
+		for _, region := range regions {
+			found, err := r.client.GetLatestAMIs(ctx, accountID, region, searched)
+			if err != nil {
+				failures = append(failures, fmt.Errorf("failed to get AMIs in account %s, region %s: %w",
+					accountID, region, err))
+
+				continue
+			}
+
+			replacements = append(replacements, found...)
+		}
+	}
+
+	kept := make([]aws.AMIReplacement, 0, len(replacements))
+
+	for _, replacement := range replacements {
+		if !aws.IsPinned(replacement, r.cfg.Pins) {
+			kept = append(kept, replacement)
+		}
+	}
+
+	return kept, errors.Join(failures...)
+}
+
+// regionsFor returns the regions to search in an account: those configured
+// for it in account_regions, its enabled regions with all_regions, the
+// configured regions, or the profile's region.
+func (r *Resolver) regionsFor(ctx context.Context, accountID string) ([]string, error) {
+	if configured, ok := r.cfg.AccountRegions[accountID]; ok {
+		return configured, nil
+	}
+
+	if r.cfg.AllRegions {
+		regions, err := r.client.ListEnabledRegions(ctx, accountID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list enabled regions of account %s: %w", accountID, err)
+		}
+
+		return regions, nil
+	}
+
+	if len(r.cfg.Regions) > 0 {
+		return r.cfg.Regions, nil
+	}
+
+	region, err := r.client.GetRegion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get region from AWS profile: %w", err)
+	}
+
+	return []string{region}, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package setup
+
+import (
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+	"github.com/schnauzersoft/ami-util/internal/config"
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+)
+
+// AWSOptions returns the options of the AWS client for the configuration:
+// retries, timeouts, credentials, roles, image filters, the Inspector check,
+// and endpoints.
+func AWSOptions(cfg *config.Config) []aws.Option {
+	return []aws.Option{
+		aws.WithRetry(cfg.RetryMaxAttempts, cfg.RetryMode, cfg.RetryMaxBackoff),
+		aws.WithRetryQuota(cfg.RetryQuota, cfg.NoRetryRateLimit),
+		aws.WithTimeout(cfg.AWSTimeout),
+		aws.WithSSO(cfg.SSOProfile, cfg.SSOLogin),
+		aws.WithWebIdentityTokenFile(cfg.WebIdentityTokenFile),
+		aws.WithRoleARNTemplate(cfg.RoleARNTemplate),
+		aws.WithAccountRoles(accountRoles(cfg)),
+		aws.WithMFA(cfg.MFASerial, cfg.MFAToken, cfg.MFATokenCommand),
+		aws.WithImageFilter(imageFilter(cfg.PatternFilter), patternFilters(cfg)),
+		aws.WithEndpointURL(cfg.EndpointURL),
+		aws.WithPolicyFile(cfg.PolicyFile),
+		aws.WithInspector(cfg.Inspector, cfg.InspectorMaxCritical, cfg.InspectorRequireScan),
+		aws.WithSessionDuration(time.Duration(cfg.DurationSeconds) * time.Second),
+		aws.WithSessionTags(config.ParseTags(cfg.SessionTags), cfg.TransitiveTagKeys, cfg.SourceIdentity),
+	}
+}
+
+// FileProcessor returns a file processor configured for updating files.
+func FileProcessor(cfg *config.Config) *fileprocessor.Processor {
+	fileProcessor := fileprocessor.NewProcessor()
+	fileProcessor.SetYAMLKeys(cfg.YAMLKeys)
+	fileProcessor.SetManageCDKContext(cfg.CDKContext != "")
+	fileProcessor.SetAnsible(cfg.Ansible)
+	fileProcessor.SetGitignore(cfg.Gitignore)
+	fileProcessor.SetMaxDepth(cfg.MaxDepth)
+	fileProcessor.SetFollowSymlinks(cfg.FollowSymlinks)
+	fileProcessor.SetWorkers(cfg.FileWorkers)
+	fileProcessor.SetNoBackup(cfg.NoBackup)
+	fileProcessor.SetBackupDir(cfg.BackupDir)
+	fileProcessor.SetBackupKeep(cfg.BackupKeep)
+	fileProcessor.SetProvenanceComments(cfg.ProvenanceComments)
+	fileProcessor.SetFileRegions(fileRegions(cfg.FileRegions))
+
+	if cfg.HCL {
+		attributes := cfg.HCLAttributes
+		if len(attributes) == 0 {
+			attributes = fileprocessor.DefaultHCLAttributes
+		}
+
+		fileProcessor.SetHCLAttributes(attributes)
+	}
+
+	return fileProcessor
+}
+
+func patternFilters(cfg *config.Config) map[string]aws.ImageFilter {
+	filters := make(map[string]aws.ImageFilter, len(cfg.PatternFilters))
+	for pattern, filter := range cfg.PatternFilters {
+		filters[pattern] = imageFilter(filter)
+	}
+
+	return filters
+}
+
+func imageFilter(filter config.PatternFilter) aws.ImageFilter {
+	return aws.ImageFilter{
+		Architecture:       filter.Architecture,
+		VirtualizationType: filter.VirtualizationType,
+		RootDeviceType:     filter.RootDeviceType,
+		Tags:               filter.TagMap(),
+		Version:            filter.VersionRegexp(),
+		Exclude:            filter.ExcludeRegexps(),
+		MinAge:             filter.MinAge,
+	}
+}
+
+func accountRoles(cfg *config.Config) map[string]aws.AccountRole {
+	roles := make(map[string]aws.AccountRole, len(cfg.AccountRoles))
+	for accountID, role := range cfg.AccountRoles {
+		roles[accountID] = aws.AccountRole{
+			RoleARN:     role.RoleARN,
+			SessionName: role.SessionName,
+			ExternalID:  role.ExternalID,
+		}
+	}
+
+	return roles
+}
+
+// fileRegions converts the configured file regions for the file processor.
+func fileRegions(configured []config.FileRegion) []fileprocessor.FileRegion {
+	regions := make([]fileprocessor.FileRegion, 0, len(configured))
+	for _, fileRegion := range configured {
+		regions = append(regions, fileprocessor.FileRegion{Path: fileRegion.Path, Region: fileRegion.Region})
+	}
+
+	return regions
+}
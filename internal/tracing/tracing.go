@@ -0,0 +1,142 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName = "ami-util"
+	tracerName  = "github.com/schnauzersoft/ami-util"
+)
+
+// OTLP protocols, as named by OTEL_EXPORTER_OTLP_PROTOCOL.
+const (
+	ProtocolGRPC         = "grpc"
+	ProtocolHTTPProtobuf = "http/protobuf"
+)
+
+// Span attributes without a semantic convention.
+const (
+	AMIKey          = attribute.Key("aws.ec2.image_id")
+	ReplacementsKey = attribute.Key("ami_util.replacements")
+)
+
+var ErrUnsupportedProtocol = errors.New("unsupported OTLP protocol")
+
+// Enabled reports whether an OTLP endpoint is configured for traces.
+func Enabled() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Setup exports spans over OTLP when an endpoint is configured, using the
+// standard OTEL_* environment variables for the endpoint, protocol, headers,
+// and sampler. Without an endpoint, spans are not recorded. The returned
+// function flushes the spans not yet exported and must be called before the
+// process exits.
+func Setup(ctx context.Context, version string) (func(context.Context) error, error) {
+	if !Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newExporter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attributes from OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES win
+	// over the defaults before them.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName), semconv.ServiceVersion(version)),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{},
+		propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// newExporter returns the OTLP exporter for the protocol named by
+// OTEL_EXPORTER_OTLP_TRACES_PROTOCOL or OTEL_EXPORTER_OTLP_PROTOCOL, which
+// defaults to http/protobuf.
+func newExporter(ctx context.Context) (*otlptrace.Exporter, error) {
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+
+	var (
+		exporter *otlptrace.Exporter
+		err      error
+	)
+
+	switch protocol {
+	case "", ProtocolHTTPProtobuf:
+		exporter, err = otlptracehttp.New(ctx)
+	case ProtocolGRPC:
+		exporter, err = otlptracegrpc.New(ctx)
+	default:
+		return nil, fmt.Errorf("%w: %s (must be %s or %s)", ErrUnsupportedProtocol, protocol, ProtocolHTTPProtobuf,
+			ProtocolGRPC)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	return exporter, nil
+}
+
+// FromEnvironment returns ctx continuing the trace named by the TRACEPARENT
+// and TRACESTATE environment variables, which a traced pipeline can set for
+// the commands it runs. Without them, ctx is returned unchanged.
+func FromEnvironment(ctx context.Context) context.Context {
+	carrier := propagation.MapCarrier{
+		"traceparent": os.Getenv("TRACEPARENT"),
+		"tracestate":  os.Getenv("TRACESTATE"),
+	}
+
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
+
+// Start starts a span as a child of the span in ctx, if any.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End ends span, recording err, if any, as the reason it failed.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
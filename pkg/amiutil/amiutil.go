@@ -0,0 +1,150 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+// Package amiutil is the library API of ami-util, for embedding its AMI
+// resolution and file updates in other programs, such as operators and bots,
+// rather than running the command.
+//
+// A Resolver finds the latest AMIs for a configuration, and an Updater
+// replaces the AMI IDs in files with them:
+//
+//	cfg, err := amiutil.LoadConfigFile(ctx, "ami.yaml")
+//	...
+//	resolver, err := amiutil.NewResolver(ctx, cfg)
+//	...
+//	updater := amiutil.NewUpdater(cfg)
+//
+//	references, err := updater.Scan(ctx, "infra/")
+//	...
+//	replacements, err := resolver.Resolve(ctx, amiutil.Patterns(cfg, references))
+//	...
+//	results, err := updater.Update(ctx, []string{"infra/"}, replacements)
+package amiutil
+
+import (
+	"slices"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/aws"
+)
+
+// Replacement is an AMI ID and the latest AMI replacing it.
+type Replacement struct {
+	OldAMI  string
+	NewAMI  string
+	Name    string
+	Account string
+	Region  string
+
+	// SourceRegion is set when OldAMI belongs to a different region than
+	// Region, for a replacement that maps it onto its equivalent in Region.
+	SourceRegion string
+
+	// Created is when NewAMI was created, and OldCreated when OldAMI was,
+	// or zero when it is not known.
+	Created    time.Time
+	OldCreated time.Time
+}
+
+// Reference is an AMI ID found in a file.
+type Reference struct {
+	File   string
+	AMI    string
+	Line   int
+	Column int
+
+	// Region is the region of the innermost region scope the reference lies
+	// in, if any.
+	Region string
+}
+
+// FileResult describes the outcome of updating a single file.
+type FileResult struct {
+	Path         string
+	BackupPath   string
+	Count        int
+	Replacements []Replacement
+
+	// Skipped is set when the update of the file was not confirmed, and Err
+	// when the file could not be processed. Neither file is changed.
+	Skipped bool
+	Err     error
+}
+
+// Patterns returns the patterns to resolve for the references found in
+// files: the AMI IDs referenced, which are replaced by the latest AMI with
+// the same name, and the configured patterns.
+func Patterns(cfg *Config, references []Reference) []string {
+	var patterns []string
+
+	for _, reference := range references {
+		patterns = appendMissing(patterns, reference.AMI)
+	}
+
+	return appendMissing(patterns, cfg.Patterns...)
+}
+
+// ReplaceInContent replaces the AMI IDs in content, returning the new content
+// and how many AMI IDs were replaced. Without the region scopes of a file,
+// only in-place replacements apply, and those onto another region's
+// equivalent are skipped.
+func ReplaceInContent(content string, replacements []Replacement) (string, int) {
+	var inPlace []aws.AMIReplacement
+
+	for _, replacement := range toAWS(replacements) {
+		if !replacement.CrossRegion() {
+			inPlace = append(inPlace, replacement)
+		}
+	}
+
+	replaced, count, _ := aws.ReplaceAMIsInContent(content, inPlace)
+
+	return replaced, count
+}
+
+func appendMissing(values []string, added ...string) []string {
+	for _, value := range added {
+		if !slices.Contains(values, value) {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func fromAWS(replacements []aws.AMIReplacement) []Replacement {
+	converted := make([]Replacement, 0, len(replacements))
+	for _, replacement := range replacements {
+		converted = append(converted, Replacement{
+			OldAMI:       replacement.OldAMI,
+			NewAMI:       replacement.NewAMI,
+			Name:         replacement.Name,
+			Account:      replacement.Account,
+			Region:       replacement.Region,
+			SourceRegion: replacement.SourceRegion,
+			Created:      replacement.Created,
+			OldCreated:   replacement.OldCreated,
+		})
+	}
+
+	return converted
+}
+
+func toAWS(replacements []Replacement) []aws.AMIReplacement {
+	converted := make([]aws.AMIReplacement, 0, len(replacements))
+	for _, replacement := range replacements {
+		converted = append(converted, aws.AMIReplacement{
+			OldAMI:       replacement.OldAMI,
+			NewAMI:       replacement.NewAMI,
+			Name:         replacement.Name,
+			Account:      replacement.Account,
+			Region:       replacement.Region,
+			SourceRegion: replacement.SourceRegion,
+			Created:      replacement.Created,
+			OldCreated:   replacement.OldCreated,
+		})
+	}
+
+	return converted
+}
@@ -0,0 +1,313 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package amiutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/schnauzersoft/ami-util/internal/config"
+)
+
+// Config is the part of the configuration of ami-util that resolving AMIs
+// and updating files use, with the settings of the ami.yaml keys of the same
+// names. The other keys, such as those for files, reports, and git, belong
+// to the command.
+type Config struct {
+	// Accounts are searched for every pattern, along with the owners that
+	// PatternOwners assigns patterns to.
+	Accounts []string
+	Regions  []string
+	Profile  string
+	RoleARN  string
+	Patterns []string
+	Pins     []string
+
+	// AccountRegions lists the regions searched in an account, in place of
+	// Regions or those discovered with AllRegions.
+	AccountRegions map[string][]string
+	AllRegions     bool
+
+	// PatternAliases name patterns, and PatternOwners lists the accounts or
+	// owner aliases each pattern is searched in instead of every account.
+	PatternAliases map[string]string
+	PatternOwners  map[string][]string
+
+	// Filter applies to every pattern without an entry in PatternFilters.
+	Filter         PatternFilter
+	PatternFilters map[string]PatternFilter
+	PolicyFile     string
+
+	// Inspector skips candidates with more than InspectorMaxCritical critical
+	// Amazon Inspector findings, and with InspectorRequireScan those that
+	// Inspector has no findings for.
+	Inspector            bool
+	InspectorMaxCritical int
+	InspectorRequireScan bool
+
+	RetryMaxAttempts int
+	RetryMode        string
+	RetryMaxBackoff  time.Duration
+	RetryQuota       int
+	NoRetryRateLimit bool
+	AWSTimeout       time.Duration
+	EndpointURL      string
+
+	SSOProfile           string
+	SSOLogin             bool
+	WebIdentityTokenFile string
+	RoleARNTemplate      string
+	AccountRoles         map[string]AccountRole
+	MFASerial            string
+	MFAToken             string
+	MFATokenCommand      string
+	DurationSeconds      int
+	SessionTags          []string
+	TransitiveTagKeys    []string
+	SourceIdentity       string
+
+	// YAMLKeys and HCLAttributes, with HCL, limit replacements in YAML and
+	// Terraform files to the values they name.
+	YAMLKeys      []string
+	HCL           bool
+	HCLAttributes []string
+	Ansible       bool
+
+	Gitignore      bool
+	MaxDepth       int
+	FollowSymlinks bool
+	FileWorkers    int
+
+	NoBackup           bool
+	BackupDir          string
+	BackupKeep         int
+	ProvenanceComments bool
+	FileRegions        []FileRegion
+}
+
+// AccountRole is the role assumed in an account, in place of the role ARN
+// template.
+type AccountRole struct {
+	RoleARN     string
+	SessionName string
+	ExternalID  string
+}
+
+// PatternFilter narrows the candidates of a pattern, with the settings of
+// the pattern_filters keys of the same names.
+type PatternFilter struct {
+	Architecture       string
+	VirtualizationType string
+	RootDeviceType     string
+
+	// Tags are Key=Value pairs every candidate carries.
+	Tags []string
+
+	// VersionRegex extracts a version from candidate names to order them
+	// by, and candidates matching ExcludePatterns are never chosen.
+	VersionRegex    string
+	ExcludePatterns []string
+	MinAge          time.Duration
+}
+
+// FileRegion assigns the AMI IDs of the files matching a path, glob pattern,
+// or directory to a region.
+type FileRegion struct {
+	Path   string
+	Region string
+}
+
+// LoadConfigFile loads a single configuration file on its own, without
+// search paths, environment variables, flags, or defaults, and validates the
+// settings that resolving AMIs and updating files use. Unlike the command,
+// it does not require files.
+func LoadConfigFile(ctx context.Context, path string) (*Config, error) {
+	loaded, err := config.LoadConfigFile(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	err = errors.Join(config.DiagnoseWithoutFiles(loaded)...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration in %s: %w", path, err)
+	}
+
+	return fromConfig(loaded), nil
+}
+
+// fromConfig returns the library settings of a configuration of the command.
+func fromConfig(cfg *config.Config) *Config {
+	filters := make(map[string]PatternFilter, len(cfg.PatternFilters))
+	for pattern, filter := range cfg.PatternFilters {
+		filters[pattern] = fromPatternFilter(filter)
+	}
+
+	roles := make(map[string]AccountRole, len(cfg.AccountRoles))
+	for accountID, role := range cfg.AccountRoles {
+		roles[accountID] = AccountRole{
+			RoleARN:     role.RoleARN,
+			SessionName: role.SessionName,
+			ExternalID:  role.ExternalID,
+		}
+	}
+
+	fileRegions := make([]FileRegion, 0, len(cfg.FileRegions))
+	for _, fileRegion := range cfg.FileRegions {
+		fileRegions = append(fileRegions, FileRegion{Path: fileRegion.Path, Region: fileRegion.Region})
+	}
+
+	return &Config{
+		Accounts:             cfg.Accounts,
+		Regions:              cfg.Regions,
+		Profile:              cfg.Profile,
+		RoleARN:              cfg.RoleARN,
+		Patterns:             cfg.Patterns,
+		Pins:                 cfg.Pins,
+		AccountRegions:       cfg.AccountRegions,
+		AllRegions:           cfg.AllRegions,
+		PatternAliases:       cfg.PatternAliases,
+		PatternOwners:        cfg.PatternOwners,
+		Filter:               fromPatternFilter(cfg.PatternFilter),
+		PatternFilters:       filters,
+		PolicyFile:           cfg.PolicyFile,
+		Inspector:            cfg.Inspector,
+		InspectorMaxCritical: cfg.InspectorMaxCritical,
+		InspectorRequireScan: cfg.InspectorRequireScan,
+		RetryMaxAttempts:     cfg.RetryMaxAttempts,
+		RetryMode:            cfg.RetryMode,
+		RetryMaxBackoff:      cfg.RetryMaxBackoff,
+		RetryQuota:           cfg.RetryQuota,
+		NoRetryRateLimit:     cfg.NoRetryRateLimit,
+		AWSTimeout:           cfg.AWSTimeout,
+		EndpointURL:          cfg.EndpointURL,
+		SSOProfile:           cfg.SSOProfile,
+		SSOLogin:             cfg.SSOLogin,
+		WebIdentityTokenFile: cfg.WebIdentityTokenFile,
+		RoleARNTemplate:      cfg.RoleARNTemplate,
+		AccountRoles:         roles,
+		MFASerial:            cfg.MFASerial,
+		MFAToken:             cfg.MFAToken,
+		MFATokenCommand:      cfg.MFATokenCommand,
+		DurationSeconds:      cfg.DurationSeconds,
+		SessionTags:          cfg.SessionTags,
+		TransitiveTagKeys:    cfg.TransitiveTagKeys,
+		SourceIdentity:       cfg.SourceIdentity,
+		YAMLKeys:             cfg.YAMLKeys,
+		HCL:                  cfg.HCL,
+		HCLAttributes:        cfg.HCLAttributes,
+		Ansible:              cfg.Ansible,
+		Gitignore:            cfg.Gitignore,
+		MaxDepth:             cfg.MaxDepth,
+		FollowSymlinks:       cfg.FollowSymlinks,
+		FileWorkers:          cfg.FileWorkers,
+		NoBackup:             cfg.NoBackup,
+		BackupDir:            cfg.BackupDir,
+		BackupKeep:           cfg.BackupKeep,
+		ProvenanceComments:   cfg.ProvenanceComments,
+		FileRegions:          fileRegions,
+	}
+}
+
+// toConfig returns the configuration of the command with the library
+// settings of c, and none of the others.
+func (c *Config) toConfig() *config.Config {
+	filters := make(map[string]config.PatternFilter, len(c.PatternFilters))
+	for pattern, filter := range c.PatternFilters {
+		filters[pattern] = filter.toConfig()
+	}
+
+	roles := make(map[string]config.AccountRole, len(c.AccountRoles))
+	for accountID, role := range c.AccountRoles {
+		roles[accountID] = config.AccountRole{
+			RoleARN:     role.RoleARN,
+			SessionName: role.SessionName,
+			ExternalID:  role.ExternalID,
+		}
+	}
+
+	fileRegions := make([]config.FileRegion, 0, len(c.FileRegions))
+	for _, fileRegion := range c.FileRegions {
+		fileRegions = append(fileRegions, config.FileRegion{Path: fileRegion.Path, Region: fileRegion.Region})
+	}
+
+	return &config.Config{
+		Accounts:             slices.Clone(c.Accounts),
+		Regions:              slices.Clone(c.Regions),
+		Profile:              c.Profile,
+		RoleARN:              c.RoleARN,
+		Patterns:             slices.Clone(c.Patterns),
+		Pins:                 slices.Clone(c.Pins),
+		AccountRegions:       maps.Clone(c.AccountRegions),
+		AllRegions:           c.AllRegions,
+		PatternAliases:       maps.Clone(c.PatternAliases),
+		PatternOwners:        maps.Clone(c.PatternOwners),
+		PatternFilter:        c.Filter.toConfig(),
+		PatternFilters:       filters,
+		PolicyFile:           c.PolicyFile,
+		Inspector:            c.Inspector,
+		InspectorMaxCritical: c.InspectorMaxCritical,
+		InspectorRequireScan: c.InspectorRequireScan,
+		RetryMaxAttempts:     c.RetryMaxAttempts,
+		RetryMode:            c.RetryMode,
+		RetryMaxBackoff:      c.RetryMaxBackoff,
+		RetryQuota:           c.RetryQuota,
+		NoRetryRateLimit:     c.NoRetryRateLimit,
+		AWSTimeout:           c.AWSTimeout,
+		EndpointURL:          c.EndpointURL,
+		SSOProfile:           c.SSOProfile,
+		SSOLogin:             c.SSOLogin,
+		WebIdentityTokenFile: c.WebIdentityTokenFile,
+		RoleARNTemplate:      c.RoleARNTemplate,
+		AccountRoles:         roles,
+		MFASerial:            c.MFASerial,
+		MFAToken:             c.MFAToken,
+		MFATokenCommand:      c.MFATokenCommand,
+		DurationSeconds:      c.DurationSeconds,
+		SessionTags:          slices.Clone(c.SessionTags),
+		TransitiveTagKeys:    slices.Clone(c.TransitiveTagKeys),
+		SourceIdentity:       c.SourceIdentity,
+		YAMLKeys:             slices.Clone(c.YAMLKeys),
+		HCL:                  c.HCL,
+		HCLAttributes:        slices.Clone(c.HCLAttributes),
+		Ansible:              c.Ansible,
+		Gitignore:            c.Gitignore,
+		MaxDepth:             c.MaxDepth,
+		FollowSymlinks:       c.FollowSymlinks,
+		FileWorkers:          c.FileWorkers,
+		NoBackup:             c.NoBackup,
+		BackupDir:            c.BackupDir,
+		BackupKeep:           c.BackupKeep,
+		ProvenanceComments:   c.ProvenanceComments,
+		FileRegions:          fileRegions,
+	}
+}
+
+func fromPatternFilter(filter config.PatternFilter) PatternFilter {
+	return PatternFilter{
+		Architecture:       filter.Architecture,
+		VirtualizationType: filter.VirtualizationType,
+		RootDeviceType:     filter.RootDeviceType,
+		Tags:               filter.Tags,
+		VersionRegex:       filter.VersionRegex,
+		ExcludePatterns:    filter.ExcludePatterns,
+		MinAge:             filter.MinAge,
+	}
+}
+
+func (f PatternFilter) toConfig() config.PatternFilter {
+	return config.PatternFilter{
+		Architecture:       f.Architecture,
+		VirtualizationType: f.VirtualizationType,
+		RootDeviceType:     f.RootDeviceType,
+		Tags:               slices.Clone(f.Tags),
+		VersionRegex:       f.VersionRegex,
+		ExcludePatterns:    slices.Clone(f.ExcludePatterns),
+		MinAge:             f.MinAge,
+	}
+}
@@ -0,0 +1,45 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package amiutil
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/schnauzersoft/ami-util/internal/setup"
+)
+
+// Resolver finds the latest AMIs replacing existing ones.
+type Resolver interface {
+	// Resolve returns the replacements for patterns: AMI IDs, replaced by
+	// the latest AMI with the same name, and name patterns, whose matching
+	// AMIs are replaced by the latest match. It returns every replacement
+	// found along with the lookups that failed, joined into one error.
+	Resolve(ctx context.Context, patterns []string) ([]Replacement, error)
+}
+
+// awsResolver resolves AMIs with an AMI lookup in every account and region
+// of the configuration.
+type awsResolver struct {
+	resolver *setup.Resolver
+}
+
+// NewResolver returns a Resolver searching the accounts and regions of cfg,
+// with its credentials, roles, and image filters. Without regions, the
+// region of the AWS profile is searched.
+func NewResolver(ctx context.Context, cfg *Config) (Resolver, error) {
+	resolver, err := setup.NewResolver(ctx, cfg.toConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resolver: %w", err)
+	}
+
+	return &awsResolver{resolver: resolver}, nil
+}
+
+func (r *awsResolver) Resolve(ctx context.Context, patterns []string) ([]Replacement, error) {
+	replacements, err := r.resolver.Resolve(ctx, patterns)
+
+	return fromAWS(replacements), err
+}
@@ -0,0 +1,83 @@
+/*
+Copyright © 2025 Ben Sapp ya.bsapp.ru
+*/
+
+package amiutil
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/schnauzersoft/ami-util/internal/fileprocessor"
+	"github.com/schnauzersoft/ami-util/internal/setup"
+)
+
+// Updater finds and replaces the AMI IDs in files.
+type Updater interface {
+	// Scan returns the AMI references in files and in every file under
+	// directories.
+	Scan(ctx context.Context, paths ...string) ([]Reference, error)
+
+	// Update replaces the AMI IDs in files and in every file under
+	// directories that contains one, returning the outcome for each file.
+	Update(ctx context.Context, paths []string, replacements []Replacement) ([]FileResult, error)
+}
+
+// fileUpdater updates files with the file processor of the command.
+type fileUpdater struct {
+	processor *fileprocessor.Processor
+}
+
+// NewUpdater returns an Updater that treats files as cfg describes: the YAML
+// keys and HCL attributes replaced, the files walked, and their backups.
+func NewUpdater(cfg *Config) Updater {
+	return &fileUpdater{processor: setup.FileProcessor(cfg.toConfig())}
+}
+
+func (u *fileUpdater) Scan(ctx context.Context, paths ...string) ([]Reference, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, fmt.Errorf("scan cancelled: %w", err)
+	}
+
+	found, err := u.processor.ScanPath(paths...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan files: %w", err)
+	}
+
+	references := make([]Reference, 0, len(found))
+	for _, reference := range found {
+		references = append(references, Reference{
+			File:   reference.File,
+			AMI:    reference.AMI,
+			Line:   reference.Line,
+			Column: reference.Column,
+			Region: reference.Region,
+		})
+	}
+
+	return references, nil
+}
+
+func (u *fileUpdater) Update(ctx context.Context, paths []string, replacements []Replacement,
+) ([]FileResult, error) {
+	processed, err := u.processor.ProcessPaths(ctx, paths, toAWS(replacements))
+
+	results := make([]FileResult, 0, len(processed))
+	for _, result := range processed {
+		results = append(results, FileResult{
+			Path:         result.Path,
+			BackupPath:   result.BackupPath,
+			Count:        result.Count,
+			Replacements: fromAWS(result.Replacements),
+			Skipped:      result.Skipped,
+			Err:          result.Err,
+		})
+	}
+
+	if err != nil {
+		return results, fmt.Errorf("failed to update files: %w", err)
+	}
+
+	return results, nil
+}